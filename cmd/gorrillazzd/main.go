@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Siasom1/gorrillazz-chain/node"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func main() {
@@ -17,6 +20,19 @@ func main() {
 	rpcPort := flag.Int("rpcport", 9000, "RPC port")
 	logLevel := flag.String("loglevel", "info", "Log level: info/debug")
 	blockTime := flag.Int("blocktime", 3, "Block time in seconds")
+	eventRetention := flag.Duration("events.retention", 7*24*time.Hour, "How long to keep the durable event log (0 = forever)")
+	chainConfig := flag.String("chainconfig", "", "JSON file with chain rules and fork heights (default: built-in config)")
+	forks := flag.String("forks", "", "Comma-separated fork heights on top of -chainconfig, e.g. merchants=0,subscriptions=100 (all=0: every fork from genesis)")
+	consensus := flag.String("consensus", "poa", "Consensus engine: poa (timer producer) or bft (Tendermint-style rounds with finality)")
+	validators := flag.String("validators", "", "Comma-separated initial PoA validator addresses (default: admin wallet)")
+	validatorKey := flag.String("validator.key", "", "File with this node's hex validator key (default: admin wallet key)")
+	mine := flag.Bool("mine", true, "Produce blocks (false = only import blocks from peers)")
+	devMode := flag.String("dev.mode", "interval", "When to mine: interval (every block time), instamine (on every tx) or manual (evm_mine only)")
+	skipEmpty := flag.Bool("skip-empty", false, "Interval mode: don't produce blocks without transactions")
+	p2pListen := flag.String("p2p.listen", "", "P2P listen address, e.g. :30303 (default: no inbound connections)")
+	staticPeers := flag.String("p2p.static", "", "Comma-separated static peers (host:port), always kept connected")
+	bootNodes := flag.String("p2p.bootnodes", "", "Comma-separated bootnodes (host:port) used for peer discovery")
+	maxPeers := flag.Int("p2p.maxpeers", 25, "Maximum number of p2p peers")
 
 	flag.Parse()
 
@@ -30,6 +46,36 @@ func main() {
 	cfg.RPCPort = *rpcPort
 	cfg.LogLevel = *logLevel
 	cfg.BlockTime = *blockTime
+	cfg.EventRetention = *eventRetention
+	cfg.Consensus = *consensus
+	if *chainConfig != "" {
+		cc, err := params.LoadChainConfig(*chainConfig)
+		if err != nil {
+			fmt.Println("Error loading chain config:", err)
+			return
+		}
+		cfg.ChainConfig = cc
+	}
+	if err := cfg.ChainConfig.SetForks(splitList(*forks)); err != nil {
+		fmt.Println("Error in -forks:", err)
+		return
+	}
+	cfg.ValidatorKey = *validatorKey
+	cfg.Mine = *mine
+	cfg.DevMode = *devMode
+	cfg.SkipEmpty = *skipEmpty
+	cfg.P2PListen = *p2pListen
+	cfg.StaticPeers = splitList(*staticPeers)
+	cfg.BootNodes = splitList(*bootNodes)
+	cfg.MaxPeers = *maxPeers
+
+	for _, v := range splitList(*validators) {
+		if !common.IsHexAddress(v) {
+			fmt.Println("Invalid validator address:", v)
+			return
+		}
+		cfg.Validators = append(cfg.Validators, common.HexToAddress(v))
+	}
 
 	n, err := node.NewNode(cfg)
 	if err != nil {
@@ -48,6 +94,17 @@ func main() {
 	}
 }
 
+// splitList splitst een komma-gescheiden flag en laat lege items weg.
+func splitList(s string) []string {
+	out := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func banner() {
 	fmt.Println(`
    ██████╗  ██████╗ ██████╗ ██████╗ ███████╗██╗     ██╗     █████╗ ███████╗███████╗
@@ -39,6 +39,7 @@ func main() {
 		return
 	}
 
+	chain.SetEventBus(bus)
 	rpcServer := rpc.NewServer(chain, bus)
 
 	go rpc.StartRPCServer(*rpcPort, rpcServer)
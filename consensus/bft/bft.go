@@ -0,0 +1,772 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tendermint-achtige BFT consensus voor een vaste validator committee:
+// - per height rondes van propose → prevote → precommit
+// - 2f+1 precommits op een block = commit + finality certificaat
+// - locking (lockedRound/validRound) voorkomt conflicterende commits
+// - round timeouts zorgen voor liveness als een proposer uitvalt
+// Een gecommit block wordt nooit meer gereorganiseerd.
+
+const (
+	// Headers mogen maximaal zoveel seconden in de toekomst liggen.
+	allowedFutureBlockTime = 15
+
+	maxFutureMsgs = 1024
+
+	// Eigen berichten van de huidige height opnieuw aanbieden: wat verstuurd
+	// is vóórdat een peer verbonden was komt anders nooit aan, en zonder die
+	// stemmen kan een ronde niet meer aflopen. De p2p known cache houdt
+	// peers die het al hebben buiten.
+	rebroadcastInterval = time.Second
+)
+
+var (
+	ErrMissingCertificate = errors.New("bft: missing finality certificate")
+	ErrInvalidCertificate = errors.New("bft: invalid finality certificate")
+	ErrInvalidTxRoot      = errors.New("bft: tx root does not match transactions")
+	ErrUnauthorized       = errors.New("bft: proposer is not a validator")
+	ErrInvalidTimestamp   = errors.New("bft: invalid timestamp")
+	ErrFutureBlock        = errors.New("bft: block in the future")
+	ErrInvalidCoinbase    = errors.New("bft: coinbase is not the proposer")
+)
+
+// Config van de engine.
+type Config struct {
+	Validators []common.Address
+
+	// BlockTime = wachttijd na een commit voordat de volgende height start.
+	BlockTime time.Duration
+
+	// Round timeouts: basis + Round * TimeoutDelta
+	TimeoutPropose   time.Duration
+	TimeoutPrevote   time.Duration
+	TimeoutPrecommit time.Duration
+	TimeoutDelta     time.Duration
+}
+
+func DefaultConfig(validators []common.Address, blockTime time.Duration) Config {
+	return Config{
+		Validators:       validators,
+		BlockTime:        blockTime,
+		TimeoutPropose:   2 * time.Second,
+		TimeoutPrevote:   time.Second,
+		TimeoutPrecommit: time.Second,
+		TimeoutDelta:     500 * time.Millisecond,
+	}
+}
+
+// Backend bouwt, controleert en importeert blocks
+// (consensus/producer.BlockProducer).
+type Backend interface {
+	BuildBlock(parent *types.Block, blockTime uint64, coinbase common.Address) *types.Block
+	CheckBlock(block *types.Block) error
+	ImportBlock(block *types.Block) error
+}
+
+// Broadcaster verspreidt consensus berichten (p2p).
+type Broadcaster interface {
+	BroadcastConsensus(data []byte)
+}
+
+type step uint8
+
+const (
+	stepNewHeight step = iota
+	stepPropose
+	stepPrevote
+	stepPrecommit
+)
+
+func (s step) String() string {
+	return [...]string{"newHeight", "propose", "prevote", "precommit"}[s]
+}
+
+type timeoutInfo struct {
+	height uint64
+	round  uint64
+	step   step
+}
+
+// roundState: alle berichten van één ronde.
+type roundState struct {
+	proposal   *Message
+	prevotes   map[common.Address]*Message
+	precommits map[common.Address]*Message
+
+	prevoteTimeout   bool // timeoutPrevote al gepland
+	precommitTimeout bool // timeoutPrecommit al gepland
+	polka            bool // regel "2f+1 prevotes op proposal" al uitgevoerd
+}
+
+func newRoundState() *roundState {
+	return &roundState{
+		prevotes:   map[common.Address]*Message{},
+		precommits: map[common.Address]*Message{},
+	}
+}
+
+type Engine struct {
+	cfg        Config
+	validators []common.Address // gesorteerd
+	quorum     int              // 2f+1
+	weak       int              // f+1
+
+	chain   *blockchain.Blockchain
+	backend Backend
+	net     Broadcaster
+	bus     *events.EventBus
+	logger  *log.Logger
+
+	key    *ecdsa.PrivateKey
+	signer common.Address
+
+	msgCh     chan *Message
+	timeoutCh chan timeoutInfo
+	quit      chan struct{}
+	wg        sync.WaitGroup
+
+	// ---- state van de loop goroutine ----
+	height      uint64
+	round       uint64
+	step        step
+	lockedRound int64
+	lockedBlock *types.Block
+	validRound  int64
+	validBlock  *types.Block
+	rounds      map[uint64]*roundState
+	valid       map[common.Hash]bool // cache van block validatie
+	future      []*Message           // berichten voor height+1
+	outbox      []*Message           // eigen berichten, lokaal nog te verwerken
+	sent        [][]byte             // eigen berichten van deze height (rebroadcast)
+
+	statusMu sync.RWMutex
+	status   Status
+}
+
+// Status voor RPC.
+type Status struct {
+	Height     uint64           `json:"height"`
+	Round      uint64           `json:"round"`
+	Step       string           `json:"step"`
+	Validators []common.Address `json:"validators"`
+	Quorum     int              `json:"quorum"`
+	Signer     common.Address   `json:"signer"`
+}
+
+func New(cfg Config, chain *blockchain.Blockchain, logger *log.Logger) (*Engine, error) {
+	n := len(cfg.Validators)
+	if n == 0 {
+		return nil, errors.New("bft: empty validator set")
+	}
+
+	validators := append([]common.Address{}, cfg.Validators...)
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+
+	// n = 3f+1 → quorum 2f+1 = n - f
+	f := (n - 1) / 3
+
+	return &Engine{
+		cfg:        cfg,
+		validators: validators,
+		quorum:     n - f,
+		weak:       f + 1,
+		chain:      chain,
+		logger:     logger,
+		msgCh:      make(chan *Message, 1024),
+		timeoutCh:  make(chan timeoutInfo, 64),
+		quit:       make(chan struct{}),
+	}, nil
+}
+
+// Authorize zet de key waarmee deze node stemt/voorstelt.
+func (e *Engine) Authorize(key *ecdsa.PrivateKey) {
+	e.key = key
+	e.signer = crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func (e *Engine) SetBackend(b Backend)             { e.backend = b }
+func (e *Engine) SetBroadcaster(n Broadcaster)     { e.net = n }
+func (e *Engine) SetEventBus(bus *events.EventBus) { e.bus = bus }
+
+func (e *Engine) Validators() []common.Address {
+	return append([]common.Address{}, e.validators...)
+}
+
+func (e *Engine) Status() Status {
+	e.statusMu.RLock()
+	defer e.statusMu.RUnlock()
+	return e.status
+}
+
+func (e *Engine) isValidator(addr common.Address) bool {
+	for _, v := range e.validators {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidator: mag deze node meestemmen?
+func (e *Engine) IsValidator() bool {
+	return e.key != nil && e.isValidator(e.signer)
+}
+
+func (e *Engine) proposer(height, round uint64) common.Address {
+	return e.validators[(height+round)%uint64(len(e.validators))]
+}
+
+// ----------------------------------------------------------------
+// blockchain.Engine + CertificateVerifier
+// ----------------------------------------------------------------
+
+func recoverProposer(header *types.Header) (common.Address, error) {
+	return recoverSigner(header.SealHash(), header.Signature)
+}
+
+// VerifyHeader: proposer handtekening + tijdregels.
+func (e *Engine) VerifyHeader(parent, header *types.Header) error {
+	proposer, err := recoverProposer(header)
+	if err != nil {
+		return err
+	}
+	if !e.isValidator(proposer) {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, proposer.Hex())
+	}
+	if header.Coinbase != (common.Address{}) && header.Coinbase != proposer {
+		return fmt.Errorf("%w: %s, signed by %s", ErrInvalidCoinbase, header.Coinbase.Hex(), proposer.Hex())
+	}
+	if header.Time <= parent.Time {
+		return fmt.Errorf("%w: %d not after parent %d", ErrInvalidTimestamp, header.Time, parent.Time)
+	}
+	if header.Time > uint64(time.Now().Unix())+allowedFutureBlockTime {
+		return ErrFutureBlock
+	}
+	return nil
+}
+
+// VerifyCertificate: 2f+1 unieke validator precommits op dit block.
+func (e *Engine) VerifyCertificate(block *types.Block) error {
+	cert := block.Certificate
+	if cert == nil {
+		return ErrMissingCertificate
+	}
+	if block.Header.TxRoot != types.DeriveTxRoot(block.Transactions) {
+		return ErrInvalidTxRoot
+	}
+	hash := block.Hash()
+	if cert.Height != block.Header.Number || cert.BlockHash != hash {
+		return fmt.Errorf("%w: height/hash mismatch", ErrInvalidCertificate)
+	}
+
+	signHash := precommitHash(cert.Height, cert.Round, hash)
+	seen := map[common.Address]bool{}
+	for _, cs := range cert.Signatures {
+		signer, err := recoverSigner(signHash, cs.Signature)
+		if err != nil || signer != cs.Validator {
+			return fmt.Errorf("%w: bad signature for %s", ErrInvalidCertificate, cs.Validator.Hex())
+		}
+		if !e.isValidator(signer) {
+			return fmt.Errorf("%w: %s is not a validator", ErrInvalidCertificate, signer.Hex())
+		}
+		seen[signer] = true
+	}
+	if len(seen) < e.quorum {
+		return fmt.Errorf("%w: %d of %d required signatures", ErrInvalidCertificate, len(seen), e.quorum)
+	}
+	return nil
+}
+
+// Finalize: niets bij te houden (vaste committee).
+func (e *Engine) Finalize(header *types.Header) error { return nil }
+
+// ----------------------------------------------------------------
+// Start / Stop
+// ----------------------------------------------------------------
+
+// Start draait de consensus loop (alleen zinvol als deze node validator is).
+func (e *Engine) Start() error {
+	if !e.IsValidator() {
+		return errors.New("bft: this node is not a validator")
+	}
+	if e.backend == nil || e.net == nil {
+		return errors.New("bft: backend/broadcaster not set")
+	}
+
+	var heads *events.Subscription
+	if e.bus != nil {
+		heads = e.bus.Subscribe(64, events.DropOldest, events.TopicBlock)
+	}
+
+	e.wg.Add(1)
+	go e.loop(heads)
+	return nil
+}
+
+func (e *Engine) Stop() {
+	close(e.quit)
+	e.wg.Wait()
+}
+
+// HandleMessage ontvangt een (p2p) consensus bericht.
+func (e *Engine) HandleMessage(data []byte) error {
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	select {
+	case e.msgCh <- &m:
+		return nil
+	default:
+		return errors.New("bft: message queue full")
+	}
+}
+
+func (e *Engine) loop(heads *events.Subscription) {
+	defer e.wg.Done()
+
+	var headC <-chan events.Event
+	if heads != nil {
+		defer heads.Unsubscribe()
+		headC = heads.C()
+	}
+
+	rebroadcast := time.NewTicker(rebroadcastInterval)
+	defer rebroadcast.Stop()
+
+	e.newHeight(e.chain.Head().Header.Number+1, 0)
+
+	for {
+		select {
+		case <-e.quit:
+			return
+		case <-rebroadcast.C:
+			for _, data := range e.sent {
+				e.net.BroadcastConsensus(data)
+			}
+		case m := <-e.msgCh:
+			e.handleMsg(m)
+		case ti := <-e.timeoutCh:
+			e.handleTimeout(ti)
+		case ev := <-headC:
+			// Block via gossip/sync geïmporteerd → door naar de volgende height
+			if bc, ok := ev.Data.(*events.BlockCommitted); ok && bc.Number >= e.height {
+				e.newHeight(bc.Number+1, e.cfg.BlockTime)
+			}
+		}
+		e.drainOutbox()
+	}
+}
+
+func (e *Engine) drainOutbox() {
+	for len(e.outbox) > 0 {
+		m := e.outbox[0]
+		e.outbox = e.outbox[1:]
+		e.handleMsg(m)
+	}
+}
+
+func (e *Engine) schedule(d time.Duration, ti timeoutInfo) {
+	time.AfterFunc(d, func() {
+		select {
+		case e.timeoutCh <- ti:
+		case <-e.quit:
+		}
+	})
+}
+
+func (e *Engine) roundTimeout(base time.Duration, round uint64) time.Duration {
+	return base + time.Duration(round)*e.cfg.TimeoutDelta
+}
+
+func (e *Engine) rs(round uint64) *roundState {
+	r, ok := e.rounds[round]
+	if !ok {
+		r = newRoundState()
+		e.rounds[round] = r
+	}
+	return r
+}
+
+func (e *Engine) updateStatus() {
+	e.statusMu.Lock()
+	defer e.statusMu.Unlock()
+	e.status = Status{
+		Height:     e.height,
+		Round:      e.round,
+		Step:       e.step.String(),
+		Validators: e.Validators(),
+		Quorum:     e.quorum,
+		Signer:     e.signer,
+	}
+}
+
+// ----------------------------------------------------------------
+// Height / round overgangen
+// ----------------------------------------------------------------
+
+func (e *Engine) newHeight(height uint64, wait time.Duration) {
+	if height <= e.height && e.rounds != nil {
+		return
+	}
+
+	e.height = height
+	e.round = 0
+	e.step = stepNewHeight
+	e.lockedRound, e.lockedBlock = -1, nil
+	e.validRound, e.validBlock = -1, nil
+	e.rounds = map[uint64]*roundState{}
+	e.valid = map[common.Hash]bool{}
+	e.outbox = nil
+	e.sent = nil
+	e.updateStatus()
+
+	e.schedule(wait, timeoutInfo{height: height, round: 0, step: stepNewHeight})
+
+	// Berichten die al voor deze height binnen waren
+	future := e.future
+	e.future = nil
+	for _, m := range future {
+		if m.Height == height {
+			e.outbox = append(e.outbox, m)
+		} else if m.Height > height {
+			e.future = append(e.future, m)
+		}
+	}
+}
+
+func (e *Engine) startRound(round uint64) {
+	e.round = round
+	e.step = stepPropose
+	e.updateStatus()
+
+	if e.proposer(e.height, round) == e.signer {
+		block := e.validBlock
+		if block == nil {
+			head := e.chain.Head()
+			now := uint64(time.Now().Unix())
+			if now <= head.Header.Time {
+				now = head.Header.Time + 1
+			}
+			block = e.backend.BuildBlock(head, now, e.signer)
+			if err := e.seal(block.Header); err != nil {
+				e.logger.Error(fmt.Sprintf("[BFT] seal: %v", err))
+				return
+			}
+		}
+		e.logger.Debug(fmt.Sprintf("[BFT] proposing #%d round %d (%d txs)", e.height, round, len(block.Transactions)))
+		e.send(&Message{
+			Type:       MsgProposal,
+			Height:     e.height,
+			Round:      round,
+			BlockHash:  block.Hash(),
+			ValidRound: e.validRound,
+			Block:      block,
+		})
+	}
+
+	e.schedule(e.roundTimeout(e.cfg.TimeoutPropose, round), timeoutInfo{height: e.height, round: round, step: stepPropose})
+	e.checkRules()
+}
+
+func (e *Engine) seal(header *types.Header) error {
+	sig, err := crypto.Sign(header.SealHash().Bytes(), e.key)
+	if err != nil {
+		return err
+	}
+	header.Signature = sig
+	return nil
+}
+
+// send tekent, verspreidt en verwerkt (via de outbox) een eigen bericht.
+func (e *Engine) send(m *Message) {
+	sig, err := crypto.Sign(m.SignHash().Bytes(), e.key)
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("[BFT] sign %s: %v", m.Type, err))
+		return
+	}
+	m.Signature = sig
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	e.net.BroadcastConsensus(data)
+	e.sent = append(e.sent, data)
+	e.outbox = append(e.outbox, m)
+}
+
+func (e *Engine) vote(t MsgType, hash common.Hash) {
+	e.send(&Message{Type: t, Height: e.height, Round: e.round, BlockHash: hash, ValidRound: -1})
+}
+
+// ----------------------------------------------------------------
+// Berichten + timeouts
+// ----------------------------------------------------------------
+
+func (e *Engine) handleMsg(m *Message) {
+	sender, err := m.Sender()
+	if err != nil || !e.isValidator(sender) {
+		return
+	}
+
+	if m.Height == e.height+1 {
+		if len(e.future) < maxFutureMsgs {
+			e.future = append(e.future, m)
+		}
+		return
+	}
+	if m.Height != e.height {
+		return
+	}
+
+	r := e.rs(m.Round)
+	switch m.Type {
+	case MsgProposal:
+		if sender != e.proposer(m.Height, m.Round) || m.Block == nil || m.Block.Header == nil {
+			return
+		}
+		if m.Block.Hash() != m.BlockHash || r.proposal != nil {
+			return
+		}
+		r.proposal = m
+	case MsgPrevote:
+		if _, ok := r.prevotes[sender]; ok {
+			return
+		}
+		r.prevotes[sender] = m
+	case MsgPrecommit:
+		if _, ok := r.precommits[sender]; ok {
+			return
+		}
+		r.precommits[sender] = m
+	default:
+		return
+	}
+
+	// f+1 validators in een hogere ronde → meteen daarheen
+	if m.Round > e.round && e.step != stepNewHeight && e.participants(m.Round) >= e.weak {
+		e.startRound(m.Round)
+		return
+	}
+
+	e.checkRules()
+}
+
+func (e *Engine) handleTimeout(ti timeoutInfo) {
+	if ti.height != e.height {
+		return
+	}
+
+	switch ti.step {
+	case stepNewHeight:
+		if e.step == stepNewHeight {
+			e.startRound(0)
+		}
+	case stepPropose:
+		if ti.round == e.round && e.step == stepPropose {
+			e.vote(MsgPrevote, common.Hash{})
+			e.step = stepPrevote
+			e.updateStatus()
+		}
+	case stepPrevote:
+		if ti.round == e.round && e.step == stepPrevote {
+			e.vote(MsgPrecommit, common.Hash{})
+			e.step = stepPrecommit
+			e.updateStatus()
+		}
+	case stepPrecommit:
+		if ti.round == e.round {
+			e.startRound(ti.round + 1)
+		}
+	}
+}
+
+// participants: aantal validators met een bericht in deze ronde.
+func (e *Engine) participants(round uint64) int {
+	r := e.rs(round)
+	seen := map[common.Address]bool{}
+	if r.proposal != nil {
+		seen[e.proposer(e.height, round)] = true
+	}
+	for a := range r.prevotes {
+		seen[a] = true
+	}
+	for a := range r.precommits {
+		seen[a] = true
+	}
+	return len(seen)
+}
+
+func countVotes(votes map[common.Address]*Message, hash common.Hash) int {
+	n := 0
+	for _, v := range votes {
+		if v.BlockHash == hash {
+			n++
+		}
+	}
+	return n
+}
+
+// isValid: past het voorgestelde block op onze head en zijn de txs geldig?
+func (e *Engine) isValid(block *types.Block) bool {
+	hash := block.Hash()
+	if ok, cached := e.valid[hash]; cached {
+		return ok
+	}
+
+	ok := e.validate(block) == nil
+	e.valid[hash] = ok
+	return ok
+}
+
+func (e *Engine) validate(block *types.Block) error {
+	head := e.chain.Head()
+	if block.Header.Number != head.Header.Number+1 || block.Header.ParentHash != head.Hash() {
+		return errors.New("does not extend head")
+	}
+	if err := e.VerifyHeader(head.Header, block.Header); err != nil {
+		return err
+	}
+	if block.Header.TxRoot != types.DeriveTxRoot(block.Transactions) {
+		return ErrInvalidTxRoot
+	}
+	return e.backend.CheckBlock(block)
+}
+
+// checkRules past de Tendermint "upon" regels toe voor de huidige height.
+func (e *Engine) checkRules() {
+	if e.step == stepNewHeight {
+		return
+	}
+
+	// Commit: proposal + 2f+1 precommits in welke ronde dan ook
+	for round, r := range e.rounds {
+		if r.proposal == nil {
+			continue
+		}
+		hash := r.proposal.BlockHash
+		if countVotes(r.precommits, hash) >= e.quorum && e.isValid(r.proposal.Block) {
+			e.commit(round, r)
+			return
+		}
+	}
+
+	r := e.rs(e.round)
+	p := r.proposal
+
+	// Proposal in de propose-stap → prevote
+	if e.step == stepPropose && p != nil {
+		hash := p.BlockHash
+		switch {
+		case p.ValidRound < 0:
+			if e.isValid(p.Block) && (e.lockedRound < 0 || e.lockedBlock.Hash() == hash) {
+				e.vote(MsgPrevote, hash)
+			} else {
+				e.vote(MsgPrevote, common.Hash{})
+			}
+			e.step = stepPrevote
+
+		case uint64(p.ValidRound) < e.round &&
+			countVotes(e.rs(uint64(p.ValidRound)).prevotes, hash) >= e.quorum:
+			if e.isValid(p.Block) && (e.lockedRound <= p.ValidRound || e.lockedBlock.Hash() == hash) {
+				e.vote(MsgPrevote, hash)
+			} else {
+				e.vote(MsgPrevote, common.Hash{})
+			}
+			e.step = stepPrevote
+		}
+	}
+
+	// 2f+1 prevotes (wat dan ook) → timeoutPrevote
+	if e.step == stepPrevote && len(r.prevotes) >= e.quorum && !r.prevoteTimeout {
+		r.prevoteTimeout = true
+		e.schedule(e.roundTimeout(e.cfg.TimeoutPrevote, e.round), timeoutInfo{height: e.height, round: e.round, step: stepPrevote})
+	}
+
+	// Polka: 2f+1 prevotes op de proposal → lock + precommit
+	if p != nil && !r.polka && e.step >= stepPrevote &&
+		countVotes(r.prevotes, p.BlockHash) >= e.quorum && e.isValid(p.Block) {
+		r.polka = true
+		if e.step == stepPrevote {
+			e.lockedRound, e.lockedBlock = int64(e.round), p.Block
+			e.vote(MsgPrecommit, p.BlockHash)
+			e.step = stepPrecommit
+		}
+		e.validRound, e.validBlock = int64(e.round), p.Block
+	}
+
+	// 2f+1 prevotes op nil → precommit nil
+	if e.step == stepPrevote && countVotes(r.prevotes, common.Hash{}) >= e.quorum {
+		e.vote(MsgPrecommit, common.Hash{})
+		e.step = stepPrecommit
+	}
+
+	// 2f+1 precommits (wat dan ook) → timeoutPrecommit
+	if len(r.precommits) >= e.quorum && !r.precommitTimeout {
+		r.precommitTimeout = true
+		e.schedule(e.roundTimeout(e.cfg.TimeoutPrecommit, e.round), timeoutInfo{height: e.height, round: e.round, step: stepPrecommit})
+	}
+
+	e.updateStatus()
+}
+
+// commit: certificaat bouwen en het block importeren.
+func (e *Engine) commit(round uint64, r *roundState) {
+	proposal := r.proposal
+	hash := proposal.BlockHash
+
+	cert := &types.Certificate{
+		Height:    e.height,
+		Round:     round,
+		BlockHash: hash,
+	}
+	for addr, v := range r.precommits {
+		if v.BlockHash == hash {
+			cert.Signatures = append(cert.Signatures, types.CommitSig{Validator: addr, Signature: v.Signature})
+		}
+	}
+	sort.Slice(cert.Signatures, func(i, j int) bool {
+		return bytes.Compare(cert.Signatures[i].Validator[:], cert.Signatures[j].Validator[:]) < 0
+	})
+
+	block := &types.Block{
+		Header:       proposal.Block.Header,
+		Transactions: proposal.Block.Transactions,
+		Certificate:  cert,
+	}
+
+	if err := e.backend.ImportBlock(block); err != nil {
+		// Kan al via gossip binnen zijn gekomen; anders is dit fataal voor
+		// deze height en wachten we op sync.
+		head := e.chain.Head().Header.Number
+		if head < e.height {
+			e.logger.Error(fmt.Sprintf("[BFT] commit #%d failed: %v", e.height, err))
+			return
+		}
+	} else {
+		e.logger.Info(fmt.Sprintf("[BFT] committed #%d round %d with %d/%d precommits", e.height, round, len(cert.Signatures), len(e.validators)))
+	}
+
+	e.newHeight(e.chain.Head().Header.Number+1, e.cfg.BlockTime)
+}
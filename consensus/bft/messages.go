@@ -0,0 +1,92 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// Consensus berichten (Tendermint: proposal / prevote / precommit)
+// ----------------------------------------------------------------
+
+type MsgType uint8
+
+const (
+	MsgProposal MsgType = iota + 1
+	MsgPrevote
+	MsgPrecommit
+)
+
+func (t MsgType) String() string {
+	switch t {
+	case MsgProposal:
+		return "proposal"
+	case MsgPrevote:
+		return "prevote"
+	case MsgPrecommit:
+		return "precommit"
+	default:
+		return "unknown"
+	}
+}
+
+// Message is een getekend consensus bericht. BlockHash nul = stem op nil.
+type Message struct {
+	Type       MsgType     `json:"type"`
+	Height     uint64      `json:"height"`
+	Round      uint64      `json:"round"`
+	BlockHash  common.Hash `json:"blockHash"`
+	ValidRound int64       `json:"validRound"` // alleen proposal; -1 = geen
+
+	// Alleen bij een proposal: het voorgestelde block
+	Block *types.Block `json:"block,omitempty"`
+
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// signPayload: wat er getekend wordt (zonder Block en Signature).
+type signPayload struct {
+	Type       MsgType     `json:"type"`
+	Height     uint64      `json:"height"`
+	Round      uint64      `json:"round"`
+	BlockHash  common.Hash `json:"blockHash"`
+	ValidRound int64       `json:"validRound"`
+}
+
+func (m *Message) SignHash() common.Hash {
+	out, _ := json.Marshal(signPayload{
+		Type:       m.Type,
+		Height:     m.Height,
+		Round:      m.Round,
+		BlockHash:  m.BlockHash,
+		ValidRound: m.ValidRound,
+	})
+	return crypto.Keccak256Hash(out)
+}
+
+// precommitHash = SignHash van een precommit; gebruikt voor certificaten.
+func precommitHash(height, round uint64, hash common.Hash) common.Hash {
+	m := &Message{Type: MsgPrecommit, Height: height, Round: round, BlockHash: hash, ValidRound: -1}
+	return m.SignHash()
+}
+
+func recoverSigner(hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, errors.New("bft: bad signature length")
+	}
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Sender haalt de validator uit de handtekening.
+func (m *Message) Sender() (common.Address, error) {
+	return recoverSigner(m.SignHash(), m.Signature)
+}
@@ -0,0 +1,355 @@
+package poa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Siasom1/gorrillazz-chain/core/clock"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Proof-of-Authority engine (Clique-achtig):
+// - een vaste validator set wisselt elkaar af (in-turn / out-of-turn)
+// - elke header draagt de secp256k1 handtekening van de proposer
+// - validators worden toegevoegd/verwijderd via stemmen in getekende headers
+
+const (
+	DiffInTurn = 2 // in-turn proposer
+	DiffNoTurn = 1 // out-of-turn proposer
+
+	// Headers mogen maximaal zoveel seconden in de toekomst liggen.
+	allowedFutureBlockTime = 15
+)
+
+var (
+	ErrMissingSignature = errors.New("poa: missing signature")
+	ErrInvalidSignature = errors.New("poa: invalid signature")
+	ErrUnauthorized     = errors.New("poa: proposer is not a validator")
+	ErrRecentlySigned   = errors.New("poa: proposer signed recently")
+	ErrWrongDifficulty  = errors.New("poa: wrong difficulty for proposer turn")
+	ErrInvalidTimestamp = errors.New("poa: invalid timestamp")
+	ErrFutureBlock      = errors.New("poa: block in the future")
+	ErrInvalidVote      = errors.New("poa: invalid vote")
+	ErrNoSigner         = errors.New("poa: no signing key configured")
+	ErrNotYourTurn      = errors.New("poa: not allowed to seal yet")
+	ErrInvalidCoinbase  = errors.New("poa: coinbase is not the proposer")
+)
+
+// Config van de engine.
+type Config struct {
+	// Period = minimale tijd (sec) tussen blocks.
+	// Out-of-turn proposers moeten een extra Period wachten.
+	Period uint64
+
+	// Validators = initiële set (alleen gebruikt zonder bestaande snapshot).
+	Validators []common.Address
+
+	// SnapshotPath = waar de validator snapshot bewaard wordt.
+	SnapshotPath string
+}
+
+type Engine struct {
+	mu sync.RWMutex
+
+	cfg  Config
+	snap *Snapshot
+
+	// Lokale signer (nil = alleen verifiëren)
+	key    *ecdsa.PrivateKey
+	signer common.Address
+
+	// Lokale voorstellen → worden als Vote in eigen headers meegenomen
+	proposals map[common.Address]bool
+
+	// Tijdsbron voor de future-block check (nil = wandklok)
+	clock *clock.Clock
+}
+
+// New laadt de snapshot van disk of start een nieuwe op de huidige head.
+func New(cfg Config, head *types.Header) (*Engine, error) {
+	if cfg.Period == 0 {
+		cfg.Period = 1
+	}
+
+	e := &Engine{
+		cfg:       cfg,
+		proposals: map[common.Address]bool{},
+	}
+
+	snap, err := loadSnapshot(cfg.SnapshotPath)
+	switch {
+	case err == nil:
+		e.snap = snap
+	case os.IsNotExist(err):
+		if len(cfg.Validators) == 0 {
+			return nil, errors.New("poa: empty validator set")
+		}
+		e.snap = newSnapshot(head.Number, head.Hash(), cfg.Validators)
+		if err := e.snap.save(cfg.SnapshotPath); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("poa: load snapshot: %w", err)
+	}
+
+	return e, nil
+}
+
+// Authorize zet de key waarmee deze node blocks tekent.
+func (e *Engine) Authorize(key *ecdsa.PrivateKey) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.key = key
+	e.signer = crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// SetClock: future blocks afmeten aan de (dev) chain clock, zodat
+// evm_increaseTime geen eigen blocks laat weigeren.
+func (e *Engine) SetClock(c *clock.Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock = c
+}
+
+func (e *Engine) Signer() common.Address {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.signer
+}
+
+func (e *Engine) Period() uint64 { return e.cfg.Period }
+
+// ----------------------------------------------------------------
+// Snapshot queries
+// ----------------------------------------------------------------
+
+func (e *Engine) Validators() []common.Address {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]common.Address{}, e.snap.Validators...)
+}
+
+func (e *Engine) Snapshot() *Snapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.snap.copy()
+}
+
+// RestoreSnapshot zet de validator snapshot terug (dev: evm_revert),
+// anders blijven recents van teruggedraaide blocks ons blokkeren.
+func (e *Engine) RestoreSnapshot(snap *Snapshot) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.snap = snap.copy()
+	return e.snap.save(e.cfg.SnapshotPath)
+}
+
+// InTurn geeft de in-turn proposer voor block number.
+func (e *Engine) InTurn(number uint64) common.Address {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.snap.inTurn(number)
+}
+
+// ----------------------------------------------------------------
+// Voorstellen (lokale stemmen)
+// ----------------------------------------------------------------
+
+// Propose: bij volgende eigen blocks stemmen om addr toe te voegen (true)
+// of te verwijderen (false).
+func (e *Engine) Propose(addr common.Address, authorize bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.proposals[addr] = authorize
+}
+
+func (e *Engine) Discard(addr common.Address) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.proposals, addr)
+}
+
+func (e *Engine) Proposals() map[common.Address]bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make(map[common.Address]bool, len(e.proposals))
+	for a, auth := range e.proposals {
+		out[a] = auth
+	}
+	return out
+}
+
+// ----------------------------------------------------------------
+// Sealing
+// ----------------------------------------------------------------
+
+// delay = minimale afstand tot de parent voor deze proposer.
+func (e *Engine) delay(inTurn bool) uint64 {
+	if inTurn {
+		return e.cfg.Period
+	}
+	return 2 * e.cfg.Period
+}
+
+// NextSealTime geeft de unix tijd waarop deze node het block na parent mag
+// tekenen. ErrNotYourTurn als de node (nu) helemaal niet mag tekenen.
+func (e *Engine) NextSealTime(parent *types.Header) (uint64, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.key == nil {
+		return 0, ErrNoSigner
+	}
+	number := parent.Number + 1
+	if !e.snap.isValidator(e.signer) {
+		return 0, ErrUnauthorized
+	}
+	if e.snap.signedRecently(e.signer, number) {
+		return 0, ErrNotYourTurn
+	}
+	return parent.Time + e.delay(e.snap.inTurn(number) == e.signer), nil
+}
+
+// Prepare vult Coinbase, Difficulty + Vote in en controleert of we nu
+// mogen tekenen.
+func (e *Engine) Prepare(parent, header *types.Header) error {
+	at, err := e.NextSealTime(parent)
+	if err != nil {
+		return err
+	}
+	if header.Time < at {
+		return ErrNotYourTurn
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	header.Coinbase = e.signer
+	header.Difficulty = DiffNoTurn
+	if e.snap.inTurn(header.Number) == e.signer {
+		header.Difficulty = DiffInTurn
+	}
+
+	// Eén geldig voorstel per block meenemen (rouleert via block number)
+	header.Vote = nil
+	var addrs []common.Address
+	for addr, auth := range e.proposals {
+		if e.snap.validVote(addr, auth) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) > 0 {
+		sortAddresses(addrs)
+		pick := addrs[header.Number%uint64(len(addrs))]
+		header.Vote = &types.Vote{Address: pick, Authorize: e.proposals[pick]}
+	}
+	return nil
+}
+
+// Seal tekent de header met de lokale key.
+func (e *Engine) Seal(header *types.Header) error {
+	e.mu.RLock()
+	key := e.key
+	e.mu.RUnlock()
+
+	if key == nil {
+		return ErrNoSigner
+	}
+	sig, err := crypto.Sign(header.SealHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	header.Signature = sig
+	return nil
+}
+
+// ----------------------------------------------------------------
+// Verificatie
+// ----------------------------------------------------------------
+
+// Recover haalt de proposer uit de header-handtekening.
+func Recover(header *types.Header) (common.Address, error) {
+	if len(header.Signature) != crypto.SignatureLength {
+		return common.Address{}, ErrMissingSignature
+	}
+	pub, err := crypto.SigToPub(header.SealHash().Bytes(), header.Signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// VerifyHeader controleert handtekening, proposer-beurt en tijdregels van
+// header t.o.v. parent, tegen de huidige snapshot.
+func (e *Engine) VerifyHeader(parent, header *types.Header) error {
+	proposer, err := Recover(header)
+	if err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.snap.isValidator(proposer) {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, proposer.Hex())
+	}
+	// Leeg mag (blocks van vóór Coinbase), anders moet het de proposer zijn
+	if header.Coinbase != (common.Address{}) && header.Coinbase != proposer {
+		return fmt.Errorf("%w: %s, signed by %s", ErrInvalidCoinbase, header.Coinbase.Hex(), proposer.Hex())
+	}
+	if e.snap.signedRecently(proposer, header.Number) {
+		return fmt.Errorf("%w: %s", ErrRecentlySigned, proposer.Hex())
+	}
+
+	inTurn := e.snap.inTurn(header.Number) == proposer
+	want := uint64(DiffNoTurn)
+	if inTurn {
+		want = DiffInTurn
+	}
+	if header.Difficulty != want {
+		return fmt.Errorf("%w: got %d want %d", ErrWrongDifficulty, header.Difficulty, want)
+	}
+
+	if header.Time < parent.Time+e.delay(inTurn) {
+		return fmt.Errorf("%w: %d too close to parent %d", ErrInvalidTimestamp, header.Time, parent.Time)
+	}
+	if header.Time > e.clock.Now()+allowedFutureBlockTime {
+		return ErrFutureBlock
+	}
+
+	if header.Vote != nil && header.Vote.Address == (common.Address{}) {
+		return ErrInvalidVote
+	}
+	return nil
+}
+
+// Finalize verwerkt een geaccepteerde header (recents + stemmen) en
+// bewaart de snapshot.
+func (e *Engine) Finalize(header *types.Header) error {
+	proposer, err := Recover(header)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	before := len(e.snap.Validators)
+	e.snap.apply(header, proposer)
+
+	// Voorstel is uitgevoerd → lokaal opruimen
+	if len(e.snap.Validators) != before {
+		for addr, auth := range e.proposals {
+			if !e.snap.validVote(addr, auth) {
+				delete(e.proposals, addr)
+			}
+		}
+	}
+
+	return e.snap.save(e.cfg.SnapshotPath)
+}
@@ -0,0 +1,274 @@
+package poa
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testPeriod = 5
+
+// committee: n validator keys, op adres gesorteerd zoals de snapshot.
+func committee(t *testing.T, n int) []*ecdsa.PrivateKey {
+	t.Helper()
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	addrs := make([]common.Address, n)
+	for i, k := range keys {
+		addrs[i] = crypto.PubkeyToAddress(k.PublicKey)
+	}
+	sorted := append([]common.Address{}, addrs...)
+	sortAddresses(sorted)
+	out := make([]*ecdsa.PrivateKey, n)
+	for i, a := range sorted {
+		for j, b := range addrs {
+			if a == b {
+				out[i] = keys[j]
+			}
+		}
+	}
+	return out
+}
+
+func addr(key *ecdsa.PrivateKey) common.Address { return crypto.PubkeyToAddress(key.PublicKey) }
+
+func newEngine(t *testing.T, keys []*ecdsa.PrivateKey, genesis *types.Header) *Engine {
+	t.Helper()
+	validators := make([]common.Address, len(keys))
+	for i, k := range keys {
+		validators[i] = addr(k)
+	}
+	e, err := New(Config{
+		Period:       testPeriod,
+		Validators:   validators,
+		SnapshotPath: filepath.Join(t.TempDir(), "poa_snapshot.json"),
+	}, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// sealed: header number na parent, getekend door key (nil = ongetekend).
+func sealed(t *testing.T, key *ecdsa.PrivateKey, parent *types.Header, blockTime, diff uint64, vote *types.Vote) *types.Header {
+	t.Helper()
+	h := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     parent.Number + 1,
+		Time:       blockTime,
+		Difficulty: diff,
+		Vote:       vote,
+	}
+	if key != nil {
+		h.Coinbase = addr(key)
+		sig, err := crypto.Sign(h.SealHash().Bytes(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Signature = sig
+	}
+	return h
+}
+
+func TestVerifyHeader(t *testing.T) {
+	keys := committee(t, 3)
+	genesis := &types.Header{Number: 0, Time: 1000}
+	// Block 1: validators[1 % 3] is in-turn
+	inTurn, outTurn := keys[1], keys[2]
+	stranger, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := uint64(time.Now().Unix())
+
+	tests := []struct {
+		name   string
+		header func() *types.Header
+		want   error
+	}{
+		{"in turn", func() *types.Header {
+			return sealed(t, inTurn, genesis, 1000+testPeriod, DiffInTurn, nil)
+		}, nil},
+		{"in turn, out-of-turn difficulty", func() *types.Header {
+			return sealed(t, inTurn, genesis, 1000+testPeriod, DiffNoTurn, nil)
+		}, ErrWrongDifficulty},
+		{"out of turn, in-turn difficulty", func() *types.Header {
+			return sealed(t, outTurn, genesis, 1000+2*testPeriod, DiffInTurn, nil)
+		}, ErrWrongDifficulty},
+		{"out of turn after one period", func() *types.Header {
+			return sealed(t, outTurn, genesis, 1000+testPeriod, DiffNoTurn, nil)
+		}, ErrInvalidTimestamp},
+		{"out of turn after two periods", func() *types.Header {
+			return sealed(t, outTurn, genesis, 1000+2*testPeriod, DiffNoTurn, nil)
+		}, nil},
+		{"in turn too early", func() *types.Header {
+			return sealed(t, inTurn, genesis, 1000+testPeriod-1, DiffInTurn, nil)
+		}, ErrInvalidTimestamp},
+		{"future block", func() *types.Header {
+			return sealed(t, inTurn, genesis, now+allowedFutureBlockTime+60, DiffInTurn, nil)
+		}, ErrFutureBlock},
+		{"not a validator", func() *types.Header {
+			return sealed(t, stranger, genesis, 1000+2*testPeriod, DiffNoTurn, nil)
+		}, ErrUnauthorized},
+		{"unsigned", func() *types.Header {
+			return sealed(t, nil, genesis, 1000+testPeriod, DiffInTurn, nil)
+		}, ErrMissingSignature},
+		{"coinbase of another validator", func() *types.Header {
+			h := sealed(t, inTurn, genesis, 1000+testPeriod, DiffInTurn, nil)
+			h.Coinbase = addr(outTurn)
+			sig, _ := crypto.Sign(h.SealHash().Bytes(), inTurn)
+			h.Signature = sig
+			return h
+		}, ErrInvalidCoinbase},
+		{"vote for the zero address", func() *types.Header {
+			return sealed(t, inTurn, genesis, 1000+testPeriod, DiffInTurn, &types.Vote{Authorize: true})
+		}, ErrInvalidVote},
+		{"vote", func() *types.Header {
+			return sealed(t, inTurn, genesis, 1000+testPeriod, DiffInTurn, &types.Vote{Address: addr(stranger), Authorize: true})
+		}, nil},
+	}
+	for _, tt := range tests {
+		e := newEngine(t, keys, genesis)
+		err := e.VerifyHeader(genesis, tt.header())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRecentlySigned(t *testing.T) {
+	keys := committee(t, 3) // venster = 3/2+1 = 2 blocks
+	genesis := &types.Header{Number: 0, Time: 1000}
+	e := newEngine(t, keys, genesis)
+
+	// keys[1] is in-turn op 1 en 4, keys[2] op 2, keys[0] op 3
+	h1 := sealed(t, keys[1], genesis, 1005, DiffInTurn, nil)
+	if err := e.VerifyHeader(genesis, h1); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(h1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nog een keer keys[1] op 2 (out-of-turn): binnen het venster
+	again := sealed(t, keys[1], h1, 1015, DiffNoTurn, nil)
+	if err := e.VerifyHeader(h1, again); !errors.Is(err, ErrRecentlySigned) {
+		t.Fatalf("second block in the window: %v, want %v", err, ErrRecentlySigned)
+	}
+	if _, err := e.NextSealTime(h1); err != ErrNoSigner {
+		t.Fatalf("NextSealTime without a key: %v", err)
+	}
+	e.Authorize(keys[1])
+	if _, err := e.NextSealTime(h1); !errors.Is(err, ErrNotYourTurn) {
+		t.Fatalf("NextSealTime in the window: %v, want %v", err, ErrNotYourTurn)
+	}
+
+	h2 := sealed(t, keys[2], h1, 1010, DiffInTurn, nil)
+	if err := e.VerifyHeader(h1, h2); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(h2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Op 3 is het venster van keys[1] voorbij
+	h3 := sealed(t, keys[1], h2, 1020, DiffNoTurn, nil)
+	if err := e.VerifyHeader(h2, h3); err != nil {
+		t.Fatalf("after the window: %v", err)
+	}
+	at, err := e.NextSealTime(h2)
+	if err != nil || at != h2.Time+2*testPeriod {
+		t.Fatalf("NextSealTime out of turn = %d, %v; want %d", at, err, h2.Time+2*testPeriod)
+	}
+}
+
+func TestValidatorVotes(t *testing.T) {
+	keys := committee(t, 3)
+	candidate, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := &types.Header{Number: 0, Time: 1000}
+	e := newEngine(t, keys, genesis)
+
+	parent := genesis
+	steps := []struct {
+		name       string
+		by         *ecdsa.PrivateKey
+		vote       *types.Vote
+		validators int
+		tally      int // stemmen voor candidate na deze stap
+	}{
+		{"first vote to add", keys[0], &types.Vote{Address: addr(candidate), Authorize: true}, 3, 1},
+		{"same validator again", keys[0], &types.Vote{Address: addr(candidate), Authorize: true}, 3, 1},
+		{"vote to add an existing validator", keys[1], &types.Vote{Address: addr(keys[2]), Authorize: true}, 3, 1},
+		{"majority adds", keys[1], &types.Vote{Address: addr(candidate), Authorize: true}, 4, 0},
+		{"first vote to remove", keys[0], &types.Vote{Address: addr(candidate), Authorize: false}, 4, 1},
+		{"second vote to remove", keys[1], &types.Vote{Address: addr(candidate), Authorize: false}, 4, 2},
+		{"majority of four removes", keys[2], &types.Vote{Address: addr(candidate), Authorize: false}, 3, 0},
+	}
+	for _, st := range steps {
+		h := sealed(t, st.by, parent, parent.Time+testPeriod, DiffNoTurn, st.vote)
+		if err := e.Finalize(h); err != nil {
+			t.Fatal(err)
+		}
+		parent = h
+
+		snap := e.Snapshot()
+		if len(snap.Validators) != st.validators {
+			t.Fatalf("%s: %d validators, want %d", st.name, len(snap.Validators), st.validators)
+		}
+		if got := snap.Tally[addr(candidate)].Votes; got != st.tally {
+			t.Fatalf("%s: %d votes, want %d", st.name, got, st.tally)
+		}
+	}
+}
+
+// Prepare + Seal geven headers die VerifyHeader accepteert, in en buiten
+// de beurt.
+func TestPrepareSealVerify(t *testing.T) {
+	keys := committee(t, 3)
+	genesis := &types.Header{Number: 0, Time: 1000}
+
+	for i, key := range keys {
+		e := newEngine(t, keys, genesis)
+		e.Authorize(key)
+		at, err := e.NextSealTime(genesis)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &types.Header{ParentHash: genesis.Hash(), Number: 1, Time: at - 1}
+		if err := e.Prepare(genesis, h); !errors.Is(err, ErrNotYourTurn) {
+			t.Fatalf("validator %d before its seal time: %v", i, err)
+		}
+		h.Time = at
+		if err := e.Prepare(genesis, h); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Seal(h); err != nil {
+			t.Fatal(err)
+		}
+		wantDiff := uint64(DiffNoTurn)
+		if e.InTurn(1) == addr(key) {
+			wantDiff = DiffInTurn
+		}
+		if h.Difficulty != wantDiff || h.Coinbase != addr(key) {
+			t.Fatalf("validator %d: difficulty %d coinbase %s", i, h.Difficulty, h.Coinbase.Hex())
+		}
+		if err := e.VerifyHeader(genesis, h); err != nil {
+			t.Fatalf("validator %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package poa
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ----------------------------------------------------------------
+// Snapshot = validator set + stemmen op een bepaalde hoogte
+// ----------------------------------------------------------------
+
+// Vote is een uitgebrachte stem van een validator (uit een getekende header).
+type Vote struct {
+	Validator common.Address `json:"validator"` // wie stemde
+	Block     uint64         `json:"block"`     // in welke header
+	Address   common.Address `json:"address"`   // over wie
+	Authorize bool           `json:"authorize"` // toevoegen of verwijderen
+}
+
+// Tally telt de stemmen per kandidaat.
+type Tally struct {
+	Authorize bool `json:"authorize"`
+	Votes     int  `json:"votes"`
+}
+
+type Snapshot struct {
+	Number     uint64                    `json:"number"`
+	Hash       common.Hash               `json:"hash"`
+	Validators []common.Address          `json:"validators"` // gesorteerd
+	Recents    map[uint64]common.Address `json:"recents"`    // block → proposer
+	Votes      []*Vote                   `json:"votes"`
+	Tally      map[common.Address]Tally  `json:"tally"`
+}
+
+func newSnapshot(number uint64, hash common.Hash, validators []common.Address) *Snapshot {
+	s := &Snapshot{
+		Number:     number,
+		Hash:       hash,
+		Validators: append([]common.Address{}, validators...),
+		Recents:    map[uint64]common.Address{},
+		Votes:      []*Vote{},
+		Tally:      map[common.Address]Tally{},
+	}
+	sortAddresses(s.Validators)
+	return s
+}
+
+func loadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Recents == nil {
+		s.Recents = map[uint64]common.Address{}
+	}
+	if s.Tally == nil {
+		s.Tally = map[common.Address]Tally{}
+	}
+	return &s, nil
+}
+
+func (s *Snapshot) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		Number:     s.Number,
+		Hash:       s.Hash,
+		Validators: append([]common.Address{}, s.Validators...),
+		Recents:    make(map[uint64]common.Address, len(s.Recents)),
+		Votes:      make([]*Vote, len(s.Votes)),
+		Tally:      make(map[common.Address]Tally, len(s.Tally)),
+	}
+	for n, a := range s.Recents {
+		cpy.Recents[n] = a
+	}
+	for i, v := range s.Votes {
+		vv := *v
+		cpy.Votes[i] = &vv
+	}
+	for a, t := range s.Tally {
+		cpy.Tally[a] = t
+	}
+	return cpy
+}
+
+func (s *Snapshot) isValidator(addr common.Address) bool {
+	for _, v := range s.Validators {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// inTurn: validators wisselen elkaar af op volgorde van adres.
+func (s *Snapshot) inTurn(number uint64) common.Address {
+	if len(s.Validators) == 0 {
+		return common.Address{}
+	}
+	return s.Validators[number%uint64(len(s.Validators))]
+}
+
+// recentLimit: een validator mag maar één keer per (N/2)+1 blocks tekenen.
+func (s *Snapshot) recentLimit() uint64 {
+	return uint64(len(s.Validators)/2 + 1)
+}
+
+// signedRecently: heeft addr binnen het limit-venster vóór number getekend?
+func (s *Snapshot) signedRecently(addr common.Address, number uint64) bool {
+	limit := s.recentLimit()
+	for seen, recent := range s.Recents {
+		if recent != addr {
+			continue
+		}
+		// seen + limit > number → nog binnen het venster
+		if seen+limit > number {
+			return true
+		}
+	}
+	return false
+}
+
+// validVote: een stem is alleen zinvol als hij de status omdraait.
+func (s *Snapshot) validVote(addr common.Address, authorize bool) bool {
+	return s.isValidator(addr) != authorize
+}
+
+func (s *Snapshot) cast(addr common.Address, authorize bool) bool {
+	if !s.validVote(addr, authorize) {
+		return false
+	}
+	t := s.Tally[addr]
+	if t.Votes > 0 && t.Authorize != authorize {
+		return false
+	}
+	s.Tally[addr] = Tally{Authorize: authorize, Votes: t.Votes + 1}
+	return true
+}
+
+func (s *Snapshot) uncast(addr common.Address, authorize bool) {
+	t, ok := s.Tally[addr]
+	if !ok || t.Authorize != authorize {
+		return
+	}
+	if t.Votes > 1 {
+		t.Votes--
+		s.Tally[addr] = t
+	} else {
+		delete(s.Tally, addr)
+	}
+}
+
+// apply verwerkt een (reeds geverifieerde) header met proposer in de snapshot.
+func (s *Snapshot) apply(header *types.Header, proposer common.Address) {
+	hash := header.Hash()
+	number := header.Number
+
+	// Oude recents uit het venster schuiven
+	limit := s.recentLimit()
+	for n := range s.Recents {
+		if n+limit <= number {
+			delete(s.Recents, n)
+		}
+	}
+	s.Recents[number] = proposer
+
+	if header.Vote != nil {
+		s.applyVote(proposer, number, header.Vote.Address, header.Vote.Authorize)
+	}
+
+	s.Number = number
+	s.Hash = hash
+}
+
+func (s *Snapshot) applyVote(validator common.Address, number uint64, addr common.Address, authorize bool) {
+	// Eerdere stem van deze validator over hetzelfde adres vervalt
+	for i, v := range s.Votes {
+		if v.Validator == validator && v.Address == addr {
+			s.uncast(v.Address, v.Authorize)
+			s.Votes = append(s.Votes[:i], s.Votes[i+1:]...)
+			break
+		}
+	}
+
+	if s.cast(addr, authorize) {
+		s.Votes = append(s.Votes, &Vote{
+			Validator: validator,
+			Block:     number,
+			Address:   addr,
+			Authorize: authorize,
+		})
+	}
+
+	// Meerderheid bereikt? → validator set aanpassen
+	t, ok := s.Tally[addr]
+	if !ok || t.Votes <= len(s.Validators)/2 {
+		return
+	}
+
+	if t.Authorize {
+		s.Validators = append(s.Validators, addr)
+		sortAddresses(s.Validators)
+	} else {
+		for i, v := range s.Validators {
+			if v == addr {
+				s.Validators = append(s.Validators[:i], s.Validators[i+1:]...)
+				break
+			}
+		}
+		// Kleinere set → kleiner recents-venster
+		limit := s.recentLimit()
+		for n := range s.Recents {
+			if n+limit <= number {
+				delete(s.Recents, n)
+			}
+		}
+		// Openstaande stemmen van de verwijderde validator vervallen
+		kept := s.Votes[:0]
+		for _, v := range s.Votes {
+			if v.Validator == addr {
+				s.uncast(v.Address, v.Authorize)
+				continue
+			}
+			kept = append(kept, v)
+		}
+		s.Votes = kept
+	}
+
+	// Alle stemmen over dit adres zijn afgehandeld
+	kept := s.Votes[:0]
+	for _, v := range s.Votes {
+		if v.Address != addr {
+			kept = append(kept, v)
+		}
+	}
+	s.Votes = kept
+	delete(s.Tally, addr)
+}
+
+func sortAddresses(addrs []common.Address) {
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+}
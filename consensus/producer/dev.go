@@ -0,0 +1,212 @@
+package producer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/state"
+)
+
+// ----------------------------------------------------------------
+// Dev modes: wanneer wordt er een block gemaakt?
+// ----------------------------------------------------------------
+//
+// interval  → elke block time (PoA beurt), optioneel lege blocks overslaan
+// instamine → zodra er een tx in de pool komt (integratietests)
+// manual    → alleen op verzoek (evm_mine)
+
+type Mode string
+
+const (
+	ModeInterval  Mode = "interval"
+	ModeInstamine Mode = "instamine"
+	ModeManual    Mode = "manual"
+)
+
+var ErrSyncing = errors.New("node is syncing")
+
+// ParseMode: "" = interval.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeInterval:
+		return ModeInterval, nil
+	case ModeInstamine, ModeManual:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("unknown dev mode %q (interval|instamine|manual)", s)
+}
+
+// SetMode kiest de mining mode; skipEmpty = in interval mode geen blocks
+// zonder txs maken. Aanroepen vóór Start.
+func (bp *BlockProducer) SetMode(mode Mode, skipEmpty bool) {
+	bp.mode = mode
+	bp.skipEmpty = skipEmpty
+}
+
+func (bp *BlockProducer) Mode() Mode { return bp.mode }
+
+// Mine maakt direct een block, ook zonder txs (evm_mine). Werkt in elke
+// mode; in interval mode gaat de timer daarna gewoon verder.
+func (bp *BlockProducer) Mine() (*types.Block, error) {
+	return bp.seal(true, true)
+}
+
+// instamineLoop maakt een block zodra een tx in de pool komt. TxPending
+// events die binnenkomen terwijl we een block maken, gaan mee in het
+// volgende block (de pool wordt in zijn geheel gelezen).
+func (bp *BlockProducer) instamineLoop() {
+	sub := bp.bus.Subscribe(events.DefaultQueueSize, events.DropOldest, events.TopicTx)
+	defer sub.Unsubscribe()
+
+	// Txs die al in de pool stonden (herstart)
+	bp.minePending()
+
+	for {
+		select {
+		case <-bp.quit:
+			return
+		case ev, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if _, pending := ev.Data.(*events.TxPending); !pending {
+				continue
+			}
+			bp.minePending()
+		}
+	}
+}
+
+// minePending blijft blocks maken zolang er txs in passen (pool groter
+// dan één block).
+func (bp *BlockProducer) minePending() {
+	for len(bp.chain.TxPool.Pending()) > 0 {
+		block, err := bp.seal(false, true)
+		if err != nil || block == nil {
+			return
+		}
+	}
+}
+
+// headerTime: een vastgelegde timestamp (evm_setNextBlockTimestamp) gaat
+// voor. immediate = niet op de block time gewacht; het block krijgt dan de
+// vroegste tijd die de engine toestaat, en altijd later dan de parent.
+func (bp *BlockProducer) headerTime(parent *types.Header, immediate bool) uint64 {
+	if ts, ok := bp.clock.Next(); ok {
+		return ts
+	}
+	t := bp.clock.Now()
+	if !immediate {
+		return t
+	}
+	if t <= parent.Time {
+		t = parent.Time + 1
+	}
+	if bp.engine != nil {
+		if at, err := bp.engine.NextSealTime(parent); err == nil && t < at {
+			t = at
+		}
+	}
+	return t
+}
+
+// ----------------------------------------------------------------
+// Snapshots (evm_snapshot / evm_revert)
+// ----------------------------------------------------------------
+
+var ErrUnknownSnapshot = errors.New("unknown snapshot")
+
+// devSnapshot: alles wat een test kan veranderen. Blocks t/m head blijven
+// op disk staan; Rewind ruimt alleen de latere op.
+type devSnapshot struct {
+	head     *types.Block
+	state    *state.Snapshot
+	pool     []*types.Transaction
+	poa      *poa.Snapshot
+	offset   int64
+	nextTime uint64
+}
+
+// Snapshot legt state (incl. intents), pool, head (en PoA snapshot +
+// clock) vast en geeft een id voor Revert. Alleen in instamine/manual mode.
+func (bp *BlockProducer) Snapshot() (uint64, error) {
+	if bp.mode == ModeInterval {
+		return 0, errors.New("snapshots require dev mode instamine or manual")
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	st, err := bp.chain.State.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	snap := &devSnapshot{
+		head:  bp.chain.Head(),
+		state: st,
+		pool:  bp.chain.TxPool.Pending(),
+	}
+	if bp.engine != nil {
+		snap.poa = bp.engine.Snapshot()
+	}
+	if bp.clock != nil {
+		snap.offset, snap.nextTime = bp.clock.State()
+	}
+
+	if bp.snapshots == nil {
+		bp.snapshots = map[uint64]*devSnapshot{}
+	}
+	bp.nextSnapshot++
+	bp.snapshots[bp.nextSnapshot] = snap
+	return bp.nextSnapshot, nil
+}
+
+// Revert zet alles terug naar snapshot id. Zoals Hardhat vervalt daarbij
+// die snapshot en alle latere.
+func (bp *BlockProducer) Revert(id uint64) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	snap, ok := bp.snapshots[id]
+	if !ok {
+		return ErrUnknownSnapshot
+	}
+	for n := range bp.snapshots {
+		if n >= id {
+			delete(bp.snapshots, n)
+		}
+	}
+
+	number := snap.head.Header.Number
+	if b, err := bp.chain.LoadBlock(number); err != nil || b.Hash() != snap.head.Hash() {
+		return fmt.Errorf("block #%d of snapshot %d is gone", number, id)
+	}
+
+	if err := bp.chain.State.RevertToSnapshot(snap.state); err != nil {
+		return err
+	}
+	if err := bp.chain.Rewind(number); err != nil {
+		return err
+	}
+	// Intents staan in de state db en zijn dus mee teruggezet
+	if bp.chain.Payment != nil {
+		if err := bp.chain.Payment.Load(); err != nil {
+			return err
+		}
+	}
+	bp.chain.TxPool.Reset(snap.pool)
+	if snap.poa != nil {
+		if err := bp.engine.RestoreSnapshot(snap.poa); err != nil {
+			return err
+		}
+	}
+	if bp.clock != nil {
+		bp.clock.Restore(snap.offset, snap.nextTime)
+	}
+
+	bp.logger.Info(fmt.Sprintf("Reverted to snapshot %d at block #%d", id, number))
+	return nil
+}
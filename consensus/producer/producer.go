@@ -1,59 +1,140 @@
 package producer
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
+	"github.com/Siasom1/gorrillazz-chain/core"
 	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/clock"
 	"github.com/Siasom1/gorrillazz-chain/core/types"
 	"github.com/Siasom1/gorrillazz-chain/events"
 	"github.com/Siasom1/gorrillazz-chain/log"
+	payment_gateway "github.com/Siasom1/gorrillazz-chain/modules/payment_gateway"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
 	"github.com/ethereum/go-ethereum/common"
 )
 
 const (
-	paymentDataPrefix = "GORR_PAY:" // tx.Data = "GORR_PAY:<intentID>"
-	// Fee in basispunten → 250 = 2.5%
-	treasuryFeeBps = 250
-	bpsDenominator = 10000
+	// Ondergrens voor de producer loop (voorkomt busy-looping)
+	minSealDelay = 50 * time.Millisecond
 )
 
 type BlockProducer struct {
 	chain  *blockchain.Blockchain
+	proc   *core.StateProcessor
 	logger *log.Logger
 	quit   chan struct{}
 	delay  time.Duration
 	bus    *events.EventBus
+	engine *poa.Engine
+	syncer Syncer
+
+	mode      Mode
+	skipEmpty bool
+	clock     *clock.Clock // nil = wandklok
+
+	// evm_snapshot id → snapshot (onder mu)
+	snapshots    map[uint64]*devSnapshot
+	nextSnapshot uint64
+
+	// produce en ImportBlock raken allebei head + state
+	mu sync.Mutex
 }
 
 func NewBlockProducer(chain *blockchain.Blockchain, logger *log.Logger, blockTime uint64, bus *events.EventBus) *BlockProducer {
 	return &BlockProducer{
 		chain:  chain,
+		proc:   core.NewStateProcessor(chain, params.GorrillazzChainConfig()),
 		logger: logger,
 		quit:   make(chan struct{}),
 		delay:  time.Duration(blockTime) * time.Second,
 		bus:    bus,
+		mode:   ModeInterval,
 	}
 }
 
+// Syncer meldt of de node nog blocks van peers aan het inhalen is (p2p).
+type Syncer interface {
+	Syncing() bool
+}
+
+// SetSyncer: tijdens sync niet produceren, anders ontstaat een fork op een
+// verouderde head.
+func (bp *BlockProducer) SetSyncer(s Syncer) {
+	bp.syncer = s
+}
+
+// SetChainConfig: gas limit en fork regels (params.ChainConfig) voor
+// produceren en importeren. Standaard params.GorrillazzChainConfig.
+func (bp *BlockProducer) SetChainConfig(config *params.ChainConfig) {
+	bp.proc = core.NewStateProcessor(bp.chain, config)
+}
+
+// SetEngine laat de producer blocks tekenen volgens de PoA beurtregeling.
+func (bp *BlockProducer) SetEngine(engine *poa.Engine) {
+	bp.engine = engine
+}
+
+// SetClock: block timestamps en slots volgen de (dev) chain clock.
+func (bp *BlockProducer) SetClock(c *clock.Clock) {
+	bp.clock = c
+}
+
+func (bp *BlockProducer) Clock() *clock.Clock { return bp.clock }
+
 func (bp *BlockProducer) Start() {
+	switch bp.mode {
+	case ModeManual:
+		bp.logger.Info("Dev mode manual: blocks only via evm_mine")
+		return
+	case ModeInstamine:
+		bp.logger.Info("Dev mode instamine: a block per pending tx")
+		go bp.instamineLoop()
+		return
+	}
+
 	go func() {
-		ticker := time.NewTicker(bp.delay)
 		for {
+			timer := time.NewTimer(bp.nextDelay())
 			select {
-			case <-ticker.C:
+			case <-timer.C:
 				bp.produce()
 			case <-bp.quit:
-				ticker.Stop()
+				timer.Stop()
 				return
 			}
 		}
 	}()
 }
 
+// nextDelay: zonder engine een vaste block time, met engine wachten tot
+// onze (in-turn of out-of-turn) slot na de huidige head.
+func (bp *BlockProducer) nextDelay() time.Duration {
+	head := bp.chain.Head()
+	if bp.engine == nil || head == nil {
+		return bp.delay
+	}
+
+	at, err := bp.engine.NextSealTime(head.Header)
+	if err != nil {
+		// Geen validator / recent getekend → later opnieuw kijken
+		return bp.delay
+	}
+
+	wait := bp.clock.Until(at)
+	if wait < minSealDelay {
+		wait = minSealDelay
+	}
+	return wait
+}
+
 func (bp *BlockProducer) Stop() {
 	close(bp.quit)
 }
@@ -63,305 +144,833 @@ func (bp *BlockProducer) Stop() {
 // ----------------------------------------------------------------
 
 func (bp *BlockProducer) produce() {
+	_, _ = bp.seal(!bp.skipEmpty, false)
+}
+
+// seal maakt, tekent en importeert een block op de huidige head.
+// allowEmpty = false → geen block zonder txs (nil, nil); immediate = niet
+// op de block time wachten (instamine / manual / evm_mine).
+func (bp *BlockProducer) seal(allowEmpty, immediate bool) (*types.Block, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.syncer != nil && bp.syncer.Syncing() {
+		bp.logger.Debug("Skip block: syncing")
+		return nil, ErrSyncing
+	}
+
 	head := bp.chain.Head()
 	if head == nil {
 		bp.logger.Error("No head block loaded in blockchain")
-		return
+		return nil, errors.New("no head block")
+	}
+
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Number:     head.Header.Number + 1,
+		Time:       bp.headerTime(head.Header, immediate),
+		GasLimit:   bp.proc.GasLimit(),
+	}
+
+	// PoA: difficulty/vote invullen; tekenen pas als de roots bekend zijn
+	if bp.engine != nil {
+		if err := bp.engine.Prepare(head.Header, header); err != nil {
+			bp.logger.Debug(fmt.Sprintf("Skip block #%d: %v", header.Number, err))
+			return nil, err
+		}
 	}
 
-	newBlock := &types.Block{
-		Header: &types.Header{
-			ParentHash: head.Hash(),
-			Number:     head.Header.Number + 1,
-			Time:       uint64(time.Now().Unix()),
-			StateRoot:  common.Hash{},
-			TxRoot:     common.Hash{},
-		},
-		Transactions: []*types.Transaction{},
+	newBlock, err := bp.fillBlock(header, true)
+	if err != nil {
+		bp.logger.Error(fmt.Sprintf("Build block #%d: %v", header.Number, err))
+		return nil, err
+	}
+	if len(newBlock.Transactions) == 0 && !allowEmpty {
+		return nil, nil
+	}
+
+	if bp.engine != nil {
+		if err := bp.engine.Seal(header); err != nil {
+			bp.logger.Error(fmt.Sprintf("Seal error: %v", err))
+			return nil, err
+		}
+	}
+	if err := bp.chain.VerifyBlock(newBlock); err != nil {
+		bp.logger.Error(fmt.Sprintf("Refusing own block #%d: %v", header.Number, err))
+		return nil, err
 	}
 
-	blockNum := newBlock.Header.Number
-	blockTime := newBlock.Header.Time
+	// Zelfde pad als een block van een peer
+	if err := bp.insert(head, newBlock); err != nil {
+		bp.logger.Error(fmt.Sprintf("Apply own block #%d: %v", header.Number, err))
+		return nil, err
+	}
+	bp.clock.Sealed(header.Time)
 
-	txns := bp.chain.TxPool.Pending()
-	receipts := []*types.Receipt{}
+	bp.logger.Info(fmt.Sprintf(
+		"Produced block #%d | %d txs | Hash=%s",
+		newBlock.Header.Number,
+		len(newBlock.Transactions),
+		newBlock.Hash().Hex(),
+	))
+	return newBlock, nil
+}
 
-	for _, tx := range txns {
+// fillBlock kiest txs uit de pool door ze één voor één op een overlay van
+// de state uit te voeren, tot de gas limit van de header op is, en vult
+// daarna TxRoot, GasUsed en StateRoot in. De echte state verandert pas bij
+// ApplyBlock. drop = ongeldige txs uit de pool halen (eigen block); anders
+// alleen overslaan (BFT proposal).
+func (bp *BlockProducer) fillBlock(header *types.Header, drop bool) (*types.Block, error) {
+	block := &types.Block{Header: header, Transactions: []*types.Transaction{}}
+
+	st := bp.chain.State.Begin()
+	var (
+		logIndex uint64
+		usedGas  uint64
+		gp       = core.GasPool(header.GasLimit)
+	)
+
+	var receipts []*types.Receipt
+	intents := map[uint64]*payment_gateway.PaymentIntent{}
+	settling := map[uint64]bool{} // settlement runs met een tx in dit block
+	for _, tx := range bp.chain.TxPool.Pending() {
 		if tx == nil {
 			continue
 		}
 
+		// Block vol: zelfs een kale transfer past niet meer
+		if gp.Gas() < core.TxGas {
+			bp.logger.Debug(fmt.Sprintf("Block #%d full (%d gas used)", header.Number, usedGas))
+			break
+		}
+		if tx.Gas > header.GasLimit {
+			bp.rejectTx(tx, tx.Sender, fmt.Sprintf("gas %d exceeds block gas limit %d", tx.Gas, header.GasLimit), drop)
+			continue
+		}
+		if tx.Gas > gp.Gas() {
+			// Past niet meer in dit block → volgende block
+			continue
+		}
+
 		from, err := tx.From()
 		if err != nil {
-			// DEV fallback: gebruik admin als sender zodat je chain niet vastloopt
-			bp.logger.Info(fmt.Sprintf("Invalid TX signature (%v); using AdminAddr as fallback sender", err))
-			if bp.chain.AdminAddr == (common.Address{}) {
-				bp.logger.Error("AdminAddr is zero address; cannot fallback sender")
-				continue
-			}
-			from = bp.chain.AdminAddr
+			bp.rejectTx(tx, common.Address{}, fmt.Sprintf("invalid signature: %v", err), drop)
+			continue
 		}
 
 		// NONCE check
-		stateNonce, err := bp.chain.State.GetNonce(from)
+		stateNonce, err := st.GetNonce(from)
 		if err != nil {
 			bp.logger.Error(fmt.Sprintf("GetNonce error for %s: %v", from.Hex(), err))
 			continue
 		}
-		if tx.Nonce != stateNonce {
-			// Nonce mismatch → skip (later opnieuw proberen)
+		if tx.Nonce < stateNonce {
+			bp.rejectTx(tx, from, fmt.Sprintf("nonce too low: got %d want %d", tx.Nonce, stateNonce), drop)
 			continue
 		}
-
-		// Detecteer payment intent in tx.Data
-		intentID, isPayment := parsePaymentIntentID(tx.Data)
-		var ok bool
-
-		if isPayment {
-			ok = bp.processPaymentGORR(tx, from, intentID, blockNum, blockTime)
-		} else {
-			ok = bp.processGORR(tx, from)
-		}
-
-		if !ok {
-			// Onvoldoende saldo / intent ongeldig
+		if tx.Nonce > stateNonce {
+			// Future nonce → in de pool laten (later opnieuw proberen)
 			continue
 		}
 
-		// Nonce verhogen pas ná succesvolle verwerking
-		if err := bp.chain.State.IncreaseNonce(from); err != nil {
-			bp.logger.Error(fmt.Sprintf("IncreaseNonce error: %v", err))
+		intent, err := bp.checkPaymentIntent(st, header, tx, from, intents)
+		if err != nil {
+			bp.rejectTx(tx, from, err.Error(), drop)
 			continue
 		}
-
-		// In block opnemen
-		newBlock.Transactions = append(newBlock.Transactions, tx)
-
-		// Tx indexeren voor eth_getTransactionReceipt / eth_getTransactionByHash
-		if err := bp.chain.SaveTxIndex(tx.Hash(), blockNum); err != nil {
-			bp.logger.Error(fmt.Sprintf("SaveTxIndex error: %v", err))
+		settlement, err := bp.checkSettlement(header, tx, from, settling)
+		if err != nil {
+			bp.rejectTx(tx, from, err.Error(), drop)
+			continue
 		}
 
-		// Receipt opslaan in geheugen (later opslaan naar disk)
-		receipt := &types.Receipt{
-			TxHash:           tx.Hash(),
-			BlockHash:        newBlock.Hash(),
-			BlockNumber:      blockNum,
-			TransactionIndex: uint64(len(newBlock.Transactions) - 1),
-			From:             from,
-			To:               *tx.To,
-			GasUsed:          tx.Gas,
-			Status:           1,
+		// Een tx die halverwege faalt laat niets achter: state, gas en
+		// log index terug naar de stand vóór de tx
+		cp, gpBefore, usedBefore, logBefore := st.Checkpoint(), gp, usedGas, logIndex
+		index := uint64(len(block.Transactions))
+		receipt, err := bp.proc.ApplyTransaction(st, header, tx, index, &logIndex, &gp, &usedGas)
+		if err != nil {
+			if rerr := st.RevertTo(cp); rerr != nil {
+				return nil, fmt.Errorf("revert tx %s: %w", tx.Hash().Hex(), rerr)
+			}
+			gp, usedGas, logIndex = gpBefore, usedBefore, logBefore
+			// Onvoldoende saldo / ongeldige tx
+			bp.rejectTx(tx, from, err.Error(), drop)
+			continue
 		}
+		block.Transactions = append(block.Transactions, tx)
 		receipts = append(receipts, receipt)
-
-		// Uit de txpool halen
-		bp.chain.TxPool.Remove(tx)
+		if intent != nil {
+			intents[intent.ID] = intent
+		}
+		if settlement != 0 {
+			settling[settlement] = true
+		}
 	}
 
-	// HEAD updaten + block opslaan
-	if err := bp.chain.SetHead(newBlock); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetHead error: %v", err))
+	// Auto pulls van subscriptions + fees en issuance verdelen (rewards
+	// fork), zoals ApplyBlock dat doet
+	pulls, err := bp.proc.ApplySubscriptions(st, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := bp.proc.Finalize(st, header, receipts, pulls); err != nil {
+		return nil, err
 	}
 
-	// Receipts opslaan
-	if err := bp.chain.SaveReceipts(newBlock.Header.Number, receipts); err != nil {
-		bp.logger.Error(fmt.Sprintf("SaveReceipts error: %v", err))
+	root, err := st.Root()
+	if err != nil {
+		return nil, err
 	}
+	header.TxRoot = types.DeriveTxRoot(block.Transactions)
+	header.GasUsed = usedGas
+	header.StateRoot = root
+	return block, nil
+}
 
-	bp.logger.Info(fmt.Sprintf(
-		"Produced block #%d | %d txs | Hash=%s",
-		newBlock.Header.Number,
-		len(newBlock.Transactions),
-		newBlock.Hash().Hex(),
-	))
+// WithStateLock voert fn uit onder het lock van produce en ImportBlock.
+// Voor wijzigingen die direct in chain.State gaan (admin RPCs): een block
+// overlay schrijft bij Commit hele accounts terug en zou een wijziging
+// die ertussen valt anders overschrijven.
+func (bp *BlockProducer) WithStateLock(fn func() error) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return fn()
 }
 
 // ----------------------------------------------------------------
-// Normale GORR transfer (zonder fee / payment intent)
+// BLOCK IMPORT (blocks van peers)
 // ----------------------------------------------------------------
 
-func (bp *BlockProducer) processGORR(tx *types.Transaction, from common.Address) bool {
-	if tx.To == nil {
-		bp.logger.Info("TX rejected: nil To address")
-		return false
-	}
+// ImportBlock voert een block van een peer uit op de lokale state en zet
+// het als nieuwe head. Het block moet direct op de head passen, door de
+// consensus engine komen, elke tx moet slagen en de state root moet
+// kloppen; anders blijft de state ongewijzigd.
+func (bp *BlockProducer) ImportBlock(block *types.Block) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 
-	fromBal, err := bp.chain.State.GetBalance(from)
-	if err != nil {
-		bp.logger.Error(fmt.Sprintf("GetBalance(from) error: %v", err))
-		return false
+	if err := bp.chain.VerifyBlock(block); err != nil {
+		return err
 	}
-
-	if fromBal.Cmp(tx.Value) < 0 {
-		// Onvoldoende saldo
-		return false
+	if err := bp.insert(bp.chain.Head(), block); err != nil {
+		return err
 	}
 
-	toBal, err := bp.chain.State.GetBalance(*tx.To)
+	bp.logger.Info(fmt.Sprintf(
+		"Imported block #%d | %d txs | Hash=%s",
+		block.Header.Number,
+		len(block.Transactions),
+		block.Hash().Hex(),
+	))
+	return nil
+}
+
+// insert: ApplyBlock + commit. Gebruikt door produce én ImportBlock.
+func (bp *BlockProducer) insert(parent, block *types.Block) error {
+	var (
+		updates *intentUpdates
+		hooked  bool
+	)
+	receipts, rewards, err := bp.proc.ApplyBlock(parent, block, func(st *state.State, receipts []*types.Receipt, pulls []*core.SubscriptionPull) error {
+		hooked = true
+		var err error
+		updates, err = bp.updateIntents(st, block, receipts, pulls)
+		return err
+	})
 	if err != nil {
-		bp.logger.Error(fmt.Sprintf("GetBalance(to) error: %v", err))
-		return false
+		// Intents in geheugen kunnen al bijgewerkt zijn → terug naar de db
+		if hooked && bp.chain.Payment != nil {
+			if lerr := bp.chain.Payment.Load(); lerr != nil {
+				bp.logger.Error(fmt.Sprintf("Reload payment intents: %v", lerr))
+			}
+		}
+		return err
 	}
+	return bp.commit(block, receipts, rewards, updates)
+}
 
-	newFrom := new(big.Int).Sub(fromBal, tx.Value)
-	newTo := new(big.Int).Add(toBal, tx.Value)
+// ----------------------------------------------------------------
+// BLOCK BUILDING zonder state te raken (BFT proposals)
+// ----------------------------------------------------------------
 
-	if err := bp.chain.State.SetBalance(from, newFrom); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetBalance(from) error: %v", err))
-		return false
+// BuildBlock stelt een block samen op parent met txs uit de pool die
+// zouden slagen; coinbase is de proposer. De state wordt pas bij
+// ImportBlock aangepast.
+func (bp *BlockProducer) BuildBlock(parent *types.Block, blockTime uint64, coinbase common.Address) *types.Block {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     parent.Header.Number + 1,
+		Time:       blockTime,
+		GasLimit:   bp.proc.GasLimit(),
+		Coinbase:   coinbase,
 	}
-	if err := bp.chain.State.SetBalance(*tx.To, newTo); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetBalance(to) error: %v", err))
-		return false
+	block, err := bp.fillBlock(header, false)
+	if err != nil {
+		// Leeg block zonder geldige root → wordt afgestemd, volgende ronde
+		bp.logger.Error(fmt.Sprintf("Build block #%d: %v", header.Number, err))
+		return &types.Block{Header: header, Transactions: []*types.Transaction{}}
 	}
-
-	return true
+	return block
 }
 
-// ----------------------------------------------------------------
-// Payment GORR transfer (met treasury fee + PaymentGateway)
-// ----------------------------------------------------------------
+// CheckBlock voert een (voorgesteld) block uit op een overlay van de
+// huidige state, inclusief root controle, zonder iets weg te schrijven.
+func (bp *BlockProducer) CheckBlock(block *types.Block) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.proc.ValidateBlock(bp.chain.Head(), block)
+}
 
-func (bp *BlockProducer) processPaymentGORR(
+// checkPaymentIntent: lokale controle van een payment tx (GORR_PAY, in
+// GORR of achter een USDCc transfer) of GORR_REFUND tx vóór opname in een
+// eigen block. intents houdt de intents bij zoals ze na de al opgenomen
+// txs van dit block zijn, zodat bijv. een tweede betaling in hetzelfde
+// block niet langs een intent komt dat al betaald is. st is de state van
+// het block in aanbouw (fee en status van de merchant). Geeft het intent
+// na tx terug (nil = geen payment/refund). Bij import doen we dit niet:
+// intents zijn node-lokaal.
+func (bp *BlockProducer) checkPaymentIntent(
+	st *state.State,
+	header *types.Header,
 	tx *types.Transaction,
 	from common.Address,
-	intentID uint64,
-	blockNum uint64,
-	blockTime uint64,
-) bool {
-	if tx.To == nil {
-		bp.logger.Info("Payment TX rejected: nil To address")
-		return false
+	intents map[uint64]*payment_gateway.PaymentIntent,
+) (*payment_gateway.PaymentIntent, error) {
+	rules := bp.proc.Config().Rules(header.Number)
+	refund, isRefund := core.RefundOf(rules, tx)
+	payment, isPayment := core.PaymentOf(rules, tx)
+	if !isRefund && !isPayment {
+		return nil, nil
 	}
-
 	if bp.chain.Payment == nil {
-		bp.logger.Info("Payment TX rejected: PaymentGateway is nil")
-		return false
+		return nil, errors.New("PaymentGateway is nil")
 	}
 
-	if bp.chain.TreasuryAddr == (common.Address{}) {
-		bp.logger.Info("Payment TX rejected: TreasuryAddr is zero address")
-		return false
+	if isRefund {
+		intent, err := bp.blockIntent(intents, refund.IntentID)
+		if err != nil {
+			return nil, err
+		}
+		if sid := bp.chain.Payment.PendingSettlement(refund.IntentID); sid != 0 {
+			return nil, fmt.Errorf("refund for intent %d: intent is in pending settlement %d", refund.IntentID, sid)
+		}
+		// Houdt ook de fee refund uit de treasury binnen wat er bij de
+		// betaling aan fee is afgegaan
+		updated, err := payment_gateway.WithRefund(intent, from, refund.Payer, refund.Token, refund.Amount, refund.Fee, tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("refund for intent %d: %w", refund.IntentID, err)
+		}
+		return updated, nil
 	}
 
-	// 1) Intent ophalen
-	intent, err := bp.chain.Payment.GetIntent(intentID)
+	intent, err := bp.blockIntent(intents, payment.IntentID)
 	if err != nil {
-		bp.logger.Info(fmt.Sprintf("Payment intent %d not found: %v", intentID, err))
-		return false
+		return nil, err
 	}
-
-	// Voor nu: alleen GORR-payments via native Value
-	if intent.Token != "GORR" {
-		bp.logger.Info(fmt.Sprintf("Payment intent %d has unsupported token %s (only GORR supported for now)", intentID, intent.Token))
-		return false
+	// Vanaf de paymentTerms fork legt het block de terms vast; die moeten
+	// die van het intent zijn
+	if t := payment.Terms; t != nil && (t.Amount.Cmp(intent.Amount) != 0 || t.Expiry != intent.Expiry) {
+		return nil, fmt.Errorf("payment intent %d: terms %s/%d do not match the intent (%s/%d)",
+			payment.IntentID, t.Amount, t.Expiry, intent.Amount, intent.Expiry)
+	}
+	if rules.IsMerchants {
+		m, err := core.GetMerchant(st, payment.Merchant)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil && m.Status == core.MerchantStatusSuspended {
+			return nil, fmt.Errorf("merchant %s is suspended", payment.Merchant.Hex())
+		}
 	}
+	bps, _, err := core.MerchantTerms(st, rules, payment.Merchant)
+	if err != nil {
+		return nil, err
+	}
+	fee, _ := core.PaymentSplit(bps, payment.Amount)
+	updated, err := payment_gateway.WithPayment(
+		intent,
+		from,
+		payment.Merchant,
+		payment.Token,
+		payment.Amount,
+		fee,
+		tx.Hash(),
+		header.Number,
+		header.Time,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("payment intent %d: %w", payment.IntentID, err)
+	}
+	return updated, nil
+}
 
-	// Merchant moet overeenkomen met tx.To
-	if intent.Merchant != *tx.To {
-		bp.logger.Info(fmt.Sprintf("Payment intent %d merchant mismatch", intentID))
-		return false
+// checkSettlement: lokale controle van een GORR_SETTLE tx vóór opname in
+// een eigen block; de run moet pending zijn en de tx moet precies zijn
+// netto bedrag van de merchant naar het payout adres sturen. settling
+// houdt de runs bij die al een tx in dit block hebben. Geeft het id van
+// de run terug (0 = geen settlement tx).
+func (bp *BlockProducer) checkSettlement(header *types.Header, tx *types.Transaction, from common.Address, settling map[uint64]bool) (uint64, error) {
+	st, ok := core.SettlementOf(bp.proc.Config().Rules(header.Number), tx)
+	if !ok {
+		return 0, nil
 	}
+	if bp.chain.Payment == nil {
+		return 0, errors.New("PaymentGateway is nil")
+	}
+	if settling[st.SettlementID] {
+		return 0, fmt.Errorf("settlement %d already has a tx in this block", st.SettlementID)
+	}
+	if err := bp.chain.Payment.CheckSettlementTx(st.SettlementID, from, st.Payout, st.Token, st.Amount); err != nil {
+		return 0, fmt.Errorf("settlement %d: %w", st.SettlementID, err)
+	}
+	return st.SettlementID, nil
+}
 
-	// 2) Balances & fee berekenen
-	fromBal, err := bp.chain.State.GetBalance(from)
+// blockIntent: het intent zoals het in het block in aanbouw staat.
+func (bp *BlockProducer) blockIntent(intents map[uint64]*payment_gateway.PaymentIntent, id uint64) (*payment_gateway.PaymentIntent, error) {
+	if intent, ok := intents[id]; ok {
+		return intent, nil
+	}
+	intent, err := bp.chain.Payment.GetIntent(id)
 	if err != nil {
-		bp.logger.Error(fmt.Sprintf("GetBalance(from) error: %v", err))
-		return false
+		return nil, fmt.Errorf("payment intent %d not found: %v", id, err)
 	}
+	return intent, nil
+}
 
-	if fromBal.Cmp(tx.Value) < 0 {
-		bp.logger.Info("Payment TX rejected: insufficient balance")
-		return false
+// commit zet het block als head, slaat receipts (en rewards) op en meldt
+// het op de bus.
+func (bp *BlockProducer) commit(
+	block *types.Block,
+	receipts []*types.Receipt,
+	rewards *types.BlockRewards,
+	updates *intentUpdates,
+) error {
+	// HEAD updaten + block opslaan
+	if err := bp.chain.SetHead(block); err != nil {
+		return err
 	}
 
-	// Fee = value * treasuryFeeBps / 10000
-	fee := new(big.Int).Mul(tx.Value, big.NewInt(treasuryFeeBps))
-	fee.Div(fee, big.NewInt(bpsDenominator))
-
-	merchantAmount := new(big.Int).Sub(tx.Value, fee)
+	// Receipts opslaan
+	if err := bp.chain.SaveReceipts(block.Header.Number, receipts); err != nil {
+		bp.logger.Error(fmt.Sprintf("SaveReceipts error: %v", err))
+	}
+	if rewards != nil {
+		if err := bp.chain.SaveRewards(block.Header.Number, rewards); err != nil {
+			bp.logger.Error(fmt.Sprintf("SaveRewards error: %v", err))
+		}
+	}
 
-	merchantBal, err := bp.chain.State.GetBalance(*tx.To)
-	if err != nil {
-		bp.logger.Error(fmt.Sprintf("GetBalance(merchant) error: %v", err))
-		return false
+	for _, tx := range block.Transactions {
+		// Tx indexeren voor eth_getTransactionReceipt / eth_getTransactionByHash
+		if err := bp.chain.SaveTxIndex(tx.Hash(), block.Header.Number); err != nil {
+			bp.logger.Error(fmt.Sprintf("SaveTxIndex error: %v", err))
+		}
+		// Uit de txpool halen
+		bp.chain.TxPool.Remove(tx)
 	}
 
-	treasuryBal, err := bp.chain.State.GetBalance(bp.chain.TreasuryAddr)
-	if err != nil {
-		bp.logger.Error(fmt.Sprintf("GetBalance(treasury) error: %v", err))
-		return false
+	// Events pas ná SetHead + receipts: dan is het block gecommit en
+	// kunnen subscribers (newHeads / logs) receipts van disk lezen.
+	bp.emitCommitted(block, receipts, updates)
+	return nil
+}
+
+// rejectTx: eigen block → tx uit de pool (TxDropped); proposal → alleen overslaan.
+func (bp *BlockProducer) rejectTx(tx *types.Transaction, from common.Address, reason string, drop bool) {
+	if drop {
+		bp.dropTx(tx, from, reason)
+		return
 	}
+	bp.logger.Debug(fmt.Sprintf("TX %s skipped: %s", tx.Hash().Hex(), reason))
+}
 
-	newFrom := new(big.Int).Sub(fromBal, tx.Value)
-	newMerchant := new(big.Int).Add(merchantBal, merchantAmount)
-	newTreasury := new(big.Int).Add(treasuryBal, fee)
+// dropTx haalt een tx definitief uit de pool en meldt dat via TxDropped.
+func (bp *BlockProducer) dropTx(tx *types.Transaction, from common.Address, reason string) {
+	bp.logger.Info(fmt.Sprintf("TX %s dropped: %s", tx.Hash().Hex(), reason))
+	bp.chain.TxPool.Remove(tx)
+
+	if bp.bus != nil {
+		bp.bus.Emit(&events.TxDropped{
+			Hash:   tx.Hash(),
+			From:   from,
+			Reason: reason,
+		})
+	}
+}
 
-	// 3) Balances wegschrijven
-	if err := bp.chain.State.SetBalance(from, newFrom); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetBalance(from) error: %v", err))
-		return false
+func (bp *BlockProducer) emitCommitted(
+	block *types.Block,
+	receipts []*types.Receipt,
+	updates *intentUpdates,
+) {
+	if bp.bus == nil {
+		return
 	}
-	if err := bp.chain.State.SetBalance(*tx.To, newMerchant); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetBalance(merchant) error: %v", err))
-		return false
+	if updates == nil {
+		updates = &intentUpdates{}
 	}
-	if err := bp.chain.State.SetBalance(bp.chain.TreasuryAddr, newTreasury); err != nil {
-		bp.logger.Error(fmt.Sprintf("SetBalance(treasury) error: %v", err))
-		return false
+
+	hashes := make([]common.Hash, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		hashes[i] = tx.Hash()
 	}
 
-	// 4) PaymentGateway updaten (on-chain settlement registratie)
-	if err := bp.chain.Payment.MarkPaidFromTx(
-		intentID,
-		from,
-		*tx.To,
-		tx.Value,
-		tx.Hash(),
-		blockNum,
-		blockTime,
-	); err != nil {
-		// Funds zijn al verplaatst, intent niet gemarkeerd -> in echte productie:
-		// alert / compensating action. Voor nu loggen we.
-		bp.logger.Info(fmt.Sprintf("MarkPaidFromTx failed for intent %d: %v", intentID, err))
+	bp.bus.Emit(&events.BlockCommitted{
+		Number:     block.Header.Number,
+		Hash:       block.Hash(),
+		ParentHash: block.Header.ParentHash,
+		Time:       block.Header.Time,
+		TxHashes:   hashes,
+		Block:      block,
+	})
+
+	for i, r := range receipts {
+		tx := block.Transactions[i]
+		bp.bus.Emit(&events.TxIncluded{
+			Hash:        r.TxHash,
+			BlockNumber: r.BlockNumber,
+			BlockHash:   r.BlockHash,
+			Index:       r.TransactionIndex,
+			From:        r.From,
+			To:          tx.To,
+			Value:       tx.Value.String(),
+			Status:      r.Status,
+		})
+
+		res, ok := updates.payments[r.TxHash]
+		if !ok || !res.marked {
+			continue
+		}
+		intent, err := bp.chain.Payment.GetIntent(res.intentID)
+		if err != nil {
+			continue
+		}
+		if res.refund != nil {
+			bp.bus.Emit(&events.IntentRefunded{
+				IntentInfo:    payment_gateway.IntentInfo(intent),
+				Refund:        res.refund.Amount.String(),
+				FeeRefund:     res.refund.Fee.String(),
+				RefundedTotal: res.refundedTotal.String(),
+				RefundTxHash:  r.TxHash.Hex(),
+			})
+			continue
+		}
+		paid := &events.IntentPaid{
+			IntentInfo: payment_gateway.IntentInfo(intent),
+			Fee:        res.fee.String(),
+			Net:        res.net.String(),
+			PaidTotal:  res.paidTotal.String(),
+		}
+		if res.overpaid != nil {
+			paid.Overpaid = res.overpaid.String()
+		}
+		bp.bus.Emit(paid)
 	}
 
-	bp.logger.Info(fmt.Sprintf(
-		"Payment intent %d PAID via tx %s | gross=%s, fee=%s, net=%s",
-		intentID,
-		tx.Hash().Hex(),
-		tx.Value.String(),
-		fee.String(),
-		merchantAmount.String(),
-	))
+	// Intents die met deze block time verlopen zijn
+	for _, intent := range updates.expired {
+		bp.bus.Emit(&events.IntentExpired{IntentInfo: payment_gateway.IntentInfo(intent)})
+	}
+
+	// Subscription termijnen: nieuw intent, betaald en settled in één keer
+	for _, intent := range updates.charged {
+		info := payment_gateway.IntentInfo(intent)
+		bp.bus.Emit(&events.IntentCreated{IntentInfo: info})
+		bp.bus.Emit(&events.IntentPaid{
+			IntentInfo: info,
+			Fee:        intent.Fee.String(),
+			Net:        new(big.Int).Sub(intent.Amount, intent.Fee).String(),
+			PaidTotal:  intent.PaidAmount.String(),
+		})
+		bp.bus.Emit(&events.IntentSettled{IntentInfo: info})
+	}
 
-	return true
+	// Intents uit settlement runs die in dit block zijn uitbetaald
+	for _, intent := range updates.settled {
+		bp.bus.Emit(&events.IntentSettled{IntentInfo: payment_gateway.IntentInfo(intent)})
+	}
 }
 
 // ----------------------------------------------------------------
-// Helpers
+// Payment intents (node-lokaal, in dezelfde commit als het block)
 // ----------------------------------------------------------------
 
-// parsePaymentIntentID verwacht tx.Data als ASCII "GORR_PAY:<id>"
-// en geeft (id, true) terug als het matcht.
-// Zo niet, dan (0, false).
-func parsePaymentIntentID(data []byte) (uint64, bool) {
-	if len(data) == 0 {
-		return 0, false
+// intentUpdates: wat updateIntents aan intents heeft bijgewerkt, voor de
+// events na commit.
+type intentUpdates struct {
+	payments map[common.Hash]*paymentResult
+	expired  []*payment_gateway.PaymentIntent
+	charged  []*payment_gateway.PaymentIntent // subscription termijnen
+	settled  []*payment_gateway.PaymentIntent // via GORR_SETTLE txs
+}
+
+// updateIntents werkt de intents bij voor een goedgekeurd block: betaalde
+// intents (GORR_PAY txs), refunds (GORR_REFUND txs), uitbetaalde
+// settlement runs (GORR_SETTLE txs), intents die met de block time
+// verlopen en een settled intent per subscription termijn (pull txs en de
+// auto pulls van het block). Alles gaat naar de overlay st en wordt dus
+// samen met het block weggeschreven.
+func (bp *BlockProducer) updateIntents(
+	st *state.State,
+	block *types.Block,
+	receipts []*types.Receipt,
+	pulls []*core.SubscriptionPull,
+) (*intentUpdates, error) {
+	u := &intentUpdates{payments: bp.markPayments(st, block, receipts)}
+	bp.markRefunds(st, block, u.payments)
+	if bp.chain.Payment == nil {
+		return u, nil
 	}
-	if !bytes.HasPrefix(data, []byte(paymentDataPrefix)) {
-		return 0, false
+	u.settled = bp.markSettlements(st, block)
+	var err error
+	if u.expired, err = bp.chain.Payment.ExpireDue(st, block.Header.Time); err != nil {
+		return nil, err
+	}
+	if u.charged, err = bp.recordPulls(st, block, receipts, pulls); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// markSettlements rondt de settlement runs af waarvan de GORR_SETTLE tx in
+// block zit: run en intents naar settled. Een run die deze node niet kent
+// (block van een andere producer) wordt gelogd, zoals bij markPayments.
+func (bp *BlockProducer) markSettlements(st *state.State, block *types.Block) []*payment_gateway.PaymentIntent {
+	rules := bp.proc.Config().Rules(block.Header.Number)
+	if !rules.IsSettlements {
+		return nil
 	}
 
-	idStr := string(data[len(paymentDataPrefix):])
-	if idStr == "" {
-		return 0, false
+	var settled []*payment_gateway.PaymentIntent
+	for _, tx := range block.Transactions {
+		transfer, ok := core.SettlementOf(rules, tx)
+		if !ok {
+			continue
+		}
+		from, _ := tx.From()
+		s, intents, err := bp.chain.Payment.SettleFromTx(
+			st,
+			transfer.SettlementID,
+			from,
+			transfer.Payout,
+			transfer.Token,
+			transfer.Amount,
+			tx.Hash(),
+			block.Header.Number,
+			block.Header.Time,
+		)
+		if errors.Is(err, payment_gateway.ErrSettlementNotFound) {
+			bp.logger.Info(fmt.Sprintf("SettleFromTx: settlement %d unknown on this node", transfer.SettlementID))
+			continue
+		}
+		if err != nil {
+			// Geld is al naar het payout adres, run niet afgerond → loggen
+			bp.logger.Info(fmt.Sprintf("SettleFromTx failed for settlement %d: %v", transfer.SettlementID, err))
+			continue
+		}
+		settled = append(settled, intents...)
+
+		bp.logger.Info(fmt.Sprintf(
+			"Settlement %d SETTLED via tx %s | merchant=%s payout=%s %s net=%s, intents=%d",
+			s.ID,
+			tx.Hash().Hex(),
+			s.Merchant.Hex(),
+			s.Payout.Hex(),
+			s.Token,
+			s.Net.String(),
+			len(intents),
+		))
 	}
+	return settled
+}
 
-	id, err := strconv.ParseUint(idStr, 10, 64)
+// recordPulls maakt voor elke subscription termijn in block een settled
+// intent: eerst de pull txs (uit hun receipts), dan de auto pulls.
+func (bp *BlockProducer) recordPulls(st *state.State, block *types.Block, receipts []*types.Receipt, auto []*core.SubscriptionPull) ([]*payment_gateway.PaymentIntent, error) {
+	rules := bp.proc.Config().Rules(block.Header.Number)
+	if !rules.IsSubscriptions {
+		return nil, nil
+	}
+	pulls, err := core.SubscriptionPullsOf(st, rules, receipts)
 	if err != nil {
-		return 0, false
+		return nil, err
+	}
+	pulls = append(pulls, auto...)
+
+	var charged []*payment_gateway.PaymentIntent
+	for _, pull := range pulls {
+		autoPull := pull.TxHash == (common.Hash{})
+		intent, err := bp.chain.Payment.CreateSettledIntent(
+			st,
+			pull.Merchant,
+			pull.Payer,
+			pull.Token,
+			pull.Amount,
+			pull.Fee,
+			pull.TxHash,
+			block.Header.Number,
+			block.Header.Time,
+			payment_gateway.IntentOptions{
+				OrderRef: fmt.Sprintf("sub:%d/%d", pull.SubscriptionID, pull.Installment),
+				Metadata: map[string]string{
+					"subscriptionId": strconv.FormatUint(pull.SubscriptionID, 10),
+					"installment":    strconv.FormatUint(pull.Installment, 10),
+					"autoPull":       strconv.FormatBool(autoPull),
+				},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		charged = append(charged, intent)
+
+		bp.logger.Info(fmt.Sprintf(
+			"Subscription %d installment %d charged (intent %d, autoPull=%t) | %s gross=%s, fee=%s",
+			pull.SubscriptionID,
+			pull.Installment,
+			intent.ID,
+			autoPull,
+			pull.Token,
+			pull.Amount.String(),
+			pull.Fee.String(),
+		))
+	}
+	return charged, nil
+}
+
+// paymentResult onthoudt wat een payment- of refund-tx deed, voor
+// IntentPaid / IntentRefunded na commit.
+type paymentResult struct {
+	intentID uint64
+	fee      *big.Int
+	net      *big.Int
+	marked   bool // intent is bijgewerkt
+
+	paidTotal *big.Int
+	overpaid  *big.Int
+
+	refund        *core.Refund // nil = payment
+	refundedTotal *big.Int
+}
+
+// markPayments zet de intents van de payment txs in block op paid, voor
+// zover ze op deze node bestaan. De saldi zijn al verplaatst door
+// ApplyBlock; dit is alleen de PaymentGateway registratie (naar st). De
+// fee komt uit de receipt (de fee van de merchant op dat moment).
+func (bp *BlockProducer) markPayments(st *state.State, block *types.Block, receipts []*types.Receipt) map[common.Hash]*paymentResult {
+	payments := map[common.Hash]*paymentResult{}
+	rules := bp.proc.Config().Rules(block.Header.Number)
+
+	for i, tx := range block.Transactions {
+		payment, isPayment := core.PaymentOf(rules, tx)
+		if !isPayment {
+			continue
+		}
+		intentID := payment.IntentID
+		fee, net := core.PaymentSplit(rules.PaymentFeeBps, payment.Amount)
+		if i < len(receipts) && receipts[i].PaymentFee != nil {
+			fee = receipts[i].PaymentFee
+			net = new(big.Int).Sub(payment.Amount, fee)
+		}
+		res := &paymentResult{intentID: intentID, fee: fee, net: net}
+		payments[tx.Hash()] = res
+
+		if bp.chain.Payment == nil {
+			continue
+		}
+		if _, err := bp.chain.Payment.GetIntent(intentID); err != nil {
+			continue
+		}
+		from, _ := tx.From()
+		intent, err := bp.chain.Payment.MarkPaidFromTx(
+			st,
+			intentID,
+			from,
+			payment.Merchant,
+			payment.Token,
+			payment.Amount,
+			fee,
+			tx.Hash(),
+			block.Header.Number,
+			block.Header.Time,
+		)
+		if err != nil {
+			// Alleen mogelijk in een block van een andere producer (die dit
+			// intent niet kent of anders ziet): funds zijn al verplaatst,
+			// intent niet gemarkeerd → loggen.
+			bp.logger.Info(fmt.Sprintf("MarkPaidFromTx failed for intent %d: %v", intentID, err))
+			continue
+		}
+		res.marked = true
+		res.paidTotal = intent.PaidAmount
+		res.overpaid = intent.Overpaid
+
+		bp.logger.Info(fmt.Sprintf(
+			"Payment intent %d %s via tx %s | %s gross=%s, fee=%s, net=%s, total=%s",
+			intentID,
+			intent.Status,
+			tx.Hash().Hex(),
+			payment.Token,
+			payment.Amount.String(),
+			fee.String(),
+			net.String(),
+			intent.PaidAmount.String(),
+		))
+	}
+	return payments
+}
+
+// markRefunds boekt de GORR_REFUND txs in block op hun intent (lopend
+// totaal + tx hash), net als markPayments na de saldo mutaties.
+func (bp *BlockProducer) markRefunds(st *state.State, block *types.Block, results map[common.Hash]*paymentResult) {
+	if bp.chain.Payment == nil {
+		return
+	}
+	rules := bp.proc.Config().Rules(block.Header.Number)
+
+	for _, tx := range block.Transactions {
+		refund, isRefund := core.RefundOf(rules, tx)
+		if !isRefund {
+			continue
+		}
+		from, _ := tx.From()
+		intent, err := bp.chain.Payment.RefundFromTx(
+			st,
+			refund.IntentID,
+			from,
+			refund.Payer,
+			refund.Token,
+			refund.Amount,
+			refund.Fee,
+			tx.Hash(),
+		)
+		if err != nil {
+			// Geld is al terug, intent niet bijgewerkt → loggen (zie markPayments)
+			bp.logger.Info(fmt.Sprintf("RefundFromTx failed for intent %d: %v", refund.IntentID, err))
+			continue
+		}
+		results[tx.Hash()] = &paymentResult{
+			intentID:      refund.IntentID,
+			marked:        true,
+			refund:        refund,
+			refundedTotal: intent.RefundedAmount,
+		}
+
+		bp.logger.Info(fmt.Sprintf(
+			"Payment intent %d REFUNDED via tx %s | %s amount=%s, fee=%s, status=%s",
+			refund.IntentID,
+			tx.Hash().Hex(),
+			refund.Token,
+			refund.Amount.String(),
+			refund.Fee.String(),
+			intent.Status,
+		))
 	}
-	return id, true
 }
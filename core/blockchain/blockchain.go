@@ -9,6 +9,8 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Siasom1/gorrillazz-chain/core/txpool"
@@ -98,6 +100,15 @@ func loadSystemWallets(datadir string) (WalletsFile, error) {
 	return w, nil
 }
 
+// AdminKey laadt de admin private key uit wallets.json (DEV: default validator key).
+func AdminKey(datadir string) (*ecdsa.PrivateKey, error) {
+	w, err := loadSystemWallets(datadir)
+	if err != nil {
+		return nil, err
+	}
+	return gethcrypto.HexToECDSA(strings.TrimPrefix(w.Admin.PrivateKey, "0x"))
+}
+
 //
 // --------------------------------------------------------
 // Blockchain Struct
@@ -106,10 +117,13 @@ func loadSystemWallets(datadir string) (WalletsFile, error) {
 type Blockchain struct {
 	dataDir   string
 	networkID uint64
-	head      *types.Block
-	State     *state.State
-	TxPool    *txpool.TxPool
-	Events    *events.EventBus
+
+	headMu sync.RWMutex
+	head   *types.Block
+
+	State  *state.State
+	TxPool *txpool.TxPool
+	Events *events.EventBus
 
 	NativeSymbol string
 
@@ -119,6 +133,21 @@ type Blockchain struct {
 
 	AdminAddr    common.Address
 	TreasuryAddr common.Address
+
+	// Consensus engine (consensus/poa); nil = blocks worden niet gecontroleerd
+	Engine Engine
+}
+
+// Engine valideert headers voordat ze aan de chain worden toegevoegd.
+type Engine interface {
+	VerifyHeader(parent, header *types.Header) error
+	Finalize(header *types.Header) error
+}
+
+// CertificateVerifier: engines met finality (consensus/bft) eisen
+// daarnaast een geldig certificaat bij elk block.
+type CertificateVerifier interface {
+	VerifyCertificate(block *types.Block) error
 }
 
 //
@@ -149,8 +178,12 @@ func NewBlockchainWithConfig(cfg ChainConfig) (*Blockchain, error) {
 	bc.TxPool = txpool.NewTxPool()
 	bc.Events = events.NewEventBus()
 
-	// Payment gateway (one instance, two fields for compatibility)
+	// Payment gateway (one instance, two fields for compatibility).
+	// Intents staan in de state db, naast de accounts.
 	pg := payment_gateway.NewPaymentGateway()
+	if err := pg.SetStore(st); err != nil {
+		return nil, fmt.Errorf("load payment intents: %w", err)
+	}
 	bc.Payment = pg
 	bc.Gateway = pg
 
@@ -192,10 +225,15 @@ func NewBlockchainWithConfig(cfg ChainConfig) (*Blockchain, error) {
 		evmFund := new(big.Int).Mul(big.NewInt(1_000_000), wei)
 		bc.State.SetBalance(evmUser, evmFund)
 
+		genesisTime := cfg.GenesisTime
+		if genesisTime == 0 {
+			genesisTime = uint64(time.Now().Unix())
+		}
+
 		genesis := &types.Block{
 			Header: &types.Header{
 				Number: 0,
-				Time:   uint64(time.Now().Unix()),
+				Time:   genesisTime,
 			},
 		}
 
@@ -224,20 +262,121 @@ func NewBlockchain(dataDir string, networkID uint64) (*Blockchain, error) {
 // Misc functions
 // --------------------------------------------------------
 
-func (bc *Blockchain) NetworkID() uint64  { return bc.networkID }
-func (bc *Blockchain) Head() *types.Block { return bc.head }
+func (bc *Blockchain) NetworkID() uint64 { return bc.networkID }
+func (bc *Blockchain) Head() *types.Block {
+	bc.headMu.RLock()
+	defer bc.headMu.RUnlock()
+	return bc.head
+}
+
+// SetEventBus koppelt de chain (en de payment gateway) aan de node bus.
+func (bc *Blockchain) SetEventBus(bus *events.EventBus) {
+	bc.Events = bus
+	if bc.Payment != nil {
+		bc.Payment.SetEventBus(bus)
+	}
+}
+
+// SetEngine koppelt de consensus engine; vanaf dan weigert SetHead blocks
+// die niet door de engine komen.
+func (bc *Blockchain) SetEngine(engine Engine) {
+	bc.Engine = engine
+}
+
+// VerifyBlock controleert of block direct op de huidige head past.
+func (bc *Blockchain) VerifyBlock(block *types.Block) error {
+	if block == nil || block.Header == nil {
+		return fmt.Errorf("nil block")
+	}
+	parent := bc.Head()
+	if parent == nil {
+		return fmt.Errorf("no head block")
+	}
+	if block.Header.Number != parent.Header.Number+1 {
+		return fmt.Errorf("block #%d does not follow head #%d", block.Header.Number, parent.Header.Number)
+	}
+	if block.Header.ParentHash != parent.Hash() {
+		return fmt.Errorf("block #%d parent hash mismatch", block.Header.Number)
+	}
+	if bc.Engine == nil {
+		return nil
+	}
+	if err := bc.Engine.VerifyHeader(parent.Header, block.Header); err != nil {
+		return err
+	}
+	if cv, ok := bc.Engine.(CertificateVerifier); ok {
+		return cv.VerifyCertificate(block)
+	}
+	return nil
+}
 
 func (bc *Blockchain) SetHead(block *types.Block) error {
+	if err := bc.VerifyBlock(block); err != nil {
+		return err
+	}
+
+	bc.headMu.Lock()
 	bc.head = block
+	bc.headMu.Unlock()
+
 	if err := bc.saveBlock(block); err != nil {
 		return err
 	}
-	return bc.saveHead()
+	if err := bc.saveHead(); err != nil {
+		return err
+	}
+
+	if bc.Engine != nil {
+		return bc.Engine.Finalize(block.Header)
+	}
+	return nil
+}
+
+// Rewind zet de head terug naar block number (dev: evm_revert) en ruimt
+// blocks, receipts en tx index erboven op. De state en de consensus
+// engine moet de aanroeper zelf terugzetten.
+func (bc *Blockchain) Rewind(number uint64) error {
+	block, err := bc.LoadBlock(number)
+	if err != nil {
+		return fmt.Errorf("load block #%d: %w", number, err)
+	}
+
+	bc.headMu.Lock()
+	old := bc.head.Header.Number
+	bc.head = block
+	bc.headMu.Unlock()
+
+	if err := bc.saveHead(); err != nil {
+		return err
+	}
+
+	for n := number + 1; n <= old; n++ {
+		for _, name := range []string{"block_%d.json", "receipts_%d.json", "rewards_%d.json"} {
+			path := filepath.Join(bc.dataDir, fmt.Sprintf(name, n))
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	idx, err := bc.loadTxIndex()
+	if err != nil {
+		return err
+	}
+	for hash, n := range idx {
+		if n > number {
+			delete(idx, hash)
+		}
+	}
+	return bc.saveTxIndex(idx)
 }
 
+// DataDir geeft de chaindata directory (voor o.a. de PoA snapshot).
+func (bc *Blockchain) DataDir() string { return bc.dataDir }
+
 func (bc *Blockchain) saveHead() error {
 	path := filepath.Join(bc.dataDir, "head.json")
-	data, err := json.MarshalIndent(bc.head, "", "  ")
+	data, err := json.MarshalIndent(bc.Head(), "", "  ")
 	if err != nil {
 		return err
 	}
@@ -314,6 +453,28 @@ func (bc *Blockchain) LoadReceipts(blockNum uint64) ([]*types.Receipt, error) {
 	return receipts, nil
 }
 
+// SaveRewards: de BlockRewards van een block (alleen vanaf de rewards fork).
+func (bc *Blockchain) SaveRewards(blockNum uint64, rewards *types.BlockRewards) error {
+	path := filepath.Join(bc.dataDir, fmt.Sprintf("rewards_%d.json", blockNum))
+	data, _ := json.MarshalIndent(rewards, "", "  ")
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadRewards: os.ErrNotExist voor blocks zonder rewards record.
+func (bc *Blockchain) LoadRewards(blockNum uint64) (*types.BlockRewards, error) {
+	path := filepath.Join(bc.dataDir, fmt.Sprintf("rewards_%d.json", blockNum))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewards types.BlockRewards
+	if err := json.Unmarshal(data, &rewards); err != nil {
+		return nil, err
+	}
+	return &rewards, nil
+}
+
 func (bc *Blockchain) loadTxIndex() (txIndex, error) {
 	path := filepath.Join(bc.dataDir, "txindex.json")
 	if _, err := os.Stat(path); os.IsNotExist(err) {
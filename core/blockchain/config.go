@@ -13,13 +13,22 @@ type ChainConfig struct {
 	// Optional: different wallets seed per chain so addresses can differ.
 	// If empty, default seed is used.
 	GenesisSeed string
+
+	// Timestamp van het genesis block. Nodes van hetzelfde netwerk moeten
+	// dezelfde genesis hash hebben (p2p handshake), dus vast i.p.v. time.Now.
+	// 0 = huidige tijd (oude gedrag).
+	GenesisTime uint64
 }
 
+// DefaultGenesisTime = 2025-01-01 00:00:00 UTC
+const DefaultGenesisTime uint64 = 1735689600
+
 func DefaultChainConfig(dataDir string, networkID uint64) ChainConfig {
 	return ChainConfig{
 		DataDir:      dataDir,
 		NetworkID:    networkID,
 		NativeSymbol: "GORR",
 		GenesisSeed:  "",
+		GenesisTime:  DefaultGenesisTime,
 	}
 }
@@ -0,0 +1,128 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------
+// Chain clock: gedeelde tijdsbron voor producer, engine en gateway
+// ----------------------------------------------------------------
+//
+// Normaal is dit gewoon de wandklok. In dev mode kan de tijd vooruit
+// gezet worden (evm_increaseTime) of de timestamp van het volgende block
+// vastgelegd worden (evm_setNextBlockTimestamp), zodat expiry tests niet
+// echt hoeven te wachten. Een nil *Clock gedraagt zich als de wandklok.
+
+type Clock struct {
+	mu     sync.Mutex
+	offset int64  // seconden bovenop de wandklok
+	next   uint64 // vaste timestamp voor het volgende block (0 = geen)
+}
+
+func New() *Clock {
+	return &Clock{}
+}
+
+// Now: huidige chain tijd (unix seconden).
+func (c *Clock) Now() uint64 {
+	if c == nil {
+		return uint64(time.Now().Unix())
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *Clock) nowLocked() uint64 {
+	return uint64(time.Now().Unix() + c.offset)
+}
+
+// Until: hoe lang (wandklok) tot chain tijd ts.
+func (c *Clock) Until(ts uint64) time.Duration {
+	return time.Duration(int64(ts)-int64(c.Now())) * time.Second
+}
+
+// Increase zet de klok seconds vooruit en geeft de totale verschuiving.
+// De wandklok (nil) blijft staan: 0.
+func (c *Clock) Increase(seconds uint64) int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += int64(seconds)
+	return c.offset
+}
+
+// Offset: totale verschuiving t.o.v. de wandklok (seconden).
+func (c *Clock) Offset() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// SetNext legt de timestamp van het volgende block vast. Ligt ts in de
+// toekomst, dan springt de klok er meteen naartoe (anders weigert de
+// engine het block als "future block"). Op de wandklok (nil) een no-op.
+func (c *Clock) SetNext(ts uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next = ts
+	if ts > c.nowLocked() {
+		c.offset = int64(ts) - time.Now().Unix()
+	}
+}
+
+// Next: vastgelegde timestamp voor het volgende block, als die er is.
+func (c *Clock) Next() (uint64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next, c.next != 0
+}
+
+// Sealed meldt dat er een block met timestamp ts gemaakt is. Was dat de
+// vastgelegde timestamp, dan loopt de klok vanaf daar verder (zoals Hardhat).
+func (c *Clock) Sealed(ts uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == 0 || ts != c.next {
+		return
+	}
+	c.next = 0
+	c.offset = int64(ts) - time.Now().Unix()
+}
+
+// State: offset + vastgelegde timestamp, voor evm_snapshot.
+func (c *Clock) State() (offset int64, next uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset, c.next
+}
+
+// Restore zet de state van State() terug (evm_revert). Op de wandklok
+// (nil) een no-op.
+func (c *Clock) Restore(offset int64, next uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = offset
+	c.next = next
+}
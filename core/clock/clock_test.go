@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func wall() uint64 { return uint64(time.Now().Unix()) }
+
+// near: a ligt binnen een seconde van b (de wandklok loopt door).
+func near(a, b uint64) bool { return a >= b && a <= b+1 }
+
+func TestNilClockIsWallClock(t *testing.T) {
+	var c *Clock
+	if !near(c.Now(), wall()) || c.Offset() != 0 {
+		t.Fatalf("nil clock at %d offset %d", c.Now(), c.Offset())
+	}
+	if _, ok := c.Next(); ok {
+		t.Fatal("nil clock has a fixed timestamp")
+	}
+	c.Sealed(1) // geen panic
+
+	// De dev calls veranderen de wandklok niet
+	if got := c.Increase(60); got != 0 {
+		t.Fatalf("nil clock increased to offset %d", got)
+	}
+	c.SetNext(wall() + 3600)
+	c.Restore(60, wall()+3600)
+	if offset, next := c.State(); offset != 0 || next != 0 || !near(c.Now(), wall()) {
+		t.Fatalf("nil clock state %d, %d at %d", offset, next, c.Now())
+	}
+}
+
+func TestClock(t *testing.T) {
+	c := New()
+	start := wall()
+
+	steps := []struct {
+		name   string
+		do     func()
+		offset int64  // verwachte offset (ongeveer)
+		next   uint64 // 0 = geen vaste timestamp
+	}{
+		{"increase", func() { c.Increase(100) }, 100, 0},
+		{"increase again", func() { c.Increase(20) }, 120, 0},
+		{"fixed timestamp in the past jumps nothing", func() { c.SetNext(start + 50) }, 120, start + 50},
+		{"other block sealed", func() { c.Sealed(start + 49) }, 120, start + 50},
+		{"fixed block sealed: clock runs on from there", func() { c.Sealed(start + 50) }, 50, 0},
+		{"fixed timestamp in the future jumps", func() { c.SetNext(start + 1000) }, 1000, start + 1000},
+		{"restore", func() { c.Restore(7, 0) }, 7, 0},
+	}
+	for _, st := range steps {
+		st.do()
+		offset, next := c.State()
+		if offset < st.offset-1 || offset > st.offset || next != st.next {
+			t.Fatalf("%s: offset %d next %d, want %d and %d", st.name, offset, next, st.offset, st.next)
+		}
+		if !near(c.Now(), uint64(int64(wall())+offset)) {
+			t.Fatalf("%s: now %d with offset %d", st.name, c.Now(), offset)
+		}
+	}
+	if d := c.Until(c.Now() + 10); d < 9*time.Second || d > 10*time.Second {
+		t.Fatalf("Until = %s, want about 10s", d)
+	}
+}
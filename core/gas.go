@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+	"math"
+
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ----------------------------------------------------------------
+// Gas: intrinsic kosten + block gas pool
+// ----------------------------------------------------------------
+//
+// Er is geen EVM: het gasverbruik van een tx is volledig intrinsiek.
+// Tarieven volgen Ethereum (EIP-2028 voor calldata).
+
+const (
+	TxGas            uint64 = 21000 // basis: elke tx
+	TxDataZeroGas    uint64 = 4     // per 0-byte calldata
+	TxDataNonZeroGas uint64 = 16    // per niet-0 byte calldata
+
+	// GORR_PAY / GORR_REFUND: extra treasury write + payment log
+	TxPaymentGas uint64 = 5000
+
+	// GORR_MERCHANT: registry record write + log
+	TxMerchantGas uint64 = 20000
+
+	// GORR_SUB: subscription record write + log(s)
+	TxSubscriptionGas uint64 = 20000
+)
+
+var (
+	ErrIntrinsicGas    = errors.New("intrinsic gas too low")
+	ErrGasLimitReached = errors.New("gas limit reached")
+	ErrGasUintOverflow = errors.New("gas uint64 overflow")
+)
+
+// IntrinsicGas: gas dat een tx met deze data altijd verbruikt.
+func IntrinsicGas(data []byte) (uint64, error) {
+	gas := TxGas
+
+	var nz uint64
+	for _, b := range data {
+		if b != 0 {
+			nz++
+		}
+	}
+	z := uint64(len(data)) - nz
+
+	if (math.MaxUint64-gas)/TxDataNonZeroGas < nz {
+		return 0, ErrGasUintOverflow
+	}
+	gas += nz * TxDataNonZeroGas
+
+	if (math.MaxUint64-gas)/TxDataZeroGas < z {
+		return 0, ErrGasUintOverflow
+	}
+	gas += z * TxDataZeroGas
+
+	if _, isPayment := ParsePaymentIntentID(data); isPayment {
+		gas += TxPaymentGas
+	}
+	return gas, nil
+}
+
+// TxIntrinsicGas: IntrinsicGas plus TxPaymentGas voor een USDCc betaling
+// (daar staat de marker achter de transfer call, niet vooraan) en voor
+// een GORR_REFUND (vanaf de refunds fork) of een GORR_PAY marker met
+// terms (vanaf de paymentTerms fork), TxMerchantGas voor een
+// registry call (vanaf de merchants fork) en TxSubscriptionGas voor een
+// subscription call (vanaf de subscriptions fork).
+func TxIntrinsicGas(rules params.Rules, to *common.Address, data []byte) (uint64, error) {
+	gas, err := IntrinsicGas(data)
+	if err != nil {
+		return 0, err
+	}
+	if rules.IsUSDCc && to != nil && *to == params.USDCcTokenAddress {
+		if t, err := ParseUSDCcTransfer(rules, data); err == nil && (t.IsPayment || t.IsRefund) {
+			gas += TxPaymentGas
+		}
+	} else if rules.IsMerchants && to != nil && *to == params.MerchantRegistryAddress {
+		gas += TxMerchantGas
+	} else if rules.IsSubscriptions && to != nil && *to == params.SubscriptionsAddress {
+		gas += TxSubscriptionGas
+	} else if _, _, isRefund := ParseRefundMarker(data); isRefund && rules.IsRefunds {
+		gas += TxPaymentGas
+	} else if _, terms, ok := ParsePaymentMarker(rules, data); ok && terms != nil {
+		gas += TxPaymentGas
+	}
+	return gas, nil
+}
+
+// GasPool: resterend gas in een block.
+type GasPool uint64
+
+func (gp *GasPool) SubGas(amount uint64) error {
+	if uint64(*gp) < amount {
+		return ErrGasLimitReached
+	}
+	*gp -= GasPool(amount)
+	return nil
+}
+
+func (gp *GasPool) AddGas(amount uint64) {
+	*gp += GasPool(amount)
+}
+
+func (gp *GasPool) Gas() uint64 { return uint64(*gp) }
@@ -0,0 +1,335 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// Merchant registry (vanaf de merchants fork)
+// ----------------------------------------------------------------
+//
+// Een tx naar params.MerchantRegistryAddress met Value 0 en als data
+// "GORR_MERCHANT:" + JSON call wijzigt de registry:
+//
+//	register  {name, payout?}            sender wordt merchant
+//	update    {name?, payout?}           eigen record
+//	addKey    {keyHash, label?}          API key (alleen de hash) erbij
+//	removeKey {keyHash}
+//	setTier   {merchant, tier}           admin; "" = standaard fee
+//	setStatus {merchant, status}         admin; active | suspended
+//
+// De payment fee van een geregistreerde merchant komt uit zijn tier
+// (rules.MerchantFeeTiers) en het netto bedrag gaat naar zijn payout
+// adres. API keys staan alleen als keccak256 hash in de registry; de REST
+// payment API vergelijkt de hash van de meegestuurde key.
+
+const MerchantDataPrefix = "GORR_MERCHANT:"
+
+const (
+	MerchantOpRegister  = "register"
+	MerchantOpUpdate    = "update"
+	MerchantOpAddKey    = "addKey"
+	MerchantOpRemoveKey = "removeKey"
+	MerchantOpSetTier   = "setTier"
+	MerchantOpSetStatus = "setStatus"
+
+	MerchantStatusActive    = "active"
+	MerchantStatusSuspended = "suspended"
+
+	MaxMerchantNameLength = 64
+	MaxMerchantLabel      = 32
+	MaxMerchantAPIKeys    = 5
+)
+
+var (
+	// MerchantUpdated(address indexed merchant, bytes32 indexed op)
+	MerchantUpdatedTopic = crypto.Keccak256Hash([]byte("MerchantUpdated(address,bytes32)"))
+
+	ErrInvalidMerchantCall = errors.New("invalid merchant registry call")
+	ErrMerchantNotFound    = errors.New("merchant not registered")
+)
+
+// Merchant is een record in de registry.
+type Merchant struct {
+	Address      common.Address   `json:"address"`
+	Name         string           `json:"name"`
+	Payout       common.Address   `json:"payout"`
+	Tier         string           `json:"tier,omitempty"`
+	Status       string           `json:"status"`
+	APIKeys      []MerchantAPIKey `json:"apiKeys,omitempty"`
+	RegisteredAt uint64           `json:"registeredAt"` // block number
+	UpdatedAt    uint64           `json:"updatedAt"`    // block number
+}
+
+type MerchantAPIKey struct {
+	Hash    common.Hash `json:"hash"`
+	Label   string      `json:"label,omitempty"`
+	AddedAt uint64      `json:"addedAt"` // block number
+}
+
+// MerchantCall is de JSON achter MerchantDataPrefix.
+type MerchantCall struct {
+	Op       string          `json:"op"`
+	Merchant *common.Address `json:"merchant,omitempty"` // setTier / setStatus
+	Name     *string         `json:"name,omitempty"`
+	Payout   *common.Address `json:"payout,omitempty"`
+	Tier     *string         `json:"tier,omitempty"`
+	Status   string          `json:"status,omitempty"`
+	KeyHash  *common.Hash    `json:"keyHash,omitempty"`
+	Label    string          `json:"label,omitempty"`
+}
+
+// IsMerchantCall: tx gaat naar het registry adres terwijl de fork actief is.
+func IsMerchantCall(rules params.Rules, tx *types.Transaction) bool {
+	return rules.IsMerchants && tx.To != nil && *tx.To == params.MerchantRegistryAddress
+}
+
+// ParseMerchantCall decodeert de tx data van een registry call en
+// controleert de velden die de op nodig heeft (niet de state).
+func ParseMerchantCall(data []byte) (*MerchantCall, error) {
+	if !bytes.HasPrefix(data, []byte(MerchantDataPrefix)) {
+		return nil, fmt.Errorf("%w: data must start with %s", ErrInvalidMerchantCall, MerchantDataPrefix)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data[len(MerchantDataPrefix):]))
+	dec.DisallowUnknownFields()
+	var c MerchantCall
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMerchantCall, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidMerchantCall)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMerchantCall, err)
+	}
+	return &c, nil
+}
+
+func (c *MerchantCall) validate() error {
+	if c.Name != nil {
+		if err := validateMerchantName(*c.Name); err != nil {
+			return err
+		}
+	}
+	if c.Payout != nil && *c.Payout == (common.Address{}) {
+		return errors.New("payout must not be the zero address")
+	}
+	if len(c.Label) > MaxMerchantLabel {
+		return fmt.Errorf("label longer than %d bytes", MaxMerchantLabel)
+	}
+
+	// Name/payout alleen bij register en update: een admin setTier met
+	// een payout mag de uitbetalingen van de merchant niet omleggen
+	if c.Op != MerchantOpRegister && c.Op != MerchantOpUpdate && (c.Name != nil || c.Payout != nil) {
+		return fmt.Errorf("%s does not take a name or payout", c.Op)
+	}
+
+	switch c.Op {
+	case MerchantOpRegister:
+		if c.Name == nil {
+			return errors.New("register needs a name")
+		}
+	case MerchantOpUpdate:
+		if c.Name == nil && c.Payout == nil {
+			return errors.New("update needs a name or payout")
+		}
+	case MerchantOpAddKey, MerchantOpRemoveKey:
+		if c.KeyHash == nil || *c.KeyHash == (common.Hash{}) {
+			return fmt.Errorf("%s needs a keyHash", c.Op)
+		}
+	case MerchantOpSetTier:
+		if c.Merchant == nil || c.Tier == nil {
+			return errors.New("setTier needs a merchant and tier")
+		}
+	case MerchantOpSetStatus:
+		if c.Merchant == nil {
+			return errors.New("setStatus needs a merchant")
+		}
+		if c.Status != MerchantStatusActive && c.Status != MerchantStatusSuspended {
+			return fmt.Errorf("status must be %s or %s", MerchantStatusActive, MerchantStatusSuspended)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	return nil
+}
+
+func validateMerchantName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxMerchantNameLength || !utf8.ValidString(name) {
+		return fmt.Errorf("name must be 1-%d bytes of UTF-8", MaxMerchantNameLength)
+	}
+	return nil
+}
+
+// MerchantCallData bouwt de tx data voor c.
+func MerchantCallData(c *MerchantCall) ([]byte, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(MerchantDataPrefix), body...), nil
+}
+
+// HashAPIKey: de hash die voor een API key in de registry staat.
+func HashAPIKey(key string) common.Hash {
+	return crypto.Keccak256Hash([]byte(key))
+}
+
+// HasAPIKey: key hoort bij m.
+func (m *Merchant) HasAPIKey(key string) bool {
+	h := HashAPIKey(key)
+	for _, k := range m.APIKeys {
+		if k.Hash == h {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------
+// Fee + payout lookup
+// ----------------------------------------------------------------
+
+// GetMerchant leest het record van addr uit st; nil als addr niet
+// geregistreerd is.
+func GetMerchant(st *state.State, addr common.Address) (*Merchant, error) {
+	raw, err := st.GetMerchant(addr)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var m Merchant
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("merchant %s: %w", addr.Hex(), err)
+	}
+	return &m, nil
+}
+
+// FeeBps: de payment fee van m onder rules. Een tier die (niet meer) in
+// de chain config staat valt terug op rules.PaymentFeeBps.
+func (m *Merchant) FeeBps(rules params.Rules) uint64 {
+	if bps, ok := rules.MerchantFeeTiers[m.Tier]; ok && m.Tier != "" {
+		return bps
+	}
+	return rules.PaymentFeeBps
+}
+
+// MerchantTerms geeft de payment fee en het payout adres voor betalingen
+// aan merchant. Zonder registry (of niet geregistreerd): PaymentFeeBps
+// en merchant zelf.
+func MerchantTerms(st *state.State, rules params.Rules, merchant common.Address) (uint64, common.Address, error) {
+	if !rules.IsMerchants {
+		return rules.PaymentFeeBps, merchant, nil
+	}
+	m, err := GetMerchant(st, merchant)
+	if err != nil {
+		return 0, common.Address{}, err
+	}
+	if m == nil {
+		return rules.PaymentFeeBps, merchant, nil
+	}
+	return m.FeeBps(rules), m.Payout, nil
+}
+
+// ----------------------------------------------------------------
+// State transition
+// ----------------------------------------------------------------
+
+// applyMerchantCall voert c uit namens from. Alle controles gebeuren
+// vóór de write.
+func (p *StateProcessor) applyMerchantCall(st *state.State, from common.Address, c *MerchantCall, rules params.Rules) (common.Address, error) {
+	target := from
+	if c.Op == MerchantOpSetTier || c.Op == MerchantOpSetStatus {
+		if from != p.chain.AdminAddr {
+			return common.Address{}, fmt.Errorf("%s is admin only", c.Op)
+		}
+		target = *c.Merchant
+	}
+
+	m, err := GetMerchant(st, target)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if c.Op == MerchantOpRegister {
+		if m != nil {
+			return common.Address{}, fmt.Errorf("merchant %s already registered", target.Hex())
+		}
+		m = &Merchant{
+			Address:      target,
+			Payout:       target,
+			Status:       MerchantStatusActive,
+			RegisteredAt: rules.Number,
+		}
+	} else if m == nil {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrMerchantNotFound, target.Hex())
+	}
+
+	switch c.Op {
+	case MerchantOpRegister, MerchantOpUpdate:
+		if c.Name != nil {
+			m.Name = strings.TrimSpace(*c.Name)
+		}
+		if c.Payout != nil {
+			m.Payout = *c.Payout
+		}
+	case MerchantOpAddKey:
+		for _, k := range m.APIKeys {
+			if k.Hash == *c.KeyHash {
+				return common.Address{}, errors.New("API key already registered")
+			}
+		}
+		if len(m.APIKeys) >= MaxMerchantAPIKeys {
+			return common.Address{}, fmt.Errorf("merchant already has %d API keys", MaxMerchantAPIKeys)
+		}
+		m.APIKeys = append(m.APIKeys, MerchantAPIKey{Hash: *c.KeyHash, Label: c.Label, AddedAt: rules.Number})
+	case MerchantOpRemoveKey:
+		keys := m.APIKeys[:0]
+		for _, k := range m.APIKeys {
+			if k.Hash != *c.KeyHash {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == len(m.APIKeys) {
+			return common.Address{}, errors.New("API key not found")
+		}
+		m.APIKeys = keys
+	case MerchantOpSetTier:
+		if _, ok := rules.MerchantFeeTiers[*c.Tier]; !ok && *c.Tier != "" {
+			return common.Address{}, fmt.Errorf("unknown fee tier %q", *c.Tier)
+		}
+		m.Tier = *c.Tier
+	case MerchantOpSetStatus:
+		m.Status = c.Status
+	}
+	m.UpdatedAt = rules.Number
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return target, st.SetMerchant(target, data)
+}
+
+// merchantUpdatedLog: log van de registry met de merchant en de op.
+func merchantUpdatedLog(merchant common.Address, op string) *types.Log {
+	return &types.Log{
+		Address: params.MerchantRegistryAddress,
+		Topics: []common.Hash{
+			MerchantUpdatedTopic,
+			common.BytesToHash(merchant.Bytes()),
+			common.BytesToHash(common.RightPadBytes([]byte(op), 32)),
+		},
+		Data: []byte{},
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseMerchantCall(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"register", `{"op":"register","name":"Shop"}`, true},
+		{"register with payout", `{"op":"register","name":"Shop","payout":"0x0000000000000000000000000000000000000b0b"}`, true},
+		{"register without name", `{"op":"register"}`, false},
+		{"blank name", `{"op":"register","name":"  "}`, false},
+		{"update payout", `{"op":"update","payout":"0x0000000000000000000000000000000000000b0b"}`, true},
+		{"update nothing", `{"op":"update"}`, false},
+		{"zero payout", `{"op":"update","payout":"0x0000000000000000000000000000000000000000"}`, false},
+		{"addKey without hash", `{"op":"addKey"}`, false},
+		{"setTier", `{"op":"setTier","merchant":"0x0000000000000000000000000000000000000a11","tier":"gold"}`, true},
+		{"setTier without merchant", `{"op":"setTier","tier":"gold"}`, false},
+		{"setStatus", `{"op":"setStatus","merchant":"0x0000000000000000000000000000000000000a11","status":"suspended"}`, true},
+		{"setTier with payout", `{"op":"setTier","merchant":"0x0000000000000000000000000000000000000a11","tier":"gold","payout":"0x0000000000000000000000000000000000000bad"}`, false},
+		{"setStatus with name", `{"op":"setStatus","merchant":"0x0000000000000000000000000000000000000a11","status":"suspended","name":"x"}`, false},
+		{"addKey with payout", `{"op":"addKey","keyHash":"0x0101010101010101010101010101010101010101010101010101010101010101","payout":"0x0000000000000000000000000000000000000bad"}`, false},
+		{"removeKey with name", `{"op":"removeKey","keyHash":"0x0101010101010101010101010101010101010101010101010101010101010101","name":"x"}`, false},
+		{"unknown status", `{"op":"setStatus","merchant":"0x0000000000000000000000000000000000000a11","status":"closed"}`, false},
+		{"unknown field", `{"op":"register","name":"Shop","owner":"x"}`, false},
+		{"trailing data", `{"op":"register","name":"Shop"}{}`, false},
+		{"unknown op", `{"op":"transfer"}`, false},
+	}
+	for _, tt := range tests {
+		_, err := ParseMerchantCall([]byte(MerchantDataPrefix + tt.data))
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidMerchantCall) {
+			t.Errorf("%s: error %v, want ErrInvalidMerchantCall", tt.name, err)
+		}
+	}
+	if _, err := ParseMerchantCall([]byte(`{"op":"register","name":"Shop"}`)); !errors.Is(err, ErrInvalidMerchantCall) {
+		t.Errorf("call without prefix: %v", err)
+	}
+}
+
+// Een reeks registry calls op één state; een afgewezen call laat het
+// record ongewijzigd.
+func TestApplyMerchantCall(t *testing.T) {
+	st, err := state.NewState(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	admin := common.HexToAddress("0xad")
+	merchant := common.HexToAddress("0xa11")
+	payout := common.HexToAddress("0xb0b")
+	p := &StateProcessor{chain: &blockchain.Blockchain{AdminAddr: admin}}
+	rules := params.Rules{Number: 1, IsMerchants: true, PaymentFeeBps: 250, MerchantFeeTiers: map[string]uint64{"gold": 50}}
+
+	name, other := "Shop", "Other"
+	gold, platinum := "gold", "platinum"
+	key := HashAPIKey("secret")
+
+	steps := []struct {
+		name   string
+		from   common.Address
+		call   *MerchantCall
+		err    string
+		feeBps uint64 // MerchantTerms na de stap
+		payout common.Address
+	}{
+		{"update before register", merchant, &MerchantCall{Op: MerchantOpUpdate, Name: &other}, "not registered", 250, merchant},
+		{"register", merchant, &MerchantCall{Op: MerchantOpRegister, Name: &name}, "", 250, merchant},
+		{"register twice", merchant, &MerchantCall{Op: MerchantOpRegister, Name: &other}, "already registered", 250, merchant},
+		{"update payout", merchant, &MerchantCall{Op: MerchantOpUpdate, Payout: &payout}, "", 250, payout},
+		{"setTier by the merchant", merchant, &MerchantCall{Op: MerchantOpSetTier, Merchant: &merchant, Tier: &gold}, "admin only", 250, payout},
+		{"unknown tier", admin, &MerchantCall{Op: MerchantOpSetTier, Merchant: &merchant, Tier: &platinum}, "unknown fee tier", 250, payout},
+		{"setTier", admin, &MerchantCall{Op: MerchantOpSetTier, Merchant: &merchant, Tier: &gold}, "", 50, payout},
+		{"addKey", merchant, &MerchantCall{Op: MerchantOpAddKey, KeyHash: &key, Label: "shop"}, "", 50, payout},
+		{"addKey twice", merchant, &MerchantCall{Op: MerchantOpAddKey, KeyHash: &key}, "already registered", 50, payout},
+		{"suspend", admin, &MerchantCall{Op: MerchantOpSetStatus, Merchant: &merchant, Status: MerchantStatusSuspended}, "", 50, payout},
+	}
+	for _, s := range steps {
+		before, _ := st.GetMerchant(merchant)
+		_, err := p.applyMerchantCall(st, s.from, s.call, rules)
+		if s.err == "" && err != nil || s.err != "" && (err == nil || !strings.Contains(err.Error(), s.err)) {
+			t.Fatalf("%s: error %v, want %q", s.name, err, s.err)
+		}
+		if after, _ := st.GetMerchant(merchant); s.err != "" && string(after) != string(before) {
+			t.Fatalf("%s: rejected call changed the record", s.name)
+		}
+		bps, to, err := MerchantTerms(st, rules, merchant)
+		if err != nil || bps != s.feeBps || to != s.payout {
+			t.Fatalf("%s: terms %d %s %v, want %d %s", s.name, bps, to.Hex(), err, s.feeBps, s.payout.Hex())
+		}
+	}
+
+	m, err := GetMerchant(st, merchant)
+	if err != nil || m == nil {
+		t.Fatalf("merchant: %v %v", m, err)
+	}
+	if m.Name != name || m.Status != MerchantStatusSuspended || !m.HasAPIKey("secret") || m.HasAPIKey("other") {
+		t.Fatalf("record %+v", m)
+	}
+
+	// Key weg; vóór de fork telt de registry niet mee
+	if _, err := p.applyMerchantCall(st, merchant, &MerchantCall{Op: MerchantOpRemoveKey, KeyHash: &key}, rules); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := GetMerchant(st, merchant); m.HasAPIKey("secret") {
+		t.Fatal("key still registered after removeKey")
+	}
+	if bps, to, _ := MerchantTerms(st, params.Rules{PaymentFeeBps: 250}, merchant); bps != 250 || to != merchant {
+		t.Fatalf("terms before the fork %d %s", bps, to.Hex())
+	}
+}
+
+// Een admin setTier kan het payout adres niet meer wijzigen, ook niet als
+// de call validate() zou omzeilen.
+func TestApplyMerchantCallPayoutOnlyOnUpdate(t *testing.T) {
+	st, err := state.NewState(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	admin := common.HexToAddress("0xad")
+	merchant := common.HexToAddress("0xa11")
+	payout := common.HexToAddress("0xb0b")
+	attacker := common.HexToAddress("0xbad")
+	p := &StateProcessor{chain: &blockchain.Blockchain{AdminAddr: admin}}
+	rules := params.Rules{Number: 1, IsMerchants: true, MerchantFeeTiers: map[string]uint64{"gold": 50}}
+
+	name := "Shop"
+	tier := "gold"
+	steps := []struct {
+		from common.Address
+		call *MerchantCall
+	}{
+		{merchant, &MerchantCall{Op: MerchantOpRegister, Name: &name}},
+		{merchant, &MerchantCall{Op: MerchantOpUpdate, Payout: &payout}},
+		{admin, &MerchantCall{Op: MerchantOpSetTier, Merchant: &merchant, Tier: &tier, Payout: &attacker}},
+		{admin, &MerchantCall{Op: MerchantOpSetStatus, Merchant: &merchant, Status: MerchantStatusActive, Payout: &attacker}},
+	}
+	for i, s := range steps {
+		if _, err := p.applyMerchantCall(st, s.from, s.call, rules); err != nil {
+			t.Fatalf("step %d (%s): %v", i, s.call.Op, err)
+		}
+	}
+
+	m, err := GetMerchant(st, merchant)
+	if err != nil || m == nil {
+		t.Fatalf("merchant: %v %v", m, err)
+	}
+	if m.Payout != payout {
+		t.Fatalf("payout %s, want %s", m.Payout.Hex(), payout.Hex())
+	}
+	if m.Tier != tier || m.Name != name {
+		t.Fatalf("tier %q name %q", m.Tier, m.Name)
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ----------------------------------------------------------------
+// Payment terms (vanaf de paymentTerms fork)
+// ----------------------------------------------------------------
+//
+// Intents zijn node-lokaal, dus vóór deze fork controleert alleen de
+// producer een GORR_PAY tx tegen het intent; een geïmporteerd block
+// verplaatst het geld hoe dan ook. Vanaf de fork tekent de payer de terms
+// van het intent mee in de marker:
+//
+//	GORR_PAY:<id>:<amount>:<expiry>    amount in wei van het token, expiry unix (0 = geen)
+//
+// en houdt de state per (merchant, id) een PaymentRecord bij. Elk block
+// weigert dan een betaling
+//
+//   - na de expiry (block time > expiry),
+//   - voor een intent dat al volledig betaald is (paid >= amount),
+//   - na een refund,
+//   - met andere terms, een ander token of een andere payer dan de
+//     eerste betaling.
+//
+// Een refund moet binnen het record blijven: bedrag ten hoogste netto
+// betaald min al terug, fee ten hoogste de betaalde fee min al terug.
+// Intents betaald vóór de fork hebben geen record; daarvoor kan alleen
+// nog zonder fee refund worden terugbetaald.
+//
+// Intrekken (CancelIntent) blijft node-lokaal: de producer weigert
+// betalingen voor een ingetrokken intent, consensus kent alleen expiry.
+
+var (
+	ErrInvalidPayment  = errors.New("invalid payment marker")
+	ErrPaymentRejected = errors.New("payment rejected")
+	ErrRefundRejected  = errors.New("refund rejected")
+)
+
+// PaymentTerms: wat de payer van het intent meetekent.
+type PaymentTerms struct {
+	Amount *big.Int // bruto bedrag van het intent
+	Expiry uint64   // unix, 0 = verloopt niet
+}
+
+// PaymentRecord is wat de state van een betaald intent weet.
+type PaymentRecord struct {
+	Token       string         `json:"token"`
+	Payer       common.Address `json:"payer"`
+	Amount      *big.Int       `json:"amount"`
+	Expiry      uint64         `json:"expiry,omitempty"`
+	Paid        *big.Int       `json:"paid"` // bruto, alle betalingen samen
+	Fee         *big.Int       `json:"fee"`
+	Refunded    *big.Int       `json:"refunded"`
+	FeeRefunded *big.Int       `json:"feeRefunded"`
+	CreatedAt   uint64         `json:"createdAt"` // block number
+	UpdatedAt   uint64         `json:"updatedAt"` // block number
+}
+
+// ParsePaymentMarker leest een GORR_PAY marker onder rules: vóór de fork
+// "GORR_PAY:<id>" (terms nil), daarna alleen de vorm met terms.
+func ParsePaymentMarker(rules params.Rules, data []byte) (uint64, *PaymentTerms, bool) {
+	if !rules.IsPaymentTerms {
+		id, ok := ParsePaymentIntentID(data)
+		return id, nil, ok
+	}
+	if !bytes.HasPrefix(data, []byte(PaymentDataPrefix)) {
+		return 0, nil, false
+	}
+	parts := strings.Split(string(data[len(PaymentDataPrefix):]), ":")
+	if len(parts) != 3 {
+		return 0, nil, false
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || id == 0 {
+		return 0, nil, false
+	}
+	amount, ok := new(big.Int).SetString(parts[1], 10)
+	if !ok || amount.Sign() <= 0 {
+		return 0, nil, false
+	}
+	expiry, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	return id, &PaymentTerms{Amount: amount, Expiry: expiry}, true
+}
+
+// PaymentData bouwt de marker; terms nil geeft de vorm van vóór de fork.
+func PaymentData(intentID uint64, terms *PaymentTerms) []byte {
+	if terms == nil {
+		return []byte(fmt.Sprintf("%s%d", PaymentDataPrefix, intentID))
+	}
+	return []byte(fmt.Sprintf("%s%d:%s:%d", PaymentDataPrefix, intentID, terms.Amount, terms.Expiry))
+}
+
+// GetPaymentRecord geeft het record van intent id bij merchant, of nil.
+func GetPaymentRecord(st *state.State, merchant common.Address, id uint64) (*PaymentRecord, error) {
+	raw, err := st.GetPaymentRecord(merchant, id)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var rec PaymentRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, fmt.Errorf("payment record %s/%d: %w", merchant.Hex(), id, err)
+	}
+	return &rec, nil
+}
+
+func putPaymentRecord(st *state.State, merchant common.Address, id uint64, rec *PaymentRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return st.SetPaymentRecord(merchant, id, data)
+}
+
+// checkPaymentTerms: de consensus regels voor betaling pay van payer op
+// blockTime tegen rec (nil = eerste betaling).
+func checkPaymentTerms(rec *PaymentRecord, pay *Payment, payer common.Address, blockTime uint64) error {
+	terms := pay.Terms
+	if terms == nil {
+		return fmt.Errorf("%w: intent %d without terms", ErrPaymentRejected, pay.IntentID)
+	}
+	if pay.Amount.Sign() <= 0 {
+		return fmt.Errorf("%w: intent %d: zero amount", ErrPaymentRejected, pay.IntentID)
+	}
+	if terms.Expiry > 0 && blockTime > terms.Expiry {
+		return fmt.Errorf("%w: intent %d expired at %d", ErrPaymentRejected, pay.IntentID, terms.Expiry)
+	}
+	if rec == nil {
+		return nil
+	}
+	switch {
+	case rec.Token != pay.Token:
+		return fmt.Errorf("%w: intent %d is paid in %s", ErrPaymentRejected, pay.IntentID, rec.Token)
+	case rec.Amount.Cmp(terms.Amount) != 0 || rec.Expiry != terms.Expiry:
+		return fmt.Errorf("%w: intent %d terms differ from the first payment", ErrPaymentRejected, pay.IntentID)
+	case rec.Payer != payer:
+		return fmt.Errorf("%w: intent %d is paid by %s", ErrPaymentRejected, pay.IntentID, rec.Payer.Hex())
+	case rec.Refunded.Sign() > 0 || rec.FeeRefunded.Sign() > 0:
+		return fmt.Errorf("%w: intent %d is refunded", ErrPaymentRejected, pay.IntentID)
+	case rec.Paid.Cmp(rec.Amount) >= 0:
+		return fmt.Errorf("%w: intent %d is already paid", ErrPaymentRejected, pay.IntentID)
+	}
+	return nil
+}
+
+// checkRefundTerms: refund r van merchant binnen wat rec aan netto en fee
+// heeft ontvangen. Zonder record (betaald vóór de fork) geen fee refund.
+func checkRefundTerms(rec *PaymentRecord, r *Refund) error {
+	if rec == nil {
+		if r.Fee.Sign() > 0 {
+			return fmt.Errorf("%w: intent %d has no payment record for a fee refund", ErrRefundRejected, r.IntentID)
+		}
+		return nil
+	}
+	if rec.Token != r.Token || rec.Payer != r.Payer {
+		return fmt.Errorf("%w: intent %d was paid in %s by %s", ErrRefundRejected, r.IntentID, rec.Token, rec.Payer.Hex())
+	}
+	net := new(big.Int).Sub(rec.Paid, rec.Fee)
+	net.Sub(net, rec.Refunded)
+	if r.Amount.Cmp(net) > 0 {
+		return fmt.Errorf("%w: intent %d: refund %s above refundable %s", ErrRefundRejected, r.IntentID, r.Amount, net)
+	}
+	fee := new(big.Int).Sub(rec.Fee, rec.FeeRefunded)
+	if r.Fee.Cmp(fee) > 0 {
+		return fmt.Errorf("%w: intent %d: fee refund %s above refundable fee %s", ErrRefundRejected, r.IntentID, r.Fee, fee)
+	}
+	return nil
+}
+
+// isMalformedPayment: vanaf de fork is data die met GORR_PAY begint maar
+// geen geldige marker is een fout, geen gewone transfer met data.
+func isMalformedPayment(rules params.Rules, tx *types.Transaction) bool {
+	if !rules.IsPaymentTerms || IsUSDCcCall(rules, tx) || !bytes.HasPrefix(tx.Data, []byte(PaymentDataPrefix)) {
+		return false
+	}
+	_, _, ok := ParsePaymentMarker(rules, tx.Data)
+	return !ok
+}
+
+// ----------------------------------------------------------------
+// State transition
+// ----------------------------------------------------------------
+
+// checkPayment: record van de betaling in tx, of nil als tx geen payment
+// is of de fork nog niet actief is. Geeft een fout vóórdat er iets
+// verplaatst is.
+func checkPayment(st *state.State, header *types.Header, from common.Address, rules params.Rules, tx *types.Transaction) (*Payment, *PaymentRecord, error) {
+	if !rules.IsPaymentTerms {
+		return nil, nil, nil
+	}
+	if isMalformedPayment(rules, tx) {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidPayment, tx.Data)
+	}
+	pay, ok := PaymentOf(rules, tx)
+	if !ok {
+		return nil, nil, nil
+	}
+	rec, err := GetPaymentRecord(st, pay.Merchant, pay.IntentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkPaymentTerms(rec, pay, from, header.Time); err != nil {
+		return nil, nil, err
+	}
+	if rec == nil {
+		rec = &PaymentRecord{
+			Token:       pay.Token,
+			Payer:       from,
+			Amount:      new(big.Int).Set(pay.Terms.Amount),
+			Expiry:      pay.Terms.Expiry,
+			Paid:        new(big.Int),
+			Fee:         new(big.Int),
+			Refunded:    new(big.Int),
+			FeeRefunded: new(big.Int),
+			CreatedAt:   header.Number,
+		}
+	}
+	return pay, rec, nil
+}
+
+// recordPayment: betaling pay met fee bij rec optellen en opslaan.
+func recordPayment(st *state.State, header *types.Header, pay *Payment, rec *PaymentRecord, fee *big.Int) error {
+	rec.Paid.Add(rec.Paid, pay.Amount)
+	rec.Fee.Add(rec.Fee, fee)
+	rec.UpdatedAt = header.Number
+	return putPaymentRecord(st, pay.Merchant, pay.IntentID, rec)
+}
+
+// checkRefund: record van de refund van merchant, of nil als er geen
+// record is (of de fork nog niet actief is).
+func checkRefund(st *state.State, merchant common.Address, rules params.Rules, r *Refund) (*PaymentRecord, error) {
+	if !rules.IsPaymentTerms {
+		return nil, nil
+	}
+	rec, err := GetPaymentRecord(st, merchant, r.IntentID)
+	if err != nil {
+		return nil, err
+	}
+	return rec, checkRefundTerms(rec, r)
+}
+
+// recordRefund: refund r bij rec optellen en opslaan.
+func recordRefund(st *state.State, header *types.Header, merchant common.Address, r *Refund, rec *PaymentRecord) error {
+	rec.Refunded.Add(rec.Refunded, r.Amount)
+	rec.FeeRefunded.Add(rec.FeeRefunded, r.Fee)
+	rec.UpdatedAt = header.Number
+	return putPaymentRecord(st, merchant, r.IntentID, rec)
+}
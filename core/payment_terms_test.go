@@ -0,0 +1,215 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestParsePaymentMarker(t *testing.T) {
+	before := params.Rules{}
+	after := params.Rules{IsPaymentTerms: true}
+	tests := []struct {
+		name   string
+		rules  params.Rules
+		data   string
+		ok     bool
+		id     uint64
+		amount int64 // 0 = geen terms
+		expiry uint64
+	}{
+		{"legacy", before, "GORR_PAY:7", true, 7, 0, 0},
+		{"terms before the fork", before, "GORR_PAY:7:1000:0", false, 0, 0, 0},
+		{"terms", after, "GORR_PAY:7:1000:1700000000", true, 7, 1000, 1700000000},
+		{"terms without expiry", after, "GORR_PAY:7:1000:0", true, 7, 1000, 0},
+		{"legacy after the fork", after, "GORR_PAY:7", false, 0, 0, 0},
+		{"zero amount", after, "GORR_PAY:7:0:0", false, 0, 0, 0},
+		{"negative amount", after, "GORR_PAY:7:-1:0", false, 0, 0, 0},
+		{"id 0", after, "GORR_PAY:0:1000:0", false, 0, 0, 0},
+		{"extra field", after, "GORR_PAY:7:1000:0:1", false, 0, 0, 0},
+		{"no marker", after, "hello", false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		id, terms, ok := ParsePaymentMarker(tt.rules, []byte(tt.data))
+		if ok != tt.ok || id != tt.id {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, id, ok, tt.id, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if tt.amount == 0 {
+			if terms != nil {
+				t.Errorf("%s: unexpected terms %+v", tt.name, terms)
+			}
+			continue
+		}
+		if terms == nil || terms.Amount.Int64() != tt.amount || terms.Expiry != tt.expiry {
+			t.Errorf("%s: terms %+v, want %d/%d", tt.name, terms, tt.amount, tt.expiry)
+			continue
+		}
+		if got := string(PaymentData(id, terms)); got != tt.data {
+			t.Errorf("%s: PaymentData = %q", tt.name, got)
+		}
+	}
+}
+
+// Een geïmporteerd block loopt door dezelfde ApplyTransaction: elke stap
+// hieronder is wat een block van een peer zou mogen (of niet).
+func TestPaymentTermsConsensus(t *testing.T) {
+	payerKey, otherKey, merchantKey := mustKey(t), mustKey(t), mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	other := crypto.PubkeyToAddress(otherKey.PublicKey)
+	merchant := crypto.PubkeyToAddress(merchantKey.PublicKey)
+
+	cfg := params.GorrillazzChainConfig()
+	zero := uint64(0)
+	cfg.RefundsBlock, cfg.RefundFees, cfg.PaymentTermsBlock = &zero, true, &zero
+	e := newTxEnv(t, cfg, payer, other, merchant)
+
+	steps := []struct {
+		name  string
+		key   *ecdsa.PrivateKey
+		to    common.Address
+		value int64
+		data  string
+		time  uint64
+		want  error // nil = geaccepteerd
+	}{
+		{"marker without terms", payerKey, merchant, 400, "GORR_PAY:1", 50, ErrInvalidPayment},
+		{"malformed marker", payerKey, merchant, 400, "GORR_PAY:1:x:0", 50, ErrInvalidPayment},
+		{"first part", payerKey, merchant, 400, "GORR_PAY:1:1000:100", 50, nil},
+		{"other payer", otherKey, merchant, 600, "GORR_PAY:1:1000:100", 60, ErrPaymentRejected},
+		{"other terms", payerKey, merchant, 600, "GORR_PAY:1:2000:100", 60, ErrPaymentRejected},
+		{"expired", payerKey, merchant, 600, "GORR_PAY:1:1000:100", 101, ErrPaymentRejected},
+		{"overpaid rest", payerKey, merchant, 700, "GORR_PAY:1:1000:100", 100, nil},
+		{"already paid", payerKey, merchant, 1, "GORR_PAY:1:1000:100", 100, ErrPaymentRejected},
+		{"fee refund above paid fee", merchantKey, payer, 100, "GORR_REFUND:1:28", 110, ErrRefundRejected},
+		{"refund above net", merchantKey, payer, 1074, "GORR_REFUND:1", 110, ErrRefundRejected},
+		{"refund to another address", merchantKey, other, 100, "GORR_REFUND:1", 110, ErrRefundRejected},
+		{"refund with fee", merchantKey, payer, 100, "GORR_REFUND:1:27", 110, nil},
+		{"fee refund twice", merchantKey, payer, 100, "GORR_REFUND:1:1", 110, ErrRefundRejected},
+
+		{"intent 2 part", payerKey, merchant, 100, "GORR_PAY:2:1000:0", 120, nil},
+		{"intent 2 refund", merchantKey, payer, 50, "GORR_REFUND:2", 120, nil},
+		{"intent 2 after refund", payerKey, merchant, 900, "GORR_PAY:2:1000:0", 130, ErrPaymentRejected},
+
+		// Geen record (betaald vóór de fork): alleen zonder fee refund
+		{"no record fee refund", merchantKey, payer, 10, "GORR_REFUND:3:1", 140, ErrRefundRejected},
+		{"no record refund", merchantKey, payer, 10, "GORR_REFUND:3", 140, nil},
+	}
+	for i, s := range steps {
+		from := crypto.PubkeyToAddress(s.key.PublicKey)
+		before := e.balance(from)
+		err := e.apply(s.key, s.to, s.value, s.data, uint64(i+1), s.time)
+		if s.want == nil {
+			if err != nil {
+				t.Fatalf("%s: %v", s.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, s.want) {
+			t.Fatalf("%s: error %v, want %v", s.name, err, s.want)
+		}
+		if after := e.balance(from); after != before {
+			t.Fatalf("%s: rejected tx moved funds (%d → %d)", s.name, before, after)
+		}
+	}
+
+	// 400 + 700 bruto, fee 2.5%: 10 + 17
+	rec, err := GetPaymentRecord(e.st, merchant, 1)
+	if err != nil || rec == nil {
+		t.Fatalf("record: %v %v", rec, err)
+	}
+	want := PaymentRecord{Token: nativeToken, Payer: payer, Amount: big.NewInt(1000), Expiry: 100,
+		Paid: big.NewInt(1100), Fee: big.NewInt(27), Refunded: big.NewInt(100), FeeRefunded: big.NewInt(27)}
+	if rec.Token != want.Token || rec.Payer != want.Payer || rec.Amount.Cmp(want.Amount) != 0 || rec.Expiry != want.Expiry ||
+		rec.Paid.Cmp(want.Paid) != 0 || rec.Fee.Cmp(want.Fee) != 0 ||
+		rec.Refunded.Cmp(want.Refunded) != 0 || rec.FeeRefunded.Cmp(want.FeeRefunded) != 0 {
+		t.Fatalf("record %+v, want %+v", rec, want)
+	}
+	if rec, _ := GetPaymentRecord(e.st, merchant, 3); rec != nil {
+		t.Fatalf("refund created a payment record: %+v", rec)
+	}
+}
+
+func TestPaymentTermsBeforeFork(t *testing.T) {
+	payerKey := mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := common.HexToAddress("0xa11")
+
+	cfg := params.GorrillazzChainConfig()
+	fork := uint64(10)
+	cfg.PaymentTermsBlock = &fork
+	e := newTxEnv(t, cfg, payer)
+
+	// Vóór de fork: legacy marker is een payment (met fee), de terms vorm
+	// een gewone transfer; geen records
+	if err := e.apply(payerKey, merchant, 1000, "GORR_PAY:1", 1, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.balance(merchant); got != 975 {
+		t.Fatalf("merchant has %d after a legacy payment, want 975", got)
+	}
+	if err := e.apply(payerKey, merchant, 1000, "GORR_PAY:1:1000:0", 2, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.balance(merchant); got != 1975 {
+		t.Fatalf("merchant has %d after a plain transfer, want 1975", got)
+	}
+	root, err := e.st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := GetPaymentRecord(e.st, merchant, 1); rec != nil {
+		t.Fatalf("record before the fork: %+v", rec)
+	}
+
+	// Vanaf de fork telt het record mee in de root
+	if err := e.apply(payerKey, merchant, 1000, "GORR_PAY:2:1000:0", fork, 50); err != nil {
+		t.Fatal(err)
+	}
+	after, err := e.st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root == after {
+		t.Fatal("payment record not in the state root")
+	}
+	if err := e.st.Put("payment:x", []byte("1")); err == nil {
+		t.Fatal("Put accepted a payment record key")
+	}
+}
+
+func TestTxIntrinsicGasPaymentTerms(t *testing.T) {
+	merchant := common.HexToAddress("0xa11")
+	data := []byte("GORR_PAY:1:1000:0")
+	base, err := IntrinsicGas(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		rules params.Rules
+		want  uint64
+	}{
+		{"before the fork", params.Rules{}, base},
+		{"after the fork", params.Rules{IsPaymentTerms: true}, base + TxPaymentGas},
+	}
+	for _, tt := range tests {
+		if got, _ := TxIntrinsicGas(tt.rules, &merchant, data); got != tt.want {
+			t.Errorf("%s: gas %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	rules := params.Rules{IsUSDCc: true, IsPaymentTerms: true}
+	usdcc := USDCcPaymentData(merchant, big.NewInt(1000), 1, &PaymentTerms{Amount: big.NewInt(1000)})
+	base, _ = IntrinsicGas(usdcc)
+	if got, _ := TxIntrinsicGas(rules, &params.USDCcTokenAddress, usdcc); got != base+TxPaymentGas {
+		t.Errorf("USDCc: gas %d, want %d", got, base+TxPaymentGas)
+	}
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// Refunds (vanaf de refunds fork)
+// ----------------------------------------------------------------
+//
+// De merchant stort terug met een gewone transfer naar de payer, met als
+// marker "GORR_REFUND:<id>" (GORR: tx.Data, USDCc: achter de transfer
+// call). "GORR_REFUND:<id>:<fee>" geeft daarnaast <fee> wei uit de
+// treasury terug aan de payer, als de chain config RefundFees aan heeft.
+//
+// Net als bij GORR_PAY kent consensus het intent niet: de producer
+// controleert sender, payer en bedragen tegen het (node-lokale) intent
+// voordat de tx in een block komt. Vanaf de paymentTerms fork moet de
+// refund ook binnen het PaymentRecord passen (core/payment_terms.go).
+
+const RefundDataPrefix = "GORR_REFUND:"
+
+var (
+	// PaymentRefunded(uint256 indexed intentId, address indexed payer, uint256 amount, uint256 fee)
+	PaymentRefundedTopic = crypto.Keccak256Hash([]byte("PaymentRefunded(uint256,address,uint256,uint256)"))
+
+	ErrRefundFeesDisabled = errors.New("fee refunds are disabled")
+)
+
+// Refund beschrijft een GORR_REFUND tx. Amount komt van de merchant (de
+// sender), Fee uit de treasury; beide gaan naar Payer.
+type Refund struct {
+	IntentID uint64
+	Token    string // "GORR" of "USDCc"
+	Payer    common.Address
+	Amount   *big.Int
+	Fee      *big.Int
+}
+
+// ParseRefundMarker verwacht "GORR_REFUND:<id>" of "GORR_REFUND:<id>:<fee>".
+func ParseRefundMarker(data []byte) (uint64, *big.Int, bool) {
+	if !bytes.HasPrefix(data, []byte(RefundDataPrefix)) {
+		return 0, nil, false
+	}
+	idStr, feeStr, hasFee := strings.Cut(string(data[len(RefundDataPrefix):]), ":")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil || id == 0 {
+		return 0, nil, false
+	}
+	fee := new(big.Int)
+	if hasFee {
+		if _, ok := fee.SetString(feeStr, 10); !ok || fee.Sign() < 0 {
+			return 0, nil, false
+		}
+	}
+	return id, fee, true
+}
+
+// RefundData bouwt de marker; fee nil of 0 laat het fee deel weg.
+func RefundData(intentID uint64, fee *big.Int) []byte {
+	if fee == nil || fee.Sign() == 0 {
+		return []byte(fmt.Sprintf("%s%d", RefundDataPrefix, intentID))
+	}
+	return []byte(fmt.Sprintf("%s%d:%s", RefundDataPrefix, intentID, fee))
+}
+
+// RefundOf geeft de refund in tx onder rules, of false als tx geen
+// (geldige) refund tx is.
+func RefundOf(rules params.Rules, tx *types.Transaction) (*Refund, bool) {
+	if !rules.IsRefunds || tx == nil || tx.To == nil {
+		return nil, false
+	}
+	if IsUSDCcCall(rules, tx) {
+		t, err := ParseUSDCcTransfer(rules, tx.Data)
+		if err != nil || !t.IsRefund {
+			return nil, false
+		}
+		return &Refund{IntentID: t.IntentID, Token: usdccToken, Payer: t.To, Amount: t.Amount, Fee: t.RefundFee}, true
+	}
+	id, fee, ok := ParseRefundMarker(tx.Data)
+	if !ok {
+		return nil, false
+	}
+	return &Refund{IntentID: id, Token: nativeToken, Payer: *tx.To, Amount: tx.Value, Fee: fee}, true
+}
+
+// ----------------------------------------------------------------
+// State transition
+// ----------------------------------------------------------------
+
+// applyRefund: Amount van de merchant en Fee van de treasury naar de payer,
+// in het token van de refund. Saldi worden vooraf gecontroleerd zodat een
+// mislukte refund de overlay niet half wijzigt.
+func (p *StateProcessor) applyRefund(st *state.State, from common.Address, r *Refund, rules params.Rules) error {
+	balanceOf, transfer := st.GetBalance, applyTransfer
+	if r.Token == usdccToken {
+		balanceOf, transfer = st.GetUSDCcBalance, applyUSDCcTransfer
+	}
+
+	// Voor GORR staat Amount al in tx.Value (checkGasFunds / applyTransfer)
+	bal, err := balanceOf(from)
+	if err != nil {
+		return err
+	}
+	if bal.Cmp(r.Amount) < 0 {
+		return fmt.Errorf("insufficient %s balance", r.Token)
+	}
+	if r.Fee.Sign() == 0 {
+		return transfer(st, from, r.Payer, r.Amount)
+	}
+
+	if !rules.RefundFees {
+		return ErrRefundFeesDisabled
+	}
+	treasury, err := p.treasury()
+	if err != nil {
+		return err
+	}
+	tBal, err := balanceOf(treasury)
+	if err != nil {
+		return err
+	}
+	need := new(big.Int).Set(r.Fee)
+	if treasury == from {
+		need.Add(need, r.Amount)
+	}
+	if tBal.Cmp(need) < 0 {
+		return fmt.Errorf("treasury has insufficient %s for fee refund", r.Token)
+	}
+
+	if err := transfer(st, from, r.Payer, r.Amount); err != nil {
+		return err
+	}
+	return transfer(st, treasury, r.Payer, r.Fee)
+}
+
+// paymentRefundedLog: tegenhanger van paymentReceivedLog, ook met de
+// merchant als "contract" adres.
+func paymentRefundedLog(merchant, payer common.Address, intentID uint64, amount, fee *big.Int) *types.Log {
+	data := make([]byte, 0, 64)
+	data = append(data, common.BigToHash(amount).Bytes()...)
+	data = append(data, common.BigToHash(fee).Bytes()...)
+	return &types.Log{
+		Address: merchant,
+		Topics: []common.Hash{
+			PaymentRefundedTopic,
+			common.BigToHash(new(big.Int).SetUint64(intentID)),
+			common.BytesToHash(payer.Bytes()),
+		},
+		Data: data,
+	}
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// txEnv: een StateProcessor op een losse state, met de treasury en de
+// funded adressen op 100_000 wei.
+type txEnv struct {
+	t     *testing.T
+	p     *StateProcessor
+	st    *state.State
+	nonce map[common.Address]uint64
+}
+
+func newTxEnv(t *testing.T, cfg *params.ChainConfig, funded ...common.Address) *txEnv {
+	t.Helper()
+	st, err := state.NewState(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	treasury := common.HexToAddress("0x7e")
+	for _, addr := range append(funded, treasury) {
+		if err := st.SetBalance(addr, big.NewInt(100_000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &txEnv{
+		t:     t,
+		p:     NewStateProcessor(&blockchain.Blockchain{TreasuryAddr: treasury}, cfg),
+		st:    st,
+		nonce: map[common.Address]uint64{},
+	}
+}
+
+// apply: GORR tx van key naar to in block number op blockTime.
+func (e *txEnv) apply(key *ecdsa.PrivateKey, to common.Address, value int64, data string, number, blockTime uint64) error {
+	e.t.Helper()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+		Nonce:    e.nonce[from],
+		To:       &to,
+		Value:    big.NewInt(value),
+		Gas:      100_000,
+		GasPrice: new(big.Int),
+		Data:     []byte(data),
+	}), gethtypes.HomesteadSigner{}, key)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	var logIndex, usedGas uint64
+	gp := GasPool(1_000_000)
+	header := &types.Header{Number: number, Time: blockTime}
+	if _, err := e.p.ApplyTransaction(e.st, header, types.FromGeth(gtx), 0, &logIndex, &gp, &usedGas); err != nil {
+		return err
+	}
+	e.nonce[from]++
+	return nil
+}
+
+func (e *txEnv) balance(addr common.Address) int64 {
+	e.t.Helper()
+	bal, err := e.st.GetBalance(addr)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return bal.Int64()
+}
+
+// payoutSum: som van de payouts van source.
+func payoutSum(rewards *types.BlockRewards, source string) *big.Int {
+	sum := new(big.Int)
+	for _, p := range rewards.Payouts {
+		if p.Source == source {
+			sum.Add(sum, p.Amount)
+		}
+	}
+	return sum
+}
+
+func TestPaymentSplit(t *testing.T) {
+	for _, bps := range []uint64{0, 1, 100, 250, 9999, 10000} {
+		for _, value := range []int64{0, 1, 39, 10001, 1_000_000_007} {
+			fee, net := PaymentSplit(bps, big.NewInt(value))
+			if new(big.Int).Add(fee, net).Int64() != value || fee.Sign() < 0 || net.Sign() < 0 {
+				t.Errorf("%d bps of %d: fee %s net %s", bps, value, fee, net)
+			}
+			if want := value * int64(bps) / 10000; fee.Int64() != want {
+				t.Errorf("%d bps of %d: fee %s, want %d", bps, value, fee, want)
+			}
+		}
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	treasury := common.HexToAddress("0x7e")
+	coinbase := common.HexToAddress("0xc0")
+
+	tests := []struct {
+		name     string
+		split    params.Split
+		coinbase common.Address
+		amount   int64
+		producer int64
+		treasury int64
+		burn     int64
+	}{
+		{"all to the treasury", params.Split{TreasuryBps: 10000}, coinbase, 999, 0, 999, 0},
+		{"three ways", params.Split{ProducerBps: 2000, TreasuryBps: 5000, BurnBps: 3000}, coinbase, 1000, 200, 500, 300},
+		{"rounding to the treasury", params.Split{ProducerBps: 3333, TreasuryBps: 3334, BurnBps: 3333}, coinbase, 10, 3, 4, 3},
+		{"one wei", params.Split{ProducerBps: 5000, BurnBps: 5000}, coinbase, 1, 0, 1, 0},
+		{"no coinbase", params.Split{ProducerBps: 7000, TreasuryBps: 1000, BurnBps: 2000}, common.Address{}, 1000, 0, 800, 200},
+		{"nothing to split", params.Split{ProducerBps: 10000}, coinbase, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		st, err := state.NewState(filepath.Join(t.TempDir(), "state"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewards := &types.BlockRewards{Coinbase: tt.coinbase, Burned: new(big.Int), Payouts: []*types.Payout{}}
+		if err := distribute(st, rewards, types.PayoutSourceFees, big.NewInt(tt.amount), tt.split, treasury); err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[string]int64{}
+		for _, p := range rewards.Payouts {
+			if p.Amount.Sign() <= 0 {
+				t.Errorf("%s: payout of %s recorded", tt.name, p.Amount)
+			}
+			got[p.Role] += p.Amount.Int64()
+		}
+		if got[types.PayoutRoleProducer] != tt.producer || got[types.PayoutRoleTreasury] != tt.treasury || got[types.PayoutRoleBurn] != tt.burn {
+			t.Errorf("%s: payouts %v, want %d/%d/%d", tt.name, got, tt.producer, tt.treasury, tt.burn)
+		}
+		if sum := payoutSum(rewards, types.PayoutSourceFees); sum.Int64() != tt.amount {
+			t.Errorf("%s: payouts add up to %s, want %d", tt.name, sum, tt.amount)
+		}
+
+		// Wat niet verbrand is, staat op een balance
+		cb, _ := st.GetBalance(coinbase)
+		tr, _ := st.GetBalance(treasury)
+		if cb.Int64()+tr.Int64()+rewards.Burned.Int64() != tt.amount || rewards.Burned.Int64() != tt.burn {
+			t.Errorf("%s: coinbase %s treasury %s burned %s", tt.name, cb, tr, rewards.Burned)
+		}
+		st.Close()
+	}
+}
+
+func TestBlockRewardAt(t *testing.T) {
+	cfg := params.GorrillazzChainConfig()
+	cfg.RewardsBlock = at(100)
+	cfg.BlockReward = big.NewInt(1000)
+	cfg.RewardHalvingInterval = 10
+
+	tests := []struct {
+		number uint64
+		want   int64
+	}{
+		{0, 0},
+		{99, 0},
+		{100, 1000},
+		{109, 1000},
+		{110, 500},
+		{129, 250},
+		{190, 1}, // 1000 >> 9
+		{200, 0}, // 1000 >> 10
+		{100 + 10*300, 0},
+	}
+	for _, tt := range tests {
+		if got := cfg.BlockRewardAt(tt.number); got.Int64() != tt.want {
+			t.Errorf("block %d: reward %s, want %d", tt.number, got, tt.want)
+		}
+	}
+
+	cfg.RewardHalvingInterval = 0
+	if got := cfg.BlockRewardAt(1 << 40); got.Int64() != 1000 {
+		t.Errorf("without halvings: reward %s, want 1000", got)
+	}
+}
+
+func at(n uint64) *uint64 { return &n }
+
+// Een payment in een block na de rewards fork: wat de payer kwijt is plus
+// de issuance komt precies terug bij merchant, producer, treasury en burn.
+func TestFinalizeKeepsSupply(t *testing.T) {
+	payerKey := mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := common.HexToAddress("0xb0b")
+	coinbase := common.HexToAddress("0xc0")
+	treasury := common.HexToAddress("0x7e")
+
+	cfg := params.GorrillazzChainConfig()
+	cfg.USDCcBlock = at(0)
+	cfg.RewardsBlock = at(1)
+	cfg.FeeSplit = params.Split{ProducerBps: 2000, TreasuryBps: 5000, BurnBps: 3000}
+	cfg.BlockReward = big.NewInt(1001)
+	cfg.RewardSplit = params.Split{ProducerBps: 5000, TreasuryBps: 5000}
+	e := newTxEnv(t, cfg, payer)
+	if err := e.st.SetUSDCcBalance(payer, big.NewInt(100_000)); err != nil {
+		t.Fatal(err)
+	}
+
+	usdcc := func(addr common.Address) int64 {
+		bal, err := e.st.GetUSDCcBalance(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bal.Int64()
+	}
+	total := func() int64 {
+		return e.balance(payer) + e.balance(merchant) + e.balance(coinbase) + e.balance(treasury)
+	}
+	totalUSDCc := func() int64 {
+		return usdcc(payer) + usdcc(merchant) + usdcc(coinbase) + usdcc(treasury)
+	}
+	sign := func(nonce uint64, to common.Address, value int64, data []byte) *types.Transaction {
+		gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+			Nonce: nonce, To: &to, Value: big.NewInt(value), Gas: 100_000, GasPrice: new(big.Int), Data: data,
+		}), gethtypes.HomesteadSigner{}, payerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.FromGeth(gtx)
+	}
+
+	tests := []struct {
+		number   uint64
+		fee      int64 // receipt.Fee (GORR) en receipt.FeeUSDCc van de payments
+		issuance int64
+	}{
+		{0, 250, 0}, // vóór de fork: fee direct naar de treasury, geen records
+		{1, 250, 1001},
+		{2, 250, 1001},
+	}
+	for i, tt := range tests {
+		before, beforeUSDCc, treasuryUSDCc := total(), totalUSDCc(), usdcc(treasury)
+		header := &types.Header{Number: tt.number, Time: 1000 + tt.number, Coinbase: coinbase}
+		txs := []*types.Transaction{
+			sign(uint64(2*i), merchant, 10_001, []byte("GORR_PAY:7")),
+			sign(uint64(2*i+1), params.USDCcTokenAddress, 0, USDCcPaymentData(merchant, big.NewInt(10_001), 8, nil)),
+		}
+		var (
+			receipts          []*types.Receipt
+			logIndex, usedGas uint64
+		)
+		gp := GasPool(1_000_000)
+		for j, tx := range txs {
+			receipt, err := e.p.ApplyTransaction(e.st, header, tx, uint64(j), &logIndex, &gp, &usedGas)
+			if err != nil {
+				t.Fatal(err)
+			}
+			receipts = append(receipts, receipt)
+		}
+		if receipts[0].Fee == nil || receipts[0].Fee.Int64() != tt.fee {
+			t.Fatalf("block %d: receipt fee %v, want %d", tt.number, receipts[0].Fee, tt.fee)
+		}
+		if receipts[1].FeeUSDCc == nil || receipts[1].FeeUSDCc.Int64() != tt.fee {
+			t.Fatalf("block %d: receipt USDCc fee %v, want %d", tt.number, receipts[1].FeeUSDCc, tt.fee)
+		}
+
+		rewards, err := e.p.Finalize(e.st, header, receipts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.number == 0 {
+			if rewards != nil || total() != before || totalUSDCc() != beforeUSDCc {
+				t.Fatalf("block 0: rewards %+v, supply %d → %d, USDCc %d → %d", rewards, before, total(), beforeUSDCc, totalUSDCc())
+			}
+			if got := usdcc(treasury) - treasuryUSDCc; got != tt.fee {
+				t.Fatalf("block 0: treasury got %d USDCc, want the fee %d", got, tt.fee)
+			}
+			continue
+		}
+		if rewards.Fees.Int64() != tt.fee || rewards.Issuance.Int64() != tt.issuance {
+			t.Fatalf("block %d: fees %s issuance %s", tt.number, rewards.Fees, rewards.Issuance)
+		}
+		if payoutSum(rewards, types.PayoutSourceFees).Int64() != tt.fee || payoutSum(rewards, types.PayoutSourceIssuance).Int64() != tt.issuance {
+			t.Fatalf("block %d: payouts %+v do not add up", tt.number, rewards.Payouts)
+		}
+		if got, want := total(), before+tt.issuance-rewards.Burned.Int64(); got != want {
+			t.Fatalf("block %d: supply %d, want %d (burned %s)", tt.number, got, want, rewards.Burned)
+		}
+
+		// USDCc fees volgen dezelfde FeeSplit, in USDCc
+		if rewards.FeesUSDCc == nil || rewards.FeesUSDCc.Int64() != tt.fee || payoutSum(rewards, types.PayoutSourceFeesUSDCc).Int64() != tt.fee {
+			t.Fatalf("block %d: USDCc fees %v, payouts %+v", tt.number, rewards.FeesUSDCc, rewards.Payouts)
+		}
+		if got, want := totalUSDCc(), beforeUSDCc-rewards.BurnedUSDCc.Int64(); got != want || rewards.BurnedUSDCc.Int64() != tt.fee*3/10 {
+			t.Fatalf("block %d: USDCc supply %d, want %d (burned %s)", tt.number, got, want, rewards.BurnedUSDCc)
+		}
+		if got, want := usdcc(treasury)-treasuryUSDCc, tt.fee-tt.fee*2/10-tt.fee*3/10; got != want {
+			t.Fatalf("block %d: treasury got %d USDCc, want %d", tt.number, got, want)
+		}
+	}
+}
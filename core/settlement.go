@@ -0,0 +1,75 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ----------------------------------------------------------------
+// Settlements (vanaf de settlements fork)
+// ----------------------------------------------------------------
+//
+// Een settlement run (modules/payment_gateway/settlement.go) wordt in één
+// gewone transfer van de merchant naar zijn payout adres uitbetaald, met
+// als marker "GORR_SETTLE:<id>" (GORR: tx.Data, USDCc: achter de transfer
+// call). Voor consensus is het een transfer als elke andere; de producer
+// controleert bedrag en adressen tegen de (node-lokale) run.
+
+const SettlementDataPrefix = "GORR_SETTLE:"
+
+// SettlementTransfer beschrijft een GORR_SETTLE tx: Amount in Token van de
+// sender naar Payout.
+type SettlementTransfer struct {
+	SettlementID uint64
+	Token        string // "GORR" of "USDCc"
+	Payout       common.Address
+	Amount       *big.Int
+}
+
+// ParseSettlementMarker verwacht "GORR_SETTLE:<id>".
+func ParseSettlementMarker(data []byte) (uint64, bool) {
+	if !bytes.HasPrefix(data, []byte(SettlementDataPrefix)) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(string(data[len(SettlementDataPrefix):]), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// SettlementData bouwt de marker.
+func SettlementData(id uint64) []byte {
+	return []byte(fmt.Sprintf("%s%d", SettlementDataPrefix, id))
+}
+
+// USDCcSettlementData: transfer naar het payout adres met GORR_SETTLE marker.
+func USDCcSettlementData(payout common.Address, amount *big.Int, id uint64) []byte {
+	return append(usdccCallData(payout, amount), SettlementData(id)...)
+}
+
+// SettlementOf geeft de settlement transfer in tx onder rules, of false
+// als tx geen settlement tx is.
+func SettlementOf(rules params.Rules, tx *types.Transaction) (*SettlementTransfer, bool) {
+	if !rules.IsSettlements || tx == nil || tx.To == nil {
+		return nil, false
+	}
+	if IsUSDCcCall(rules, tx) {
+		t, err := ParseUSDCcTransfer(rules, tx.Data)
+		if err != nil || !t.IsSettlement {
+			return nil, false
+		}
+		return &SettlementTransfer{SettlementID: t.SettlementID, Token: usdccToken, Payout: t.To, Amount: t.Amount}, true
+	}
+	id, ok := ParseSettlementMarker(tx.Data)
+	if !ok {
+		return nil, false
+	}
+	return &SettlementTransfer{SettlementID: id, Token: nativeToken, Payout: *tx.To, Amount: tx.Value}, true
+}
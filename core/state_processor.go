@@ -0,0 +1,800 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// State transition: één pad voor produceren, importeren en syncen
+// ----------------------------------------------------------------
+//
+// ApplyBlock controleert de header tegen de parent, voert alle txs uit op
+// een overlay van de state, vergelijkt de state root en schrijft de
+// overlay pas daarna weg. Een block van een peer wordt zo op precies
+// dezelfde manier uitgevoerd als een block dat we zelf maken.
+
+const (
+	PaymentDataPrefix = "GORR_PAY:" // tx.Data = "GORR_PAY:<intentID>" (terms: core/payment_terms.go)
+
+	// Fees in basispunten (params.Rules.PaymentFeeBps) → 250 = 2.5%
+	bpsDenominator = 10000
+
+	nativeToken = "GORR"
+	usdccToken  = "USDCc"
+)
+
+var (
+	ErrParentHash  = errors.New("parent hash mismatch")
+	ErrBlockNumber = errors.New("block number does not follow parent")
+	ErrTimestamp   = errors.New("timestamp not after parent")
+	ErrTxRoot      = errors.New("tx root mismatch")
+	ErrStateRoot   = errors.New("state root mismatch")
+	ErrGasLimit    = errors.New("invalid block gas limit")
+	ErrGasUsed     = errors.New("block gas used mismatch")
+
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrInsufficientFunds  = errors.New("insufficient funds for gas * price + value")
+)
+
+// PaymentReceivedTopic is topic[0] van het log dat bij elke geslaagde
+// GORR_PAY betaling in de receipt komt:
+// PaymentReceived(uint256 indexed intentId, address indexed payer, uint256 amount)
+var PaymentReceivedTopic = crypto.Keccak256Hash([]byte("PaymentReceived(uint256,address,uint256)"))
+
+// TxError: tx Index van het block kon niet worden uitgevoerd.
+type TxError struct {
+	Index int
+	Hash  common.Hash
+	Err   error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("tx %d (%s): %v", e.Index, e.Hash.Hex(), e.Err)
+}
+
+func (e *TxError) Unwrap() error { return e.Err }
+
+type StateProcessor struct {
+	chain  *blockchain.Blockchain
+	config *params.ChainConfig
+}
+
+func NewStateProcessor(chain *blockchain.Blockchain, config *params.ChainConfig) *StateProcessor {
+	return &StateProcessor{chain: chain, config: config}
+}
+
+// GasLimit: de gas limit die elk nieuw block moet hebben.
+func (p *StateProcessor) GasLimit() uint64 { return p.config.GasLimit }
+
+func (p *StateProcessor) Config() *params.ChainConfig { return p.config }
+
+// CommitHook schrijft node-lokale gegevens van een goedgekeurd block
+// (payment intents) in de overlay st, vlak vóór de commit. Geen invloed op
+// de state root. pulls zijn de auto pulls van ApplySubscriptions.
+type CommitHook func(st *state.State, receipts []*types.Receipt, pulls []*SubscriptionPull) error
+
+// ApplyBlock voert block uit bovenop parent (= de huidige head) en schrijft
+// de nieuwe state weg, samen met wat hook (optioneel) in dezelfde overlay
+// zet. Faalt er iets, dan blijft de state ongewijzigd. rewards is nil vóór
+// de rewards fork.
+func (p *StateProcessor) ApplyBlock(parent, block *types.Block, hook CommitHook) ([]*types.Receipt, *types.BlockRewards, error) {
+	receipts, rewards, pulls, st, err := p.process(parent, block)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hook != nil {
+		if err := hook(st, receipts, pulls); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := st.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit state: %w", err)
+	}
+	// Total supply en fee administratie zijn node-lokaal (niet in de
+	// root) → pas na de commit
+	if rewards != nil {
+		p.chain.State.AddSupply(nativeToken, rewards.Issuance)
+		_ = p.chain.State.SubSupply(nativeToken, rewards.Burned)
+		if rewards.BurnedUSDCc != nil {
+			_ = p.chain.State.SubSupply(usdccToken, rewards.BurnedUSDCc)
+		}
+	}
+	usdccFees, usdccRefunds := new(big.Int), new(big.Int)
+	for _, r := range receipts {
+		if r.FeeUSDCc != nil {
+			usdccFees.Add(usdccFees, r.FeeUSDCc)
+		}
+		if r.FeeRefundUSDCc != nil {
+			usdccRefunds.Add(usdccRefunds, r.FeeRefundUSDCc)
+		}
+	}
+	for _, pull := range pulls {
+		if pull.Token == usdccToken {
+			usdccFees.Add(usdccFees, pull.Fee)
+		}
+	}
+	if usdccFees.Sign() > 0 {
+		p.chain.State.AddCollectedFee(usdccToken, usdccFees)
+	}
+	_ = p.chain.State.SubCollectedFee(usdccToken, usdccRefunds)
+	return receipts, rewards, nil
+}
+
+// ValidateBlock is ApplyBlock zonder wegschrijven (BFT proposals).
+func (p *StateProcessor) ValidateBlock(parent, block *types.Block) error {
+	_, _, _, _, err := p.process(parent, block)
+	return err
+}
+
+func (p *StateProcessor) process(parent, block *types.Block) ([]*types.Receipt, *types.BlockRewards, []*SubscriptionPull, *state.State, error) {
+	if err := p.ValidateHeader(parent, block); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	st := p.chain.State.Begin()
+	receipts, usedGas, err := p.Execute(st, block)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if usedGas != block.Header.GasUsed {
+		return nil, nil, nil, nil, fmt.Errorf("%w: block #%d has %d, computed %d",
+			ErrGasUsed, block.Header.Number, block.Header.GasUsed, usedGas)
+	}
+	pulls, err := p.ApplySubscriptions(st, block.Header)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rewards, err := p.Finalize(st, block.Header, receipts, pulls)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	root, err := st.Root()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if root != block.Header.StateRoot {
+		return nil, nil, nil, nil, fmt.Errorf("%w: block #%d has %s, computed %s",
+			ErrStateRoot, block.Header.Number, block.Header.StateRoot.Hex(), root.Hex())
+	}
+	return receipts, rewards, pulls, st, nil
+}
+
+// ValidateHeader: de regels die los van de consensus engine gelden.
+func (p *StateProcessor) ValidateHeader(parent, block *types.Block) error {
+	if block == nil || block.Header == nil {
+		return errors.New("nil block")
+	}
+	h := block.Header
+	if h.ParentHash != parent.Hash() {
+		return fmt.Errorf("%w: block #%d", ErrParentHash, h.Number)
+	}
+	if h.Number != parent.Header.Number+1 {
+		return fmt.Errorf("%w: #%d after #%d", ErrBlockNumber, h.Number, parent.Header.Number)
+	}
+	if h.Time <= parent.Header.Time {
+		return fmt.Errorf("%w: %d <= %d", ErrTimestamp, h.Time, parent.Header.Time)
+	}
+	if h.TxRoot != types.DeriveTxRoot(block.Transactions) {
+		return fmt.Errorf("%w: block #%d", ErrTxRoot, h.Number)
+	}
+	if h.GasLimit != p.config.GasLimit {
+		return fmt.Errorf("%w: %d, want %d", ErrGasLimit, h.GasLimit, p.config.GasLimit)
+	}
+	if h.GasUsed > h.GasLimit {
+		return fmt.Errorf("%w: used %d > limit %d", ErrGasLimit, h.GasUsed, h.GasLimit)
+	}
+	return nil
+}
+
+// Execute voert alle txs van block uit op st (zonder Finalize), zonder roots of GasUsed te
+// controleren, en geeft de receipts + het totale gasverbruik terug.
+// Een falende tx geeft een *TxError.
+func (p *StateProcessor) Execute(st *state.State, block *types.Block) ([]*types.Receipt, uint64, error) {
+	receipts := make([]*types.Receipt, 0, len(block.Transactions))
+	var (
+		logIndex uint64
+		usedGas  uint64
+		gp       = GasPool(block.Header.GasLimit)
+	)
+
+	for i, tx := range block.Transactions {
+		receipt, err := p.ApplyTransaction(st, block.Header, tx, uint64(i), &logIndex, &gp, &usedGas)
+		if err != nil {
+			var hash common.Hash
+			if tx != nil {
+				hash = tx.Hash()
+			}
+			return nil, 0, &TxError{Index: i, Hash: hash, Err: err}
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, usedGas, nil
+}
+
+// ApplyTransaction voert één tx uit (transfer of payment), verhoogt de
+// nonce en bouwt de receipt. Alle controles gebeuren vóór de eerste write.
+// tx.Gas gaat uit gp; het ongebruikte deel komt terug, het verbruik wordt
+// bij usedGas opgeteld.
+func (p *StateProcessor) ApplyTransaction(
+	st *state.State,
+	header *types.Header,
+	tx *types.Transaction,
+	index uint64,
+	logIndex *uint64,
+	gp *GasPool,
+	usedGas *uint64,
+) (*types.Receipt, error) {
+	if tx == nil || tx.To == nil {
+		return nil, errors.New("invalid transaction")
+	}
+	rules := p.config.Rules(header.Number)
+	if err := p.checkTxType(rules, tx); err != nil {
+		return nil, err
+	}
+	from, err := tx.From()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	nonce, err := st.GetNonce(from)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Nonce != nonce {
+		return nil, fmt.Errorf("bad nonce: got %d want %d", tx.Nonce, nonce)
+	}
+
+	// USDCc fork: een tx naar het USDCc adres is een token call
+	var usdcc *USDCcTransfer
+	if IsUSDCcCall(rules, tx) {
+		if usdcc, err = ParseUSDCcTransfer(rules, tx.Data); err != nil {
+			return nil, err
+		}
+		if tx.Value.Sign() != 0 {
+			return nil, fmt.Errorf("%w: value must be 0", ErrInvalidUSDCcCall)
+		}
+	}
+	// Merchants fork: een tx naar het registry adres is een registry call
+	var merchantCall *MerchantCall
+	if IsMerchantCall(rules, tx) {
+		if merchantCall, err = ParseMerchantCall(tx.Data); err != nil {
+			return nil, err
+		}
+		if tx.Value.Sign() != 0 {
+			return nil, fmt.Errorf("%w: value must be 0", ErrInvalidMerchantCall)
+		}
+	}
+	// Subscriptions fork: een tx naar het subscriptions adres is een
+	// subscription call
+	var subCall *SubscriptionCall
+	if IsSubscriptionCall(rules, tx) {
+		if subCall, err = ParseSubscriptionCall(tx.Data); err != nil {
+			return nil, err
+		}
+		if tx.Value.Sign() != 0 {
+			return nil, fmt.Errorf("%w: value must be 0", ErrInvalidSubscriptionCall)
+		}
+	}
+	// PaymentTerms fork: een betaling of refund moet in het payment record
+	// van het intent passen, anders verplaatst hij niets
+	payment, record, err := checkPayment(st, header, from, rules, tx)
+	if err != nil {
+		return nil, err
+	}
+	refund, isRefund := RefundOf(rules, tx)
+	var refundRecord *PaymentRecord
+	if isRefund {
+		if refundRecord, err = checkRefund(st, from, rules, refund); err != nil {
+			return nil, err
+		}
+	}
+
+	gas, err := TxIntrinsicGas(rules, tx.To, tx.Data)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Gas < gas {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.Gas, gas)
+	}
+	// GasCharge fork: de sender moet het volle gas budget kunnen betalen
+	var gasPrice *big.Int
+	if rules.IsGasCharge {
+		gasPrice = tx.EffectiveGasPrice()
+		if err := checkGasFunds(st, tx, from, gasPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := gp.SubGas(tx.Gas); err != nil {
+		return nil, fmt.Errorf("%w: tx gas %d, block has %d left", err, tx.Gas, gp.Gas())
+	}
+
+	// Detecteer payment intent of refund in tx.Data (GORR) of achter de
+	// USDCc call
+	var (
+		fee        = new(big.Int)
+		paymentFee *big.Int
+		payout     common.Address
+		intentID   uint64
+		isPayment  bool
+		registered common.Address // merchant van een registry call
+		subID      uint64
+		pull       *SubscriptionPull // termijn van een pull call
+	)
+	switch {
+	case merchantCall != nil:
+		registered, err = p.applyMerchantCall(st, from, merchantCall, rules)
+	case subCall != nil:
+		subID, pull, err = p.applySubscriptionCall(st, header, from, subCall, rules)
+		if pull != nil && pull.Token == nativeToken {
+			fee.Set(pull.Fee)
+		}
+	case isRefund:
+		err = p.applyRefund(st, from, refund, rules)
+	case usdcc != nil && usdcc.IsPayment:
+		intentID, isPayment = usdcc.IntentID, true
+		paymentFee, payout, err = p.applyUSDCcPayment(st, from, usdcc, rules)
+	case usdcc != nil:
+		err = applyUSDCcTransfer(st, from, usdcc.To, usdcc.Amount)
+	default:
+		intentID, _, isPayment = ParsePaymentMarker(rules, tx.Data)
+		if isPayment {
+			paymentFee, payout, err = p.applyPayment(st, tx, from, rules)
+			if err == nil {
+				fee.Set(paymentFee)
+			}
+		} else {
+			err = applyTransfer(st, from, *tx.To, tx.Value)
+		}
+	}
+	if err != nil {
+		gp.AddGas(tx.Gas)
+		return nil, err
+	}
+	if record != nil {
+		if err := recordPayment(st, header, payment, record, paymentFee); err != nil {
+			return nil, err
+		}
+	}
+	if refundRecord != nil {
+		if err := recordRefund(st, header, from, refund, refundRecord); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ongebruikt gas terug naar het block
+	gp.AddGas(tx.Gas - gas)
+	*usedGas += gas
+
+	// Alleen het verbruikte gas wordt betaald
+	if gasPrice != nil {
+		gasFee, err := p.chargeGas(st, from, gas, gasPrice, rules)
+		if err != nil {
+			return nil, err
+		}
+		fee.Add(fee, gasFee)
+	}
+
+	// Nonce verhogen pas ná succesvolle verwerking
+	if err := st.IncreaseNonce(from); err != nil {
+		return nil, fmt.Errorf("IncreaseNonce: %w", err)
+	}
+
+	receipt := &types.Receipt{
+		TxHash:            tx.Hash(),
+		BlockHash:         header.Hash(),
+		BlockNumber:       header.Number,
+		TransactionIndex:  index,
+		From:              from,
+		To:                *tx.To,
+		GasUsed:           gas,
+		CumulativeGasUsed: *usedGas,
+		Status:            1,
+		EffectiveGasPrice: gasPrice,
+		Logs:              []*types.Log{},
+	}
+	if fee.Sign() > 0 {
+		receipt.Fee = fee
+	}
+	if isPayment {
+		receipt.PaymentFee = paymentFee
+	}
+	var usdccFee *big.Int
+	if usdcc != nil && usdcc.IsPayment {
+		usdccFee = paymentFee
+		if usdccFee.Sign() > 0 {
+			receipt.FeeUSDCc = usdccFee
+		}
+	}
+	if pull != nil {
+		pull.TxHash = receipt.TxHash
+		receipt.PaymentFee = pull.Fee
+		if pull.Token == usdccToken && pull.Fee.Sign() > 0 {
+			receipt.FeeUSDCc = pull.Fee
+		}
+	}
+	if isRefund && refund.Fee.Sign() > 0 {
+		if refund.Token == usdccToken {
+			receipt.FeeRefundUSDCc = refund.Fee
+		} else {
+			receipt.FeeRefund = refund.Fee
+		}
+	}
+
+	addLog := func(l *types.Log) {
+		l.BlockNumber = header.Number
+		l.BlockHash = receipt.BlockHash
+		l.TxHash = receipt.TxHash
+		l.TxIndex = receipt.TransactionIndex
+		l.Index = *logIndex
+		*logIndex++
+		receipt.Logs = append(receipt.Logs, l)
+	}
+	if usdcc != nil {
+		net, to := usdcc.Amount, usdcc.To
+		if usdccFee != nil {
+			net, to = new(big.Int).Sub(usdcc.Amount, usdccFee), payout
+		}
+		addLog(usdccTransferLog(from, to, net))
+		// Vanaf de rewards fork gaat de fee in de pot; de verdeling staat
+		// in de BlockRewards van het block
+		if usdccFee != nil && usdccFee.Sign() > 0 && !rules.IsRewards {
+			addLog(usdccTransferLog(from, p.chain.TreasuryAddr, usdccFee))
+		}
+		if receipt.FeeRefundUSDCc != nil {
+			addLog(usdccTransferLog(p.chain.TreasuryAddr, usdcc.To, receipt.FeeRefundUSDCc))
+		}
+	}
+	if isPayment {
+		merchant, amount := *tx.To, tx.Value
+		if usdcc != nil {
+			merchant, amount = usdcc.To, usdcc.Amount
+		}
+		addLog(paymentReceivedLog(merchant, from, intentID, amount))
+	}
+	if isRefund {
+		addLog(paymentRefundedLog(from, refund.Payer, refund.IntentID, refund.Amount, refund.Fee))
+	}
+	if merchantCall != nil {
+		addLog(merchantUpdatedLog(registered, merchantCall.Op))
+	}
+	if subCall != nil {
+		if pull != nil && pull.Token == usdccToken {
+			addLog(usdccTransferLog(pull.Payer, pull.Payout, new(big.Int).Sub(pull.Amount, pull.Fee)))
+			if pull.Fee.Sign() > 0 {
+				addLog(usdccTransferLog(pull.Payer, p.chain.TreasuryAddr, pull.Fee))
+			}
+		}
+		if pull != nil {
+			addLog(subscriptionChargedLog(pull))
+		}
+		addLog(subscriptionUpdatedLog(subID, subCall.Op, from))
+	}
+	return receipt, nil
+}
+
+// checkTxType: typed txs pas vanaf de TypedTx fork, en dan voor deze chain.
+func (p *StateProcessor) checkTxType(rules params.Rules, tx *types.Transaction) error {
+	switch tx.Type {
+	case types.LegacyTxType:
+		return nil
+	case types.AccessListTxType, types.DynamicFeeTxType:
+	default:
+		return fmt.Errorf("%w: type %d", ErrTxTypeNotSupported, tx.Type)
+	}
+	if !rules.IsTypedTx {
+		return fmt.Errorf("%w: type %d before the typed tx fork (block #%d)", ErrTxTypeNotSupported, tx.Type, rules.Number)
+	}
+	if tx.ChainID == nil || tx.ChainID.Uint64() != p.chain.NetworkID() {
+		return fmt.Errorf("wrong chain id %v, want %d", tx.ChainID, p.chain.NetworkID())
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------
+// Gas kosten (vanaf de GasCharge fork)
+// ----------------------------------------------------------------
+
+// checkGasFunds: saldo >= value + tx.Gas * gasPrice, zoals Ethereum's buyGas.
+func checkGasFunds(st *state.State, tx *types.Transaction, from common.Address, gasPrice *big.Int) error {
+	bal, err := st.GetBalance(from)
+	if err != nil {
+		return err
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas), gasPrice)
+	cost.Add(cost, tx.Value)
+	if bal.Cmp(cost) < 0 {
+		return fmt.Errorf("%w: address %s have %s want %s", ErrInsufficientFunds, from.Hex(), bal, cost)
+	}
+	return nil
+}
+
+// chargeGas: gasUsed * gasPrice van de sender naar de fee pot (collectFee).
+func (p *StateProcessor) chargeGas(st *state.State, from common.Address, gasUsed uint64, gasPrice *big.Int, rules params.Rules) (*big.Int, error) {
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), gasPrice)
+	if fee.Sign() == 0 {
+		return fee, nil
+	}
+	if _, err := p.treasury(); err != nil {
+		return nil, err
+	}
+	bal, err := st.GetBalance(from)
+	if err != nil {
+		return nil, err
+	}
+	if bal.Cmp(fee) < 0 {
+		return nil, errors.New("insufficient balance")
+	}
+	if err := st.SetBalance(from, new(big.Int).Sub(bal, fee)); err != nil {
+		return nil, err
+	}
+	return fee, p.collectFee(st, rules, nativeToken, fee)
+}
+
+// collectFee: een fee in token die al van de sender afgeschreven is. Vóór
+// de rewards fork gaat hij direct naar de treasury; daarna blijft hij in
+// de pot tot Finalize hem volgens FeeSplit verdeelt.
+func (p *StateProcessor) collectFee(st *state.State, rules params.Rules, token string, fee *big.Int) error {
+	if rules.IsRewards {
+		return nil
+	}
+	treasury, err := p.treasury()
+	if err != nil {
+		return err
+	}
+	if token == usdccToken {
+		return creditUSDCc(st, treasury, fee)
+	}
+	return credit(st, treasury, fee)
+}
+
+func (p *StateProcessor) treasury() (common.Address, error) {
+	if p.chain.TreasuryAddr == (common.Address{}) {
+		return common.Address{}, errors.New("TreasuryAddr is zero address")
+	}
+	return p.chain.TreasuryAddr, nil
+}
+
+func credit(st *state.State, addr common.Address, amount *big.Int) error {
+	bal, err := st.GetBalance(addr)
+	if err != nil {
+		return err
+	}
+	return st.SetBalance(addr, new(big.Int).Add(bal, amount))
+}
+
+func creditUSDCc(st *state.State, addr common.Address, amount *big.Int) error {
+	bal, err := st.GetUSDCcBalance(addr)
+	if err != nil {
+		return err
+	}
+	return st.SetUSDCcBalance(addr, new(big.Int).Add(bal, amount))
+}
+
+// ----------------------------------------------------------------
+// Block rewards (vanaf de rewards fork)
+// ----------------------------------------------------------------
+
+// Finalize verdeelt na de laatste tx de fees van het block volgens
+// FeeSplit, per token: GORR (receipt.Fee en de GORR fees van de auto
+// pulls) en USDCc (receipt.FeeUSDCc en de USDCc fees van de auto pulls).
+// Daarna munt hij de issuance van het block volgens RewardSplit. Het
+// producer deel gaat naar header.Coinbase, of naar de treasury als die
+// leeg is. Vóór de rewards fork: nil, niets gewijzigd.
+func (p *StateProcessor) Finalize(st *state.State, header *types.Header, receipts []*types.Receipt, pulls []*SubscriptionPull) (*types.BlockRewards, error) {
+	if !p.config.IsRewards(header.Number) {
+		return nil, nil
+	}
+	treasury, err := p.treasury()
+	if err != nil {
+		return nil, err
+	}
+
+	fees, feesUSDCc := new(big.Int), new(big.Int)
+	for _, r := range receipts {
+		if r.Fee != nil {
+			fees.Add(fees, r.Fee)
+		}
+		if r.FeeUSDCc != nil {
+			feesUSDCc.Add(feesUSDCc, r.FeeUSDCc)
+		}
+	}
+	for _, pull := range pulls {
+		switch pull.Token {
+		case nativeToken:
+			fees.Add(fees, pull.Fee)
+		case usdccToken:
+			feesUSDCc.Add(feesUSDCc, pull.Fee)
+		}
+	}
+	rewards := &types.BlockRewards{
+		BlockNumber: header.Number,
+		BlockHash:   header.Hash(),
+		Coinbase:    header.Coinbase,
+		Fees:        fees,
+		Issuance:    p.config.BlockRewardAt(header.Number),
+		Burned:      new(big.Int),
+		Payouts:     []*types.Payout{},
+	}
+	if feesUSDCc.Sign() > 0 {
+		rewards.FeesUSDCc, rewards.BurnedUSDCc = feesUSDCc, new(big.Int)
+	}
+	if err := distribute(st, rewards, types.PayoutSourceFees, fees, p.config.FeeSplit, treasury); err != nil {
+		return nil, err
+	}
+	if err := distribute(st, rewards, types.PayoutSourceFeesUSDCc, feesUSDCc, p.config.FeeSplit, treasury); err != nil {
+		return nil, err
+	}
+	if err := distribute(st, rewards, types.PayoutSourceIssuance, rewards.Issuance, p.config.RewardSplit, treasury); err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
+
+// distribute splitst amount volgens split; afrondingsrest gaat naar de
+// treasury. Alleen payouts > 0 worden vastgelegd. PayoutSourceFeesUSDCc
+// betaalt in USDCc, de andere bronnen in GORR.
+func distribute(st *state.State, rewards *types.BlockRewards, source string, amount *big.Int, split params.Split, treasury common.Address) error {
+	if amount.Sign() == 0 {
+		return nil
+	}
+	producer := bpsOf(amount, split.ProducerBps)
+	burn := bpsOf(amount, split.BurnBps)
+	rest := new(big.Int).Sub(amount, producer)
+	rest.Sub(rest, burn)
+
+	coinbase := rewards.Coinbase
+	if coinbase == (common.Address{}) {
+		rest.Add(rest, producer)
+		producer = new(big.Int)
+	}
+
+	pay := func(role string, to common.Address, amt *big.Int) error {
+		if amt.Sign() == 0 {
+			return nil
+		}
+		rewards.Payouts = append(rewards.Payouts, &types.Payout{Source: source, Role: role, Recipient: to, Amount: amt})
+		usdcc := source == types.PayoutSourceFeesUSDCc
+		switch {
+		case role == types.PayoutRoleBurn && usdcc:
+			rewards.BurnedUSDCc.Add(rewards.BurnedUSDCc, amt)
+			return nil
+		case role == types.PayoutRoleBurn:
+			rewards.Burned.Add(rewards.Burned, amt)
+			return nil
+		case usdcc:
+			return creditUSDCc(st, to, amt)
+		}
+		return credit(st, to, amt)
+	}
+	if err := pay(types.PayoutRoleProducer, coinbase, producer); err != nil {
+		return err
+	}
+	if err := pay(types.PayoutRoleTreasury, treasury, rest); err != nil {
+		return err
+	}
+	return pay(types.PayoutRoleBurn, common.Address{}, burn)
+}
+
+func bpsOf(amount *big.Int, bps uint64) *big.Int {
+	out := new(big.Int).Mul(amount, new(big.Int).SetUint64(bps))
+	return out.Div(out, big.NewInt(bpsDenominator))
+}
+
+// ----------------------------------------------------------------
+// Normale GORR transfer (zonder fee / payment intent)
+// ----------------------------------------------------------------
+
+func applyTransfer(st *state.State, from, to common.Address, value *big.Int) error {
+	fromBal, err := st.GetBalance(from)
+	if err != nil {
+		return err
+	}
+	if fromBal.Cmp(value) < 0 {
+		return errors.New("insufficient balance")
+	}
+
+	if err := st.SetBalance(from, new(big.Int).Sub(fromBal, value)); err != nil {
+		return err
+	}
+
+	// Na de debit lezen: from == to moet netto niets doen
+	toBal, err := st.GetBalance(to)
+	if err != nil {
+		return err
+	}
+	return st.SetBalance(to, new(big.Int).Add(toBal, value))
+}
+
+// ----------------------------------------------------------------
+// Payment GORR transfer (met treasury fee)
+// ----------------------------------------------------------------
+
+// applyPayment splitst tx.Value in een fee (de fee van de merchant, zie
+// MerchantTerms en collectFee) en het netto bedrag voor de merchant (tx.To,
+// of zijn payout adres). De payment intent zelf is node-lokaal en wordt
+// door de producer ná de commit bijgewerkt; consensus kent vanaf de
+// paymentTerms fork alleen het PaymentRecord (core/payment_terms.go).
+func (p *StateProcessor) applyPayment(st *state.State, tx *types.Transaction, from common.Address, rules params.Rules) (*big.Int, common.Address, error) {
+	if _, err := p.treasury(); err != nil {
+		return nil, common.Address{}, err
+	}
+	fromBal, err := st.GetBalance(from)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if fromBal.Cmp(tx.Value) < 0 {
+		return nil, common.Address{}, errors.New("insufficient balance")
+	}
+	bps, payout, err := MerchantTerms(st, rules, *tx.To)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+
+	fee, net := PaymentSplit(bps, tx.Value)
+
+	if err := st.SetBalance(from, new(big.Int).Sub(fromBal, tx.Value)); err != nil {
+		return nil, common.Address{}, err
+	}
+	if err := credit(st, payout, net); err != nil {
+		return nil, common.Address{}, err
+	}
+	return fee, payout, p.collectFee(st, rules, nativeToken, fee)
+}
+
+// PaymentSplit: fee = value * feeBps / 10000, net = value - fee. feeBps is
+// rules.PaymentFeeBps of de fee van de merchant (MerchantTerms).
+func PaymentSplit(feeBps uint64, value *big.Int) (fee, net *big.Int) {
+	fee = bpsOf(value, feeBps)
+	return fee, new(big.Int).Sub(value, fee)
+}
+
+// paymentReceivedLog bouwt het log met de merchant als "contract" adres,
+// zodat merchants met een logs-filter op hun eigen adres kunnen luisteren.
+// amount is het bruto bedrag (GORR of USDCc, naar het token van de tx).
+func paymentReceivedLog(merchant, payer common.Address, intentID uint64, amount *big.Int) *types.Log {
+	return &types.Log{
+		Address: merchant,
+		Topics: []common.Hash{
+			PaymentReceivedTopic,
+			common.BigToHash(new(big.Int).SetUint64(intentID)),
+			common.BytesToHash(payer.Bytes()),
+		},
+		Data: common.BigToHash(amount).Bytes(),
+	}
+}
+
+// ParsePaymentIntentID verwacht tx.Data als ASCII "GORR_PAY:<id>"
+// en geeft (id, true) terug als het matcht.
+// Zo niet, dan (0, false).
+func ParsePaymentIntentID(data []byte) (uint64, bool) {
+	if len(data) == 0 {
+		return 0, false
+	}
+	if !bytes.HasPrefix(data, []byte(PaymentDataPrefix)) {
+		return 0, false
+	}
+
+	idStr := string(data[len(PaymentDataPrefix):])
+	if idStr == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
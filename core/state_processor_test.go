@@ -0,0 +1,238 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type chainEnv struct {
+	t     *testing.T
+	chain *blockchain.Blockchain
+	p     *StateProcessor
+	key   *ecdsa.PrivateKey
+	from  common.Address
+}
+
+// newChainEnv: chain met genesis in een temp dir en een key met GORR.
+func newChainEnv(t *testing.T, cfg *params.ChainConfig) *chainEnv {
+	t.Helper()
+	chain, err := blockchain.NewBlockchain(t.TempDir(), 9999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.State.Close() })
+	key := mustKey(t)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	if err := chain.State.SetBalance(from, big.NewInt(1_000_000)); err != nil {
+		t.Fatal(err)
+	}
+	return &chainEnv{t: t, chain: chain, p: NewStateProcessor(chain, cfg), key: key, from: from}
+}
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (e *chainEnv) tx(nonce uint64, to common.Address, value int64, gas uint64, data string) *types.Transaction {
+	e.t.Helper()
+	gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+		Nonce: nonce, To: &to, Value: big.NewInt(value), Gas: gas, GasPrice: new(big.Int), Data: []byte(data),
+	}), gethtypes.HomesteadSigner{}, e.key)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return types.FromGeth(gtx)
+}
+
+// build: een geldig block met txs op parent, zoals de producer het maakt
+// (roots en gas uit een overlay die niet wordt weggeschreven).
+func (e *chainEnv) build(parent *types.Block, txs ...*types.Transaction) *types.Block {
+	e.t.Helper()
+	block := &types.Block{
+		Header: &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     parent.Header.Number + 1,
+			Time:       parent.Header.Time + 3,
+			GasLimit:   e.p.GasLimit(),
+			TxRoot:     types.DeriveTxRoot(txs),
+		},
+		Transactions: txs,
+	}
+	st := e.chain.State.Begin()
+	receipts, used, err := e.p.Execute(st, block)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	pulls, err := e.p.ApplySubscriptions(st, block.Header)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if _, err := e.p.Finalize(st, block.Header, receipts, pulls); err != nil {
+		e.t.Fatal(err)
+	}
+	block.Header.GasUsed = used
+	if block.Header.StateRoot, err = st.Root(); err != nil {
+		e.t.Fatal(err)
+	}
+	return block
+}
+
+func (e *chainEnv) root() common.Hash {
+	e.t.Helper()
+	root, err := e.chain.State.Root()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return root
+}
+
+func TestApplyBlockRules(t *testing.T) {
+	cfg := params.GorrillazzChainConfig()
+	cfg.GasLimit = 100_000
+	to := common.HexToAddress("0xb0b")
+
+	tests := []struct {
+		name   string
+		mutate func(e *chainEnv, parent, block *types.Block)
+		want   error // nil = geaccepteerd
+	}{
+		{"valid", func(*chainEnv, *types.Block, *types.Block) {}, nil},
+		{"parent hash", func(_ *chainEnv, _, b *types.Block) { b.Header.ParentHash = common.Hash{1} }, ErrParentHash},
+		{"number", func(_ *chainEnv, _, b *types.Block) { b.Header.Number++ }, ErrBlockNumber},
+		{"time equal to parent", func(_ *chainEnv, p, b *types.Block) { b.Header.Time = p.Header.Time }, ErrTimestamp},
+		{"tx dropped", func(_ *chainEnv, _, b *types.Block) { b.Transactions = b.Transactions[:1] }, ErrTxRoot},
+		{"gas limit", func(_ *chainEnv, _, b *types.Block) { b.Header.GasLimit++ }, ErrGasLimit},
+		{"gas used above limit", func(_ *chainEnv, _, b *types.Block) { b.Header.GasUsed = b.Header.GasLimit + 1 }, ErrGasLimit},
+		{"gas used", func(_ *chainEnv, _, b *types.Block) { b.Header.GasUsed-- }, ErrGasUsed},
+		{"state root", func(_ *chainEnv, _, b *types.Block) { b.Header.StateRoot = common.Hash{1} }, ErrStateRoot},
+		{"bad nonce", func(e *chainEnv, _, b *types.Block) {
+			b.Transactions[1] = e.tx(5, to, 1, 21000, "")
+			b.Header.TxRoot = types.DeriveTxRoot(b.Transactions)
+		}, errBadNonce},
+		{"gas below intrinsic", func(e *chainEnv, _, b *types.Block) {
+			b.Transactions[1] = e.tx(1, to, 1, 21000, "x")
+			b.Header.TxRoot = types.DeriveTxRoot(b.Transactions)
+		}, ErrIntrinsicGas},
+		{"txs above the block gas limit", func(e *chainEnv, _, b *types.Block) {
+			b.Transactions[1] = e.tx(1, to, 1, 80_000, "")
+			b.Header.TxRoot = types.DeriveTxRoot(b.Transactions)
+		}, ErrGasLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newChainEnv(t, cfg)
+			parent := e.chain.Head()
+			block := e.build(parent, e.tx(0, to, 100, 21000, ""), e.tx(1, to, 200, 21000, ""))
+			tt.mutate(e, parent, block)
+
+			before := e.root()
+			receipts, _, err := e.p.ApplyBlock(parent, block, nil)
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatal(err)
+			case tt.want == errBadNonce:
+				var txErr *TxError
+				if !errors.As(err, &txErr) || txErr.Index != 1 {
+					t.Fatalf("got %v, want a TxError for tx 1", err)
+				}
+			case !errors.Is(err, tt.want):
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			if tt.want != nil {
+				if e.root() != before {
+					t.Fatal("rejected block changed the state")
+				}
+				return
+			}
+			if len(receipts) != 2 || e.root() != block.Header.StateRoot {
+				t.Fatalf("%d receipts, state root %s, want %s", len(receipts), e.root().Hex(), block.Header.StateRoot.Hex())
+			}
+			if bal, _ := e.chain.State.GetBalance(to); bal.Int64() != 300 {
+				t.Fatalf("recipient has %s, want 300", bal)
+			}
+		})
+	}
+}
+
+// errBadNonce markeert in de tabel een TxError zonder sentinel.
+var errBadNonce = errors.New("bad nonce")
+
+func TestIntrinsicGas(t *testing.T) {
+	merchant := common.HexToAddress("0xb0b")
+	all := params.Rules{IsUSDCc: true, IsRefunds: true, IsMerchants: true, IsSubscriptions: true, IsPaymentTerms: true}
+	transfer := USDCcTransferData(merchant, big.NewInt(5), 0)
+	payTransfer := USDCcPaymentData(merchant, big.NewInt(5), 7, &PaymentTerms{Amount: big.NewInt(5)})
+	data := func(s string) uint64 { return uint64(len(s)) * TxDataNonZeroGas }
+
+	tests := []struct {
+		name  string
+		rules params.Rules
+		to    common.Address
+		data  []byte
+		want  uint64
+	}{
+		{"plain transfer", params.Rules{}, merchant, nil, TxGas},
+		{"zero and non-zero bytes", params.Rules{}, merchant, []byte{0, 0, 1}, TxGas + 2*TxDataZeroGas + TxDataNonZeroGas},
+		{"legacy payment", params.Rules{}, merchant, []byte("GORR_PAY:7"), TxGas + data("GORR_PAY:7") + TxPaymentGas},
+		{"payment with terms", all, merchant, []byte("GORR_PAY:7:5:0"), TxGas + data("GORR_PAY:7:5:0") + TxPaymentGas},
+		{"refund before the fork", params.Rules{}, merchant, []byte("GORR_REFUND:7"), TxGas + data("GORR_REFUND:7")},
+		{"refund", all, merchant, []byte("GORR_REFUND:7"), TxGas + data("GORR_REFUND:7") + TxPaymentGas},
+		{"registry call", all, params.MerchantRegistryAddress, []byte("GORR_MERCHANT:{}"), TxGas + data("GORR_MERCHANT:{}") + TxMerchantGas},
+		{"subscription call", all, params.SubscriptionsAddress, []byte("GORR_SUB:{}"), TxGas + data("GORR_SUB:{}") + TxSubscriptionGas},
+		{"subscription address before the fork", params.Rules{}, params.SubscriptionsAddress, []byte("GORR_SUB:{}"), TxGas + data("GORR_SUB:{}")},
+	}
+	for _, tt := range tests {
+		to := tt.to
+		got, err := TxIntrinsicGas(tt.rules, &to, tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: gas %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// USDCc calls: de marker staat achter de transfer, met zero bytes
+	base, _ := IntrinsicGas(transfer)
+	if got, _ := TxIntrinsicGas(all, &params.USDCcTokenAddress, transfer); got != base {
+		t.Errorf("USDCc transfer without terms after the fork: gas %d, want %d", got, base)
+	}
+	base, _ = IntrinsicGas(payTransfer)
+	if got, _ := TxIntrinsicGas(all, &params.USDCcTokenAddress, payTransfer); got != base+TxPaymentGas {
+		t.Errorf("USDCc payment: gas %d, want %d", got, base+TxPaymentGas)
+	}
+}
+
+func TestGasPool(t *testing.T) {
+	gp := GasPool(50_000)
+	steps := []struct {
+		sub  uint64
+		want error
+		left uint64
+	}{
+		{21_000, nil, 29_000},
+		{21_000, nil, 8_000},
+		{21_000, ErrGasLimitReached, 8_000},
+		{8_000, nil, 0},
+	}
+	for i, st := range steps {
+		if err := gp.SubGas(st.sub); !errors.Is(err, st.want) || gp.Gas() != st.left {
+			t.Fatalf("step %d: err %v left %d, want %v and %d", i, err, gp.Gas(), st.want, st.left)
+		}
+	}
+}
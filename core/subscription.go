@@ -0,0 +1,648 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// Subscriptions (vanaf de subscriptions fork)
+// ----------------------------------------------------------------
+//
+// Een tx naar params.SubscriptionsAddress met Value 0 en als data
+// "GORR_SUB:" + JSON call:
+//
+//	authorize {merchant, token, maxAmount, period, end, start?, autoPull?}   sender wordt payer
+//	cancel    {id}                                                          payer of merchant
+//	pull      {id, amount?}                                                 merchant; standaard maxAmount
+//
+// Met de autorisatie mag de merchant elke period (seconden) één termijn
+// van ten hoogste maxAmount van de payer afschrijven: de eerste op start
+// (standaard de block time van de autorisatie), de laatste uiterlijk op
+// end. Een termijn kan worden afgeschreven vanaf zijn due tijd tot de
+// volgende; daarna is hij gemist en schuift de subscription door.
+//
+// Met autoPull schrijft het block zelf de termijn af zodra die due is
+// (ApplySubscriptions, na de txs en vóór Finalize). Lukt dat niet (saldo,
+// merchant suspended), dan wordt de subscription past_due en probeert elk
+// volgend block het opnieuw zolang de termijn loopt.
+//
+// Een termijn is een gewone payment: fee volgens MerchantTerms, netto
+// naar de payout van de merchant. De producer maakt er node-lokaal een
+// settled payment intent van.
+
+const SubscriptionDataPrefix = "GORR_SUB:"
+
+const (
+	SubscriptionOpAuthorize = "authorize"
+	SubscriptionOpCancel    = "cancel"
+	SubscriptionOpPull      = "pull"
+
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPastDue   = "past_due"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusEnded     = "ended"
+
+	MinSubscriptionPeriod = 60              // seconden
+	MaxSubscriptionPeriod = 366 * 24 * 3600 // een jaar
+)
+
+var (
+	// SubscriptionUpdated(uint256 indexed id, bytes32 indexed op, address indexed actor)
+	SubscriptionUpdatedTopic = crypto.Keccak256Hash([]byte("SubscriptionUpdated(uint256,bytes32,address)"))
+
+	// SubscriptionCharged(uint256 indexed id, address indexed payer, address indexed merchant,
+	// uint256 amount, uint256 fee, uint256 installment)
+	SubscriptionChargedTopic = crypto.Keccak256Hash([]byte("SubscriptionCharged(uint256,address,address,uint256,uint256,uint256)"))
+
+	ErrInvalidSubscriptionCall = errors.New("invalid subscription call")
+	ErrSubscriptionNotFound    = errors.New("subscription not found")
+
+	// ErrSubscriptionPull: de termijn kan nu niet worden afgeschreven
+	// (geen termijn due, saldo, merchant suspended).
+	ErrSubscriptionPull = errors.New("subscription pull rejected")
+)
+
+// Subscription is een autorisatie in de state.
+type Subscription struct {
+	ID          uint64          `json:"id"`
+	Payer       common.Address  `json:"payer"`
+	Merchant    common.Address  `json:"merchant"`
+	Token       string          `json:"token"`
+	MaxAmount   *big.Int        `json:"maxAmount"`
+	Period      uint64          `json:"period"` // seconden
+	Start       uint64          `json:"start"`  // unix, due tijd eerste termijn
+	End         uint64          `json:"end"`    // unix, geen termijnen daarna
+	AutoPull    bool            `json:"autoPull,omitempty"`
+	Status      string          `json:"status"`
+	NextPull    uint64          `json:"nextPull"` // due tijd van de volgende termijn
+	Pulls       uint64          `json:"pulls"`
+	Missed      uint64          `json:"missed,omitempty"`
+	PulledTotal *big.Int        `json:"pulledTotal"`
+	LastPullAt  uint64          `json:"lastPullAt,omitempty"`
+	CancelledBy *common.Address `json:"cancelledBy,omitempty"`
+	CreatedAt   uint64          `json:"createdAt"` // block number
+	UpdatedAt   uint64          `json:"updatedAt"` // block number
+}
+
+// SubscriptionCall is de JSON achter SubscriptionDataPrefix.
+type SubscriptionCall struct {
+	Op        string          `json:"op"`
+	ID        uint64          `json:"id,omitempty"` // cancel / pull
+	Merchant  *common.Address `json:"merchant,omitempty"`
+	Token     string          `json:"token,omitempty"`
+	MaxAmount *big.Int        `json:"maxAmount,omitempty"`
+	Period    uint64          `json:"period,omitempty"`
+	Start     uint64          `json:"start,omitempty"`
+	End       uint64          `json:"end,omitempty"`
+	AutoPull  bool            `json:"autoPull,omitempty"`
+	Amount    *big.Int        `json:"amount,omitempty"` // pull
+}
+
+// SubscriptionPull is één afgeschreven termijn, via een pull tx of als
+// auto pull van het block.
+type SubscriptionPull struct {
+	SubscriptionID uint64
+	Installment    uint64 // 1 = eerste termijn
+	Payer          common.Address
+	Merchant       common.Address
+	Payout         common.Address
+	Token          string
+	Amount         *big.Int // bruto
+	Fee            *big.Int
+	TxHash         common.Hash // leeg bij een auto pull
+}
+
+// IsSubscriptionCall: tx gaat naar het subscriptions adres terwijl de fork
+// actief is.
+func IsSubscriptionCall(rules params.Rules, tx *types.Transaction) bool {
+	return rules.IsSubscriptions && tx.To != nil && *tx.To == params.SubscriptionsAddress
+}
+
+// ParseSubscriptionCall decodeert de tx data van een subscription call en
+// controleert de velden die de op nodig heeft (niet de state).
+func ParseSubscriptionCall(data []byte) (*SubscriptionCall, error) {
+	if !bytes.HasPrefix(data, []byte(SubscriptionDataPrefix)) {
+		return nil, fmt.Errorf("%w: data must start with %s", ErrInvalidSubscriptionCall, SubscriptionDataPrefix)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data[len(SubscriptionDataPrefix):]))
+	dec.DisallowUnknownFields()
+	var c SubscriptionCall
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubscriptionCall, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidSubscriptionCall)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubscriptionCall, err)
+	}
+	return &c, nil
+}
+
+func (c *SubscriptionCall) validate() error {
+	switch c.Op {
+	case SubscriptionOpAuthorize:
+		if c.Merchant == nil || *c.Merchant == (common.Address{}) {
+			return errors.New("authorize needs a merchant")
+		}
+		if c.Token != nativeToken && c.Token != usdccToken {
+			return fmt.Errorf("token must be %s or %s", nativeToken, usdccToken)
+		}
+		if c.MaxAmount == nil || c.MaxAmount.Sign() <= 0 {
+			return errors.New("maxAmount must be positive")
+		}
+		if c.Period < MinSubscriptionPeriod || c.Period > MaxSubscriptionPeriod {
+			return fmt.Errorf("period must be %d-%d seconds", MinSubscriptionPeriod, MaxSubscriptionPeriod)
+		}
+		if c.End == 0 {
+			return errors.New("authorize needs an end time")
+		}
+		if c.Start > 0 && c.End < c.Start {
+			return errors.New("end before start")
+		}
+		if c.ID != 0 || c.Amount != nil {
+			return errors.New("authorize takes no id or amount")
+		}
+	case SubscriptionOpCancel, SubscriptionOpPull:
+		if c.ID == 0 {
+			return fmt.Errorf("%s needs an id", c.Op)
+		}
+		if c.Merchant != nil || c.Token != "" || c.MaxAmount != nil || c.Period != 0 || c.Start != 0 || c.End != 0 || c.AutoPull {
+			return fmt.Errorf("%s only takes an id (and amount)", c.Op)
+		}
+		if c.Op == SubscriptionOpCancel && c.Amount != nil {
+			return errors.New("cancel takes no amount")
+		}
+		if c.Amount != nil && c.Amount.Sign() <= 0 {
+			return errors.New("amount must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	return nil
+}
+
+// SubscriptionCallData bouwt de tx data voor c.
+func SubscriptionCallData(c *SubscriptionCall) ([]byte, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(SubscriptionDataPrefix), body...), nil
+}
+
+// ----------------------------------------------------------------
+// Records
+// ----------------------------------------------------------------
+
+// GetSubscription leest record id uit st; nil als het niet bestaat.
+func GetSubscription(st *state.State, id uint64) (*Subscription, error) {
+	raw, err := st.GetSubscription(id)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	return decodeSubscription(id, raw)
+}
+
+// ForEachSubscription loopt op id volgorde over alle records in st.
+func ForEachSubscription(st *state.State, fn func(sub *Subscription) error) error {
+	return st.ForEachSubscription(func(id uint64, data []byte) error {
+		sub, err := decodeSubscription(id, data)
+		if err != nil {
+			return err
+		}
+		return fn(sub)
+	})
+}
+
+func decodeSubscription(id uint64, raw []byte) (*Subscription, error) {
+	var sub Subscription
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		return nil, fmt.Errorf("subscription %d: %w", id, err)
+	}
+	return &sub, nil
+}
+
+// putSubscription schrijft sub en houdt de due index bij.
+func putSubscription(st *state.State, sub *Subscription) error {
+	prev, err := GetSubscription(st, sub.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	if err := st.SetSubscription(sub.ID, data); err != nil {
+		return err
+	}
+	var from *uint64
+	if prev != nil {
+		from = prev.checkAt()
+	}
+	return st.MoveSubscriptionDue(sub.ID, from, sub.checkAt())
+}
+
+// checkAt: vanaf welke block time ApplySubscriptions iets met sub moet
+// (nil = nooit meer). Een autoPull termijn vanaf zijn due tijd, anders
+// pas als de termijn gemist is en NextPull doorschuift.
+func (s *Subscription) checkAt() *uint64 {
+	if !s.Open() {
+		return nil
+	}
+	at := s.NextPull
+	switch {
+	case s.NextPull > s.End:
+		at = 0 // hoort al ended te zijn
+	case !s.AutoPull:
+		at = s.NextPull + s.Period
+		if at < s.NextPull {
+			at = math.MaxUint64
+		}
+	}
+	return &at
+}
+
+// indexSubscriptions bouwt de due index één keer op uit de records
+// (state van vóór de index).
+func indexSubscriptions(st *state.State) error {
+	ok, err := st.HasSubscriptionIndex()
+	if err != nil || ok {
+		return err
+	}
+	err = ForEachSubscription(st, func(sub *Subscription) error {
+		return st.MoveSubscriptionDue(sub.ID, nil, sub.checkAt())
+	})
+	if err != nil {
+		return err
+	}
+	return st.SetSubscriptionIndexed()
+}
+
+// Open: er kunnen nog termijnen worden afgeschreven.
+func (s *Subscription) Open() bool {
+	return s.Status == SubscriptionStatusActive || s.Status == SubscriptionStatusPastDue
+}
+
+// Due: de termijn van NextPull kan op tijdstip now worden afgeschreven.
+func (s *Subscription) Due(now uint64) bool {
+	return s.Open() && s.NextPull <= s.End && now >= s.NextPull && now < s.NextPull+s.Period
+}
+
+// Installment: volgnummer van de termijn van NextPull (1 = eerste).
+func (s *Subscription) Installment() uint64 {
+	return (s.NextPull-s.Start)/s.Period + 1
+}
+
+// advance schuift NextPull voorbij de termijnen die op now gemist zijn
+// (hun periode is om zonder pull) en zet de status op ended als er geen
+// termijn meer komt. true = record gewijzigd.
+func (s *Subscription) advance(now uint64) bool {
+	if !s.Open() {
+		return false
+	}
+	changed := false
+	if s.NextPull <= s.End && now >= s.NextPull+s.Period {
+		k := (now - s.NextPull) / s.Period
+		s.Missed += min(k, (s.End-s.NextPull)/s.Period+1)
+		s.NextPull += k * s.Period
+		s.Status = SubscriptionStatusActive
+		changed = true
+	}
+	if s.NextPull > s.End {
+		s.Status = SubscriptionStatusEnded
+		changed = true
+	}
+	return changed
+}
+
+// ----------------------------------------------------------------
+// State transition
+// ----------------------------------------------------------------
+
+// applySubscriptionCall voert c uit namens from. Geeft het id van de
+// subscription en, bij een pull, de afgeschreven termijn.
+func (p *StateProcessor) applySubscriptionCall(st *state.State, header *types.Header, from common.Address, c *SubscriptionCall, rules params.Rules) (uint64, *SubscriptionPull, error) {
+	if c.Op == SubscriptionOpAuthorize {
+		id, err := p.authorizeSubscription(st, header, from, c, rules)
+		return id, nil, err
+	}
+
+	sub, err := GetSubscription(st, c.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if sub == nil {
+		return 0, nil, fmt.Errorf("%w: %d", ErrSubscriptionNotFound, c.ID)
+	}
+	sub.advance(header.Time)
+
+	switch c.Op {
+	case SubscriptionOpCancel:
+		if from != sub.Payer && from != sub.Merchant {
+			return 0, nil, errors.New("only the payer or merchant can cancel this subscription")
+		}
+		if !sub.Open() {
+			return 0, nil, fmt.Errorf("subscription %d is %s", sub.ID, sub.Status)
+		}
+		sub.Status = SubscriptionStatusCancelled
+		sub.CancelledBy = &from
+		sub.UpdatedAt = rules.Number
+		return sub.ID, nil, putSubscription(st, sub)
+
+	default: // pull
+		if from != sub.Merchant {
+			return 0, nil, errors.New("only the merchant can pull this subscription")
+		}
+		amount := sub.MaxAmount
+		if c.Amount != nil {
+			if c.Amount.Cmp(sub.MaxAmount) > 0 {
+				return 0, nil, fmt.Errorf("amount %s above maxAmount %s", c.Amount, sub.MaxAmount)
+			}
+			amount = c.Amount
+		}
+		pull, err := p.pullSubscription(st, sub, amount, rules, header.Time)
+		return sub.ID, pull, err
+	}
+}
+
+func (p *StateProcessor) authorizeSubscription(st *state.State, header *types.Header, payer common.Address, c *SubscriptionCall, rules params.Rules) (uint64, error) {
+	if *c.Merchant == payer {
+		return 0, errors.New("payer and merchant must differ")
+	}
+	if c.Token == usdccToken && !rules.IsUSDCc {
+		return 0, errors.New("USDCc subscriptions need the USDCc fork")
+	}
+	if err := checkMerchantActive(st, rules, *c.Merchant); err != nil {
+		return 0, err
+	}
+	start := max(c.Start, header.Time)
+	if c.End < start {
+		return 0, fmt.Errorf("end %d before start %d", c.End, start)
+	}
+
+	id, err := st.NextSubscriptionID()
+	if err != nil {
+		return 0, err
+	}
+	sub := &Subscription{
+		ID:          id,
+		Payer:       payer,
+		Merchant:    *c.Merchant,
+		Token:       c.Token,
+		MaxAmount:   new(big.Int).Set(c.MaxAmount),
+		Period:      c.Period,
+		Start:       start,
+		End:         c.End,
+		AutoPull:    c.AutoPull,
+		Status:      SubscriptionStatusActive,
+		NextPull:    start,
+		PulledTotal: new(big.Int),
+		CreatedAt:   rules.Number,
+		UpdatedAt:   rules.Number,
+	}
+	return id, putSubscription(st, sub)
+}
+
+// pullSubscription schrijft de termijn van NextPull af (amount bruto) en
+// schuift sub door naar de volgende. Alle controles gebeuren vóór de
+// eerste write; een afgewezen pull is een ErrSubscriptionPull.
+func (p *StateProcessor) pullSubscription(st *state.State, sub *Subscription, amount *big.Int, rules params.Rules, now uint64) (*SubscriptionPull, error) {
+	if !sub.Due(now) {
+		if !sub.Open() {
+			return nil, fmt.Errorf("%w: subscription %d is %s", ErrSubscriptionPull, sub.ID, sub.Status)
+		}
+		return nil, fmt.Errorf("%w: next installment of subscription %d is due at %d", ErrSubscriptionPull, sub.ID, sub.NextPull)
+	}
+	if err := checkMerchantActive(st, rules, sub.Merchant); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSubscriptionPull, err)
+	}
+	if _, err := p.treasury(); err != nil {
+		return nil, err
+	}
+	bps, payout, err := MerchantTerms(st, rules, sub.Merchant)
+	if err != nil {
+		return nil, err
+	}
+	fee, net := PaymentSplit(bps, amount)
+
+	if sub.Token == usdccToken {
+		bal, err := st.GetUSDCcBalance(sub.Payer)
+		if err != nil {
+			return nil, err
+		}
+		if bal.Cmp(amount) < 0 {
+			return nil, fmt.Errorf("%w: insufficient USDCc balance", ErrSubscriptionPull)
+		}
+		if err := applyUSDCcTransfer(st, sub.Payer, payout, net); err != nil {
+			return nil, err
+		}
+		if err := debitUSDCc(st, sub.Payer, fee); err != nil {
+			return nil, err
+		}
+		if err := p.collectFee(st, rules, usdccToken, fee); err != nil {
+			return nil, err
+		}
+	} else {
+		bal, err := st.GetBalance(sub.Payer)
+		if err != nil {
+			return nil, err
+		}
+		if bal.Cmp(amount) < 0 {
+			return nil, fmt.Errorf("%w: insufficient balance", ErrSubscriptionPull)
+		}
+		if err := st.SetBalance(sub.Payer, new(big.Int).Sub(bal, amount)); err != nil {
+			return nil, err
+		}
+		if err := credit(st, payout, net); err != nil {
+			return nil, err
+		}
+		if err := p.collectFee(st, rules, nativeToken, fee); err != nil {
+			return nil, err
+		}
+	}
+
+	pull := &SubscriptionPull{
+		SubscriptionID: sub.ID,
+		Installment:    sub.Installment(),
+		Payer:          sub.Payer,
+		Merchant:       sub.Merchant,
+		Payout:         payout,
+		Token:          sub.Token,
+		Amount:         new(big.Int).Set(amount),
+		Fee:            fee,
+	}
+	sub.Pulls++
+	sub.PulledTotal = new(big.Int).Add(sub.PulledTotal, amount)
+	sub.LastPullAt = now
+	sub.NextPull += sub.Period
+	sub.Status = SubscriptionStatusActive
+	if sub.NextPull > sub.End {
+		sub.Status = SubscriptionStatusEnded
+	}
+	sub.UpdatedAt = rules.Number
+	return pull, putSubscription(st, sub)
+}
+
+// ApplySubscriptions loopt na de txs van een block over de open
+// subscriptions: gemiste termijnen doorschuiven, afgelopen subscriptions
+// op ended en de due termijnen van autoPull subscriptions afschrijven.
+// Gaat net als Finalize mee in de state root; de GORR fees van de pulls
+// horen in de fees die Finalize verdeelt.
+//
+// Alleen de subscriptions uit de due index met checkAt <= block time
+// worden gelezen, op id volgorde: de andere zou dit block niet wijzigen,
+// dus de uitkomst is gelijk aan een scan over alle records.
+func (p *StateProcessor) ApplySubscriptions(st *state.State, header *types.Header) ([]*SubscriptionPull, error) {
+	rules := p.config.Rules(header.Number)
+	if !rules.IsSubscriptions {
+		return nil, nil
+	}
+	if err := indexSubscriptions(st); err != nil {
+		return nil, err
+	}
+
+	// Eerst verzamelen: de pulls schrijven zelf naar st
+	ids, err := st.SubscriptionsDue(header.Time)
+	if err != nil {
+		return nil, err
+	}
+	open := make([]*Subscription, 0, len(ids))
+	for _, id := range ids {
+		sub, err := GetSubscription(st, id)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			return nil, fmt.Errorf("%w: %d in the due index", ErrSubscriptionNotFound, id)
+		}
+		if sub.Open() {
+			open = append(open, sub)
+		}
+	}
+
+	var pulls []*SubscriptionPull
+	for _, sub := range open {
+		changed := sub.advance(header.Time)
+		if sub.AutoPull && sub.Due(header.Time) {
+			pull, err := p.pullSubscription(st, sub, sub.MaxAmount, rules, header.Time)
+			if err == nil {
+				pulls = append(pulls, pull)
+				continue
+			}
+			if !errors.Is(err, ErrSubscriptionPull) {
+				return nil, err
+			}
+			if sub.Status != SubscriptionStatusPastDue {
+				sub.Status = SubscriptionStatusPastDue
+				changed = true
+			}
+		}
+		if changed {
+			sub.UpdatedAt = rules.Number
+			if err := putSubscription(st, sub); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pulls, nil
+}
+
+// checkMerchantActive: een suspended merchant (registry) krijgt geen
+// nieuwe autorisaties of termijnen.
+func checkMerchantActive(st *state.State, rules params.Rules, merchant common.Address) error {
+	if !rules.IsMerchants {
+		return nil
+	}
+	m, err := GetMerchant(st, merchant)
+	if err != nil {
+		return err
+	}
+	if m != nil && m.Status == MerchantStatusSuspended {
+		return fmt.Errorf("merchant %s is suspended", merchant.Hex())
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------
+// Logs
+// ----------------------------------------------------------------
+
+func subscriptionUpdatedLog(id uint64, op string, actor common.Address) *types.Log {
+	return &types.Log{
+		Address: params.SubscriptionsAddress,
+		Topics: []common.Hash{
+			SubscriptionUpdatedTopic,
+			common.BigToHash(new(big.Int).SetUint64(id)),
+			common.BytesToHash(common.RightPadBytes([]byte(op), 32)),
+			common.BytesToHash(actor.Bytes()),
+		},
+		Data: []byte{},
+	}
+}
+
+func subscriptionChargedLog(pull *SubscriptionPull) *types.Log {
+	data := make([]byte, 0, 96)
+	data = append(data, common.BigToHash(pull.Amount).Bytes()...)
+	data = append(data, common.BigToHash(pull.Fee).Bytes()...)
+	data = append(data, common.BigToHash(new(big.Int).SetUint64(pull.Installment)).Bytes()...)
+	return &types.Log{
+		Address: params.SubscriptionsAddress,
+		Topics: []common.Hash{
+			SubscriptionChargedTopic,
+			common.BigToHash(new(big.Int).SetUint64(pull.SubscriptionID)),
+			common.BytesToHash(pull.Payer.Bytes()),
+			common.BytesToHash(pull.Merchant.Bytes()),
+		},
+		Data: data,
+	}
+}
+
+// SubscriptionPullsOf haalt de pulls van de pull txs uit receipts (via
+// het SubscriptionCharged log); token en payout komen uit st, de state na
+// het block.
+func SubscriptionPullsOf(st *state.State, rules params.Rules, receipts []*types.Receipt) ([]*SubscriptionPull, error) {
+	var pulls []*SubscriptionPull
+	for _, r := range receipts {
+		for _, l := range r.Logs {
+			if l.Address != params.SubscriptionsAddress || len(l.Topics) != 4 || l.Topics[0] != SubscriptionChargedTopic || len(l.Data) != 96 {
+				continue
+			}
+			id := new(big.Int).SetBytes(l.Topics[1].Bytes()).Uint64()
+			sub, err := GetSubscription(st, id)
+			if err != nil {
+				return nil, err
+			}
+			if sub == nil {
+				return nil, fmt.Errorf("%w: %d", ErrSubscriptionNotFound, id)
+			}
+			_, payout, err := MerchantTerms(st, rules, sub.Merchant)
+			if err != nil {
+				return nil, err
+			}
+			pulls = append(pulls, &SubscriptionPull{
+				SubscriptionID: id,
+				Installment:    new(big.Int).SetBytes(l.Data[64:96]).Uint64(),
+				Payer:          sub.Payer,
+				Merchant:       sub.Merchant,
+				Payout:         payout,
+				Token:          sub.Token,
+				Amount:         new(big.Int).SetBytes(l.Data[:32]),
+				Fee:            new(big.Int).SetBytes(l.Data[32:64]),
+				TxHash:         r.TxHash,
+			})
+		}
+	}
+	return pulls, nil
+}
@@ -0,0 +1,345 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// checkDueIndex: elke open subscription staat precies op checkAt in de
+// index, de rest niet, en een subscription die nog niet aan de beurt is
+// zou op now ook niet veranderen (dus de scan mist niets).
+func checkDueIndex(t *testing.T, st *state.State, now uint64) {
+	t.Helper()
+	all, err := st.SubscriptionsDue(math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ForEachSubscription(st, func(sub *Subscription) error {
+		at := sub.checkAt()
+		if at == nil {
+			if slices.Contains(all, sub.ID) {
+				return fmt.Errorf("%s subscription %d in the due index", sub.Status, sub.ID)
+			}
+			return nil
+		}
+		due, err := st.SubscriptionsDue(*at)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(due, sub.ID) {
+			return fmt.Errorf("subscription %d not due at %d", sub.ID, *at)
+		}
+		if *at > 0 {
+			early, err := st.SubscriptionsDue(*at - 1)
+			if err != nil {
+				return err
+			}
+			if slices.Contains(early, sub.ID) {
+				return fmt.Errorf("subscription %d due before %d", sub.ID, *at)
+			}
+		}
+		if *at > now {
+			cp := *sub
+			if cp.advance(now) || (cp.AutoPull && cp.Due(now)) {
+				return fmt.Errorf("subscription %d changes at %d but is indexed at %d", sub.ID, now, *at)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func subscriptionsConfig() *params.ChainConfig {
+	cfg := params.GorrillazzChainConfig()
+	zero := uint64(0)
+	cfg.SubscriptionsBlock = &zero
+	return cfg
+}
+
+// applySubscriptions: ApplySubscriptions op een overlay, zoals een block.
+func (e *txEnv) applySubscriptions(number, blockTime uint64) []*SubscriptionPull {
+	e.t.Helper()
+	ov := e.st.Begin()
+	pulls, err := e.p.ApplySubscriptions(ov, &types.Header{Number: number, Time: blockTime})
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if err := ov.Commit(); err != nil {
+		e.t.Fatal(err)
+	}
+	return pulls
+}
+
+func TestParseSubscriptionCall(t *testing.T) {
+	m := `"merchant":"0x0000000000000000000000000000000000000a11"`
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"authorize", `{"op":"authorize",` + m + `,"token":"GORR","maxAmount":100,"period":60,"end":2000}`, true},
+		{"authorize USDCc with autoPull", `{"op":"authorize",` + m + `,"token":"USDCc","maxAmount":100,"period":60,"end":2000,"autoPull":true}`, true},
+		{"no merchant", `{"op":"authorize","token":"GORR","maxAmount":100,"period":60,"end":2000}`, false},
+		{"unknown token", `{"op":"authorize",` + m + `,"token":"ETH","maxAmount":100,"period":60,"end":2000}`, false},
+		{"zero maxAmount", `{"op":"authorize",` + m + `,"token":"GORR","maxAmount":0,"period":60,"end":2000}`, false},
+		{"period too short", `{"op":"authorize",` + m + `,"token":"GORR","maxAmount":100,"period":59,"end":2000}`, false},
+		{"no end", `{"op":"authorize",` + m + `,"token":"GORR","maxAmount":100,"period":60}`, false},
+		{"end before start", `{"op":"authorize",` + m + `,"token":"GORR","maxAmount":100,"period":60,"start":3000,"end":2000}`, false},
+		{"authorize with id", `{"op":"authorize","id":1,` + m + `,"token":"GORR","maxAmount":100,"period":60,"end":2000}`, false},
+		{"cancel", `{"op":"cancel","id":1}`, true},
+		{"cancel without id", `{"op":"cancel"}`, false},
+		{"cancel with amount", `{"op":"cancel","id":1,"amount":5}`, false},
+		{"pull", `{"op":"pull","id":1}`, true},
+		{"pull with amount", `{"op":"pull","id":1,"amount":5}`, true},
+		{"pull zero", `{"op":"pull","id":1,"amount":0}`, false},
+		{"pull with terms", `{"op":"pull","id":1,"period":60}`, false},
+		{"unknown field", `{"op":"cancel","id":1,"reason":"x"}`, false},
+		{"trailing data", `{"op":"cancel","id":1}{}`, false},
+		{"unknown op", `{"op":"pause","id":1}`, false},
+	}
+	for _, tt := range tests {
+		_, err := ParseSubscriptionCall([]byte(SubscriptionDataPrefix + tt.data))
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidSubscriptionCall) {
+			t.Errorf("%s: error %v, want ErrInvalidSubscriptionCall", tt.name, err)
+		}
+	}
+}
+
+// Elke stap is een tx naar het subscriptions adres of een block met
+// ApplySubscriptions; daarna de stand van subscription 1 (handmatig) en 2
+// (autoPull).
+func TestSubscriptionLifecycle(t *testing.T) {
+	payerKey, merchantKey, otherKey := mustKey(t), mustKey(t), mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := crypto.PubkeyToAddress(merchantKey.PublicKey)
+	e := newTxEnv(t, subscriptionsConfig(), payer, merchant)
+	to := params.SubscriptionsAddress
+
+	authorize := func(autoPull bool) string {
+		return fmt.Sprintf(`GORR_SUB:{"op":"authorize","merchant":"%s","token":"GORR","maxAmount":100,"period":60,"end":1200,"autoPull":%t}`, merchant.Hex(), autoPull)
+	}
+	if err := e.apply(payerKey, to, 0, fmt.Sprintf(`GORR_SUB:{"op":"authorize","merchant":"%s","token":"GORR","maxAmount":100,"period":60,"end":1200}`, payer.Hex()), 1, 1000); err == nil || !strings.Contains(err.Error(), "must differ") {
+		t.Fatalf("authorize to self: %v", err)
+	}
+	for _, autoPull := range []bool{false, true} {
+		if err := e.apply(payerKey, to, 0, authorize(autoPull), 1, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	payerStart := e.balance(payer)
+
+	steps := []struct {
+		name   string
+		block  bool // ApplySubscriptions i.p.v. een tx
+		key    bool // true = merchant, false = other
+		data   string
+		time   uint64
+		err    string
+		pulls  int // auto pulls van het block
+		status [2]string
+		paid   [2]uint64 // Pulls
+	}{
+		{"auto pull of the first installment", true, false, "", 1000, "", 1, [2]string{"active", "active"}, [2]uint64{0, 1}},
+		{"pull by another address", false, false, `GORR_SUB:{"op":"pull","id":1}`, 1010, "only the merchant", 0, [2]string{"active", "active"}, [2]uint64{0, 1}},
+		{"pull above maxAmount", false, true, `GORR_SUB:{"op":"pull","id":1,"amount":101}`, 1010, "above maxAmount", 0, [2]string{"active", "active"}, [2]uint64{0, 1}},
+		{"pull", false, true, `GORR_SUB:{"op":"pull","id":1,"amount":40}`, 1010, "", 0, [2]string{"active", "active"}, [2]uint64{1, 1}},
+		{"pull twice in one period", false, true, `GORR_SUB:{"op":"pull","id":1}`, 1020, "due at 1060", 0, [2]string{"active", "active"}, [2]uint64{1, 1}},
+		{"no auto pull before the next period", true, false, "", 1050, "", 0, [2]string{"active", "active"}, [2]uint64{1, 1}},
+		{"auto pull skips a missed period", true, false, "", 1130, "", 1, [2]string{"active", "active"}, [2]uint64{1, 2}},
+		{"cancel by another address", false, false, `GORR_SUB:{"op":"cancel","id":1}`, 1130, "only the payer or merchant", 0, [2]string{"active", "active"}, [2]uint64{1, 2}},
+		{"cancel by the merchant", false, true, `GORR_SUB:{"op":"cancel","id":1}`, 1130, "", 0, [2]string{"cancelled", "active"}, [2]uint64{1, 2}},
+		{"pull after cancel", false, true, `GORR_SUB:{"op":"pull","id":1}`, 1130, "is cancelled", 0, [2]string{"cancelled", "active"}, [2]uint64{1, 2}},
+		{"last installment", true, false, "", 1200, "", 1, [2]string{"cancelled", "ended"}, [2]uint64{1, 3}},
+		{"unknown subscription", false, true, `GORR_SUB:{"op":"pull","id":9}`, 1200, "not found", 0, [2]string{"cancelled", "ended"}, [2]uint64{1, 3}},
+	}
+	number := uint64(2)
+	for _, st := range steps {
+		if st.block {
+			if pulls := e.applySubscriptions(number, st.time); len(pulls) != st.pulls {
+				t.Fatalf("%s: %d auto pulls, want %d", st.name, len(pulls), st.pulls)
+			}
+		} else {
+			key := otherKey
+			if st.key {
+				key = merchantKey
+			}
+			err := e.apply(key, to, 0, st.data, number, st.time)
+			if st.err == "" && err != nil || st.err != "" && (err == nil || !strings.Contains(err.Error(), st.err)) {
+				t.Fatalf("%s: error %v, want %q", st.name, err, st.err)
+			}
+		}
+		number++
+		for i := range 2 {
+			sub, err := GetSubscription(e.st, uint64(i+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.Status != st.status[i] || sub.Pulls != st.paid[i] {
+				t.Fatalf("%s: subscription %d is %s with %d pulls, want %s with %d", st.name, i+1, sub.Status, sub.Pulls, st.status[i], st.paid[i])
+			}
+		}
+	}
+
+	// 40 handmatig + 3 auto pulls van 100
+	if got := payerStart - e.balance(payer); got != 340 {
+		t.Fatalf("payer paid %d, want 340", got)
+	}
+	if sub, _ := GetSubscription(e.st, 2); sub.Missed != 1 || sub.PulledTotal.Int64() != 300 {
+		t.Fatalf("auto pull subscription %+v", sub)
+	}
+}
+
+// Zonder saldo wordt een autoPull subscription past_due; elk block probeert
+// de lopende termijn opnieuw.
+func TestSubscriptionPastDue(t *testing.T) {
+	payerKey, merchantKey := mustKey(t), mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := crypto.PubkeyToAddress(merchantKey.PublicKey)
+	e := newTxEnv(t, subscriptionsConfig(), payer)
+
+	data := fmt.Sprintf(`GORR_SUB:{"op":"authorize","merchant":"%s","token":"GORR","maxAmount":200000,"period":60,"end":2000,"autoPull":true}`, merchant.Hex())
+	if err := e.apply(payerKey, params.SubscriptionsAddress, 0, data, 1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if pulls := e.applySubscriptions(1, 1000); len(pulls) != 0 {
+		t.Fatalf("pulls %+v without balance", pulls)
+	}
+	if sub, _ := GetSubscription(e.st, 1); sub.Status != SubscriptionStatusPastDue {
+		t.Fatalf("status %s, want past_due", sub.Status)
+	}
+
+	if err := e.st.SetBalance(payer, big.NewInt(300_000)); err != nil {
+		t.Fatal(err)
+	}
+	pulls := e.applySubscriptions(2, 1030)
+	if len(pulls) != 1 || pulls[0].Installment != 1 {
+		t.Fatalf("retry pulls %+v", pulls)
+	}
+	if sub, _ := GetSubscription(e.st, 1); sub.Status != SubscriptionStatusActive || sub.NextPull != 1060 {
+		t.Fatalf("after the retry %+v", sub)
+	}
+}
+
+func TestSubscriptionDueIndex(t *testing.T) {
+	payerKey, poorKey, merchantKey := mustKey(t), mustKey(t), mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := crypto.PubkeyToAddress(merchantKey.PublicKey)
+	e := newTxEnv(t, subscriptionsConfig(), payer, merchant)
+
+	to := params.SubscriptionsAddress
+	for _, sub := range []struct {
+		key      *ecdsa.PrivateKey
+		autoPull bool
+	}{
+		{payerKey, true},  // 1: pulls elke 60s
+		{payerKey, false}, // 2: merchant pullt zelf, termijnen worden gemist
+		{poorKey, true},   // 3: past_due, elk block opnieuw
+		{payerKey, true},  // 4: wordt gecancelled
+	} {
+		data := fmt.Sprintf(`GORR_SUB:{"op":"authorize","merchant":"%s","token":"GORR","maxAmount":100,"period":60,"end":1300,"autoPull":%t}`, merchant.Hex(), sub.autoPull)
+		if err := e.apply(sub.key, to, 0, data, 1, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.apply(payerKey, to, 0, `GORR_SUB:{"op":"cancel","id":4}`, 1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	checkDueIndex(t, e.st, 1000)
+
+	pulled := map[uint64]int{}
+	number := uint64(1)
+	for now := uint64(1000); now <= 1400; now += 20 {
+		if now == 1100 {
+			// Handmatige pull van 2 in zijn tweede termijn
+			if err := e.apply(merchantKey, to, 0, `GORR_SUB:{"op":"pull","id":2}`, number, now); err != nil {
+				t.Fatal(err)
+			}
+			pulled[2]++
+		}
+		for _, pull := range e.applySubscriptions(number, now) {
+			pulled[pull.SubscriptionID]++
+		}
+		checkDueIndex(t, e.st, now)
+		number++
+	}
+
+	// 1000..1300 = 6 termijnen voor de autoPull van payer
+	if pulled[1] != 6 || pulled[2] != 1 || pulled[3] != 0 || pulled[4] != 0 {
+		t.Fatalf("pulls %v, want 6 for 1, 1 for 2 and none for 3 and 4", pulled)
+	}
+	for id, want := range map[uint64]string{1: SubscriptionStatusEnded, 2: SubscriptionStatusEnded, 3: SubscriptionStatusEnded, 4: SubscriptionStatusCancelled} {
+		sub, err := GetSubscription(e.st, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sub.Status != want {
+			t.Fatalf("subscription %d is %s, want %s", id, sub.Status, want)
+		}
+	}
+	if all, _ := e.st.SubscriptionsDue(math.MaxUint64); len(all) != 0 {
+		t.Fatalf("due index still holds %v", all)
+	}
+}
+
+// Een state van vóór de index: ApplySubscriptions bouwt hem uit de records.
+func TestSubscriptionDueIndexRebuild(t *testing.T) {
+	payerKey, merchantKey := mustKey(t), mustKey(t)
+	payer := crypto.PubkeyToAddress(payerKey.PublicKey)
+	merchant := crypto.PubkeyToAddress(merchantKey.PublicKey)
+	e := newTxEnv(t, subscriptionsConfig(), payer)
+
+	for id, status := range map[uint64]string{1: SubscriptionStatusActive, 2: SubscriptionStatusCancelled} {
+		data, err := json.Marshal(&Subscription{
+			ID: id, Payer: payer, Merchant: merchant, Token: nativeToken, MaxAmount: big.NewInt(100),
+			Period: 60, Start: 1000, End: 1300, AutoPull: true, Status: status, NextPull: 1000, PulledTotal: new(big.Int),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.st.SetSubscription(id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := e.st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Een afgekeurd block laat de state (en dus de index) ongemoeid
+	ov := e.st.Begin()
+	if _, err := e.p.ApplySubscriptions(ov, &types.Header{Number: 1, Time: 900}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := e.st.HasSubscriptionIndex(); ok {
+		t.Fatal("index built outside the overlay")
+	}
+	if got, _ := ov.Root(); got != root {
+		t.Fatal("building the index changed the state root")
+	}
+
+	pulls := e.applySubscriptions(1, 1000)
+	if len(pulls) != 1 || pulls[0].SubscriptionID != 1 {
+		t.Fatalf("pulls %+v, want subscription 1", pulls)
+	}
+	if ok, _ := e.st.HasSubscriptionIndex(); !ok {
+		t.Fatal("index not built")
+	}
+	checkDueIndex(t, e.st, 1000)
+}
@@ -2,22 +2,69 @@ package txpool
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Limieten: txs komen ook van peers, dus de pool mag niet onbegrensd
+// groeien. Zie SetLimits.
+const (
+	DefaultMaxPending    = 4096 // txs in de hele pool
+	DefaultMaxPerAccount = 64   // pending txs per sender
+	DefaultMaxNonceGap   = 16   // hoe ver een nonce voor de pending nonce mag liggen
+)
+
+var (
+	ErrAlreadyKnown = errors.New("already known")
+	ErrPoolFull     = errors.New("txpool is full")
+	ErrAccountLimit = errors.New("too many pending txs for this account")
+	ErrNonceTooLow  = errors.New("nonce too low")
+	ErrNonceGap     = errors.New("nonce too far ahead")
 )
 
 type TxPool struct {
-	mu      sync.RWMutex
-	pending []*types.Transaction
+	mu       sync.RWMutex
+	pending  []*types.Transaction // in volgorde van binnenkomst
+	byHash   map[common.Hash]*types.Transaction
+	bySender map[common.Address]int
+
+	maxPending    int
+	maxPerAccount int
+	maxNonceGap   uint64
 }
 
 func NewTxPool() *TxPool {
 	return &TxPool{
-		pending: []*types.Transaction{},
+		pending:       []*types.Transaction{},
+		byHash:        map[common.Hash]*types.Transaction{},
+		bySender:      map[common.Address]int{},
+		maxPending:    DefaultMaxPending,
+		maxPerAccount: DefaultMaxPerAccount,
+		maxNonceGap:   DefaultMaxNonceGap,
+	}
+}
+
+// SetLimits vervangt de limieten; 0 laat een limiet zoals hij is.
+func (p *TxPool) SetLimits(maxPending, maxPerAccount int, maxNonceGap uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if maxPending > 0 {
+		p.maxPending = maxPending
+	}
+	if maxPerAccount > 0 {
+		p.maxPerAccount = maxPerAccount
+	}
+	if maxNonceGap > 0 {
+		p.maxNonceGap = maxNonceGap
 	}
 }
 
+// Add zet tx in de pool binnen de pool- en account limieten, zonder
+// nonce controle (eigen txs, tests).
 func (p *TxPool) Add(tx *types.Transaction) error {
 	if tx == nil {
 		return errors.New("nil tx")
@@ -25,7 +72,45 @@ func (p *TxPool) Add(tx *types.Transaction) error {
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+
+	return p.addLocked(tx)
+}
+
+// AddWithNonce is Add voor txs van buiten (RPC, peers): de nonce moet
+// minstens stateNonce zijn en mag niet meer dan de nonce gap voor de
+// pending nonce van de sender liggen.
+func (p *TxPool) AddWithNonce(tx *types.Transaction, stateNonce uint64) error {
+	if tx == nil {
+		return errors.New("nil tx")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if tx.Nonce < stateNonce {
+		return fmt.Errorf("%w: got %d want %d", ErrNonceTooLow, tx.Nonce, stateNonce)
+	}
+	if next := p.pendingNonceLocked(tx.Sender, stateNonce); tx.Nonce > next+p.maxNonceGap {
+		return fmt.Errorf("%w: got %d, pending nonce %d (max gap %d)", ErrNonceGap, tx.Nonce, next, p.maxNonceGap)
+	}
+	return p.addLocked(tx)
+}
+
+func (p *TxPool) addLocked(tx *types.Transaction) error {
+	h := tx.Hash()
+	if _, ok := p.byHash[h]; ok {
+		return ErrAlreadyKnown
+	}
+	if len(p.pending) >= p.maxPending {
+		return ErrPoolFull
+	}
+	if p.bySender[tx.Sender] >= p.maxPerAccount {
+		return fmt.Errorf("%w (%d)", ErrAccountLimit, p.maxPerAccount)
+	}
+
 	p.pending = append(p.pending, tx)
+	p.byHash[h] = tx
+	p.bySender[tx.Sender]++
 	return nil
 }
 
@@ -38,15 +123,71 @@ func (p *TxPool) Pending() []*types.Transaction {
 	return list
 }
 
+// Get geeft de pending tx met deze hash, of nil.
+func (p *TxPool) Get(hash common.Hash) *types.Transaction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.byHash[hash]
+}
+
+// PendingNonce geeft de eerstvolgende vrije nonce voor addr, uitgaande
+// van de state nonce plus aaneengesloten pending txs (tx.Sender).
+func (p *TxPool) PendingNonce(addr common.Address, stateNonce uint64) uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.pendingNonceLocked(addr, stateNonce)
+}
+
+func (p *TxPool) pendingNonceLocked(addr common.Address, stateNonce uint64) uint64 {
+	used := map[uint64]bool{}
+	for _, t := range p.pending {
+		if t.Sender == addr {
+			used[t.Nonce] = true
+		}
+	}
+
+	next := stateNonce
+	for used[next] {
+		next++
+	}
+	return next
+}
+
 func (p *TxPool) Remove(tx *types.Transaction) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	newList := []*types.Transaction{}
+	h := tx.Hash()
+	known, ok := p.byHash[h]
+	if !ok {
+		return
+	}
+	newList := make([]*types.Transaction, 0, len(p.pending)-1)
 	for _, t := range p.pending {
-		if t.Hash() != tx.Hash() {
+		if t != known {
 			newList = append(newList, t)
 		}
 	}
 	p.pending = newList
+	delete(p.byHash, h)
+	if p.bySender[known.Sender]--; p.bySender[known.Sender] <= 0 {
+		delete(p.bySender, known.Sender)
+	}
+}
+
+// Reset vervangt de hele pool (dev: evm_revert). De limieten gelden hier
+// niet: txs komen uit een eerdere stand van dezelfde pool.
+func (p *TxPool) Reset(txs []*types.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = append([]*types.Transaction{}, txs...)
+	p.byHash = make(map[common.Hash]*types.Transaction, len(txs))
+	p.bySender = map[common.Address]int{}
+	for _, t := range txs {
+		p.byHash[t.Hash()] = t
+		p.bySender[t.Sender]++
+	}
 }
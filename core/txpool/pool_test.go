@@ -0,0 +1,112 @@
+package txpool
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func poolTx(sender common.Address, nonce uint64) *types.Transaction {
+	to := common.HexToAddress("0xb0b")
+	return &types.Transaction{Nonce: nonce, To: &to, Value: big.NewInt(1), GasPrice: new(big.Int), Sender: sender}
+}
+
+func TestAddRejectsDuplicates(t *testing.T) {
+	p := NewTxPool()
+	a := common.HexToAddress("0xa")
+	tx := poolTx(a, 0)
+	if err := p.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(poolTx(a, 0)); !errors.Is(err, ErrAlreadyKnown) {
+		t.Fatalf("same tx again: %v, want %v", err, ErrAlreadyKnown)
+	}
+	if got := p.Get(tx.Hash()); got != tx {
+		t.Fatalf("Get = %v, want the added tx", got)
+	}
+
+	p.Remove(tx)
+	if p.Get(tx.Hash()) != nil || len(p.Pending()) != 0 {
+		t.Fatal("tx still pending after Remove")
+	}
+	if err := p.Add(tx); err != nil {
+		t.Fatalf("re-adding a removed tx: %v", err)
+	}
+}
+
+func TestPendingNonce(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	p := NewTxPool()
+	for _, tx := range []*types.Transaction{poolTx(a, 2), poolTx(a, 3), poolTx(a, 5), poolTx(b, 0)} {
+		if err := p.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		addr       common.Address
+		stateNonce uint64
+		want       uint64
+	}{
+		{a, 2, 4}, // 2, 3 aaneengesloten; 5 is een gat verder
+		{a, 0, 0}, // nonce 0 en 1 ontbreken
+		{a, 4, 4},
+		{a, 5, 6},
+		{b, 0, 1},
+		{common.HexToAddress("0xc"), 7, 7},
+	}
+	for _, tt := range tests {
+		if got := p.PendingNonce(tt.addr, tt.stateNonce); got != tt.want {
+			t.Errorf("%s from %d: pending nonce %d, want %d", tt.addr.Hex(), tt.stateNonce, got, tt.want)
+		}
+	}
+}
+
+func TestPoolLimits(t *testing.T) {
+	a, b, c := common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+	p := NewTxPool()
+	p.SetLimits(4, 2, 3)
+
+	steps := []struct {
+		name       string
+		tx         *types.Transaction
+		stateNonce uint64
+		err        error
+	}{
+		{"first", poolTx(a, 5), 5, nil},
+		{"nonce below the state", poolTx(a, 4), 5, ErrNonceTooLow},
+		{"gap of 3", poolTx(b, 3), 0, nil},
+		{"gap of 4", poolTx(c, 4), 0, ErrNonceGap},
+		{"gap counts from the pending nonce", poolTx(a, 9), 5, nil},
+		{"third tx of a sender", poolTx(a, 6), 5, ErrAccountLimit},
+		{"fills the pool", poolTx(c, 0), 0, nil},
+		{"pool full", poolTx(c, 1), 0, ErrPoolFull},
+		{"known tx before the limits", poolTx(a, 5), 5, ErrAlreadyKnown},
+	}
+	for _, st := range steps {
+		if err := p.AddWithNonce(st.tx, st.stateNonce); !errors.Is(err, st.err) {
+			t.Fatalf("%s: error %v, want %v", st.name, err, st.err)
+		}
+	}
+
+	// Remove maakt ruimte voor de pool en de sender
+	p.Remove(poolTx(a, 9))
+	if err := p.AddWithNonce(poolTx(a, 6), 5); err != nil {
+		t.Fatalf("after Remove: %v", err)
+	}
+	if got := len(p.Pending()); got != 4 {
+		t.Fatalf("%d pending, want 4", got)
+	}
+
+	// Reset bouwt de index opnieuw op
+	p.Reset([]*types.Transaction{poolTx(a, 5)})
+	if p.Get(poolTx(a, 6).Hash()) != nil || p.Get(poolTx(a, 5).Hash()) == nil {
+		t.Fatal("hash index not rebuilt by Reset")
+	}
+	if err := p.AddWithNonce(poolTx(a, 6), 5); err != nil {
+		t.Fatalf("after Reset: %v", err)
+	}
+}
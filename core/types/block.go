@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 // Header beschrijft de metadata van een block
@@ -14,12 +15,53 @@ type Header struct {
 	Time       uint64      `json:"timestamp"`
 	StateRoot  common.Hash `json:"stateRoot"`
 	TxRoot     common.Hash `json:"txRoot"`
+
+	// Gas (omitempty: blocks van vóór gas accounting houden hun hash)
+	GasLimit uint64 `json:"gasLimit,omitempty"`
+	GasUsed  uint64 `json:"gasUsed,omitempty"`
+
+	// --- PoA (consensus/poa) ---
+	// omitempty: oude, ongetekende headers houden zo hun oorspronkelijke hash.
+
+	// Coinbase: de proposer, ontvangt het producer deel van fees en
+	// issuance (rewards fork). Leeg = dat deel gaat naar de treasury.
+	Coinbase common.Address `json:"coinbase,omitempty"`
+
+	// Difficulty: 2 = in-turn, 1 = out-of-turn proposer
+	Difficulty uint64 `json:"difficulty,omitempty"`
+	// Vote: optionele validator-stem van de proposer (getekend via Signature)
+	Vote *Vote `json:"vote,omitempty"`
+	// Signature: secp256k1 [R || S || V] van de proposer over SealHash()
+	Signature hexutil.Bytes `json:"signature,omitempty"`
+}
+
+// Vote stelt voor een validator toe te voegen (Authorize) of te verwijderen.
+type Vote struct {
+	Address   common.Address `json:"address"`
+	Authorize bool           `json:"authorize"`
 }
 
 // Block = header + lijst transacties
 type Block struct {
 	Header       *Header        `json:"header"`
 	Transactions []*Transaction `json:"transactions"`
+
+	// Finality certificaat (alleen BFT). Valt buiten de block hash.
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+// DeriveTxRoot: keccak over de tx hashes, zodat de header (en dus de
+// block hash) de transacties vastlegt. Geen txs = lege hash.
+func DeriveTxRoot(txs []*Transaction) common.Hash {
+	if len(txs) == 0 {
+		return common.Hash{}
+	}
+	buf := make([]byte, 0, len(txs)*common.HashLength)
+	for _, tx := range txs {
+		h := tx.Hash()
+		buf = append(buf, h[:]...)
+	}
+	return common.BytesToHash(Keccak256(buf))
 }
 
 // SerializeHeader serialiseert alleen de header naar JSON (voor de hash)
@@ -32,3 +74,17 @@ func (b *Block) SerializeHeader() []byte {
 func (b *Block) Hash() common.Hash {
 	return common.BytesToHash(Keccak256(b.SerializeHeader()))
 }
+
+// Hash is gelijk aan Block.Hash(), maar dan direct op de header.
+func (h *Header) Hash() common.Hash {
+	out, _ := json.Marshal(h)
+	return common.BytesToHash(Keccak256(out))
+}
+
+// SealHash is de hash die de proposer tekent: de header zonder Signature.
+func (h *Header) SealHash() common.Hash {
+	cpy := *h
+	cpy.Signature = nil
+	out, _ := json.Marshal(&cpy)
+	return common.BytesToHash(Keccak256(out))
+}
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CommitSig is één precommit-handtekening van een validator.
+type CommitSig struct {
+	Validator common.Address `json:"validator"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// Certificate bewijst dat 2f+1 validators het block in (Height, Round)
+// hebben geprecommit (consensus/bft). Een block met certificaat is final.
+type Certificate struct {
+	Height     uint64      `json:"height"`
+	Round      uint64      `json:"round"`
+	BlockHash  common.Hash `json:"blockHash"`
+	Signatures []CommitSig `json:"signatures"`
+}
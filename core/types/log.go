@@ -0,0 +1,20 @@
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Log is een Ethereum-compatibel event-log dat in een receipt terechtkomt.
+// De chain heeft geen EVM; logs worden door de state transition zelf
+// geschreven (bijv. bij een GORR_PAY betaling).
+type Log struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    []byte         `json:"data"`
+
+	BlockNumber uint64      `json:"blockNumber"`
+	TxHash      common.Hash `json:"transactionHash"`
+	TxIndex     uint64      `json:"transactionIndex"`
+	BlockHash   common.Hash `json:"blockHash"`
+	Index       uint64      `json:"logIndex"`
+}
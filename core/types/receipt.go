@@ -1,6 +1,8 @@
 package types
 
 import (
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -13,6 +15,30 @@ type Receipt struct {
 	From common.Address `json:"from"`
 	To   common.Address `json:"to"`
 
-	GasUsed uint64 `json:"gasUsed"`
-	Status  uint64 `json:"status"` // 1 = success
+	GasUsed           uint64 `json:"gasUsed"`
+	CumulativeGasUsed uint64 `json:"cumulativeGasUsed"` // GasUsed t/m deze tx in het block
+	Status            uint64 `json:"status"`            // 1 = success
+
+	// Betaalde prijs per gas; nil = gas niet in rekening gebracht (vóór de
+	// GasCharge fork).
+	EffectiveGasPrice *big.Int `json:"effectiveGasPrice,omitempty"`
+
+	// Fee: payment fee + gas kosten van deze tx (vanaf de rewards fork
+	// verdeeld via de BlockRewards van het block).
+	Fee *big.Int `json:"fee,omitempty"`
+
+	// PaymentFee: de payment fee van een GORR_PAY betaling, in het token
+	// van de betaling (volgens de fee van de merchant, zonder gas).
+	PaymentFee *big.Int `json:"paymentFee,omitempty"`
+
+	// FeeUSDCc: payment fee van een USDCc betaling (naar de treasury, vanaf
+	// de rewards fork verdeeld door Finalize).
+	FeeUSDCc *big.Int `json:"feeUSDCc,omitempty"`
+
+	// FeeRefund / FeeRefundUSDCc: fee die de treasury bij een GORR_REFUND
+	// aan de payer teruggeeft.
+	FeeRefund      *big.Int `json:"feeRefund,omitempty"`
+	FeeRefundUSDCc *big.Int `json:"feeRefundUSDCc,omitempty"`
+
+	Logs []*Log `json:"logs"`
 }
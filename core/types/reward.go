@@ -0,0 +1,46 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Bron en rol van een payout (zie params.Split)
+const (
+	PayoutSourceFees      = "fees"
+	PayoutSourceFeesUSDCc = "feesUSDCc" // payout in USDCc
+	PayoutSourceIssuance  = "issuance"
+
+	PayoutRoleProducer = "producer"
+	PayoutRoleTreasury = "treasury"
+	PayoutRoleBurn     = "burn"
+)
+
+// Payout: één uitbetaling aan het einde van een block. Bij RoleBurn is
+// Recipient leeg en wordt het bedrag nergens bijgeschreven.
+type Payout struct {
+	Source    string         `json:"source"`
+	Role      string         `json:"role"`
+	Recipient common.Address `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+// BlockRewards legt per block (vanaf de rewards fork) vast wat er aan fees
+// binnenkwam, wat er gemunt en verbrand is en wie wat kreeg. Zo is de
+// supply per block na te rekenen: Δsupply = Issuance - Burned (GORR) en
+// -BurnedUSDCc (USDCc).
+type BlockRewards struct {
+	BlockNumber uint64         `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Coinbase    common.Address `json:"coinbase"`
+
+	Fees     *big.Int  `json:"fees"`
+	Issuance *big.Int  `json:"issuance"`
+	Burned   *big.Int  `json:"burned"`
+	Payouts  []*Payout `json:"payouts"`
+
+	// USDCc fees (payments en pulls); nil als het block er geen had
+	FeesUSDCc   *big.Int `json:"feesUSDCc,omitempty"`
+	BurnedUSDCc *big.Int `json:"burnedUSDCc,omitempty"`
+}
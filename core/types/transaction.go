@@ -4,10 +4,24 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// Tx types (EIP-2718). Typed txs zijn pas geldig vanaf de TypedTx fork
+// (params.ChainConfig).
+const (
+	LegacyTxType     = gethtypes.LegacyTxType
+	AccessListTxType = gethtypes.AccessListTxType
+	DynamicFeeTxType = gethtypes.DynamicFeeTxType
+)
+
 type Transaction struct {
+	// 0 = legacy; velden hieronder met omitempty bestaan alleen bij typed txs,
+	// zodat legacy blocks op disk ongewijzigd blijven.
+	Type    uint8    `json:",omitempty"`
+	ChainID *big.Int `json:",omitempty"`
+
 	Nonce    uint64
 	To       *common.Address
 	Value    *big.Int
@@ -16,9 +30,36 @@ type Transaction struct {
 	Data     []byte
 	V, R, S  *big.Int
 
+	// EIP-1559 (DynamicFeeTxType)
+	GasTipCap *big.Int `json:",omitempty"`
+	GasFeeCap *big.Int `json:",omitempty"`
+
+	// EIP-2930 / 1559
+	AccessList gethtypes.AccessList `json:",omitempty"`
+
+	// Sender is de (door de RPC-laag) recovered afzender, als cache voor
+	// de txpool. Consensus gebruikt altijd From().
 	Sender common.Address
 }
 
 func (tx *Transaction) Hash() common.Hash {
 	return crypto.Keccak256Hash(tx.Serialize())
 }
+
+// EffectiveGasPrice: wat de sender per gas betaalt. Er is geen base fee,
+// dus een 1559 tx betaalt zijn tip (maximaal de fee cap).
+func (tx *Transaction) EffectiveGasPrice() *big.Int {
+	if tx.Type == DynamicFeeTxType {
+		if tx.GasTipCap == nil {
+			return new(big.Int)
+		}
+		if tx.GasFeeCap != nil && tx.GasFeeCap.Cmp(tx.GasTipCap) < 0 {
+			return new(big.Int).Set(tx.GasFeeCap)
+		}
+		return new(big.Int).Set(tx.GasTipCap)
+	}
+	if tx.GasPrice == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(tx.GasPrice)
+}
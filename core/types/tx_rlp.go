@@ -4,6 +4,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -19,8 +20,14 @@ type rlpTx struct {
 	S        *big.Int
 }
 
-// Serialize encodes the tx in exact Ethereum RLP format
+// Serialize encodes the tx in exact Ethereum RLP format; typed txs als
+// type byte || RLP payload (EIP-2718), net als geth.
 func (tx *Transaction) Serialize() []byte {
+	if tx.Type != LegacyTxType {
+		out, _ := tx.toGeth().MarshalBinary()
+		return out
+	}
+
 	obj := rlpTx{
 		Nonce:    tx.Nonce,
 		GasPrice: tx.GasPrice,
@@ -39,6 +46,15 @@ func (tx *Transaction) Serialize() []byte {
 
 // DecodeTx decodes Ethereum-style RLP into our Transaction struct
 func DecodeTx(data []byte) (*Transaction, error) {
+	// Typed tx: eerste byte is het type (< 0x7f), legacy begint met een RLP list
+	if len(data) > 0 && data[0] <= 0x7f {
+		var gtx gethtypes.Transaction
+		if err := gtx.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return FromGeth(&gtx), nil
+	}
+
 	var decoded rlpTx
 	err := rlp.DecodeBytes(data, &decoded)
 	if err != nil {
@@ -4,42 +4,105 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
 )
 
-// From recovers the sender from an EIP-155 signed transaction.
+// From recovers the sender from a (EIP-155) signed legacy transaction or a
+// typed (EIP-2930 / EIP-1559) transaction.
 func (tx *Transaction) From() (common.Address, error) {
 	if tx.V == nil || tx.R == nil || tx.S == nil {
 		return common.Address{}, errors.New("missing signature")
 	}
 
-	// Compute recovery id (EIP-155)
-	// V = 27/28 (no chainid) OR V = 35 + 2·chainId or 36 + 2·chainId
-	v := tx.V.Uint64()
-	recoveryID := byte((v - 35) % 2) // always 0 or 1
+	// Zelfde RLP als geth's tx types, dus geth doet de signing-hash
+	// (met chainId uit V of het ChainID veld) en de recovery voor ons.
+	gtx := tx.toGeth()
 
-	// Build 65-byte signature [R || S || V]
-	sig := make([]byte, 65)
-
-	rb := tx.R.Bytes()
-	sb := tx.S.Bytes()
-
-	copy(sig[32-len(rb):32], rb)
-	copy(sig[64-len(sb):64], sb)
-	sig[64] = recoveryID
+	var signer gethtypes.Signer = gethtypes.HomesteadSigner{}
+	switch {
+	case tx.Type != LegacyTxType:
+		if tx.ChainID == nil {
+			return common.Address{}, errors.New("typed tx without chain id")
+		}
+		signer = gethtypes.LatestSignerForChainID(tx.ChainID)
+	case gtx.Protected():
+		signer = gethtypes.NewEIP155Signer(gtx.ChainId())
+	}
 
-	// Hash per yellowpaper (Keccak256 of RLP of signing data)
-	h := tx.Hash()
+	return gethtypes.Sender(signer, gtx)
+}
 
-	pub, err := crypto.Ecrecover(h.Bytes(), sig)
-	if err != nil {
-		return common.Address{}, err
+// FromGeth zet een door geth gedecodeerde tx om naar ons formaat.
+func FromGeth(gtx *gethtypes.Transaction) *Transaction {
+	v, r, s := gtx.RawSignatureValues()
+	tx := &Transaction{
+		Type:     gtx.Type(),
+		Nonce:    gtx.Nonce(),
+		To:       gtx.To(),
+		Value:    gtx.Value(),
+		Gas:      gtx.Gas(),
+		GasPrice: gtx.GasPrice(),
+		Data:     gtx.Data(),
+		V:        v,
+		R:        r,
+		S:        s,
 	}
-
-	key, err := crypto.UnmarshalPubkey(pub)
-	if err != nil {
-		return common.Address{}, err
+	switch gtx.Type() {
+	case AccessListTxType:
+		tx.ChainID = gtx.ChainId()
+		tx.AccessList = gtx.AccessList()
+	case DynamicFeeTxType:
+		tx.ChainID = gtx.ChainId()
+		tx.AccessList = gtx.AccessList()
+		tx.GasTipCap = gtx.GasTipCap()
+		tx.GasFeeCap = gtx.GasFeeCap()
+		// geth geeft de fee cap als GasPrice; die hoort bij legacy txs
+		tx.GasPrice = nil
 	}
+	return tx
+}
 
-	return crypto.PubkeyToAddress(*key), nil
+func (tx *Transaction) toGeth() *gethtypes.Transaction {
+	switch tx.Type {
+	case AccessListTxType:
+		return gethtypes.NewTx(&gethtypes.AccessListTx{
+			ChainID:    tx.ChainID,
+			Nonce:      tx.Nonce,
+			GasPrice:   tx.GasPrice,
+			Gas:        tx.Gas,
+			To:         tx.To,
+			Value:      tx.Value,
+			Data:       tx.Data,
+			AccessList: tx.AccessList,
+			V:          tx.V,
+			R:          tx.R,
+			S:          tx.S,
+		})
+	case DynamicFeeTxType:
+		return gethtypes.NewTx(&gethtypes.DynamicFeeTx{
+			ChainID:    tx.ChainID,
+			Nonce:      tx.Nonce,
+			GasTipCap:  tx.GasTipCap,
+			GasFeeCap:  tx.GasFeeCap,
+			Gas:        tx.Gas,
+			To:         tx.To,
+			Value:      tx.Value,
+			Data:       tx.Data,
+			AccessList: tx.AccessList,
+			V:          tx.V,
+			R:          tx.R,
+			S:          tx.S,
+		})
+	}
+	return gethtypes.NewTx(&gethtypes.LegacyTx{
+		Nonce:    tx.Nonce,
+		GasPrice: tx.GasPrice,
+		Gas:      tx.Gas,
+		To:       tx.To,
+		Value:    tx.Value,
+		Data:     tx.Data,
+		V:        tx.V,
+		R:        tx.R,
+		S:        tx.S,
+	})
 }
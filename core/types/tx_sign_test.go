@@ -0,0 +1,74 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestFromRecoversSender(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xb0b")
+
+	tests := []struct {
+		name   string
+		signer gethtypes.Signer
+	}{
+		{"homestead", gethtypes.HomesteadSigner{}},
+		{"eip155 chain 9999", gethtypes.NewEIP155Signer(big.NewInt(9999))},
+		{"eip155 chain 1", gethtypes.NewEIP155Signer(big.NewInt(1))},
+	}
+	for _, tt := range tests {
+		gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+			Nonce: 3, To: &to, Value: big.NewInt(1000), Gas: 21000, GasPrice: big.NewInt(1), Data: []byte("GORR_PAY:7"),
+		}), tt.signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx := FromGeth(gtx)
+		if from, err := tx.From(); err != nil || from != sender {
+			t.Errorf("%s: From() = %s, %v; want %s", tt.name, from.Hex(), err, sender.Hex())
+		}
+		// Zelfde RLP als geth: hash en decode van de raw bytes kloppen
+		if tx.Hash() != gtx.Hash() {
+			t.Errorf("%s: hash %s, geth %s", tt.name, tx.Hash().Hex(), gtx.Hash().Hex())
+		}
+		raw, err := gtx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeTx(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from, err := decoded.From(); err != nil || from != sender {
+			t.Errorf("%s: decoded From() = %s, %v", tt.name, from.Hex(), err)
+		}
+
+		// Een gewijzigde tx hoort niet meer bij de sender
+		decoded.Value = big.NewInt(1001)
+		if from, err := decoded.From(); err == nil && from == sender {
+			t.Errorf("%s: tampered tx still recovers the sender", tt.name)
+		}
+	}
+}
+
+func TestFromWithoutSignature(t *testing.T) {
+	to := common.HexToAddress("0xb0b")
+	tx := &Transaction{To: &to, Value: big.NewInt(1), GasPrice: new(big.Int)}
+	if _, err := tx.From(); err == nil {
+		t.Fatal("unsigned tx has a sender")
+	}
+	tx.V, tx.R, tx.S = big.NewInt(27), new(big.Int), big.NewInt(1)
+	if _, err := tx.From(); err == nil {
+		t.Fatal("signature with r = 0 has a sender")
+	}
+}
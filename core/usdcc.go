@@ -0,0 +1,232 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ----------------------------------------------------------------
+// USDCc on-chain (vanaf de USDCc fork)
+// ----------------------------------------------------------------
+//
+// Een tx naar params.USDCcTokenAddress met Value 0 en als data een ERC-20
+// transfer(address,uint256) verplaatst USDCc, zodat gewone wallets het als
+// token transfer kunnen tekenen. Staat er direct achter de calldata
+// "GORR_PAY:<id>", dan is het een betaling van intent <id>: de fee gaat
+// in USDCc naar de treasury (vanaf de rewards fork via FeeSplit), het
+// netto bedrag naar de merchant. Vanaf de
+// refunds fork kan er ook een GORR_REFUND marker staan (core/refund.go),
+// vanaf de paymentTerms fork draagt de GORR_PAY marker de terms van het
+// intent (core/payment_terms.go).
+
+const usdccCallLength = 4 + 32 + 32
+
+var (
+	// transfer(address,uint256)
+	erc20TransferSelector = crypto.Keccak256([]byte("transfer(address,uint256)"))[:4]
+
+	// Transfer(address indexed from, address indexed to, uint256 value)
+	ERC20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	ErrInvalidUSDCcCall = errors.New("invalid USDCc call")
+)
+
+// USDCcTransfer is de gedecodeerde data van een USDCc tx.
+type USDCcTransfer struct {
+	To        common.Address
+	Amount    *big.Int
+	IntentID  uint64
+	IsPayment bool
+	Terms     *PaymentTerms // alleen bij IsPayment, vanaf de paymentTerms fork
+
+	IsRefund  bool
+	RefundFee *big.Int // alleen bij IsRefund
+
+	IsSettlement bool
+	SettlementID uint64 // alleen bij IsSettlement
+}
+
+// IsUSDCcCall: tx gaat naar het USDCc adres terwijl de fork actief is.
+func IsUSDCcCall(rules params.Rules, tx *types.Transaction) bool {
+	return rules.IsUSDCc && tx.To != nil && *tx.To == params.USDCcTokenAddress
+}
+
+// ParseUSDCcTransfer decodeert transfer(to, amount) met optionele
+// GORR_PAY marker (of GORR_REFUND vanaf de refunds fork). Andere calls of
+// rommel erachter zijn ongeldig.
+func ParseUSDCcTransfer(rules params.Rules, data []byte) (*USDCcTransfer, error) {
+	if len(data) < usdccCallLength || !bytes.Equal(data[:4], erc20TransferSelector) {
+		return nil, fmt.Errorf("%w: only transfer(address,uint256) is supported", ErrInvalidUSDCcCall)
+	}
+	addrWord := data[4:36]
+	if !bytes.Equal(addrWord[:12], make([]byte, 12)) {
+		return nil, fmt.Errorf("%w: bad address argument", ErrInvalidUSDCcCall)
+	}
+
+	t := &USDCcTransfer{
+		To:     common.BytesToAddress(addrWord[12:]),
+		Amount: new(big.Int).SetBytes(data[36:usdccCallLength]),
+	}
+	rest := data[usdccCallLength:]
+	if len(rest) == 0 {
+		return t, nil
+	}
+	if id, terms, ok := ParsePaymentMarker(rules, rest); ok {
+		t.IntentID, t.IsPayment, t.Terms = id, true, terms
+		return t, nil
+	}
+	if id, fee, ok := ParseRefundMarker(rest); ok && rules.IsRefunds {
+		t.IntentID, t.IsRefund, t.RefundFee = id, true, fee
+		return t, nil
+	}
+	if id, ok := ParseSettlementMarker(rest); ok && rules.IsSettlements {
+		t.IsSettlement, t.SettlementID = true, id
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected data after transfer call", ErrInvalidUSDCcCall)
+}
+
+// USDCcTransferData bouwt de tx data voor een USDCc transfer; intentID > 0
+// zet de GORR_PAY marker (zonder terms) erachter.
+func USDCcTransferData(to common.Address, amount *big.Int, intentID uint64) []byte {
+	if intentID == 0 {
+		return usdccCallData(to, amount)
+	}
+	return USDCcPaymentData(to, amount, intentID, nil)
+}
+
+// USDCcPaymentData: transfer naar de merchant met GORR_PAY marker; terms
+// zijn verplicht vanaf de paymentTerms fork.
+func USDCcPaymentData(to common.Address, amount *big.Int, intentID uint64, terms *PaymentTerms) []byte {
+	return append(usdccCallData(to, amount), PaymentData(intentID, terms)...)
+}
+
+// USDCcRefundData: transfer naar de payer met GORR_REFUND marker.
+func USDCcRefundData(payer common.Address, amount *big.Int, intentID uint64, fee *big.Int) []byte {
+	return append(usdccCallData(payer, amount), RefundData(intentID, fee)...)
+}
+
+func usdccCallData(to common.Address, amount *big.Int) []byte {
+	data := make([]byte, 0, usdccCallLength+32)
+	data = append(data, erc20TransferSelector...)
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+}
+
+// ----------------------------------------------------------------
+// Payments: GORR (Value + GORR_PAY data) of USDCc (transfer + marker)
+// ----------------------------------------------------------------
+
+// Payment beschrijft de betaling die een tx voor een intent doet.
+type Payment struct {
+	IntentID uint64
+	Token    string // "GORR" of "USDCc"
+	Merchant common.Address
+	Amount   *big.Int
+	Terms    *PaymentTerms // vanaf de paymentTerms fork
+}
+
+// PaymentOf geeft de betaling in tx onder rules, of false als tx geen
+// (geldige) payment tx is.
+func PaymentOf(rules params.Rules, tx *types.Transaction) (*Payment, bool) {
+	if tx == nil || tx.To == nil {
+		return nil, false
+	}
+	if IsUSDCcCall(rules, tx) {
+		t, err := ParseUSDCcTransfer(rules, tx.Data)
+		if err != nil || !t.IsPayment {
+			return nil, false
+		}
+		return &Payment{IntentID: t.IntentID, Token: usdccToken, Merchant: t.To, Amount: t.Amount, Terms: t.Terms}, true
+	}
+	id, terms, ok := ParsePaymentMarker(rules, tx.Data)
+	if !ok {
+		return nil, false
+	}
+	return &Payment{IntentID: id, Token: nativeToken, Merchant: *tx.To, Amount: tx.Value, Terms: terms}, true
+}
+
+// ----------------------------------------------------------------
+// State transition
+// ----------------------------------------------------------------
+
+func applyUSDCcTransfer(st *state.State, from, to common.Address, amount *big.Int) error {
+	fromBal, err := st.GetUSDCcBalance(from)
+	if err != nil {
+		return err
+	}
+	if fromBal.Cmp(amount) < 0 {
+		return errors.New("insufficient USDCc balance")
+	}
+	if err := st.SetUSDCcBalance(from, new(big.Int).Sub(fromBal, amount)); err != nil {
+		return err
+	}
+	// Na de debit lezen: from == to moet netto niets doen
+	toBal, err := st.GetUSDCcBalance(to)
+	if err != nil {
+		return err
+	}
+	return st.SetUSDCcBalance(to, new(big.Int).Add(toBal, amount))
+}
+
+// applyUSDCcPayment: zoals applyPayment, maar in USDCc. De fee
+// (MerchantTerms) gaat via collectFee: naar de treasury, of vanaf de
+// rewards fork in de USDCc pot die Finalize verdeelt.
+func (p *StateProcessor) applyUSDCcPayment(st *state.State, from common.Address, t *USDCcTransfer, rules params.Rules) (*big.Int, common.Address, error) {
+	if _, err := p.treasury(); err != nil {
+		return nil, common.Address{}, err
+	}
+	bal, err := st.GetUSDCcBalance(from)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if bal.Cmp(t.Amount) < 0 {
+		return nil, common.Address{}, errors.New("insufficient USDCc balance")
+	}
+	bps, payout, err := MerchantTerms(st, rules, t.To)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	fee, net := PaymentSplit(bps, t.Amount)
+
+	if err := applyUSDCcTransfer(st, from, payout, net); err != nil {
+		return nil, common.Address{}, err
+	}
+	if err := debitUSDCc(st, from, fee); err != nil {
+		return nil, common.Address{}, err
+	}
+	return fee, payout, p.collectFee(st, rules, usdccToken, fee)
+}
+
+// debitUSDCc: amount van addr af, bijv. een fee voor collectFee.
+func debitUSDCc(st *state.State, addr common.Address, amount *big.Int) error {
+	bal, err := st.GetUSDCcBalance(addr)
+	if err != nil {
+		return err
+	}
+	if bal.Cmp(amount) < 0 {
+		return errors.New("insufficient USDCc balance")
+	}
+	return st.SetUSDCcBalance(addr, new(big.Int).Sub(bal, amount))
+}
+
+// usdccTransferLog: ERC-20 Transfer log met het USDCc adres als contract.
+func usdccTransferLog(from, to common.Address, amount *big.Int) *types.Log {
+	return &types.Log{
+		Address: params.USDCcTokenAddress,
+		Topics: []common.Hash{
+			ERC20TransferTopic,
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+		},
+		Data: common.BigToHash(amount).Bytes(),
+	}
+}
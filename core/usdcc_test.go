@@ -0,0 +1,192 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func (e *chainEnv) usdcc(addr common.Address) int64 {
+	e.t.Helper()
+	bal, err := e.chain.State.GetUSDCcBalance(addr)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return bal.Int64()
+}
+
+// usdccTx: USDCc call (transfer + marker) van de env key.
+func (e *chainEnv) usdccTx(nonce uint64, data []byte) *types.Transaction {
+	return e.tx(nonce, params.USDCcTokenAddress, 0, 100_000, string(data))
+}
+
+func usdccConfig() *params.ChainConfig {
+	cfg := params.GorrillazzChainConfig()
+	cfg.USDCcBlock = at(0)
+	cfg.RefundsBlock, cfg.RefundFees = at(0), true
+	return cfg
+}
+
+// USDCc payments: de fee gaat in USDCc naar de treasury, staat op de
+// receipt en telt op in de collected fees van de node.
+func TestUSDCcPaymentFees(t *testing.T) {
+	e := newChainEnv(t, usdccConfig())
+	merchant := common.HexToAddress("0xb0b")
+	other := common.HexToAddress("0xca7")
+	treasury := e.chain.TreasuryAddr
+	if err := e.chain.State.SetUSDCcBalance(e.from, big.NewInt(100_000)); err != nil {
+		t.Fatal(err)
+	}
+	pay := func(id uint64, amount int64) []byte {
+		return USDCcPaymentData(merchant, big.NewInt(amount), id, nil)
+	}
+
+	blocks := []struct {
+		name      string
+		data      [][]byte
+		fees      []int64 // receipt.FeeUSDCc per tx (-1 = geen)
+		merchant  int64   // USDCc van de merchant na het block
+		collected int64   // lopend totaal collected fees
+		rejected  bool
+	}{
+		{"payment", [][]byte{pay(1, 10_000)}, []int64{250}, 9_750, 250, false},
+		{"plain transfer", [][]byte{USDCcTransferData(other, big.NewInt(500), 0)}, []int64{-1}, 9_750, 250, false},
+		{"two payments, fees rounded down", [][]byte{pay(2, 4_001), pay(3, 399)}, []int64{100, 9}, 9_750 + 3_901 + 390, 359, false},
+		{"payment above the balance", [][]byte{pay(4, 1_000_000)}, nil, 9_750 + 3_901 + 390, 359, true},
+	}
+	parent, nonce := e.chain.Head(), uint64(0)
+	spent := int64(0)
+	for _, b := range blocks {
+		txs := []*types.Transaction{}
+		for i, data := range b.data {
+			txs = append(txs, e.usdccTx(nonce+uint64(i), data))
+		}
+		var block *types.Block
+		if b.rejected {
+			// De producer zou de tx weigeren; bouw het block met een
+			// plausibele header zodat ApplyBlock zelf moet afkeuren
+			block = e.build(parent)
+			block.Transactions = txs
+			block.Header.TxRoot = types.DeriveTxRoot(txs)
+		} else {
+			block = e.build(parent, txs...)
+		}
+
+		receipts, _, err := e.p.ApplyBlock(parent, block, nil)
+		if b.rejected {
+			var txErr *TxError
+			if !errors.As(err, &txErr) || !strings.Contains(err.Error(), "insufficient USDCc") {
+				t.Fatalf("%s: got %v, want a TxError for the balance", b.name, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		} else {
+			for i, r := range receipts {
+				got := int64(-1)
+				if r.FeeUSDCc != nil {
+					got = r.FeeUSDCc.Int64()
+				}
+				if got != b.fees[i] {
+					t.Fatalf("%s: tx %d fee %d, want %d", b.name, i, got, b.fees[i])
+				}
+			}
+			for _, data := range b.data {
+				tr, err := ParseUSDCcTransfer(e.p.config.Rules(block.Header.Number), data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				spent += tr.Amount.Int64()
+			}
+			parent, nonce = block, nonce+uint64(len(txs))
+		}
+
+		if got := e.usdcc(merchant); got != b.merchant {
+			t.Fatalf("%s: merchant has %d USDCc, want %d", b.name, got, b.merchant)
+		}
+		if got := e.chain.State.GetCollectedFees(usdccToken).Int64(); got != b.collected {
+			t.Fatalf("%s: collected fees %d, want %d", b.name, got, b.collected)
+		}
+		if got := e.usdcc(treasury); got != b.collected {
+			t.Fatalf("%s: treasury has %d USDCc, want %d", b.name, got, b.collected)
+		}
+		// Niets verdwijnt: payer + ontvangers = het beginsaldo
+		if total := e.usdcc(e.from) + e.usdcc(merchant) + e.usdcc(other) + e.usdcc(treasury); total != 100_000 || e.usdcc(e.from) != 100_000-spent {
+			t.Fatalf("%s: USDCc total %d, payer %d after spending %d", b.name, total, e.usdcc(e.from), spent)
+		}
+	}
+}
+
+// USDCc refunds met fee: de fee komt uit de treasury en gaat van de
+// collected fees af. De env key is hier de merchant.
+func TestUSDCcRefundFees(t *testing.T) {
+	e := newChainEnv(t, usdccConfig())
+	payer := common.HexToAddress("0xb0b")
+	treasury := e.chain.TreasuryAddr
+	if err := e.chain.State.SetUSDCcBalance(e.from, big.NewInt(100_000)); err != nil {
+		t.Fatal(err)
+	}
+	refund := func(amount, fee int64) []byte {
+		return USDCcRefundData(payer, big.NewInt(amount), 1, big.NewInt(fee))
+	}
+
+	blocks := []struct {
+		name      string
+		data      []byte
+		feeRefund int64 // receipt.FeeRefundUSDCc (-1 = geen)
+		payer     int64
+		collected int64
+		rejected  bool
+	}{
+		// Betaling aan zichzelf: alleen de fee verlaat de merchant
+		{"payment", USDCcPaymentData(e.from, big.NewInt(10_000), 1, nil), -1, 0, 250, false},
+		{"refund with fee", refund(4_000, 100), 100, 4_100, 150, false},
+		{"refund without fee", refund(1_000, 0), -1, 5_100, 150, false},
+		{"fee above the treasury", refund(1, 151), -1, 5_100, 150, true},
+	}
+	parent, nonce := e.chain.Head(), uint64(0)
+	for _, b := range blocks {
+		tx := e.usdccTx(nonce, b.data)
+		var block *types.Block
+		if b.rejected {
+			block = e.build(parent)
+			block.Transactions = []*types.Transaction{tx}
+			block.Header.TxRoot = types.DeriveTxRoot(block.Transactions)
+		} else {
+			block = e.build(parent, tx)
+		}
+
+		receipts, _, err := e.p.ApplyBlock(parent, block, nil)
+		if b.rejected {
+			if !strings.Contains(fmt.Sprint(err), "treasury has insufficient USDCc") {
+				t.Fatalf("%s: got %v, want the treasury balance error", b.name, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		} else {
+			parent, nonce = block, nonce+1
+			got := int64(-1)
+			if r := receipts[0]; r.FeeRefundUSDCc != nil {
+				got = r.FeeRefundUSDCc.Int64()
+			}
+			if got != b.feeRefund {
+				t.Fatalf("%s: receipt fee refund %d, want %d", b.name, got, b.feeRefund)
+			}
+		}
+
+		if got := e.usdcc(payer); got != b.payer {
+			t.Fatalf("%s: payer has %d USDCc, want %d", b.name, got, b.payer)
+		}
+		if got := e.chain.State.GetCollectedFees(usdccToken).Int64(); got != b.collected || e.usdcc(treasury) != b.collected {
+			t.Fatalf("%s: collected fees %d, treasury %d, want %d", b.name, got, e.usdcc(treasury), b.collected)
+		}
+		if total := e.usdcc(e.from) + e.usdcc(payer) + e.usdcc(treasury); total != 100_000 {
+			t.Fatalf("%s: USDCc total %d, want 100000", b.name, total)
+		}
+	}
+}
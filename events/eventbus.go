@@ -1,42 +1,297 @@
 package events
 
-import "sync"
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// ---------- TOPICS ----------
+
+type Topic string
+
+const (
+	TopicBlock   Topic = "block"
+	TopicTx      Topic = "tx"
+	TopicPayment Topic = "payment"
+	TopicAdmin   Topic = "admin"
+)
+
+// Event is wat een subscriber uit zijn queue leest. Seq is het
+// sequence number in het durable event log (0 als er geen log is).
+type Event struct {
+	Seq   uint64      `json:"seq"`
+	Topic Topic       `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// ---------- BACKPRESSURE ----------
+
+// Policy bepaalt wat er gebeurt als de queue van een subscriber vol is.
+// De publisher blokkeert nooit: een trage consumer mag de producer
+// (en daarmee block productie) niet ophouden.
+type Policy int
+
+const (
+	// DropNewest: het nieuwe event wordt voor deze subscriber overgeslagen.
+	DropNewest Policy = iota
+	// DropOldest: het oudste event in de queue maakt plaats voor het nieuwe.
+	DropOldest
+	// Disconnect: de subscriber wordt als slow consumer afgesloten
+	// (kanaal dicht); de consumer moet opnieuw subscriben.
+	Disconnect
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Disconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultQueueSize is de queue-grootte van SubscribeBlocks / SubscribeTxs.
+const DefaultQueueSize = 100
+
+// ---------- SUBSCRIPTION ----------
+
+type Subscription struct {
+	id     uint64
+	bus    *EventBus
+	topics map[Topic]bool
+	policy Policy
+	ch     chan Event
+
+	closed    bool // alleen onder bus.mu
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// C geeft het kanaal met events. Het wordt gesloten bij Unsubscribe of
+// wanneer de Disconnect policy de subscriber afsluit.
+func (s *Subscription) C() <-chan Event { return s.ch }
+
+func (s *Subscription) Unsubscribe() { s.bus.unsubscribe(s) }
+
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+// ---------- BUS ----------
 
 type EventBus struct {
-	mu sync.RWMutex
+	mu     sync.RWMutex
+	nextID uint64
+	subs   map[uint64]*Subscription
+
+	// pubMu houdt append-in-log + aflevering atomair, zodat subscribers
+	// events altijd in seq-volgorde zien.
+	pubMu sync.Mutex
+	log   *EventLog
 
-	Blocks   chan interface{}
-	Txs      chan interface{}
-	Payments chan interface{}
+	published map[Topic]*atomic.Uint64
+	dropped   atomic.Uint64
+	slowKills atomic.Uint64
 }
 
 func NewEventBus() *EventBus {
-	return &EventBus{
-		Blocks:   make(chan interface{}, 100),
-		Txs:      make(chan interface{}, 100),
-		Payments: make(chan interface{}, 100),
+	b := &EventBus{
+		subs:      make(map[uint64]*Subscription),
+		published: make(map[Topic]*atomic.Uint64),
 	}
+	for _, t := range []Topic{TopicBlock, TopicTx, TopicPayment, TopicAdmin} {
+		b.published[t] = new(atomic.Uint64)
+	}
+	return b
 }
 
-// ---------- EMIT HELPERS ----------
+// Subscribe registreert een subscriber met een eigen queue van queueSize
+// events. Zonder topics ontvangt de subscriber alle topics.
+func (b *EventBus) Subscribe(queueSize int, policy Policy, topics ...Topic) *Subscription {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
 
-func (b *EventBus) EmitBlock(block interface{}) {
-	select {
-	case b.Blocks <- block:
-	default:
+	s := &Subscription{
+		bus:    b,
+		topics: make(map[Topic]bool),
+		policy: policy,
+		ch:     make(chan Event, queueSize),
+	}
+	for _, t := range topics {
+		s.topics[t] = true
 	}
+
+	b.mu.Lock()
+	b.nextID++
+	s.id = b.nextID
+	b.subs[s.id] = s
+	b.mu.Unlock()
+
+	return s
 }
 
-func (b *EventBus) EmitTx(tx interface{}) {
-	select {
-	case b.Txs <- tx:
-	default:
+// AttachLog laat elk gepubliceerd event eerst in het durable log schrijven.
+func (b *EventBus) AttachLog(l *EventLog) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	b.log = l
+}
+
+// Log geeft het gekoppelde event log (of nil).
+func (b *EventBus) Log() *EventLog {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	return b.log
+}
+
+func (b *EventBus) SubscribeBlocks() *Subscription {
+	return b.Subscribe(DefaultQueueSize, DropOldest, TopicBlock)
+}
+
+func (b *EventBus) SubscribeTxs() *Subscription {
+	return b.Subscribe(DefaultQueueSize, DropOldest, TopicTx)
+}
+
+func (b *EventBus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subs, s.id)
+	close(s.ch)
+}
+
+// Publish levert data af in de queue van elke subscriber op dit topic.
+func (b *EventBus) Publish(topic Topic, data interface{}) {
+	if c, ok := b.published[topic]; ok {
+		c.Add(1)
+	}
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	ev := Event{Topic: topic, Data: data}
+	if b.log != nil {
+		seq, err := b.log.Append(topic, data)
+		if err != nil {
+			log.Println("[EVENTS] append to event log failed:", err)
+		}
+		ev.Seq = seq
+	}
+
+	var slow []*Subscription
+
+	b.mu.RLock()
+	for _, s := range b.subs {
+		if len(s.topics) > 0 && !s.topics[topic] {
+			continue
+		}
+		if !s.deliver(ev) {
+			b.dropped.Add(1)
+			if s.policy == Disconnect {
+				slow = append(slow, s)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range slow {
+		b.slowKills.Add(1)
+		b.unsubscribe(s)
 	}
 }
 
-func (b *EventBus) EmitPayment(p interface{}) {
+// deliver probeert ev in de queue te zetten volgens de policy.
+// Geeft false terug als er een event verloren ging.
+func (s *Subscription) deliver(ev Event) bool {
 	select {
-	case b.Payments <- p:
+	case s.ch <- ev:
+		s.delivered.Add(1)
+		return true
 	default:
 	}
+
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- ev:
+			s.delivered.Add(1)
+		default:
+		}
+	}
+
+	s.dropped.Add(1)
+	return false
+}
+
+// ---------- EMIT HELPERS ----------
+
+func (b *EventBus) EmitBlock(block interface{}) { b.Publish(TopicBlock, block) }
+
+func (b *EventBus) EmitTx(tx interface{}) { b.Publish(TopicTx, tx) }
+
+func (b *EventBus) EmitPayment(p interface{}) { b.Publish(TopicPayment, p) }
+
+func (b *EventBus) EmitAdmin(a interface{}) { b.Publish(TopicAdmin, a) }
+
+// ---------- METRICS ----------
+
+type SubscriberMetrics struct {
+	ID        uint64  `json:"id"`
+	Topics    []Topic `json:"topics"`
+	Policy    string  `json:"policy"`
+	Queued    int     `json:"queued"`
+	QueueSize int     `json:"queueSize"`
+	Delivered uint64  `json:"delivered"`
+	Dropped   uint64  `json:"dropped"`
+}
+
+type Metrics struct {
+	Published     map[Topic]uint64    `json:"published"`
+	Dropped       uint64              `json:"dropped"`
+	SlowConsumers uint64              `json:"slowConsumersDisconnected"`
+	Subscribers   []SubscriberMetrics `json:"subscribers"`
+}
+
+func (b *EventBus) Metrics() Metrics {
+	m := Metrics{
+		Published:     make(map[Topic]uint64),
+		Dropped:       b.dropped.Load(),
+		SlowConsumers: b.slowKills.Load(),
+		Subscribers:   []SubscriberMetrics{},
+	}
+	for t, c := range b.published {
+		m.Published[t] = c.Load()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, s := range b.subs {
+		sm := SubscriberMetrics{
+			ID:        s.id,
+			Topics:    []Topic{},
+			Policy:    s.policy.String(),
+			Queued:    len(s.ch),
+			QueueSize: cap(s.ch),
+			Delivered: s.delivered.Load(),
+			Dropped:   s.dropped.Load(),
+		}
+		for t := range s.topics {
+			sm.Topics = append(sm.Topics, t)
+		}
+		m.Subscribers = append(m.Subscribers, sm)
+	}
+	return m
 }
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+// drain leest alles wat nu in de queue staat. closed = het kanaal is dicht.
+func drain(s *Subscription) (got []interface{}, closed bool) {
+	for {
+		select {
+		case ev, ok := <-s.C():
+			if !ok {
+				return got, true
+			}
+			got = append(got, ev.Data)
+		default:
+			return got, false
+		}
+	}
+}
+
+func subscriberMetrics(b *EventBus, s *Subscription) (SubscriberMetrics, bool) {
+	for _, sm := range b.Metrics().Subscribers {
+		if sm.ID == s.id {
+			return sm, true
+		}
+	}
+	return SubscriberMetrics{}, false
+}
+
+// Een trage subscriber (queue van 2, leest niet) krijgt 4 events.
+func TestBackpressurePolicies(t *testing.T) {
+	tests := []struct {
+		policy    Policy
+		got       []interface{}
+		closed    bool
+		delivered uint64
+		dropped   uint64
+		slowKills uint64
+	}{
+		{DropNewest, []interface{}{1, 2}, false, 2, 2, 0},
+		{DropOldest, []interface{}{3, 4}, false, 4, 2, 0},
+		{Disconnect, []interface{}{1, 2}, true, 2, 1, 1},
+	}
+	for _, tt := range tests {
+		b := NewEventBus()
+		slow := b.Subscribe(2, tt.policy, TopicBlock)
+		fast := b.Subscribe(10, DropNewest, TopicBlock)
+
+		for i := 1; i <= 4; i++ {
+			b.EmitBlock(i)
+		}
+		sm, subscribed := subscriberMetrics(b, slow)
+
+		got, closed := drain(slow)
+		if !reflect.DeepEqual(got, tt.got) || closed != tt.closed {
+			t.Errorf("%s: got %v closed=%v, want %v closed=%v", tt.policy, got, closed, tt.got, tt.closed)
+		}
+		if got, _ := drain(fast); len(got) != 4 {
+			t.Errorf("%s: fast subscriber got %v", tt.policy, got)
+		}
+		if slow.Dropped() != tt.dropped {
+			t.Errorf("%s: Dropped() = %d, want %d", tt.policy, slow.Dropped(), tt.dropped)
+		}
+
+		m := b.Metrics()
+		if m.Published[TopicBlock] != 4 || m.Dropped != tt.dropped || m.SlowConsumers != tt.slowKills {
+			t.Errorf("%s: metrics %+v", tt.policy, m)
+		}
+		// Een afgesloten subscriber verdwijnt uit de metrics
+		if subscribed == tt.closed {
+			t.Errorf("%s: subscriber listed = %v after %d slow kills", tt.policy, subscribed, tt.slowKills)
+		}
+		if subscribed && (sm.Delivered != tt.delivered || sm.Dropped != tt.dropped || sm.Queued != 2 || sm.QueueSize != 2 || sm.Policy != tt.policy.String()) {
+			t.Errorf("%s: subscriber metrics %+v", tt.policy, sm)
+		}
+	}
+}
+
+func TestTopicFilter(t *testing.T) {
+	b := NewEventBus()
+	blocks := b.Subscribe(10, DropNewest, TopicBlock)
+	payments := b.Subscribe(10, DropNewest, TopicPayment, TopicAdmin)
+	all := b.Subscribe(10, DropNewest)
+
+	b.EmitBlock("b")
+	b.EmitTx("t")
+	b.EmitPayment("p")
+	b.EmitAdmin("a")
+
+	tests := []struct {
+		sub  *Subscription
+		want []interface{}
+	}{
+		{blocks, []interface{}{"b"}},
+		{payments, []interface{}{"p", "a"}},
+		{all, []interface{}{"b", "t", "p", "a"}},
+	}
+	for i, tt := range tests {
+		if got, _ := drain(tt.sub); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("subscriber %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+	for _, topic := range []Topic{TopicBlock, TopicTx, TopicPayment, TopicAdmin} {
+		if n := b.Metrics().Published[topic]; n != 1 {
+			t.Errorf("published %s = %d, want 1", topic, n)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewEventBus()
+	s := b.Subscribe(10, DropNewest)
+	b.EmitTx(1)
+	s.Unsubscribe()
+	s.Unsubscribe() // tweede keer is een no-op
+
+	b.EmitTx(2)
+	if got, closed := drain(s); !reflect.DeepEqual(got, []interface{}{1}) || !closed {
+		t.Fatalf("got %v closed=%v, want [1] and a closed channel", got, closed)
+	}
+	if n := len(b.Metrics().Subscribers); n != 0 {
+		t.Fatalf("%d subscribers after unsubscribe", n)
+	}
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ---------- DURABLE EVENT LOG ----------
+//
+// Elk event dat via de bus gaat wordt eerst (synchroon) aan dit log
+// toegevoegd met een oplopend sequence number. Consumers onthouden de
+// laatste seq die ze zagen en hervatten vanaf daar (REST / SSE / WS).
+
+var (
+	logPrefix = []byte("e")
+	seqKey    = []byte("_seq")
+)
+
+// Record is één event in het log.
+type Record struct {
+	Seq   uint64          `json:"seq"`
+	Topic Topic           `json:"topic"`
+	Time  uint64          `json:"time"` // unix seconds (wall clock van de node)
+	Event json.RawMessage `json:"event"`
+}
+
+type EventLog struct {
+	mu        sync.Mutex
+	db        *leveldb.DB
+	seq       uint64        // laatst toegekende seq
+	retention time.Duration // 0 = alles bewaren
+
+	quit chan struct{}
+}
+
+// OpenEventLog opent (of maakt) het log in path. Retention bepaalt hoe
+// lang records bewaard blijven; 0 = onbeperkt.
+func OpenEventLog(path string, retention time.Duration) (*EventLog, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &EventLog{
+		db:        db,
+		retention: retention,
+		quit:      make(chan struct{}),
+	}
+
+	raw, err := db.Get(seqKey, nil)
+	switch err {
+	case nil:
+		l.seq = binary.BigEndian.Uint64(raw)
+	case leveldb.ErrNotFound:
+	default:
+		db.Close()
+		return nil, err
+	}
+
+	if retention > 0 {
+		go l.pruneLoop()
+	}
+	return l, nil
+}
+
+func (l *EventLog) Close() {
+	close(l.quit)
+	l.db.Close()
+}
+
+// Head geeft de laatst toegekende seq (0 = leeg log).
+func (l *EventLog) Head() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// Append schrijft data als nieuw record en geeft de seq terug.
+func (l *EventLog) Append(topic Topic, data interface{}) (uint64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq := l.seq + 1
+	rec, err := json.Marshal(Record{
+		Seq:   seq,
+		Topic: topic,
+		Time:  uint64(time.Now().Unix()),
+		Event: payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var seqBuf [8]byte
+	binary.BigEndian.PutUint64(seqBuf[:], seq)
+
+	batch := new(leveldb.Batch)
+	batch.Put(recordKey(seq), rec)
+	batch.Put(seqKey, seqBuf[:])
+	if err := l.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+
+	l.seq = seq
+	return seq, nil
+}
+
+// Read geeft maximaal limit records met seq > after, optioneel alleen
+// voor de gegeven topics.
+func (l *EventLog) Read(after uint64, limit int, topics ...Topic) ([]Record, error) {
+	want := map[Topic]bool{}
+	for _, t := range topics {
+		want[t] = true
+	}
+
+	iter := l.db.NewIterator(&util.Range{
+		Start: recordKey(after + 1),
+		Limit: recordKey(^uint64(0)),
+	}, nil)
+	defer iter.Release()
+
+	out := []Record{}
+	for iter.Next() {
+		var rec Record
+		if err := json.Unmarshal(iter.Value(), &rec); err != nil {
+			return nil, err
+		}
+		if len(want) > 0 && !want[rec.Topic] {
+			continue
+		}
+		out = append(out, rec)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out, iter.Error()
+}
+
+// ---------- RETENTION ----------
+
+func (l *EventLog) pruneLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = l.Prune(time.Now().Add(-l.retention))
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// Prune verwijdert records ouder dan cutoff. Seqs blijven oplopen; een
+// consumer met een te oude cursor krijgt gewoon het oudste nog bewaarde record.
+func (l *EventLog) Prune(cutoff time.Time) error {
+	iter := l.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		var rec Record
+		if err := json.Unmarshal(iter.Value(), &rec); err != nil {
+			return err
+		}
+		if int64(rec.Time) >= cutoff.Unix() {
+			break
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return l.db.Write(batch, nil)
+}
+
+func recordKey(seq uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], seq)
+	return key
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openLog(t *testing.T, path string) *EventLog {
+	t.Helper()
+	l, err := OpenEventLog(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func seqs(recs []Record) []uint64 {
+	out := make([]uint64, len(recs))
+	for i, r := range recs {
+		out[i] = r.Seq
+	}
+	return out
+}
+
+func TestEventLogRead(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "events"))
+	defer l.Close()
+
+	// 1 block, 2 tx, 3 payment, 4 tx, 5 block
+	for _, topic := range []Topic{TopicBlock, TopicTx, TopicPayment, TopicTx, TopicBlock} {
+		if _, err := l.Append(topic, map[string]string{"topic": string(topic)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		after  uint64
+		limit  int
+		topics []Topic
+		want   []uint64
+	}{
+		{"all", 0, 0, nil, []uint64{1, 2, 3, 4, 5}},
+		{"after cursor", 2, 0, nil, []uint64{3, 4, 5}},
+		{"limit", 1, 2, nil, []uint64{2, 3}},
+		{"topic", 0, 0, []Topic{TopicTx}, []uint64{2, 4}},
+		{"topics with cursor", 2, 0, []Topic{TopicTx, TopicBlock}, []uint64{4, 5}},
+		{"limit counts matches only", 0, 1, []Topic{TopicPayment}, []uint64{3}},
+		{"at head", 5, 0, nil, []uint64{}},
+		{"past head", 9, 0, nil, []uint64{}},
+	}
+	for _, tt := range tests {
+		recs, err := l.Read(tt.after, tt.limit, tt.topics...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := seqs(recs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: seqs %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventLogSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events")
+	l := openLog(t, path)
+	for i := 0; i < 3; i++ {
+		if _, err := l.Append(TopicPayment, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	l = openLog(t, path)
+	defer l.Close()
+	if l.Head() != 3 {
+		t.Fatalf("head %d after reopen, want 3", l.Head())
+	}
+	seq, err := l.Append(TopicPayment, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 4 {
+		t.Fatalf("seq %d after reopen, want 4", seq)
+	}
+	recs, err := l.Read(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := seqs(recs); !slices.Equal(got, []uint64{3, 4}) || string(recs[0].Event) != "2" {
+		t.Fatalf("replay after reopen: %v %s", got, recs[0].Event)
+	}
+}
+
+func TestEventLogPruneKeepsSeq(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "events"))
+	defer l.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := l.Append(TopicTx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Prune(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := l.Read(0, 0); len(recs) != 0 {
+		t.Fatalf("%d records after prune, want 0", len(recs))
+	}
+
+	// Een oude cursor krijgt het oudste bewaarde record; seqs lopen door
+	if seq, _ := l.Append(TopicTx, 2); seq != 3 {
+		t.Fatalf("seq %d after prune, want 3", seq)
+	}
+	recs, err := l.Read(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := seqs(recs); !slices.Equal(got, []uint64{3}) {
+		t.Fatalf("seqs %v, want [3]", got)
+	}
+}
+
+func TestBusEventsCarryLogSeq(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "events"))
+	defer l.Close()
+
+	bus := NewEventBus()
+	bus.AttachLog(l)
+	sub := bus.Subscribe(8, DropNewest, TopicPayment)
+	defer sub.Unsubscribe()
+
+	bus.Publish(TopicBlock, "block")
+	bus.Emit(&IntentCancelled{})
+
+	ev := <-sub.C()
+	if ev.Seq != 2 || ev.Topic != TopicPayment {
+		t.Fatalf("event seq %d topic %s, want 2 payment", ev.Seq, ev.Topic)
+	}
+	recs, err := l.Read(ev.Seq-1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Seq != ev.Seq || recs[0].Topic != TopicPayment {
+		t.Fatalf("log record %+v, want seq %d", recs, ev.Seq)
+	}
+}
@@ -0,0 +1,213 @@
+package events
+
+import (
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SchemaVersion wordt in elk event meegestuurd. Verhoog bij een
+// breaking change in een van de structs hieronder.
+const SchemaVersion = 1
+
+type EventType string
+
+const (
+	TypeBlockCommitted EventType = "block.committed"
+
+	TypeTxPending  EventType = "tx.pending"
+	TypeTxIncluded EventType = "tx.included"
+	TypeTxDropped  EventType = "tx.dropped"
+	TypeTransfer   EventType = "tx.transfer"
+
+	TypeIntentCreated   EventType = "intent.created"
+	TypeIntentPaid      EventType = "intent.paid"
+	TypeIntentExpired   EventType = "intent.expired"
+	TypeIntentRefunded  EventType = "intent.refunded"
+	TypeIntentSettled   EventType = "intent.settled"
+	TypeIntentCancelled EventType = "intent.cancelled"
+
+	TypeAdminAction EventType = "admin.action"
+)
+
+// Schema staat bovenaan elk event: {"type": "...", "version": N, ...}
+type Schema struct {
+	Type    EventType `json:"type"`
+	Version int       `json:"version"`
+}
+
+func (s *Schema) schema() *Schema { return s }
+
+// TypedEvent is geïmplementeerd door alle events in dit bestand.
+type TypedEvent interface {
+	EventType() EventType
+	schema() *Schema
+}
+
+// Emit zet type + versie in het event en publiceert het op het
+// bijbehorende topic.
+func (b *EventBus) Emit(ev TypedEvent) {
+	sc := ev.schema()
+	sc.Type = ev.EventType()
+	sc.Version = SchemaVersion
+	b.Publish(topicFor(sc.Type), ev)
+}
+
+func topicFor(t EventType) Topic {
+	switch t {
+	case TypeBlockCommitted:
+		return TopicBlock
+	case TypeTxPending, TypeTxIncluded, TypeTxDropped, TypeTransfer:
+		return TopicTx
+	case TypeIntentCreated, TypeIntentPaid, TypeIntentExpired, TypeIntentRefunded, TypeIntentSettled, TypeIntentCancelled:
+		return TopicPayment
+	default:
+		return TopicAdmin
+	}
+}
+
+// ---------- BLOCKS ----------
+
+type BlockCommitted struct {
+	Schema
+	Number     uint64        `json:"number"`
+	Hash       common.Hash   `json:"hash"`
+	ParentHash common.Hash   `json:"parentHash"`
+	Time       uint64        `json:"timestamp"`
+	TxHashes   []common.Hash `json:"txHashes"`
+
+	// In-process consumers (eth_subscribe) krijgen het volledige block mee
+	Block *types.Block `json:"-"`
+}
+
+func (*BlockCommitted) EventType() EventType { return TypeBlockCommitted }
+
+// ---------- TRANSACTIONS ----------
+
+// TxPending: tx is geaccepteerd in de txpool.
+type TxPending struct {
+	Schema
+	Hash common.Hash    `json:"hash"`
+	From common.Address `json:"from"`
+}
+
+func (*TxPending) EventType() EventType { return TypeTxPending }
+
+// TxIncluded: tx is uitgevoerd in een gecommit block.
+type TxIncluded struct {
+	Schema
+	Hash        common.Hash     `json:"hash"`
+	BlockNumber uint64          `json:"blockNumber"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	Index       uint64          `json:"index"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Value       string          `json:"value"` // wei, decimaal
+	Status      uint64          `json:"status"`
+}
+
+func (*TxIncluded) EventType() EventType { return TypeTxIncluded }
+
+// TxDropped: tx is definitief uit de txpool verwijderd zonder inclusie.
+type TxDropped struct {
+	Schema
+	Hash   common.Hash    `json:"hash"`
+	From   common.Address `json:"from"`
+	Reason string         `json:"reason"`
+}
+
+func (*TxDropped) EventType() EventType { return TypeTxDropped }
+
+// Transfer: directe state transfer via gorr_sendTransaction / gorr_sendUSDCc
+// (buiten een block om).
+type Transfer struct {
+	Schema
+	Token  string         `json:"token"`
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Amount string         `json:"amount"`
+	Fee    string         `json:"fee"`
+}
+
+func (*Transfer) EventType() EventType { return TypeTransfer }
+
+// ---------- PAYMENT INTENTS ----------
+
+// IntentInfo is de snapshot van een intent op het moment van het event.
+type IntentInfo struct {
+	IntentID    uint64         `json:"intentId"`
+	Merchant    common.Address `json:"merchant"`
+	Payer       common.Address `json:"payer"`
+	Amount      string         `json:"amount"`
+	Token       string         `json:"token"`
+	Status      string         `json:"status"`
+	Expiry      uint64         `json:"expiry"`
+	TxHash      string         `json:"txHash,omitempty"`
+	BlockNumber uint64         `json:"blockNumber,omitempty"`
+	OrderRef    string         `json:"orderRef,omitempty"`
+}
+
+type IntentCreated struct {
+	Schema
+	IntentInfo
+}
+
+func (*IntentCreated) EventType() EventType { return TypeIntentCreated }
+
+// IntentPaid: één payment tx. Fee/Net zijn van deze tx, PaidTotal het
+// lopende bruto totaal; status "partially_paid" zolang dat onder het
+// bedrag van het intent zit.
+type IntentPaid struct {
+	Schema
+	IntentInfo
+	Fee       string `json:"fee"`
+	Net       string `json:"net"`
+	PaidTotal string `json:"paidTotal"`
+	Overpaid  string `json:"overpaid,omitempty"`
+}
+
+func (*IntentPaid) EventType() EventType { return TypeIntentPaid }
+
+type IntentExpired struct {
+	Schema
+	IntentInfo
+}
+
+func (*IntentExpired) EventType() EventType { return TypeIntentExpired }
+
+// IntentRefunded: één GORR_REFUND tx. Refund/FeeRefund zijn de bedragen
+// van deze tx, RefundedTotal het lopende totaal van de merchant.
+type IntentRefunded struct {
+	Schema
+	IntentInfo
+	Refund        string `json:"refund"`
+	FeeRefund     string `json:"feeRefund"`
+	RefundedTotal string `json:"refundedTotal"`
+	RefundTxHash  string `json:"refundTxHash"`
+}
+
+func (*IntentRefunded) EventType() EventType { return TypeIntentRefunded }
+
+type IntentSettled struct {
+	Schema
+	IntentInfo
+}
+
+func (*IntentSettled) EventType() EventType { return TypeIntentSettled }
+
+type IntentCancelled struct {
+	Schema
+	IntentInfo
+}
+
+func (*IntentCancelled) EventType() EventType { return TypeIntentCancelled }
+
+// ---------- ADMIN ----------
+
+type AdminAction struct {
+	Schema
+	Action  string                 `json:"action"` // bv "pause", "mint", "forceTransfer"
+	Actor   common.Address         `json:"actor"`
+	Details map[string]interface{} `json:"details"`
+}
+
+func (*AdminAction) EventType() EventType { return TypeAdminAction }
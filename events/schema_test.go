@@ -0,0 +1,88 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Elk event komt met type + versie op het juiste topic en overleeft een
+// JSON round-trip ongewijzigd.
+func TestSchemaRoundTrip(t *testing.T) {
+	to := common.HexToAddress("0xb0b")
+	intent := IntentInfo{
+		IntentID: 7, Merchant: to, Payer: common.HexToAddress("0xa1"), Amount: "1000",
+		Token: "GORR", Status: "paid", Expiry: 1234, TxHash: "0xabc", BlockNumber: 9,
+	}
+
+	tests := []struct {
+		ev    TypedEvent
+		topic Topic
+		typ   string
+	}{
+		{&BlockCommitted{Number: 3, Hash: common.HexToHash("0x3"), ParentHash: common.HexToHash("0x2"), Time: 99, TxHashes: []common.Hash{common.HexToHash("0x1")}}, TopicBlock, "block.committed"},
+		{&TxPending{Hash: common.HexToHash("0x1"), From: to}, TopicTx, "tx.pending"},
+		{&TxIncluded{Hash: common.HexToHash("0x1"), BlockNumber: 3, BlockHash: common.HexToHash("0x3"), Index: 1, From: to, To: &to, Value: "5", Status: 1}, TopicTx, "tx.included"},
+		{&TxDropped{Hash: common.HexToHash("0x1"), From: to, Reason: "nonce too low"}, TopicTx, "tx.dropped"},
+		{&Transfer{Token: "USDCc", From: to, To: to, Amount: "10", Fee: "1"}, TopicTx, "tx.transfer"},
+		{&IntentCreated{IntentInfo: intent}, TopicPayment, "intent.created"},
+		{&IntentPaid{IntentInfo: intent, Fee: "25", Net: "975"}, TopicPayment, "intent.paid"},
+		{&IntentExpired{IntentInfo: intent}, TopicPayment, "intent.expired"},
+		{&IntentRefunded{IntentInfo: intent}, TopicPayment, "intent.refunded"},
+		{&IntentSettled{IntentInfo: intent}, TopicPayment, "intent.settled"},
+		{&AdminAction{Action: "pause", Actor: to, Details: map[string]interface{}{"paused": true}}, TopicAdmin, "admin.action"},
+	}
+	for _, tt := range tests {
+		b := NewEventBus()
+		sub := b.Subscribe(1, DropNewest)
+		b.Emit(tt.ev)
+		got := <-sub.C()
+		if got.Topic != tt.topic || got.Data != tt.ev {
+			t.Errorf("%s: published on %s as %v", tt.typ, got.Topic, got.Data)
+		}
+
+		data, err := json.Marshal(tt.ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var head Schema
+		if err := json.Unmarshal(data, &head); err != nil {
+			t.Fatal(err)
+		}
+		if string(head.Type) != tt.typ || head.Version != SchemaVersion {
+			t.Errorf("%s: schema %+v in %s", tt.typ, head, data)
+		}
+
+		back := reflect.New(reflect.TypeOf(tt.ev).Elem()).Interface().(TypedEvent)
+		if err := json.Unmarshal(data, back); err != nil {
+			t.Fatalf("%s: %v", tt.typ, err)
+		}
+		if !reflect.DeepEqual(back, tt.ev) {
+			t.Errorf("%s: round-trip\n got %+v\nwant %+v", tt.typ, back, tt.ev)
+		}
+	}
+}
+
+// Het block zelf gaat alleen naar in-process consumers, niet in de JSON.
+func TestBlockCommittedOmitsBlock(t *testing.T) {
+	ev := &BlockCommitted{Number: 1, Block: &types.Block{Header: &types.Header{Number: 1}}}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"type", "version", "number", "hash", "parentHash", "timestamp", "txHashes"} {
+		if _, ok := fields[k]; !ok {
+			t.Errorf("missing %q in %s", k, data)
+		}
+	}
+	if len(fields) != 7 {
+		t.Errorf("unexpected fields in %s", data)
+	}
+}
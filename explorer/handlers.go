@@ -170,13 +170,18 @@ func (api *ExplorerAPI) handleStreamBlocks(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ch := api.Events.SubscribeBlocks()
+	sub := api.Events.SubscribeBlocks()
+	defer sub.Unsubscribe()
 	ctx := r.Context()
 
 	for {
 		select {
-		case block := <-ch:
-			data, _ := json.Marshal(block)
+		case ev, ok := <-sub.C():
+			if !ok {
+				// subscription gesloten
+				return
+			}
+			data, _ := json.Marshal(ev.Data)
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
 		case <-ctx.Done():
@@ -199,13 +204,18 @@ func (api *ExplorerAPI) handleStreamTxs(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ch := api.Events.SubscribeTxs()
+	sub := api.Events.SubscribeTxs()
+	defer sub.Unsubscribe()
 	ctx := r.Context()
 
 	for {
 		select {
-		case tx := <-ch:
-			data, _ := json.Marshal(tx)
+		case ev, ok := <-sub.C():
+			if !ok {
+				// subscription gesloten
+				return
+			}
+			data, _ := json.Marshal(ev.Data)
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
 		case <-ctx.Done():
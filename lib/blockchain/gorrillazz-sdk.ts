@@ -246,6 +246,11 @@ export interface SendGorrPaymentTxParams {
    * Als gezet → tx.data = "GORR_PAY:<id>" (ASCII).
    */
   intentId?: number;
+  /**
+   * Vanaf de paymentTerms fork verplicht bij intentId: Amount en Expiry
+   * van het intent → tx.data = "GORR_PAY:<id>:<amountWei>:<expiry>".
+   */
+  terms?: { amountWei: BigNumberish; expiry: number };
   /**
    * Optioneel: custom gasLimit (standard is meestal genoeg).
    */
@@ -256,7 +261,8 @@ export interface SendGorrPaymentTxParams {
  * Verstuur een GORR payment transaction via een ethers.js Signer.
  *
  * - Als intentId gezet is:
- *   - tx.data = "GORR_PAY:<id>" (ASCII → bytes)
+ *   - tx.data = "GORR_PAY:<id>" (ASCII → bytes), met terms
+ *     "GORR_PAY:<id>:<amountWei>:<expiry>"
  *   - block producer herkent dit als payment tx
  *   - PaymentGateway.MarkPaidFromTx wordt aangeroepen + fee/tax splits
  *
@@ -268,7 +274,7 @@ export async function sendGorrPaymentTx(
   signer: Signer,
   params: SendGorrPaymentTxParams
 ): Promise<TransactionResponse> {
-  const { to, valueWei, intentId, gasLimit } = params;
+  const { to, valueWei, intentId, terms, gasLimit } = params;
 
   // Zorg dat signer een provider heeft (nodig voor gas price / chain id, etc.)
   if (!signer.provider) {
@@ -281,7 +287,10 @@ export async function sendGorrPaymentTx(
   };
 
   if (intentId !== undefined) {
-    const dataStr = `GORR_PAY:${intentId}`;
+    const dataStr =
+      terms === undefined
+        ? `GORR_PAY:${intentId}`
+        : `GORR_PAY:${intentId}:${BigInt(terms.amountWei)}:${terms.expiry}`;
     tx.data = toUtf8Bytes(dataStr);
   }
 
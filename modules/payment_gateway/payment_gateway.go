@@ -1,11 +1,15 @@
 package paymentgateway
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
+	"sort"
 	"sync"
-	"time"
 
+	"github.com/Siasom1/gorrillazz-chain/core/clock"
+	"github.com/Siasom1/gorrillazz-chain/events"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -16,11 +20,14 @@ import (
 type PaymentStatus string
 
 const (
-	StatusPending  PaymentStatus = "pending"
-	StatusPaid     PaymentStatus = "paid"
-	StatusExpired  PaymentStatus = "expired"
-	StatusRefunded PaymentStatus = "refunded"
-	StatusSettled  PaymentStatus = "settled"
+	StatusPending           PaymentStatus = "pending"
+	StatusPartiallyPaid     PaymentStatus = "partially_paid"
+	StatusPaid              PaymentStatus = "paid"
+	StatusExpired           PaymentStatus = "expired"
+	StatusRefunded          PaymentStatus = "refunded"
+	StatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	StatusSettled           PaymentStatus = "settled"
+	StatusCancelled         PaymentStatus = "cancelled"
 )
 
 // ---------------------------------------------
@@ -45,10 +52,84 @@ type PaymentIntent struct {
 	BlockNumber uint64 `json:"BlockNumber"` // Block waar de betaling in zat
 	PaidAt      uint64 `json:"PaidAt"`      // Block timestamp (unix) van betaling
 
-	// Optioneel: later kun je hier fields toevoegen zoals:
-	// MerchantNetAmount, TreasuryFeeAmount, Currency, Metadata, etc.
+	// Wat de payment txs on-chain deden: lopend bruto totaal, de treasury
+	// fee daarvan en wat er boven Amount is betaald (terug te storten).
+	// TxHash/BlockNumber/PaidAt horen bij de laatste payment tx.
+	PaidAmount      *big.Int `json:"PaidAmount,omitempty"`
+	Fee             *big.Int `json:"Fee,omitempty"`
+	Overpaid        *big.Int `json:"Overpaid,omitempty"`
+	PaymentTxHashes []string `json:"PaymentTxHashes,omitempty"`
+
+	// GORR_REFUND txs: lopend totaal van de merchant en uit de treasury
+	RefundedAmount *big.Int `json:"RefundedAmount,omitempty"`
+	RefundedFee    *big.Int `json:"RefundedFee,omitempty"`
+	RefundTxHashes []string `json:"RefundTxHashes,omitempty"`
+
+	// Merchant gegevens (eigen ordernummer + vrije key/values)
+	OrderRef string            `json:"OrderRef,omitempty"`
+	Metadata map[string]string `json:"Metadata,omitempty"`
+
+	// Settlement run waarmee het intent is uitbetaald (0 = handmatig)
+	SettlementID uint64 `json:"SettlementID,omitempty"`
 }
 
+// IntentOptions: optionele velden bij CreateIntentWithOptions.
+type IntentOptions struct {
+	ExpirySeconds uint64 // 0 = standaard (SetExpirySeconds)
+	OrderRef      string
+	Metadata      map[string]string
+}
+
+// Limieten voor IntentOptions
+const (
+	MaxExpirySeconds    = 30 * 24 * 3600 // 30 dagen
+	MaxOrderRefLength   = 128
+	MaxMetadataKeys     = 20
+	MaxMetadataKeyLen   = 40
+	MaxMetadataValueLen = 500
+)
+
+// validate controleert de opties tegen de limieten hierboven.
+func (o IntentOptions) validate() error {
+	if o.ExpirySeconds > MaxExpirySeconds {
+		return fmt.Errorf("expiry above %d seconds", MaxExpirySeconds)
+	}
+	if len(o.OrderRef) > MaxOrderRefLength {
+		return fmt.Errorf("orderRef longer than %d characters", MaxOrderRefLength)
+	}
+	if len(o.Metadata) > MaxMetadataKeys {
+		return fmt.Errorf("more than %d metadata keys", MaxMetadataKeys)
+	}
+	for k, v := range o.Metadata {
+		if k == "" || len(k) > MaxMetadataKeyLen {
+			return fmt.Errorf("metadata key %q must be 1-%d characters", k, MaxMetadataKeyLen)
+		}
+		if len(v) > MaxMetadataValueLen {
+			return fmt.Errorf("metadata value for %q longer than %d characters", k, MaxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+var ErrIntentNotFound = errors.New("payment intent not found")
+
+// ---------------------------------------------
+// Opslag
+// ---------------------------------------------
+
+// Store bewaart intents als key/value (state.State). Tijdens een block is
+// dat de overlay van het block, zodat de intents in dezelfde LevelDB batch
+// landen als de state van dat block.
+type Store interface {
+	Put(key string, value []byte) error
+	ForEachPrefix(prefix string, fn func(key string, value []byte) error) error
+}
+
+// Key = prefix + id met voorloopnullen → iteratie gaat op id volgorde.
+const intentKeyPrefix = "pi:"
+
+func intentKey(id uint64) string { return fmt.Sprintf("%s%020d", intentKeyPrefix, id) }
+
 // ---------------------------------------------
 // PaymentGateway struct
 // ---------------------------------------------
@@ -56,8 +137,19 @@ type PaymentIntent struct {
 type PaymentGateway struct {
 	mu            sync.RWMutex
 	intents       map[uint64]*PaymentIntent
+	byMerchant    map[common.Address][]uint64 // intent ids per merchant, oplopend
 	counter       uint64
 	expirySeconds uint64 // standaard geldigheidsduur van een intent
+
+	store Store // nil = alleen in geheugen
+
+	// Settlement runs (settlement.go); locked: intent id → pending run
+	settlements       map[uint64]*Settlement
+	settlementCounter uint64
+	locked            map[uint64]uint64
+
+	bus   *events.EventBus // optioneel; nil = geen events
+	clock *clock.Clock     // chain clock voor expiry; nil = wandklok
 }
 
 // NewPaymentGateway maakt een nieuwe gateway.
@@ -65,8 +157,11 @@ type PaymentGateway struct {
 func NewPaymentGateway() *PaymentGateway {
 	return &PaymentGateway{
 		intents:       make(map[uint64]*PaymentIntent),
+		byMerchant:    make(map[common.Address][]uint64),
 		counter:       0,
 		expirySeconds: 900, // 15 min
+		settlements:   make(map[uint64]*Settlement),
+		locked:        make(map[uint64]uint64),
 	}
 }
 
@@ -77,6 +172,76 @@ func (pg *PaymentGateway) SetExpirySeconds(seconds uint64) {
 	pg.expirySeconds = seconds
 }
 
+// SetEventBus koppelt de gateway aan de node event bus.
+func (pg *PaymentGateway) SetEventBus(bus *events.EventBus) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.bus = bus
+}
+
+// SetClock laat expiry de chain clock volgen (evm_increaseTime in dev).
+func (pg *PaymentGateway) SetClock(c *clock.Clock) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.clock = c
+}
+
+// SetStore koppelt de gateway aan de node database en laadt de intents.
+func (pg *PaymentGateway) SetStore(store Store) error {
+	pg.mu.Lock()
+	pg.store = store
+	pg.mu.Unlock()
+	return pg.Load()
+}
+
+// Load leest alle intents en settlement runs opnieuw uit de store en bouwt
+// de id tellers en de merchant index op. Ook na evm_revert of een mislukte block commit.
+func (pg *PaymentGateway) Load() error {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	if pg.store == nil {
+		return nil
+	}
+	intents := make(map[uint64]*PaymentIntent)
+	var counter uint64
+	err := pg.store.ForEachPrefix(intentKeyPrefix, func(key string, value []byte) error {
+		var intent PaymentIntent
+		if err := json.Unmarshal(value, &intent); err != nil {
+			return fmt.Errorf("payment intent %s: %w", key, err)
+		}
+		intents[intent.ID] = &intent
+		if intent.ID > counter {
+			counter = intent.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	pg.intents = intents
+	pg.counter = counter
+	pg.byMerchant = make(map[common.Address][]uint64)
+	ids := make([]uint64, 0, len(intents))
+	for id := range intents {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	for _, id := range ids {
+		m := intents[id].Merchant
+		pg.byMerchant[m] = append(pg.byMerchant[m], id)
+	}
+	return pg.loadSettlementsLocked()
+}
+
+// Now: huidige chain tijd, bijv. als ts voor CreateIntent.
+func (pg *PaymentGateway) Now() uint64 {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.clock.Now()
+}
+
 // ---------------------------------------------
 // Intent Lifecycle
 // ---------------------------------------------
@@ -85,25 +250,46 @@ func (pg *PaymentGateway) SetExpirySeconds(seconds uint64) {
 // merchant: merchant address
 // amount:   brutobedrag dat klant moet betalen (wei)
 // token:    "GORR" of "USDCc"
-// ts:       unix timestamp (bijv. time.Now().Unix() of blockTime)
+// ts:       unix timestamp (bijv. pg.Now() of blockTime)
 func (pg *PaymentGateway) CreateIntent(
 	merchant common.Address,
 	amount *big.Int,
 	token string,
 	ts uint64,
+) (*PaymentIntent, uint64, error) {
+	return pg.CreateIntentWithOptions(merchant, amount, token, ts, IntentOptions{})
+}
+
+// CreateIntentWithOptions is CreateIntent met eigen expiry, ordernummer
+// en metadata.
+func (pg *PaymentGateway) CreateIntentWithOptions(
+	merchant common.Address,
+	amount *big.Int,
+	token string,
+	ts uint64,
+	opts IntentOptions,
 ) (*PaymentIntent, uint64, error) {
 	if amount == nil || amount.Sign() <= 0 {
 		return nil, 0, errors.New("amount must be positive")
 	}
-	if token == "" {
-		return nil, 0, errors.New("token is required")
+	if token != "GORR" && token != "USDCc" {
+		return nil, 0, fmt.Errorf("unsupported token %q (GORR or USDCc)", token)
+	}
+	if merchant == (common.Address{}) {
+		return nil, 0, errors.New("merchant is required")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, 0, err
 	}
 
 	pg.mu.Lock()
 	defer pg.mu.Unlock()
 
-	pg.counter++
-	id := pg.counter
+	id := pg.counter + 1
+	expiry := pg.expirySeconds
+	if opts.ExpirySeconds > 0 {
+		expiry = opts.ExpirySeconds
+	}
 
 	intent := &PaymentIntent{
 		ID:        id,
@@ -112,54 +298,57 @@ func (pg *PaymentGateway) CreateIntent(
 		Amount:    new(big.Int).Set(amount),
 		Token:     token,
 		Timestamp: ts,
-		Expiry:    ts + pg.expirySeconds,
+		Expiry:    ts + expiry,
 		Paid:      false,
 		Refunded:  false,
 		Status:    StatusPending,
 		TxHash:    "",
+		OrderRef:  opts.OrderRef,
+		Metadata:  copyMetadata(opts.Metadata),
 	}
 
+	if err := pg.saveLocked(nil, intent); err != nil {
+		return nil, 0, err
+	}
+	pg.counter = id
 	pg.intents[id] = intent
+	pg.byMerchant[merchant] = append(pg.byMerchant[merchant], id)
+	pg.emitLocked(&events.IntentCreated{IntentInfo: IntentInfo(intent)})
+
 	return cloneIntent(intent), id, nil
 }
 
-// GetIntent haalt een intent op én update automatisch de status
-// naar "expired" als de intent verlopen is en nog niet betaald.
+// GetIntent haalt een intent op; een verlopen, onbetaalde intent heeft
+// status "expired" (zie statusAt).
 func (pg *PaymentGateway) GetIntent(id uint64) (*PaymentIntent, error) {
-	pg.mu.Lock()
-	defer pg.mu.Unlock()
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
 
 	intent, ok := pg.intents[id]
 	if !ok {
-		return nil, errors.New("payment intent not found")
+		return nil, ErrIntentNotFound
 	}
 
-	now := uint64(time.Now().Unix())
-	pg.updateStatusLocked(intent, now)
-
-	return cloneIntent(intent), nil
+	return statusAt(intent, pg.clock.Now()), nil
 }
 
-// ListMerchantPayments geeft alle intents voor een merchant.
-// Status wordt per intent bijgewerkt (expiry).
+// ListMerchantPayments geeft alle intents voor een merchant, op id.
+// Status zoals bij GetIntent (expiry).
 func (pg *PaymentGateway) ListMerchantPayments(merchant common.Address) []*PaymentIntent {
-	pg.mu.Lock()
-	defer pg.mu.Unlock()
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
 
-	now := uint64(time.Now().Unix())
+	now := pg.clock.Now()
 	list := []*PaymentIntent{}
 
-	for _, i := range pg.intents {
-		if i.Merchant == merchant {
-			pg.updateStatusLocked(i, now)
-			list = append(list, cloneIntent(i))
-		}
+	for _, id := range pg.byMerchant[merchant] {
+		list = append(list, statusAt(pg.intents[id], now))
 	}
 	return list
 }
 
 // ---------------------------------------------
-// "Soft" Pay / Refund API (RPC helpers)
+// "Soft" Pay API (RPC helpers)
 // ---------------------------------------------
 
 // PayIntent is een "zachte" betaalactie, zonder on-chain saldo checks.
@@ -171,50 +360,63 @@ func (pg *PaymentGateway) PayIntent(id uint64, payer common.Address) (*PaymentIn
 
 	intent, ok := pg.intents[id]
 	if !ok {
-		return nil, errors.New("payment intent not found")
+		return nil, ErrIntentNotFound
 	}
 
-	now := uint64(time.Now().Unix())
-	pg.updateStatusLocked(intent, now)
-
-	if intent.Status == StatusExpired {
+	now := pg.clock.Now()
+	if isDue(intent, now) || intent.Status == StatusExpired {
 		return nil, errors.New("cannot pay expired intent")
 	}
-	if intent.Status == StatusPaid || intent.Status == StatusRefunded || intent.Status == StatusSettled {
+	if intent.Status == StatusPaid || intent.Status == StatusPartiallyRefunded || intent.Status == StatusRefunded || intent.Status == StatusSettled {
 		return cloneIntent(intent), nil
 	}
 
-	intent.Paid = true
-	intent.Status = StatusPaid
-	intent.Payer = payer
-	intent.PaidAt = now
+	updated := cloneIntent(intent)
+	updated.Paid = true
+	updated.Status = StatusPaid
+	updated.Payer = payer
+	updated.PaidAt = now
+	if err := pg.saveLocked(nil, updated); err != nil {
+		return nil, err
+	}
+	intent = updated
+	pg.intents[id] = intent
+	pg.emitLocked(&events.IntentPaid{
+		IntentInfo: IntentInfo(intent),
+		Fee:        "0",
+		Net:        intent.Amount.String(),
+		PaidTotal:  intent.Amount.String(),
+	})
 
 	return cloneIntent(intent), nil
 }
 
-// RefundIntent markeert een intent als refunded.
-// In de echte wereld zou hier ook saldo-verplaatsing bijkomen;
-// hier markeren we alleen de intent state.
-func (pg *PaymentGateway) RefundIntent(id uint64) (*PaymentIntent, error) {
+// CancelIntent trekt een nog niet betaalde intent in; een GORR_PAY tx
+// ervoor wordt daarna niet meer opgenomen.
+func (pg *PaymentGateway) CancelIntent(id uint64) (*PaymentIntent, error) {
 	pg.mu.Lock()
 	defer pg.mu.Unlock()
 
 	intent, ok := pg.intents[id]
 	if !ok {
-		return nil, errors.New("payment intent not found")
+		return nil, ErrIntentNotFound
 	}
-
-	now := uint64(time.Now().Unix())
-	pg.updateStatusLocked(intent, now)
-
-	if intent.Status != StatusPaid {
-		return nil, errors.New("only paid intents can be refunded")
+	if isDue(intent, pg.clock.Now()) {
+		return nil, errors.New("cannot cancel expired intent")
+	}
+	if intent.Status != StatusPending {
+		return nil, fmt.Errorf("only pending intents can be cancelled (status %s)", intent.Status)
 	}
 
-	intent.Refunded = true
-	intent.Status = StatusRefunded
+	updated := cloneIntent(intent)
+	updated.Status = StatusCancelled
+	if err := pg.saveLocked(nil, updated); err != nil {
+		return nil, err
+	}
+	pg.intents[id] = updated
+	pg.emitLocked(&events.IntentCancelled{IntentInfo: IntentInfo(updated)})
 
-	return cloneIntent(intent), nil
+	return cloneIntent(updated), nil
 }
 
 // Settlen (bijv. na uitbetaling naar bankrekening).
@@ -225,14 +427,25 @@ func (pg *PaymentGateway) SettleIntent(id uint64) (*PaymentIntent, error) {
 
 	intent, ok := pg.intents[id]
 	if !ok {
-		return nil, errors.New("payment intent not found")
+		return nil, ErrIntentNotFound
 	}
 
-	if intent.Status != StatusPaid && intent.Status != StatusRefunded {
+	if intent.Status != StatusPaid && intent.Status != StatusPartiallyRefunded && intent.Status != StatusRefunded {
 		return nil, errors.New("only paid or refunded intents can be settled")
 	}
+	if sid := pg.locked[id]; sid != 0 {
+		return nil, fmt.Errorf("intent %d is in pending settlement %d", id, sid)
+	}
+
+	updated := cloneIntent(intent)
+	updated.Status = StatusSettled
+	if err := pg.saveLocked(nil, updated); err != nil {
+		return nil, err
+	}
+	intent = updated
+	pg.intents[id] = intent
+	pg.emitLocked(&events.IntentSettled{IntentInfo: IntentInfo(intent)})
 
-	intent.Status = StatusSettled
 	return cloneIntent(intent), nil
 }
 
@@ -245,76 +458,432 @@ func (pg *PaymentGateway) SettleIntent(id uint64) (*PaymentIntent, error) {
 //
 // Hier doen we:
 // - intent opzoeken
-// - expiry check
-// - merchant match
-// - amount ≥ intent.Amount check
-// - status = paid
+// - checkPayment (status, expiry, merchant, token, payer)
+// - bedrag en fee optellen bij het lopende totaal
+// - status = paid als Amount bereikt is, anders partially_paid
 // - on-chain metadata invullen (TxHash, BlockNumber, PaidAt)
+//
+// Een te hoog totaal wordt als Overpaid bijgehouden; dat deel kan de
+// merchant met een GORR_REFUND terugstorten. w is de overlay van het
+// block: de intent wordt samen met de block state weggeschreven.
 func (pg *PaymentGateway) MarkPaidFromTx(
+	w Store,
 	id uint64,
 	payer common.Address,
 	merchant common.Address,
+	token string,
 	amount *big.Int,
+	fee *big.Int,
 	txHash common.Hash,
 	blockNum uint64,
 	blockTime uint64,
-) error {
+) (*PaymentIntent, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	intent, ok := pg.intents[id]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	// IntentPaid wordt door de producer ge-emit zodra het block gecommit
+	// is (die kent ook fee/net).
+	updated, err := WithPayment(intent, payer, merchant, token, amount, fee, txHash, blockNum, blockTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := pg.saveLocked(w, updated); err != nil {
+		return nil, err
+	}
+	pg.intents[id] = updated
+	return cloneIntent(updated), nil
+}
+
+// CreateSettledIntent legt een betaling vast die zonder intent on-chain
+// is gedaan (een subscription termijn): een nieuw intent dat meteen
+// settled is. Net als MarkPaidFromTx gaat het naar w en emit de producer
+// de events pas na de commit. txHash is leeg bij een auto pull van het
+// block zelf.
+func (pg *PaymentGateway) CreateSettledIntent(
+	w Store,
+	merchant common.Address,
+	payer common.Address,
+	token string,
+	amount *big.Int,
+	fee *big.Int,
+	txHash common.Hash,
+	blockNum uint64,
+	blockTime uint64,
+	opts IntentOptions,
+) (*PaymentIntent, error) {
 	if amount == nil || amount.Sign() <= 0 {
-		return errors.New("amount must be positive")
+		return nil, errors.New("amount must be positive")
+	}
+	if token != "GORR" && token != "USDCc" {
+		return nil, fmt.Errorf("unsupported token %q (GORR or USDCc)", token)
+	}
+	if fee == nil || fee.Sign() < 0 || fee.Cmp(amount) > 0 {
+		return nil, errors.New("invalid fee")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
 	}
 
 	pg.mu.Lock()
 	defer pg.mu.Unlock()
 
+	id := pg.counter + 1
+	intent := &PaymentIntent{
+		ID:          id,
+		Merchant:    merchant,
+		Payer:       payer,
+		Amount:      new(big.Int).Set(amount),
+		Token:       token,
+		Timestamp:   blockTime,
+		Expiry:      blockTime,
+		Paid:        true,
+		Status:      StatusSettled,
+		BlockNumber: blockNum,
+		PaidAt:      blockTime,
+		PaidAmount:  new(big.Int).Set(amount),
+		Fee:         new(big.Int).Set(fee),
+		OrderRef:    opts.OrderRef,
+		Metadata:    copyMetadata(opts.Metadata),
+	}
+	if txHash != (common.Hash{}) {
+		intent.TxHash = txHash.Hex()
+		intent.PaymentTxHashes = []string{txHash.Hex()}
+	}
+
+	if err := pg.saveLocked(w, intent); err != nil {
+		return nil, err
+	}
+	pg.counter = id
+	pg.intents[id] = intent
+	pg.byMerchant[merchant] = append(pg.byMerchant[merchant], id)
+	return cloneIntent(intent), nil
+}
+
+// WithPayment geeft intent na deze betaling, zonder iets op te slaan. De
+// producer gebruikt dit om de intents in een block in aanbouw bij te
+// houden: er komt alleen een payment tx in als het intent hem accepteert,
+// zodat er nooit geld naar een merchant gaat dat het intent weigert.
+func WithPayment(
+	intent *PaymentIntent,
+	payer common.Address,
+	merchant common.Address,
+	token string,
+	amount *big.Int,
+	fee *big.Int,
+	txHash common.Hash,
+	blockNum uint64,
+	blockTime uint64,
+) (*PaymentIntent, error) {
+	if err := checkPayment(intent, payer, merchant, token, amount, blockTime); err != nil {
+		return nil, err
+	}
+	if fee == nil || fee.Sign() < 0 || fee.Cmp(amount) > 0 {
+		return nil, errors.New("invalid fee")
+	}
+
+	updated := cloneIntent(intent)
+	updated.Payer = payer
+	updated.PaidAt = blockTime
+	updated.TxHash = txHash.Hex()
+	updated.BlockNumber = blockNum
+	updated.PaidAmount = new(big.Int).Add(bigOrZero(intent.PaidAmount), amount)
+	updated.Fee = new(big.Int).Add(bigOrZero(intent.Fee), fee)
+	updated.PaymentTxHashes = append(updated.PaymentTxHashes, txHash.Hex())
+
+	if updated.PaidAmount.Cmp(updated.Amount) >= 0 {
+		updated.Paid = true
+		updated.Status = StatusPaid
+		if excess := new(big.Int).Sub(updated.PaidAmount, updated.Amount); excess.Sign() > 0 {
+			updated.Overpaid = excess
+		}
+	} else {
+		updated.Status = StatusPartiallyPaid
+	}
+	return updated, nil
+}
+
+// CheckRefund controleert een refund van merchant aan payer tegen het
+// intent: alleen de merchant, alleen naar de payer, in het token van het
+// intent en nooit meer dan wat er nog openstaat (zie Refundable).
+func (pg *PaymentGateway) CheckRefund(id uint64, merchant, payer common.Address, token string, amount, fee *big.Int) error {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+
 	intent, ok := pg.intents[id]
 	if !ok {
-		return errors.New("payment intent not found")
+		return ErrIntentNotFound
+	}
+	if sid := pg.locked[id]; sid != 0 {
+		return fmt.Errorf("intent %d is in pending settlement %d", id, sid)
 	}
+	return checkRefund(intent, merchant, payer, token, amount, fee)
+}
+
+// RefundFromTx verwerkt een GORR_REFUND tx uit een block: de bedragen
+// tellen op bij het lopende totaal en de tx hash komt op het intent. Is
+// het netto bedrag volledig terug, dan is het intent refunded, anders
+// partially_refunded. w is de overlay van het block, zoals bij
+// MarkPaidFromTx.
+func (pg *PaymentGateway) RefundFromTx(
+	w Store,
+	id uint64,
+	merchant common.Address,
+	payer common.Address,
+	token string,
+	amount *big.Int,
+	fee *big.Int,
+	txHash common.Hash,
+) (*PaymentIntent, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
 
-	// Status updaten obv blockTime (chain time)
-	pg.updateStatusLocked(intent, blockTime)
+	intent, ok := pg.intents[id]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	updated, err := WithRefund(intent, merchant, payer, token, amount, fee, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := pg.saveLocked(w, updated); err != nil {
+		return nil, err
+	}
+	pg.intents[id] = updated
+	return cloneIntent(updated), nil
+}
 
-	if intent.Status == StatusExpired {
-		return errors.New("intent is expired")
+// WithRefund geeft intent na deze refund, zonder iets op te slaan (zie
+// WithPayment).
+func WithRefund(
+	intent *PaymentIntent,
+	merchant common.Address,
+	payer common.Address,
+	token string,
+	amount *big.Int,
+	fee *big.Int,
+	txHash common.Hash,
+) (*PaymentIntent, error) {
+	if err := checkRefund(intent, merchant, payer, token, amount, fee); err != nil {
+		return nil, err
 	}
-	if intent.Status == StatusPaid || intent.Status == StatusRefunded || intent.Status == StatusSettled {
-		return errors.New("intent already processed")
+
+	updated := cloneIntent(intent)
+	updated.RefundedAmount = new(big.Int).Add(bigOrZero(intent.RefundedAmount), amount)
+	updated.RefundedFee = new(big.Int).Add(bigOrZero(intent.RefundedFee), fee)
+	updated.RefundTxHashes = append(updated.RefundTxHashes, txHash.Hex())
+	if net, _ := Refundable(updated); net.Sign() == 0 {
+		updated.Refunded = true
+		updated.Status = StatusRefunded
+	} else {
+		updated.Status = StatusPartiallyRefunded
 	}
+	return updated, nil
+}
 
-	if merchant != intent.Merchant {
-		return errors.New("merchant mismatch for intent")
+// Refundable: wat de merchant nog kan terugstorten (netto ontvangen min
+// al terug) en wat er nog aan fee terug kan.
+func Refundable(intent *PaymentIntent) (net, fee *big.Int) {
+	paid := bigOrZero(intent.PaidAmount)
+	if intent.PaidAmount == nil && intent.Paid {
+		// Betaald vóór PaidAmount werd bijgehouden
+		paid = intent.Amount
 	}
+	paidFee := bigOrZero(intent.Fee)
+	net = new(big.Int).Sub(paid, paidFee)
+	net.Sub(net, bigOrZero(intent.RefundedAmount))
+	fee = new(big.Int).Sub(paidFee, bigOrZero(intent.RefundedFee))
+	if net.Sign() < 0 {
+		net.SetInt64(0)
+	}
+	if fee.Sign() < 0 {
+		fee.SetInt64(0)
+	}
+	return net, fee
+}
 
-	// We eisen dat de on-chain betaalde waarde >= intent.Amount is
-	if amount.Cmp(intent.Amount) < 0 {
-		return errors.New("amount less than invoice value")
+// Outstanding: wat er van het intent nog betaald moet worden (Amount min
+// wat er al binnen is), nooit negatief.
+func Outstanding(intent *PaymentIntent) *big.Int {
+	due := new(big.Int).Sub(intent.Amount, bigOrZero(intent.PaidAmount))
+	if due.Sign() < 0 {
+		due.SetInt64(0)
 	}
+	return due
+}
 
-	// Markeer als betaald
-	intent.Paid = true
-	intent.Status = StatusPaid
-	intent.Payer = payer
-	intent.PaidAt = blockTime
-	intent.TxHash = txHash.Hex()
-	intent.BlockNumber = blockNum
+// ExpireDue zet alle open (pending of deels betaalde) intents met
+// Expiry < now op expired en schrijft ze naar w (de overlay van het
+// block). De producer roept dit per block aan met de block timestamp en
+// meldt IntentExpired pas na de commit, zodat dat niet afhangt van wie er
+// toevallig leest.
+func (pg *PaymentGateway) ExpireDue(w Store, now uint64) ([]*PaymentIntent, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
 
-	return nil
+	expired := []*PaymentIntent{}
+	for _, intent := range pg.intents {
+		if !isDue(intent, now) {
+			continue
+		}
+		updated := cloneIntent(intent)
+		updated.Status = StatusExpired
+		if err := pg.saveLocked(w, updated); err != nil {
+			return nil, err
+		}
+		pg.intents[updated.ID] = updated
+		expired = append(expired, cloneIntent(updated))
+	}
+	sort.Slice(expired, func(a, b int) bool { return expired[a].ID < expired[b].ID })
+	return expired, nil
 }
 
 // ---------------------------------------------
 // Helpers
 // ---------------------------------------------
 
-// updateStatusLocked werkt onder pg.mu.Lock() / pg.mu.RLock().
-// Als intent verlopen is en nog niet betaald -> StatusExpired.
-func (pg *PaymentGateway) updateStatusLocked(intent *PaymentIntent, now uint64) {
-	if intent.Status == StatusPending &&
+// checkPayment: intent staat (nog) open, is niet verlopen op blockTime,
+// en de betaling past qua merchant, token en payer. Elk positief bedrag
+// mag: een deelbetaling telt op, een te hoge wordt Overpaid.
+func checkPayment(intent *PaymentIntent, payer, merchant common.Address, token string, amount *big.Int, blockTime uint64) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return errors.New("amount must be positive")
+	}
+	switch intent.Status {
+	case StatusPending, StatusPartiallyPaid:
+	case StatusCancelled:
+		return errors.New("intent is cancelled")
+	case StatusExpired:
+		return errors.New("intent is expired")
+	default:
+		return fmt.Errorf("intent already processed (status %s)", intent.Status)
+	}
+	// Expiry obv blockTime (chain time); opgeslagen wordt die pas door
+	// ExpireDue.
+	if intent.Expiry > 0 && blockTime > intent.Expiry {
+		return errors.New("intent is expired")
+	}
+	if merchant != intent.Merchant {
+		return errors.New("merchant mismatch for intent")
+	}
+	if token != intent.Token {
+		return fmt.Errorf("intent is priced in %s, paid in %s", intent.Token, token)
+	}
+	// Vervolgbetalingen van dezelfde payer: een refund gaat naar één adres
+	if intent.Status == StatusPartiallyPaid && payer != intent.Payer {
+		return errors.New("intent is partially paid by another payer")
+	}
+	return nil
+}
+
+func checkRefund(intent *PaymentIntent, merchant, payer common.Address, token string, amount, fee *big.Int) error {
+	switch intent.Status {
+	case StatusPaid, StatusPartiallyPaid, StatusPartiallyRefunded:
+	case StatusExpired:
+		// Verlopen na een deelbetaling: die moet terug kunnen
+		if bigOrZero(intent.PaidAmount).Sign() == 0 {
+			return errors.New("expired intent was never paid")
+		}
+	default:
+		return fmt.Errorf("only paid intents can be refunded (status %s)", intent.Status)
+	}
+	if merchant != intent.Merchant {
+		return errors.New("only the merchant can refund this intent")
+	}
+	if payer != intent.Payer {
+		return errors.New("refund must go to the payer of the intent")
+	}
+	if token != intent.Token {
+		return fmt.Errorf("intent was paid in %s, refund is in %s", intent.Token, token)
+	}
+	if amount == nil || fee == nil || amount.Sign() < 0 || fee.Sign() < 0 || amount.Sign()+fee.Sign() == 0 {
+		return errors.New("refund amount must be positive")
+	}
+	net, openFee := Refundable(intent)
+	if amount.Cmp(net) > 0 {
+		return fmt.Errorf("refund of %s exceeds refundable amount %s", amount, net)
+	}
+	if fee.Cmp(openFee) > 0 {
+		return fmt.Errorf("fee refund of %s exceeds refundable fee %s", fee, openFee)
+	}
+	return nil
+}
+
+func bigOrZero(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return x
+}
+
+// statusAt geeft een kopie van intent met de status op tijdstip now: een
+// verlopen pending intent heet hier al expired. Opgeslagen (en gemeld)
+// wordt dat pas door ExpireDue in het eerstvolgende block.
+func statusAt(intent *PaymentIntent, now uint64) *PaymentIntent {
+	view := cloneIntent(intent)
+	if isDue(view, now) {
+		view.Status = StatusExpired
+	}
+	return view
+}
+
+// isDue: pending of deels betaald, en voorbij de Expiry. Een deels betaald
+// intent dat verloopt kan nog wel gerefund worden.
+func isDue(intent *PaymentIntent, now uint64) bool {
+	return (intent.Status == StatusPending || intent.Status == StatusPartiallyPaid) &&
 		!intent.Paid &&
 		!intent.Refunded &&
 		intent.Expiry > 0 &&
-		now > intent.Expiry {
-		intent.Status = StatusExpired
+		now > intent.Expiry
+}
+
+// saveLocked schrijft intent naar w, of naar de eigen store als w nil is.
+// Zonder store (tests / tooling) blijft alles in geheugen.
+func (pg *PaymentGateway) saveLocked(w Store, intent *PaymentIntent) error {
+	if w == nil {
+		w = pg.store
 	}
+	if w == nil {
+		return nil
+	}
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+	if err := w.Put(intentKey(intent.ID), data); err != nil {
+		return fmt.Errorf("save payment intent %d: %w", intent.ID, err)
+	}
+	return nil
+}
+
+// emitLocked publiceert een event; Publish blokkeert nooit, dus dit mag
+// onder pg.mu.
+func (pg *PaymentGateway) emitLocked(ev events.TypedEvent) {
+	if pg.bus != nil {
+		pg.bus.Emit(ev)
+	}
+}
+
+// IntentInfo zet een intent om naar de event-snapshot.
+func IntentInfo(i *PaymentIntent) events.IntentInfo {
+	info := events.IntentInfo{
+		IntentID:    i.ID,
+		Merchant:    i.Merchant,
+		Payer:       i.Payer,
+		Token:       i.Token,
+		Status:      string(i.Status),
+		Expiry:      i.Expiry,
+		TxHash:      i.TxHash,
+		BlockNumber: i.BlockNumber,
+		OrderRef:    i.OrderRef,
+	}
+	if i.Amount != nil {
+		info.Amount = i.Amount.String()
+	}
+	return info
 }
 
 // cloneIntent maakt een kopie zodat de aanroeper de interne struct
@@ -324,8 +893,24 @@ func cloneIntent(i *PaymentIntent) *PaymentIntent {
 		return nil
 	}
 	clone := *i
-	if i.Amount != nil {
-		clone.Amount = new(big.Int).Set(i.Amount)
+	for _, x := range []**big.Int{&clone.Amount, &clone.PaidAmount, &clone.Fee, &clone.Overpaid, &clone.RefundedAmount, &clone.RefundedFee} {
+		if *x != nil {
+			*x = new(big.Int).Set(*x)
+		}
 	}
+	clone.PaymentTxHashes = append([]string(nil), i.PaymentTxHashes...)
+	clone.RefundTxHashes = append([]string(nil), i.RefundTxHashes...)
+	clone.Metadata = copyMetadata(i.Metadata)
 	return &clone
 }
+
+func copyMetadata(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
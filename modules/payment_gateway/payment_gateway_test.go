@@ -0,0 +1,71 @@
+package paymentgateway
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Deelbetalingen tellen op tot Amount; wat erboven zit is Overpaid. Een
+// betaling die het intent weigert verandert niets.
+func TestPartialPayments(t *testing.T) {
+	pg := NewPaymentGateway()
+	intent, _, err := pg.CreateIntent(testMerchant, big.NewInt(1000), "GORR", pg.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := common.HexToAddress("0xca7")
+
+	steps := []struct {
+		name     string
+		payer    common.Address
+		merchant common.Address
+		token    string
+		amount   int64
+		fee      int64
+		time     uint64 // 0 = nu
+		ok       bool
+		status   PaymentStatus
+		paid     int64 // lopend totaal
+		fees     int64
+		overpaid int64
+	}{
+		{"other merchant", testPayer, other, "GORR", 400, 10, 0, false, StatusPending, 0, 0, 0},
+		{"other token", testPayer, testMerchant, "USDCc", 400, 10, 0, false, StatusPending, 0, 0, 0},
+		{"fee above the amount", testPayer, testMerchant, "GORR", 400, 401, 0, false, StatusPending, 0, 0, 0},
+		{"after the expiry", testPayer, testMerchant, "GORR", 400, 10, intent.Expiry + 1, false, StatusPending, 0, 0, 0},
+		{"first part", testPayer, testMerchant, "GORR", 400, 10, 0, true, StatusPartiallyPaid, 400, 10, 0},
+		{"another payer", other, testMerchant, "GORR", 100, 2, 0, false, StatusPartiallyPaid, 400, 10, 0},
+		{"zero", testPayer, testMerchant, "GORR", 0, 0, 0, false, StatusPartiallyPaid, 400, 10, 0},
+		{"the rest and more", testPayer, testMerchant, "GORR", 700, 17, 0, true, StatusPaid, 1100, 27, 100},
+		{"after paid", testPayer, testMerchant, "GORR", 1, 0, 0, false, StatusPaid, 1100, 27, 100},
+	}
+	hashes := []string{}
+	for i, st := range steps {
+		ts := st.time
+		if ts == 0 {
+			ts = pg.Now()
+		}
+		hash := common.Hash{byte(i + 1)}
+		_, err := pg.MarkPaidFromTx(nil, intent.ID, st.payer, st.merchant, st.token, big.NewInt(st.amount), big.NewInt(st.fee), hash, uint64(i+1), ts)
+		if (err == nil) != st.ok {
+			t.Fatalf("%s: err %v, want ok=%v", st.name, err, st.ok)
+		}
+		if st.ok {
+			hashes = append(hashes, hash.Hex())
+		}
+
+		got, err := pg.GetIntent(intent.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != st.status || bigOrZero(got.PaidAmount).Int64() != st.paid || bigOrZero(got.Fee).Int64() != st.fees || bigOrZero(got.Overpaid).Int64() != st.overpaid {
+			t.Fatalf("%s: status %s paid %v fee %v overpaid %v, want %s %d %d %d", st.name, got.Status, got.PaidAmount, got.Fee, got.Overpaid, st.status, st.paid, st.fees, st.overpaid)
+		}
+		if !slices.Equal(got.PaymentTxHashes, hashes) || got.Paid != (st.status == StatusPaid) {
+			t.Fatalf("%s: payment txs %v paid=%v", st.name, got.PaymentTxHashes, got.Paid)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package paymentgateway
+
+import (
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/state"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testMerchant = common.HexToAddress("0xa11")
+	testPayer    = common.HexToAddress("0xb0b")
+)
+
+// openGateway: gateway op de state db in path, zoals de node hem opent.
+func openGateway(t *testing.T, path string) (*PaymentGateway, *state.State) {
+	t.Helper()
+	st, err := state.NewState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := NewPaymentGateway()
+	if err := pg.SetStore(st); err != nil {
+		t.Fatal(err)
+	}
+	return pg, st
+}
+
+func intentJSON(t *testing.T, pg *PaymentGateway, id uint64) string {
+	t.Helper()
+	intent, err := pg.GetIntent(id)
+	if err != nil {
+		t.Fatalf("intent %d: %v", id, err)
+	}
+	data, err := json.Marshal(intent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func merchantIDs(pg *PaymentGateway, merchant common.Address) []uint64 {
+	ids := []uint64{}
+	for _, intent := range pg.ListMerchantPayments(merchant) {
+		ids = append(ids, intent.ID)
+	}
+	return ids
+}
+
+func TestIntentsSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	other := common.HexToAddress("0xa12")
+	pg, st := openGateway(t, path)
+
+	// 1, 2, 4 van testMerchant, 3 van other
+	for _, m := range []common.Address{testMerchant, testMerchant, other, testMerchant} {
+		if _, _, err := pg.CreateIntentWithOptions(m, big.NewInt(1000), "GORR", pg.Now(), IntentOptions{
+			OrderRef: "order", Metadata: map[string]string{"k": "v"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 1 betaald in een block dat gecommit wordt
+	block := st.Begin()
+	if _, err := pg.MarkPaidFromTx(block, 1, testPayer, testMerchant, "GORR", big.NewInt(1000), big.NewInt(25), common.Hash{1}, 7, pg.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.CancelIntent(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 betaald in een block dat nooit gecommit wordt (afgekeurd)
+	if _, err := pg.MarkPaidFromTx(st.Begin(), 4, testPayer, testMerchant, "GORR", big.NewInt(1000), big.NewInt(25), common.Hash{4}, 8, pg.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint64]string{}
+	for id := uint64(1); id <= 3; id++ {
+		want[id] = intentJSON(t, pg, id)
+	}
+	st.Close()
+
+	pg, st = openGateway(t, path)
+	defer st.Close()
+
+	for id, w := range want {
+		if got := intentJSON(t, pg, id); got != w {
+			t.Errorf("intent %d after reopen:\n got %s\nwant %s", id, got, w)
+		}
+	}
+	tests := []struct {
+		id     uint64
+		status PaymentStatus
+	}{
+		{1, StatusPaid},
+		{2, StatusCancelled},
+		{3, StatusPending},
+		{4, StatusPending}, // de betaling zat in een block zonder commit
+	}
+	for _, tt := range tests {
+		intent, err := pg.GetIntent(tt.id)
+		if err != nil || intent.Status != tt.status {
+			t.Errorf("intent %d: %+v, %v; want status %s", tt.id, intent, err, tt.status)
+		}
+	}
+
+	// Teller en merchant index komen uit de records
+	if got := merchantIDs(pg, testMerchant); !slices.Equal(got, []uint64{1, 2, 4}) {
+		t.Errorf("testMerchant intents %v, want [1 2 4]", got)
+	}
+	if got := merchantIDs(pg, other); !slices.Equal(got, []uint64{3}) {
+		t.Errorf("other intents %v, want [3]", got)
+	}
+	next, id, err := pg.CreateIntent(other, big.NewInt(5), "GORR", pg.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 5 || next.ID != 5 {
+		t.Fatalf("new intent after reopen got id %d, want 5", id)
+	}
+	if got := merchantIDs(pg, other); !slices.Equal(got, []uint64{3, 5}) {
+		t.Errorf("other intents %v, want [3 5]", got)
+	}
+}
+
+// Load na een teruggedraaide state (evm_revert) vergeet latere intents en
+// geeft hun ids opnieuw uit.
+func TestLoadRebuildsCounter(t *testing.T) {
+	pg, st := openGateway(t, filepath.Join(t.TempDir(), "state"))
+	defer st.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := pg.CreateIntent(testMerchant, big.NewInt(1000), "GORR", pg.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := st.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := pg.CreateIntent(testMerchant, big.NewInt(1000), "GORR", pg.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.RevertToSnapshot(snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := merchantIDs(pg, testMerchant); !slices.Equal(got, []uint64{1, 2}) {
+		t.Fatalf("intents %v after revert, want [1 2]", got)
+	}
+	if _, err := pg.GetIntent(3); err != ErrIntentNotFound {
+		t.Fatalf("intent 3 after revert: %v", err)
+	}
+	if _, id, _ := pg.CreateIntent(testMerchant, big.NewInt(1000), "GORR", pg.Now()); id != 3 {
+		t.Fatalf("id %d after revert, want 3", id)
+	}
+}
@@ -0,0 +1,111 @@
+package paymentgateway
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var testPayout = common.HexToAddress("0xca5")
+
+// paidIntent: intent van amount wei, in één tx volledig betaald met fee.
+func paidIntent(t *testing.T, pg *PaymentGateway, amount, fee int64, tx byte) *PaymentIntent {
+	t.Helper()
+	now := pg.Now()
+	intent, _, err := pg.CreateIntent(testMerchant, big.NewInt(amount), "GORR", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid, err := pg.MarkPaidFromTx(nil, intent.ID, testPayer, testMerchant, "GORR",
+		big.NewInt(amount), big.NewInt(fee), common.Hash{tx}, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paid
+}
+
+// Deelrefunds tellen op; wat niet past of van de verkeerde partij komt
+// verandert niets.
+func TestPartialRefunds(t *testing.T) {
+	pg := NewPaymentGateway()
+	intent := paidIntent(t, pg, 1000, 25, 1) // netto 975, fee 25
+
+	steps := []struct {
+		name     string
+		merchant common.Address
+		payer    common.Address
+		token    string
+		amount   int64
+		fee      int64
+		ok       bool
+		status   PaymentStatus
+		refunded int64 // lopend totaal van de merchant
+		feeBack  int64 // lopend totaal uit de treasury
+	}{
+		{"first part", testMerchant, testPayer, "GORR", 300, 0, true, StatusPartiallyRefunded, 300, 0},
+		{"fee only", testMerchant, testPayer, "GORR", 0, 10, true, StatusPartiallyRefunded, 300, 10},
+		{"not the merchant", testPayout, testPayer, "GORR", 1, 0, false, StatusPartiallyRefunded, 300, 10},
+		{"not the payer", testMerchant, testPayout, "GORR", 1, 0, false, StatusPartiallyRefunded, 300, 10},
+		{"other token", testMerchant, testPayer, "USDCc", 1, 0, false, StatusPartiallyRefunded, 300, 10},
+		{"above the net left", testMerchant, testPayer, "GORR", 676, 0, false, StatusPartiallyRefunded, 300, 10},
+		{"above the fee left", testMerchant, testPayer, "GORR", 0, 16, false, StatusPartiallyRefunded, 300, 10},
+		{"nothing", testMerchant, testPayer, "GORR", 0, 0, false, StatusPartiallyRefunded, 300, 10},
+		{"the rest", testMerchant, testPayer, "GORR", 675, 15, true, StatusRefunded, 975, 25},
+		{"after the full refund", testMerchant, testPayer, "GORR", 1, 0, false, StatusRefunded, 975, 25},
+	}
+	hashes := []string{}
+	for i, st := range steps {
+		hash := common.Hash{byte(i + 1)}
+		amount, fee := big.NewInt(st.amount), big.NewInt(st.fee)
+		checkErr := pg.CheckRefund(intent.ID, st.merchant, st.payer, st.token, amount, fee)
+		_, err := pg.RefundFromTx(nil, intent.ID, st.merchant, st.payer, st.token, amount, fee, hash)
+		if (err == nil) != st.ok || (checkErr == nil) != st.ok {
+			t.Fatalf("%s: RefundFromTx %v, CheckRefund %v, want ok=%v", st.name, err, checkErr, st.ok)
+		}
+		if st.ok {
+			hashes = append(hashes, hash.Hex())
+		}
+
+		got, err := pg.GetIntent(intent.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != st.status || bigOrZero(got.RefundedAmount).Int64() != st.refunded || bigOrZero(got.RefundedFee).Int64() != st.feeBack {
+			t.Fatalf("%s: status %s refunded %v fee %v, want %s %d %d", st.name, got.Status, got.RefundedAmount, got.RefundedFee, st.status, st.refunded, st.feeBack)
+		}
+		if !slices.Equal(got.RefundTxHashes, hashes) {
+			t.Fatalf("%s: refund txs %v, want %v", st.name, got.RefundTxHashes, hashes)
+		}
+		if got.Refunded != (st.status == StatusRefunded) {
+			t.Fatalf("%s: Refunded = %v", st.name, got.Refunded)
+		}
+		net, openFee := Refundable(got)
+		if net.Int64() != 975-st.refunded || openFee.Int64() != 25-st.feeBack {
+			t.Fatalf("%s: refundable %s/%s", st.name, net, openFee)
+		}
+	}
+}
+
+// Een deels betaald (en daarna verlopen) intent kan terug tot wat er binnen is.
+func TestRefundPartiallyPaid(t *testing.T) {
+	pg := NewPaymentGateway()
+	intent, _, err := pg.CreateIntent(testMerchant, big.NewInt(1000), "GORR", pg.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.MarkPaidFromTx(nil, intent.ID, testPayer, testMerchant, "GORR", big.NewInt(400), big.NewInt(10), common.Hash{1}, 1, pg.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.CheckRefund(intent.ID, testMerchant, testPayer, "GORR", big.NewInt(391), new(big.Int)); err == nil {
+		t.Fatal("refund above the partial payment accepted")
+	}
+	got, err := pg.RefundFromTx(nil, intent.ID, testMerchant, testPayer, "GORR", big.NewInt(390), big.NewInt(10), common.Hash{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusRefunded || !got.Refunded {
+		t.Fatalf("status %s after refunding the whole part", got.Status)
+	}
+}
@@ -0,0 +1,523 @@
+package paymentgateway
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ---------------------------------------------
+// Settlements: uitbetaling per merchant
+// ---------------------------------------------
+//
+// Een settlement run bundelt de betaalde, nog niet gesettelde intents van
+// een merchant in één token over een periode (PaidAt in [From, To)). Per
+// intent telt wat de merchant overhoudt: bruto min fee min refunds. Het
+// totaal gaat in één tx van de merchant naar het payout adres, met een
+// GORR_SETTLE marker (core/settlement.go); komt die in een block, dan zet
+// SettleFromTx de run en al zijn intents op settled. Zolang een run
+// pending is zitten zijn intents vast: geen refund, geen andere run.
+//
+// Staat het geld al op het payout adres (payout in de merchant registry)
+// of blijft er netto niets over, dan is er niets te verplaatsen en wordt
+// de run direct settled. Dat is bewust: bij een registry payout heeft de
+// payment tx zelf het netto bedrag al naar Payout gestuurd (de payment
+// tx hashes staan per regel in het rapport). PayoutMode staat op elke CSV
+// regel, PayoutNote in het JSON rapport.
+
+type SettlementStatus string
+
+const (
+	SettlementPending   SettlementStatus = "pending"
+	SettlementSettled   SettlementStatus = "settled"
+	SettlementCancelled SettlementStatus = "cancelled"
+)
+
+var ErrSettlementNotFound = errors.New("settlement not found")
+
+// SettlementPayoutMode: hoe het netto bedrag bij Payout komt.
+type SettlementPayoutMode string
+
+const (
+	// GORR_SETTLE tx van de merchant naar Payout (TxHash)
+	PayoutTransfer SettlementPayoutMode = "transfer"
+	// Al op Payout ontvangen via de payment txs (registry payout adres)
+	PayoutDirect SettlementPayoutMode = "direct"
+	// Netto niets uit te betalen
+	PayoutNone SettlementPayoutMode = "none"
+)
+
+var payoutNotes = map[SettlementPayoutMode]string{
+	PayoutDirect: "net amount was paid straight to the registered payout address by the payment transactions (merchant registry); no separate settlement transfer",
+	PayoutNone:   "nothing to pay out (net amount is zero); no settlement transfer",
+}
+
+// SettlementLine: één intent in een run, zoals het was bij het aanmaken.
+type SettlementLine struct {
+	IntentID uint64         `json:"intentId"`
+	OrderRef string         `json:"orderRef,omitempty"`
+	Payer    common.Address `json:"payer"`
+	PaidAt   uint64         `json:"paidAt"`
+	TxHash   string         `json:"txHash,omitempty"` // laatste payment tx
+	Status   PaymentStatus  `json:"status"`           // status vóór de settlement
+	Gross    *big.Int       `json:"gross"`
+	Fee      *big.Int       `json:"fee"`
+	Refunded *big.Int       `json:"refunded"`
+	Net      *big.Int       `json:"net"`
+}
+
+// Settlement is één run. Bedragen in wei van Token.
+type Settlement struct {
+	ID       uint64           `json:"id"`
+	Merchant common.Address   `json:"merchant"`
+	Token    string           `json:"token"`
+	Payout   common.Address   `json:"payout"`
+	From     uint64           `json:"since"` // PaidAt periode [From, To)
+	To       uint64           `json:"until"`
+	Status   SettlementStatus `json:"status"`
+
+	Lines   []*SettlementLine `json:"lines"`
+	Gross   *big.Int          `json:"gross"`
+	Fees    *big.Int          `json:"fees"`
+	Refunds *big.Int          `json:"refunds"`
+	Net     *big.Int          `json:"net"`
+
+	CreatedAt   uint64 `json:"createdAt"`
+	SettledAt   uint64 `json:"settledAt,omitempty"`
+	TxHash      string `json:"txHash,omitempty"` // alleen bij PayoutTransfer
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+
+	PayoutMode SettlementPayoutMode `json:"payoutMode"`
+	PayoutNote string               `json:"payoutNote,omitempty"`
+}
+
+// SettlementRequest: wat CreateSettlement bundelt.
+type SettlementRequest struct {
+	Merchant common.Address
+	Token    string
+	From     uint64
+	To       uint64 // 0 = geen grens (alles t/m het laatste block)
+	Payout   common.Address
+
+	// Direct: het netto bedrag staat al op Payout → meteen settled
+	Direct bool
+}
+
+const settlementKeyPrefix = "settlement:"
+
+func settlementKey(id uint64) string { return fmt.Sprintf("%s%020d", settlementKeyPrefix, id) }
+
+// loadSettlementsLocked leest de runs uit de store en legt de intents van
+// pending runs weer vast. Onder pg.mu, vanuit Load.
+func (pg *PaymentGateway) loadSettlementsLocked() error {
+	settlements := make(map[uint64]*Settlement)
+	locked := make(map[uint64]uint64)
+	var counter uint64
+	err := pg.store.ForEachPrefix(settlementKeyPrefix, func(key string, value []byte) error {
+		var s Settlement
+		if err := json.Unmarshal(value, &s); err != nil {
+			return fmt.Errorf("settlement %s: %w", key, err)
+		}
+		settlements[s.ID] = &s
+		if s.ID > counter {
+			counter = s.ID
+		}
+		if s.Status == SettlementPending {
+			for _, l := range s.Lines {
+				locked[l.IntentID] = s.ID
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	pg.settlements = settlements
+	pg.settlementCounter = counter
+	pg.locked = locked
+	return nil
+}
+
+// CreateSettlement maakt een run van alle intents van req.Merchant in
+// req.Token die paid, partially_refunded of refunded zijn, binnen de
+// periode betaald en nog niet in een pending run zitten.
+func (pg *PaymentGateway) CreateSettlement(req SettlementRequest) (*Settlement, error) {
+	if req.Token != "GORR" && req.Token != "USDCc" {
+		return nil, fmt.Errorf("unsupported token %q (GORR or USDCc)", req.Token)
+	}
+	if req.Merchant == (common.Address{}) || req.Payout == (common.Address{}) {
+		return nil, errors.New("merchant and payout are required")
+	}
+
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	now := pg.clock.Now()
+	to := req.To
+	if to == 0 {
+		// Block times kunnen voor de klok uit lopen (instamine); de
+		// periode wordt hieronder t/m de laatste betaling gezet
+		to = math.MaxUint64
+	}
+	if to <= req.From {
+		return nil, errors.New("settlement period is empty (until must be after since)")
+	}
+
+	s := &Settlement{
+		ID:         pg.settlementCounter + 1,
+		Merchant:   req.Merchant,
+		Token:      req.Token,
+		Payout:     req.Payout,
+		From:       req.From,
+		To:         to,
+		Status:     SettlementPending,
+		Lines:      []*SettlementLine{},
+		Gross:      new(big.Int),
+		Fees:       new(big.Int),
+		Refunds:    new(big.Int),
+		Net:        new(big.Int),
+		CreatedAt:  now,
+		PayoutMode: PayoutTransfer,
+	}
+	for _, id := range pg.byMerchant[req.Merchant] {
+		intent := pg.intents[id]
+		if !settleable(intent) || intent.Token != req.Token || intent.PaidAt < req.From || intent.PaidAt >= to {
+			continue
+		}
+		if _, ok := pg.locked[id]; ok {
+			continue
+		}
+		line := settlementLine(intent)
+		s.Lines = append(s.Lines, line)
+		s.Gross.Add(s.Gross, line.Gross)
+		s.Fees.Add(s.Fees, line.Fee)
+		s.Refunds.Add(s.Refunds, line.Refunded)
+		s.Net.Add(s.Net, line.Net)
+	}
+	if len(s.Lines) == 0 {
+		return nil, fmt.Errorf("no unsettled %s payments for %s in this period", req.Token, req.Merchant.Hex())
+	}
+	if req.To == 0 {
+		s.To = now
+		for _, l := range s.Lines {
+			s.To = max(s.To, l.PaidAt)
+		}
+		s.To++
+	}
+
+	if req.Direct || s.Net.Sign() == 0 {
+		s.PayoutMode = PayoutDirect
+		if s.Net.Sign() == 0 {
+			s.PayoutMode = PayoutNone
+		}
+		s.PayoutNote = payoutNotes[s.PayoutMode]
+		settled, err := pg.settleLocked(nil, s, common.Hash{}, 0, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, intent := range settled {
+			pg.emitLocked(&events.IntentSettled{IntentInfo: IntentInfo(intent)})
+		}
+		return cloneSettlement(s), nil
+	}
+
+	if err := pg.saveSettlementLocked(nil, s); err != nil {
+		return nil, err
+	}
+	pg.settlementCounter = s.ID
+	pg.settlements[s.ID] = s
+	for _, l := range s.Lines {
+		pg.locked[l.IntentID] = s.ID
+	}
+	return cloneSettlement(s), nil
+}
+
+// GetSettlement geeft run id.
+func (pg *PaymentGateway) GetSettlement(id uint64) (*Settlement, error) {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+
+	s, ok := pg.settlements[id]
+	if !ok {
+		return nil, ErrSettlementNotFound
+	}
+	return cloneSettlement(s), nil
+}
+
+// ListSettlements geeft de runs van merchant (nul adres = alle), op id.
+func (pg *PaymentGateway) ListSettlements(merchant common.Address) []*Settlement {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+
+	ids := make([]uint64, 0, len(pg.settlements))
+	for id, s := range pg.settlements {
+		if merchant == (common.Address{}) || s.Merchant == merchant {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	list := make([]*Settlement, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, cloneSettlement(pg.settlements[id]))
+	}
+	return list
+}
+
+// CancelSettlement trekt een pending run in; de intents komen weer vrij.
+// Een al getekende settlement tx wordt daarna niet meer opgenomen.
+func (pg *PaymentGateway) CancelSettlement(id uint64) (*Settlement, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	s, ok := pg.settlements[id]
+	if !ok {
+		return nil, ErrSettlementNotFound
+	}
+	if s.Status != SettlementPending {
+		return nil, fmt.Errorf("only pending settlements can be cancelled (status %s)", s.Status)
+	}
+	updated := cloneSettlement(s)
+	updated.Status = SettlementCancelled
+	if err := pg.saveSettlementLocked(nil, updated); err != nil {
+		return nil, err
+	}
+	pg.settlements[id] = updated
+	for _, l := range updated.Lines {
+		delete(pg.locked, l.IntentID)
+	}
+	return cloneSettlement(updated), nil
+}
+
+// PendingSettlement: de pending run waar intent id in zit, of 0.
+func (pg *PaymentGateway) PendingSettlement(intentID uint64) uint64 {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.locked[intentID]
+}
+
+// CheckSettlementTx: zou een settlement tx (from → to, amount in token)
+// run id afronden? Voor de producer vóór opname in een eigen block.
+func (pg *PaymentGateway) CheckSettlementTx(id uint64, from, to common.Address, token string, amount *big.Int) error {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+
+	s, ok := pg.settlements[id]
+	if !ok {
+		return ErrSettlementNotFound
+	}
+	return checkSettlementTx(s, from, to, token, amount)
+}
+
+// SettleFromTx rondt run id af na zijn settlement tx: run en intents
+// settled, naar w (de overlay van het block). Events emit de producer na
+// de commit, met de intents die hier terugkomen.
+func (pg *PaymentGateway) SettleFromTx(
+	w Store,
+	id uint64,
+	from common.Address,
+	to common.Address,
+	token string,
+	amount *big.Int,
+	txHash common.Hash,
+	blockNum uint64,
+	blockTime uint64,
+) (*Settlement, []*PaymentIntent, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	s, ok := pg.settlements[id]
+	if !ok {
+		return nil, nil, ErrSettlementNotFound
+	}
+	if err := checkSettlementTx(s, from, to, token, amount); err != nil {
+		return nil, nil, err
+	}
+	updated := cloneSettlement(s)
+	settled, err := pg.settleLocked(w, updated, txHash, blockNum, blockTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cloneSettlement(updated), settled, nil
+}
+
+// settleLocked zet s en zijn intents op settled en slaat alles op in w.
+// Intents die intussen niet meer settleable zijn (bijv. al handmatig
+// settled) blijven zoals ze zijn.
+func (pg *PaymentGateway) settleLocked(w Store, s *Settlement, txHash common.Hash, blockNum, blockTime uint64) ([]*PaymentIntent, error) {
+	s.Status = SettlementSettled
+	s.SettledAt = blockTime
+	s.BlockNumber = blockNum
+	if txHash != (common.Hash{}) {
+		s.TxHash = txHash.Hex()
+	}
+
+	var settled []*PaymentIntent
+	for _, l := range s.Lines {
+		intent, ok := pg.intents[l.IntentID]
+		if !ok || !settleable(intent) {
+			continue
+		}
+		updated := cloneIntent(intent)
+		updated.Status = StatusSettled
+		updated.SettlementID = s.ID
+		if err := pg.saveLocked(w, updated); err != nil {
+			return nil, err
+		}
+		settled = append(settled, updated)
+	}
+	if err := pg.saveSettlementLocked(w, s); err != nil {
+		return nil, err
+	}
+
+	// Pas na alle writes het geheugen bijwerken
+	for _, intent := range settled {
+		pg.intents[intent.ID] = intent
+	}
+	for _, l := range s.Lines {
+		delete(pg.locked, l.IntentID)
+	}
+	pg.settlements[s.ID] = s
+	if s.ID > pg.settlementCounter {
+		pg.settlementCounter = s.ID
+	}
+
+	out := make([]*PaymentIntent, len(settled))
+	for i, intent := range settled {
+		out[i] = cloneIntent(intent)
+	}
+	return out, nil
+}
+
+func (pg *PaymentGateway) saveSettlementLocked(w Store, s *Settlement) error {
+	if w == nil {
+		w = pg.store
+	}
+	if w == nil {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := w.Put(settlementKey(s.ID), data); err != nil {
+		return fmt.Errorf("save settlement %d: %w", s.ID, err)
+	}
+	return nil
+}
+
+func checkSettlementTx(s *Settlement, from, to common.Address, token string, amount *big.Int) error {
+	if s.Status != SettlementPending {
+		return fmt.Errorf("settlement %d is %s", s.ID, s.Status)
+	}
+	if from != s.Merchant {
+		return errors.New("settlement tx must come from the merchant")
+	}
+	if to != s.Payout {
+		return fmt.Errorf("settlement tx must go to payout %s", s.Payout.Hex())
+	}
+	if token != s.Token {
+		return fmt.Errorf("settlement is in %s, tx is in %s", s.Token, token)
+	}
+	if amount == nil || amount.Cmp(s.Net) != 0 {
+		return fmt.Errorf("settlement tx must move exactly %s", s.Net)
+	}
+	return nil
+}
+
+// settleable: betaald (eventueel met refunds) en nog niet settled, zoals
+// bij SettleIntent.
+func settleable(intent *PaymentIntent) bool {
+	switch intent.Status {
+	case StatusPaid, StatusPartiallyRefunded, StatusRefunded:
+		return true
+	}
+	return false
+}
+
+func settlementLine(intent *PaymentIntent) *SettlementLine {
+	gross := bigOrZero(intent.PaidAmount)
+	if intent.PaidAmount == nil && intent.Paid {
+		gross = intent.Amount
+	}
+	net, _ := Refundable(intent)
+	return &SettlementLine{
+		IntentID: intent.ID,
+		OrderRef: intent.OrderRef,
+		Payer:    intent.Payer,
+		PaidAt:   intent.PaidAt,
+		TxHash:   intent.TxHash,
+		Status:   intent.Status,
+		Gross:    new(big.Int).Set(gross),
+		Fee:      bigOrZero(intent.Fee),
+		Refunded: bigOrZero(intent.RefundedAmount),
+		Net:      net,
+	}
+}
+
+func cloneSettlement(s *Settlement) *Settlement {
+	clone := *s
+	for _, x := range []**big.Int{&clone.Gross, &clone.Fees, &clone.Refunds, &clone.Net} {
+		*x = new(big.Int).Set(*x)
+	}
+	clone.Lines = make([]*SettlementLine, len(s.Lines))
+	for i, l := range s.Lines {
+		line := *l
+		for _, x := range []**big.Int{&line.Gross, &line.Fee, &line.Refunded, &line.Net} {
+			*x = new(big.Int).Set(*x)
+		}
+		clone.Lines[i] = &line
+	}
+	return &clone
+}
+
+// ---------------------------------------------
+// Rapport
+// ---------------------------------------------
+
+var settlementCSVHeader = []string{
+	"settlementId", "intentId", "orderRef", "payer", "token", "paidAt",
+	"paymentTxHash", "status", "gross", "fee", "refunded", "net", "payoutMode",
+}
+
+// SettlementCSV: alleen de header plus één regel per intent, zodat elke
+// regel hetzelfde schema heeft; totalen en PayoutNote staan in het JSON
+// rapport. Bedragen in wei, tijden in unix seconden.
+func SettlementCSV(s *Settlement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(settlementCSVHeader); err != nil {
+		return nil, err
+	}
+	sid := strconv.FormatUint(s.ID, 10)
+	for _, l := range s.Lines {
+		err := w.Write([]string{
+			sid,
+			strconv.FormatUint(l.IntentID, 10),
+			l.OrderRef,
+			l.Payer.Hex(),
+			s.Token,
+			strconv.FormatUint(l.PaidAt, 10),
+			l.TxHash,
+			string(l.Status),
+			l.Gross.String(),
+			l.Fee.String(),
+			l.Refunded.String(),
+			l.Net.String(),
+			string(s.PayoutMode),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,223 @@
+package paymentgateway
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func readCSV(t *testing.T, s *Settlement) [][]string {
+	t.Helper()
+	report, err := SettlementCSV(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(report)).ReadAll()
+	if err != nil {
+		t.Fatalf("report is not valid CSV: %v\n%s", err, report)
+	}
+	return rows
+}
+
+func TestSettlementPayoutModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		direct bool
+		fee    int64
+		mode   SettlementPayoutMode
+		status SettlementStatus
+	}{
+		{"transfer", false, 10, PayoutTransfer, SettlementPending},
+		{"direct to registry payout", true, 10, PayoutDirect, SettlementSettled},
+		{"nothing to pay", false, 1000, PayoutNone, SettlementSettled},
+	}
+	for _, tt := range tests {
+		pg := NewPaymentGateway()
+		paidIntent(t, pg, 1000, tt.fee, 1)
+
+		s, err := pg.CreateSettlement(SettlementRequest{
+			Merchant: testMerchant, Token: "GORR", Payout: testPayout, Direct: tt.direct,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if s.PayoutMode != tt.mode || s.Status != tt.status {
+			t.Fatalf("%s: mode %s status %s, want %s %s", tt.name, s.PayoutMode, s.Status, tt.mode, tt.status)
+		}
+		if want := payoutNotes[tt.mode]; s.PayoutNote != want {
+			t.Fatalf("%s: note %q, want %q", tt.name, s.PayoutNote, want)
+		}
+		if s.TxHash != "" {
+			t.Fatalf("%s: tx hash %s before any settlement tx", tt.name, s.TxHash)
+		}
+
+		// header + 1 intent, de note staat alleen in het JSON rapport
+		rows := readCSV(t, s)
+		if len(rows) != 2 {
+			t.Fatalf("%s: %d CSV rows, want 2", tt.name, len(rows))
+		}
+		for _, row := range rows[1:] {
+			if row[len(row)-1] != string(tt.mode) {
+				t.Fatalf("%s: row %v without payout mode %s", tt.name, row, tt.mode)
+			}
+		}
+	}
+}
+
+// Een run bundelt de betaalde intents en houdt ze vast tot zijn tx of een
+// cancel.
+func TestCreateSettlement(t *testing.T) {
+	pg := NewPaymentGateway()
+	first := paidIntent(t, pg, 1000, 25, 1)
+	refunded := paidIntent(t, pg, 500, 10, 2)
+	if _, err := pg.RefundFromTx(nil, refunded.ID, testMerchant, testPayer, "GORR", big.NewInt(90), big.NewInt(0), common.Hash{3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pg.CreateIntent(testMerchant, big.NewInt(700), "GORR", pg.Now()); err != nil { // pending, telt niet mee
+		t.Fatal(err)
+	}
+	req := SettlementRequest{Merchant: testMerchant, Token: "GORR", Payout: testPayout}
+
+	for _, bad := range []struct {
+		name string
+		req  SettlementRequest
+		err  string
+	}{
+		{"unknown token", SettlementRequest{Merchant: testMerchant, Token: "ETH", Payout: testPayout}, "unsupported token"},
+		{"no payout", SettlementRequest{Merchant: testMerchant, Token: "GORR"}, "required"},
+		{"empty period", SettlementRequest{Merchant: testMerchant, Token: "GORR", Payout: testPayout, From: 10, To: 10}, "empty"},
+		{"nothing in USDCc", SettlementRequest{Merchant: testMerchant, Token: "USDCc", Payout: testPayout}, "no unsettled"},
+	} {
+		if _, err := pg.CreateSettlement(bad.req); err == nil || !strings.Contains(err.Error(), bad.err) {
+			t.Fatalf("%s: error %v, want %q", bad.name, err, bad.err)
+		}
+	}
+
+	s, err := pg.CreateSettlement(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 975 + (490 - 90)
+	if s.Status != SettlementPending || len(s.Lines) != 2 || s.Gross.Int64() != 1500 || s.Fees.Int64() != 35 || s.Refunds.Int64() != 90 || s.Net.Int64() != 1375 {
+		t.Fatalf("settlement %+v", s)
+	}
+	if s.To <= first.PaidAt {
+		t.Fatalf("period until %d does not cover paidAt %d", s.To, first.PaidAt)
+	}
+
+	// Vastgehouden: geen tweede run, geen refund of handmatige settle
+	if _, err := pg.CreateSettlement(req); err == nil {
+		t.Fatal("second run over the same intents")
+	}
+	if err := pg.CheckRefund(first.ID, testMerchant, testPayer, "GORR", big.NewInt(1), big.NewInt(0)); err == nil || !strings.Contains(err.Error(), "pending settlement") {
+		t.Fatalf("refund of a locked intent: %v", err)
+	}
+	if _, err := pg.SettleIntent(first.ID); err == nil {
+		t.Fatal("manual settle of a locked intent")
+	}
+
+	// Cancel geeft ze weer vrij
+	if _, err := pg.CancelSettlement(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.CancelSettlement(s.ID); err == nil {
+		t.Fatal("cancelled twice")
+	}
+	if pg.PendingSettlement(first.ID) != 0 {
+		t.Fatal("intent still locked after cancel")
+	}
+	again, err := pg.CreateSettlement(req)
+	if err != nil || again.ID != s.ID+1 {
+		t.Fatalf("run after cancel: %+v %v", again, err)
+	}
+	if list := pg.ListSettlements(testMerchant); len(list) != 2 || len(pg.ListSettlements(testPayer)) != 0 {
+		t.Fatalf("list %d", len(list))
+	}
+}
+
+func TestSettleFromTx(t *testing.T) {
+	pg := NewPaymentGateway()
+	intent := paidIntent(t, pg, 1000, 25, 1)
+	s, err := pg.CreateSettlement(SettlementRequest{Merchant: testMerchant, Token: "GORR", Payout: testPayout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		from   common.Address
+		to     common.Address
+		token  string
+		amount int64
+		err    string
+	}{
+		{"not the merchant", testPayer, testPayout, "GORR", 975, "from the merchant"},
+		{"other payout", testMerchant, testPayer, "GORR", 975, "payout"},
+		{"other token", testMerchant, testPayout, "USDCc", 975, "tx is in USDCc"},
+		{"wrong amount", testMerchant, testPayout, "GORR", 974, "exactly 975"},
+	}
+	for _, tt := range tests {
+		if err := pg.CheckSettlementTx(s.ID, tt.from, tt.to, tt.token, big.NewInt(tt.amount)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if err := pg.CheckSettlementTx(99, testMerchant, testPayout, "GORR", big.NewInt(975)); !errors.Is(err, ErrSettlementNotFound) {
+		t.Fatalf("unknown run: %v", err)
+	}
+
+	done, settled, err := pg.SettleFromTx(nil, s.ID, testMerchant, testPayout, "GORR", big.NewInt(975), common.Hash{9}, 7, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != SettlementSettled || done.TxHash != (common.Hash{9}).Hex() || done.BlockNumber != 7 || done.SettledAt != 1234 {
+		t.Fatalf("settled run %+v", done)
+	}
+	if len(settled) != 1 || settled[0].Status != StatusSettled || settled[0].SettlementID != s.ID {
+		t.Fatalf("settled intents %+v", settled)
+	}
+	if got, _ := pg.GetIntent(intent.ID); got.Status != StatusSettled || pg.PendingSettlement(intent.ID) != 0 {
+		t.Fatalf("intent after the settlement tx %+v", got)
+	}
+	if _, _, err := pg.SettleFromTx(nil, s.ID, testMerchant, testPayout, "GORR", big.NewInt(975), common.Hash{10}, 8, 1240); err == nil {
+		t.Fatal("settlement tx applied twice")
+	}
+}
+
+func TestSettlementDirectAndReport(t *testing.T) {
+	pg := NewPaymentGateway()
+	paidIntent(t, pg, 1000, 25, 1)
+	paidIntent(t, pg, 400, 10, 2)
+
+	s, err := pg.CreateSettlement(SettlementRequest{Merchant: testMerchant, Token: "GORR", Payout: testPayout, Direct: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != SettlementSettled || s.TxHash != "" {
+		t.Fatalf("direct settlement %+v", s)
+	}
+	for _, intent := range pg.ListMerchantPayments(testMerchant) {
+		if intent.Status != StatusSettled {
+			t.Fatalf("intent %d is %s after a direct settlement", intent.ID, intent.Status)
+		}
+	}
+
+	// header + 2 intents, geen totaal- of note regel tussen de data
+	rows := readCSV(t, s)
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3", len(rows))
+	}
+	for _, row := range rows[1:] {
+		if _, err := strconv.ParseUint(row[1], 10, 64); err != nil {
+			t.Fatalf("row %v has no intent id", row)
+		}
+	}
+	if s.Gross.String() != "1400" || s.Fees.String() != "35" || s.Net.String() != "1365" {
+		t.Fatalf("totals %s %s %s", s.Gross, s.Fees, s.Net)
+	}
+}
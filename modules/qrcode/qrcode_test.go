@@ -0,0 +1,295 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Bekende EC codewords voor versie 1-M (één block, 10 EC codewords).
+func TestReedSolomonVectors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ecc  []byte
+	}{
+		// "HELLO WORLD" in alphanumeric mode
+		{"HELLO WORLD", []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}},
+		// "01234567" in numeric mode (ISO/IEC 18004 bijlage)
+		{"01234567", []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			[]byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.ecc))); !bytes.Equal(got, tt.ecc) {
+			t.Errorf("%s: ecc % x, want % x", tt.name, got, tt.ecc)
+		}
+		c := newCode(1)
+		if got := c.addEccAndInterleave(tt.data); !bytes.Equal(got, append(append([]byte{}, tt.data...), tt.ecc...)) {
+			t.Errorf("%s: codewords % x", tt.name, got)
+		}
+	}
+}
+
+// Format bits voor level M per mask, uit de tabel van de standaard.
+var formatM = [8]int{
+	0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+	0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+}
+
+// readFormat: beide kopieën van de format bits.
+func readFormat(c *Code) (int, int) {
+	a, b := 0, 0
+	set := func(v *int, i int, dark bool) {
+		if dark {
+			*v |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(&a, i, c.modules[i][8])
+	}
+	set(&a, 6, c.modules[7][8])
+	set(&a, 7, c.modules[8][8])
+	set(&a, 8, c.modules[8][7])
+	for i := 9; i < 15; i++ {
+		set(&a, i, c.modules[8][14-i])
+	}
+	for i := 0; i < 8; i++ {
+		set(&b, i, c.modules[8][c.Size-1-i])
+	}
+	for i := 8; i < 15; i++ {
+		set(&b, i, c.modules[c.Size-15+i][8])
+	}
+	return a, b
+}
+
+func TestFormatBits(t *testing.T) {
+	for mask, want := range formatM {
+		c := newCode(1)
+		c.drawFormatBits(mask)
+		if a, b := readFormat(c); a != want || b != want {
+			t.Errorf("mask %d: format %015b / %015b, want %015b", mask, a, b, want)
+		}
+		if !c.modules[c.Size-8][8] {
+			t.Errorf("mask %d: dark module missing", mask)
+		}
+	}
+}
+
+// Version info (vanaf 7), uit de tabel van de standaard.
+func TestVersionInfo(t *testing.T) {
+	for version, want := range map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 21: 0x15683, 40: 0x28C69} {
+		c := newCode(version)
+		c.drawVersion()
+		a, b := 0, 0
+		for i := 0; i < 18; i++ {
+			x, y := c.Size-11+i%3, i/3
+			if c.modules[y][x] {
+				a |= 1 << i
+			}
+			if c.modules[x][y] {
+				b |= 1 << i
+			}
+		}
+		if a != want || b != want {
+			t.Errorf("version %d: %018b / %018b, want %018b", version, a, b, want)
+		}
+	}
+}
+
+// Byte mode capaciteit bij level M: de grootste lengte per versie.
+func TestVersionSelection(t *testing.T) {
+	capacity := map[int]int{1: 14, 2: 26, 3: 42, 4: 62, 5: 84, 6: 106, 7: 122, 8: 152, 9: 180, 10: 213, 20: 666, 40: 2331}
+	for version, n := range capacity {
+		c, err := Encode(bytes.Repeat([]byte{'a'}, n))
+		if err != nil || c.Version != version || c.Size != 17+4*version {
+			t.Errorf("%d bytes: %v, want version %d", n, err, version)
+			continue
+		}
+		if version == 40 {
+			continue
+		}
+		if c, err := Encode(bytes.Repeat([]byte{'a'}, n+1)); err != nil || c.Version <= version {
+			t.Errorf("%d bytes: version %d, want above %d", n+1, c.Version, version)
+		}
+	}
+	if _, err := Encode(make([]byte, 2332)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("2332 bytes: %v, want %v", err, ErrTooLong)
+	}
+}
+
+// decode leest een code terug zoals een scanner (zonder foutcorrectie):
+// format → mask, zigzag lezen, de-interleaven, EC controleren, byte mode.
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+	version := (c.Size - 17) / 4
+	a, b := readFormat(c)
+	if a != b {
+		t.Fatalf("format copies differ: %015b / %015b", a, b)
+	}
+	mask := -1
+	for m, f := range formatM {
+		if f == a {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format %015b is not level M", a)
+	}
+
+	// Function patterns van deze versie; de rest zijn data modules
+	f := newCode(version)
+	f.drawFunctionPatterns()
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if f.isFunction[y][x] {
+				if y != 8 && x != 8 && f.modules[y][x] != c.modules[y][x] {
+					t.Fatalf("function module (%d, %d) differs", x, y)
+				}
+				continue
+			}
+			f.modules[y][x] = c.modules[y][x]
+		}
+	}
+	f.applyMask(mask)
+
+	raw := make([]byte, numRawDataModules(version)/8)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			upward := ((c.Size-1-right)/2)%2 == 0
+			if right < 6 {
+				upward = ((c.Size-2-right)/2)%2 == 0
+			}
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for _, x := range []int{right, right - 1} {
+				if f.isFunction[y][x] || i >= len(raw)*8 {
+					continue
+				}
+				if f.modules[y][x] {
+					raw[i>>3] |= 1 << (7 - uint(i&7))
+				}
+				i++
+			}
+		}
+	}
+
+	// De-interleaven: eerst de data codewords per kolom, dan de EC
+	numBlocks, eccLen := numEccBlocks[version], eccCodewordsPerBlock[version]
+	shortData := len(raw)/numBlocks - eccLen
+	numShort := numBlocks - len(raw)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for col := 0; col <= shortData; col++ {
+		for j := range blocks {
+			if col == shortData && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	eccs := make([][]byte, numBlocks)
+	for col := 0; col < eccLen; col++ {
+		for j := range eccs {
+			eccs[j] = append(eccs[j], raw[k])
+			k++
+		}
+	}
+	var data []byte
+	for j, blk := range blocks {
+		if !bytes.Equal(rsRemainder(blk, rsDivisor(eccLen)), eccs[j]) {
+			t.Fatalf("block %d: EC codewords do not match", j)
+		}
+		data = append(data, blk...)
+	}
+
+	read := func(pos, n int) int {
+		v := 0
+		for i := pos; i < pos+n; i++ {
+			v = v<<1 | int(data[i>>3]>>(7-uint(i&7))&1)
+		}
+		return v
+	}
+	if mode := read(0, 4); mode != 0x4 {
+		t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	n := read(4, charCountBits(version))
+	out := make([]byte, n)
+	for j := range out {
+		out[j] = byte(read(4+charCountBits(version)+8*j, 8))
+	}
+	return out
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	binary := make([]byte, 300)
+	for i := range binary {
+		binary[i] = byte(i * 7)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one byte", []byte{0}},
+		{"payment link", []byte("ethereum:0x000000000000000000000000000000000000b0b0@9999?value=1e18&data=GORR_PAY:7")},
+		{"usdcc link", []byte("ethereum:0x000000000000000000000000000000000000Cc01@9999/transfer?address=0x000000000000000000000000000000000000b0b0&uint256=2500000")},
+		{"binary", binary},
+		{"version 7+", []byte(strings.Repeat("GORR_PAY:123456789;", 10))},
+		{"large", bytes.Repeat([]byte("0123456789abcdef"), 100)},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := decode(t, c); !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: decoded %q", tt.name, got)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	c, err := Encode([]byte("GORR_PAY:7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := (c.Size + 2*quietZone) * 3
+	if b := img.Bounds(); b.Dx() != side || b.Dy() != side {
+		t.Fatalf("image %v, want %dx%d", b, side, side)
+	}
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			px, py := (x+quietZone)*3, (y+quietZone)*3
+			if dark(px, py) != c.Dark(x, y) || dark(px+2, py+2) != c.Dark(x, y) {
+				t.Fatalf("module (%d, %d) drawn wrong", x, y)
+			}
+		}
+	}
+	for i := 0; i < side; i++ {
+		if dark(i, 0) || dark(0, i) || dark(i, side-1) || dark(side-1, i) {
+			t.Fatal("quiet zone is not light")
+		}
+	}
+}
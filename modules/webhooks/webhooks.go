@@ -0,0 +1,945 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ---------------------------------------------
+// Merchant webhooks
+// ---------------------------------------------
+//
+// Merchants registreren een URL; elke intent status wijziging van die
+// merchant (intent.* events) wordt ernaar gePOST. De bron is het durable
+// event log: de manager onthoudt tot welke seq hij events heeft omgezet in
+// deliveries, zodat er na een restart of een volle bus queue niets
+// gemist wordt. Deliveries staan in een eigen LevelDB en worden met
+// exponentiële backoff opnieuw geprobeerd. De POSTs doet een vaste pool
+// workers, per webhook één tegelijk: een trage endpoint houdt zo alleen
+// zijn eigen queue op.
+//
+// Elke POST heeft de header
+//
+//	X-Gorr-Signature: t=<unix>,v1=<hex(HMAC-SHA256(secret, "<unix>.<body>"))>
+//
+// zodat de merchant kan controleren dat de body van deze node komt en
+// niet opnieuw afgespeeld is.
+
+const (
+	SignatureHeader = "X-Gorr-Signature"
+	EventHeader     = "X-Gorr-Event"
+	DeliveryHeader  = "X-Gorr-Delivery"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed" // MaxAttempts bereikt
+)
+
+// Limieten voor registraties
+const (
+	MaxWebhooksPerMerchant = 10
+	MaxURLLength           = 2048
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Webhook is een geregistreerde URL van een merchant. Secret wordt alleen
+// bij het aanmaken teruggegeven.
+type Webhook struct {
+	ID        string         `json:"id"`
+	Merchant  common.Address `json:"merchant"`
+	URL       string         `json:"url"`
+	Events    []string       `json:"events,omitempty"` // leeg = alle intent events
+	Secret    string         `json:"secret,omitempty"`
+	CreatedAt uint64         `json:"createdAt"`
+}
+
+// Delivery is één event voor één webhook, met de stand van de pogingen.
+type Delivery struct {
+	ID        uint64          `json:"id"`
+	WebhookID string          `json:"webhookId"`
+	Merchant  common.Address  `json:"merchant"`
+	URL       string          `json:"url"`
+	Event     string          `json:"event"`
+	EventSeq  uint64          `json:"eventSeq"`
+	Payload   json.RawMessage `json:"payload"`
+
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttempt    uint64         `json:"nextAttempt,omitempty"` // unix
+	LastStatusCode int            `json:"lastStatusCode,omitempty"`
+	LastError      string         `json:"lastError,omitempty"`
+	CreatedAt      uint64         `json:"createdAt"`
+	DeliveredAt    uint64         `json:"deliveredAt,omitempty"`
+}
+
+// Config: retry gedrag en de HTTP client (tests: httptest server).
+type Config struct {
+	MaxAttempts  int
+	BaseBackoff  time.Duration // wachttijd na de eerste mislukte poging
+	MaxBackoff   time.Duration
+	PollInterval time.Duration // hoe vaak de queue bekeken wordt
+	Timeout      time.Duration // per POST, ook met een eigen Client
+	Workers      int           // gelijktijdige POSTs; <= 0 = 1
+	Client       *http.Client  // nil = http.DefaultClient
+}
+
+// DefaultConfig: 10 pogingen, 5s → 10s → ... tot max 1 uur ertussen,
+// 4 workers.
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  10,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Second,
+		Timeout:      10 * time.Second,
+		Workers:      4,
+	}
+}
+
+// DB keys
+var (
+	webhookPrefix  = []byte("wh:")
+	deliveryPrefix = []byte("dl:")
+	pendingPrefix  = []byte("pq:") // index: alleen pending deliveries
+	cursorKey      = []byte("_cursor")
+	deliverySeqKey = []byte("_dlseq")
+)
+
+// ---------------------------------------------
+// Manager
+// ---------------------------------------------
+
+type Manager struct {
+	mu       sync.Mutex
+	db       *leveldb.DB
+	cfg      Config
+	client   *http.Client
+	logger   *log.Logger
+	bus      *events.EventBus
+	eventLog *events.EventLog
+
+	webhooks map[string]*Webhook
+	cursor   uint64 // laatste event seq die in deliveries is omgezet
+	nextID   uint64 // laatst toegekende delivery id
+
+	now  func() time.Time
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+
+	// Worker pool: jobs is unbuffered, een send lukt alleen als er een
+	// worker vrij is. busy: webhook id → delivery onderweg.
+	jobs    chan *Delivery
+	busy    map[string]bool
+	ctx     context.Context // afgebroken bij Close
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// Open opent (of maakt) de webhook db in path. Events komen uit eventLog;
+// een nieuwe db begint bij de huidige head, oude events worden niet
+// alsnog verstuurd.
+func Open(path string, bus *events.EventBus, eventLog *events.EventLog, cfg Config, logger *log.Logger) (*Manager, error) {
+	if bus == nil || eventLog == nil {
+		return nil, errors.New("webhooks need the event bus and event log")
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	m := &Manager{
+		db:       db,
+		cfg:      cfg,
+		client:   client,
+		logger:   logger,
+		bus:      bus,
+		eventLog: eventLog,
+		webhooks: make(map[string]*Webhook),
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		busy:     make(map[string]bool),
+	}
+	if err := m.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manager) load() error {
+	iter := m.db.NewIterator(util.BytesPrefix(webhookPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var wh Webhook
+		if err := json.Unmarshal(iter.Value(), &wh); err != nil {
+			return fmt.Errorf("webhook %s: %w", iter.Key(), err)
+		}
+		m.webhooks[wh.ID] = &wh
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	cursor, err := m.getUint(cursorKey)
+	switch {
+	case errors.Is(err, leveldb.ErrNotFound):
+		m.cursor = m.eventLog.Head()
+		if err := m.putUint(nil, cursorKey, m.cursor); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		m.cursor = cursor
+	}
+
+	m.nextID, err = m.getUint(deliverySeqKey)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		err = nil
+	}
+	return err
+}
+
+// Start start de delivery loop en de workers.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quit != nil {
+		return
+	}
+	m.quit = make(chan struct{})
+	m.done = make(chan struct{})
+	m.jobs = make(chan *Delivery)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	for i := 0; i < m.cfg.Workers; i++ {
+		m.workers.Add(1)
+		go m.worker()
+	}
+	go m.loop(m.bus.Subscribe(events.DefaultQueueSize, events.DropOldest, events.TopicPayment))
+}
+
+// Close stopt de loop, breekt lopende POSTs af en sluit de db. Een
+// afgebroken poging telt niet mee; die delivery blijft pending.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	quit, done := m.quit, m.done
+	m.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+		m.cancel()
+		close(m.jobs)
+		m.workers.Wait()
+	}
+	m.db.Close()
+}
+
+// loop: nieuwe payment events (of de ticker) → log inlezen → wat due is
+// versturen. De bus subscription is alleen een wekker; de events zelf
+// komen uit het log.
+func (m *Manager) loop(sub *events.Subscription) {
+	defer close(m.done)
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.ingest(); err != nil {
+			m.logError(fmt.Sprintf("ingest events: %v", err))
+		}
+		m.deliverDue()
+
+		select {
+		case <-sub.C():
+		case <-ticker.C:
+		case <-m.wake:
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// ---------------------------------------------
+// Registratie
+// ---------------------------------------------
+
+// Register voegt een webhook toe voor merchant. events filtert op event
+// type ("intent.paid" of kort "paid"); leeg = alle intent events. De
+// teruggegeven webhook bevat het secret voor de signature.
+func (m *Manager) Register(merchant common.Address, rawURL string, eventTypes []string) (*Webhook, error) {
+	if merchant == (common.Address{}) {
+		return nil, errors.New("merchant is required")
+	}
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	types, err := normalizeEvents(eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.listLocked(merchant)) >= MaxWebhooksPerMerchant {
+		return nil, fmt.Errorf("merchant already has %d webhooks", MaxWebhooksPerMerchant)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	wh := &Webhook{
+		ID:        "wh_" + id,
+		Merchant:  merchant,
+		URL:       rawURL,
+		Events:    types,
+		Secret:    "whsec_" + secret,
+		CreatedAt: uint64(m.now().Unix()),
+	}
+	data, err := json.Marshal(wh)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.db.Put(webhookKey(wh.ID), data, nil); err != nil {
+		return nil, err
+	}
+	m.webhooks[wh.ID] = wh
+
+	out := *wh
+	return &out, nil
+}
+
+// Get geeft een webhook zonder secret.
+func (m *Manager) Get(id string) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wh, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return redact(wh), nil
+}
+
+// List geeft de webhooks van merchant (zonder secret), op aanmaaktijd.
+func (m *Manager) List(merchant common.Address) []*Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := []*Webhook{}
+	for _, wh := range m.listLocked(merchant) {
+		list = append(list, redact(wh))
+	}
+	return list
+}
+
+// Delete verwijdert een webhook; openstaande deliveries ervoor vervallen.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	if err := m.db.Delete(webhookKey(id), nil); err != nil {
+		return err
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *Manager) listLocked(merchant common.Address) []*Webhook {
+	list := []*Webhook{}
+	for _, wh := range m.webhooks {
+		if wh.Merchant == merchant {
+			list = append(list, wh)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].CreatedAt != list[b].CreatedAt {
+			return list[a].CreatedAt < list[b].CreatedAt
+		}
+		return list[a].ID < list[b].ID
+	})
+	return list
+}
+
+// ---------------------------------------------
+// Delivery log
+// ---------------------------------------------
+
+// DeliveryFilter voor Deliveries; lege velden filteren niet.
+type DeliveryFilter struct {
+	Merchant  common.Address
+	WebhookID string
+	Status    DeliveryStatus
+	Limit     int // 0 = 50
+}
+
+const maxDeliveryLimit = 500
+
+// Deliveries geeft de nieuwste deliveries eerst.
+func (m *Manager) Deliveries(f DeliveryFilter) ([]*Delivery, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxDeliveryLimit {
+		limit = maxDeliveryLimit
+	}
+
+	iter := m.db.NewIterator(util.BytesPrefix(deliveryPrefix), nil)
+	defer iter.Release()
+
+	out := []*Delivery{}
+	for ok := iter.Last(); ok && len(out) < limit; ok = iter.Prev() {
+		var d Delivery
+		if err := json.Unmarshal(iter.Value(), &d); err != nil {
+			return nil, err
+		}
+		if f.Merchant != (common.Address{}) && d.Merchant != f.Merchant {
+			continue
+		}
+		if f.WebhookID != "" && d.WebhookID != f.WebhookID {
+			continue
+		}
+		if f.Status != "" && d.Status != f.Status {
+			continue
+		}
+		out = append(out, &d)
+	}
+	return out, iter.Error()
+}
+
+// GetDelivery geeft één delivery.
+func (m *Manager) GetDelivery(id uint64) (*Delivery, error) {
+	data, err := m.db.Get(deliveryKey(id), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d Delivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Retry zet een mislukte delivery opnieuw in de queue met een nieuwe
+// reeks pogingen.
+func (m *Manager) Retry(id uint64) (*Delivery, error) {
+	d, err := m.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != DeliveryFailed {
+		return nil, fmt.Errorf("only failed deliveries can be retried (status %s)", d.Status)
+	}
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttempt = uint64(m.now().Unix())
+	if err := m.saveDelivery(nil, d); err != nil {
+		return nil, err
+	}
+	m.poke()
+	return d, nil
+}
+
+// ---------------------------------------------
+// Events → deliveries
+// ---------------------------------------------
+
+// intentEvent: de velden die we uit een intent.* event nodig hebben.
+type intentEvent struct {
+	Type     string         `json:"type"`
+	Merchant common.Address `json:"merchant"`
+}
+
+// ingest zet nieuwe payment events uit het log om in deliveries; de
+// cursor gaat in dezelfde batch mee, zodat een event nooit twee keer en
+// nooit niet wordt ingepland.
+func (m *Manager) ingest() error {
+	for {
+		m.mu.Lock()
+		cursor := m.cursor
+		m.mu.Unlock()
+
+		// Head vóór Read: een event dat tussendoor binnenkomt valt dan
+		// altijd na de head en wordt de volgende ronde gelezen
+		head := m.eventLog.Head()
+		records, err := m.eventLog.Read(cursor, 100, events.TopicPayment)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			// Geen payment events meer: cursor mag naar de head (scheelt
+			// het opnieuw overslaan van andere topics)
+			return m.advanceCursor(head)
+		}
+
+		m.mu.Lock()
+		batch := new(leveldb.Batch)
+		nextID := m.nextID
+		for _, rec := range records {
+			var ev intentEvent
+			if err := json.Unmarshal(rec.Event, &ev); err != nil || !strings.HasPrefix(ev.Type, "intent.") {
+				continue
+			}
+			for _, wh := range m.listLocked(ev.Merchant) {
+				if !wh.wants(ev.Type) {
+					continue
+				}
+				nextID++
+				d := &Delivery{
+					ID:          nextID,
+					WebhookID:   wh.ID,
+					Merchant:    wh.Merchant,
+					URL:         wh.URL,
+					Event:       ev.Type,
+					EventSeq:    rec.Seq,
+					Status:      DeliveryPending,
+					NextAttempt: uint64(m.now().Unix()),
+					CreatedAt:   uint64(m.now().Unix()),
+				}
+				d.Payload, err = json.Marshal(map[string]interface{}{
+					"id":        d.ID,
+					"type":      ev.Type,
+					"seq":       rec.Seq,
+					"createdAt": rec.Time,
+					"data":      rec.Event,
+				})
+				if err != nil {
+					m.mu.Unlock()
+					return err
+				}
+				if err := m.saveDelivery(batch, d); err != nil {
+					m.mu.Unlock()
+					return err
+				}
+			}
+		}
+		last := records[len(records)-1].Seq
+		_ = m.putUint(batch, deliverySeqKey, nextID)
+		_ = m.putUint(batch, cursorKey, last)
+		if err := m.db.Write(batch, nil); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		m.nextID = nextID
+		m.cursor = last
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) advanceCursor(head uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if head <= m.cursor {
+		return nil
+	}
+	if err := m.putUint(nil, cursorKey, head); err != nil {
+		return err
+	}
+	m.cursor = head
+	return nil
+}
+
+// ---------------------------------------------
+// Versturen
+// ---------------------------------------------
+
+// deliverDue geeft pending deliveries waarvan NextAttempt voorbij is aan
+// de workers, oudste eerst en per webhook één tegelijk (de volgorde per
+// webhook blijft zo gelijk). Blokkeert nooit: zijn alle workers bezig,
+// dan komt de rest de volgende ronde.
+func (m *Manager) deliverDue() {
+	now := uint64(m.now().Unix())
+
+	iter := m.db.NewIterator(util.BytesPrefix(pendingPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		id := binary.BigEndian.Uint64(iter.Key()[len(pendingPrefix):])
+		d, err := m.GetDelivery(id)
+		if err != nil || d.Status != DeliveryPending {
+			continue
+		}
+
+		m.mu.Lock()
+		if m.busy[d.WebhookID] {
+			// Oudere delivery voor deze webhook nog onderweg
+			m.mu.Unlock()
+			continue
+		}
+		m.busy[d.WebhookID] = true
+		m.mu.Unlock()
+
+		if d.NextAttempt <= now {
+			select {
+			case m.jobs <- d:
+				continue
+			default:
+				// Alle workers bezig
+				m.release(d.WebhookID)
+				return
+			}
+		}
+		// Nog niet due: nieuwere deliveries van deze webhook wachten erop
+		// (busy blijft gezet tot het einde van deze ronde)
+		defer m.release(d.WebhookID)
+	}
+}
+
+// worker verstuurt deliveries tot Close jobs sluit.
+func (m *Manager) worker() {
+	defer m.workers.Done()
+	for d := range m.jobs {
+		m.attempt(d)
+		m.release(d.WebhookID)
+		m.poke()
+	}
+}
+
+func (m *Manager) release(webhookID string) {
+	m.mu.Lock()
+	delete(m.busy, webhookID)
+	m.mu.Unlock()
+}
+
+// attempt doet één POST en werkt de delivery bij.
+func (m *Manager) attempt(d *Delivery) {
+	m.mu.Lock()
+	wh, ok := m.webhooks[d.WebhookID]
+	m.mu.Unlock()
+	if !ok {
+		d.Status = DeliveryFailed
+		d.LastError = "webhook deleted"
+		_ = m.saveDelivery(nil, d)
+		return
+	}
+
+	now := m.now()
+	code, err := m.post(wh, d, now)
+	if m.ctx.Err() != nil {
+		// Close tijdens de POST: na een restart opnieuw
+		return
+	}
+	d.Attempts++
+	d.LastStatusCode = code
+	switch {
+	case err == nil && code >= 200 && code < 300:
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = uint64(now.Unix())
+		d.NextAttempt = 0
+		d.LastError = ""
+	default:
+		if err != nil {
+			d.LastError = err.Error()
+		} else {
+			d.LastError = fmt.Sprintf("HTTP %d", code)
+		}
+		if d.Attempts >= m.cfg.MaxAttempts {
+			d.Status = DeliveryFailed
+			d.NextAttempt = 0
+			m.logInfo(fmt.Sprintf("Webhook delivery %d to %s failed after %d attempts: %s", d.ID, d.URL, d.Attempts, d.LastError))
+		} else {
+			d.NextAttempt = uint64(now.Add(m.backoff(d.Attempts)).Unix())
+		}
+	}
+	if err := m.saveDelivery(nil, d); err != nil {
+		m.logError(fmt.Sprintf("save webhook delivery %d: %v", d.ID, err))
+	}
+}
+
+func (m *Manager) post(wh *Webhook, d *Delivery, now time.Time) (int, error) {
+	ctx, cancel := m.ctx, context.CancelFunc(func() {})
+	if m.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(m.ctx, m.cfg.Timeout)
+	}
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gorrillazz-webhooks/1")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(d.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(wh.Secret, now.Unix(), d.Payload))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Body leeg lezen (begrensd) zodat de verbinding hergebruikt wordt
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff na attempts mislukte pogingen: Base * 2^(attempts-1), max MaxBackoff.
+func (m *Manager) backoff(attempts int) time.Duration {
+	d := m.cfg.BaseBackoff
+	for i := 1; i < attempts && d < m.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > m.cfg.MaxBackoff {
+		d = m.cfg.MaxBackoff
+	}
+	return d
+}
+
+// poke maakt de loop wakker (Retry).
+func (m *Manager) poke() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ---------------------------------------------
+// Signature
+// ---------------------------------------------
+
+// Sign bouwt de SignatureHeader waarde voor body op tijdstip ts.
+func Sign(secret string, ts int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac(secret, ts, body)))
+}
+
+// Verify controleert een SignatureHeader waarde (voor merchants / tests).
+// maxAge > 0 weigert oudere timestamps dan now - maxAge.
+func Verify(secret, header string, body []byte, now time.Time, maxAge time.Duration) error {
+	var (
+		ts  int64 = -1
+		sig []byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errors.New("invalid signature timestamp")
+			}
+			ts = n
+		case "v1":
+			b, err := hex.DecodeString(v)
+			if err != nil {
+				return errors.New("invalid signature")
+			}
+			sig = b
+		}
+	}
+	if ts < 0 || sig == nil {
+		return errors.New("malformed signature header")
+	}
+	if maxAge > 0 && now.Sub(time.Unix(ts, 0)) > maxAge {
+		return errors.New("signature timestamp too old")
+	}
+	if !hmac.Equal(sig, mac(secret, ts, body)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func mac(secret string, ts int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%d.", ts)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// ---------------------------------------------
+// Helpers
+// ---------------------------------------------
+
+// wants: webhook filtert op event type (leeg = alles).
+func (wh *Webhook) wants(eventType string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, t := range wh.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+var intentEventTypes = []events.EventType{
+	events.TypeIntentCreated,
+	events.TypeIntentPaid,
+	events.TypeIntentExpired,
+	events.TypeIntentRefunded,
+	events.TypeIntentSettled,
+	events.TypeIntentCancelled,
+}
+
+// normalizeEvents: "paid" → "intent.paid", onbekende types zijn een fout.
+func normalizeEvents(in []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range in {
+		if !strings.HasPrefix(t, "intent.") {
+			t = "intent." + t
+		}
+		known := false
+		for _, et := range intentEventTypes {
+			if string(et) == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func validateURL(raw string) error {
+	if raw == "" || len(raw) > MaxURLLength {
+		return fmt.Errorf("url must be 1-%d characters", MaxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+func redact(wh *Webhook) *Webhook {
+	out := *wh
+	out.Secret = ""
+	out.Events = append([]string(nil), wh.Events...)
+	return &out
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// saveDelivery schrijft d en houdt de pending index bij.
+func (m *Manager) saveDelivery(batch *leveldb.Batch, d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	own := batch == nil
+	if own {
+		batch = new(leveldb.Batch)
+	}
+	batch.Put(deliveryKey(d.ID), data)
+	if d.Status == DeliveryPending {
+		batch.Put(idKey(pendingPrefix, d.ID), nil)
+	} else {
+		batch.Delete(idKey(pendingPrefix, d.ID))
+	}
+	if own {
+		return m.db.Write(batch, nil)
+	}
+	return nil
+}
+
+func (m *Manager) getUint(key []byte) (uint64, error) {
+	raw, err := m.db.Get(key, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) != 8 {
+		return 0, fmt.Errorf("corrupt %s", key)
+	}
+	return binary.BigEndian.Uint64(raw), nil
+}
+
+func (m *Manager) putUint(batch *leveldb.Batch, key []byte, v uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	if batch != nil {
+		batch.Put(key, buf[:])
+		return nil
+	}
+	return m.db.Put(key, buf[:], nil)
+}
+
+func webhookKey(id string) []byte {
+	return append(append([]byte{}, webhookPrefix...), id...)
+}
+
+func deliveryKey(id uint64) []byte {
+	return idKey(deliveryPrefix, id)
+}
+
+func idKey(prefix []byte, id uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], id)
+	return key
+}
+
+func (m *Manager) logInfo(msg string) {
+	if m.logger != nil {
+		m.logger.Info("[WEBHOOKS] " + msg)
+	}
+}
+
+func (m *Manager) logError(msg string) {
+	if m.logger != nil {
+		m.logger.Error("[WEBHOOKS] " + msg)
+	}
+}
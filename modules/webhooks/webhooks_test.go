@@ -0,0 +1,353 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var testMerchant = common.HexToAddress("0x19E7E376E7C213B7E7e7e46cc70A5dD086DAff2A")
+
+// clock: instelbare tijd voor de backoff; m.now wordt vanuit de loop en
+// de workers gelezen.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+type testEnv struct {
+	dir string
+	bus *events.EventBus
+	log *events.EventLog
+	clk *clock
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := events.OpenEventLog(filepath.Join(dir, "events"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Close)
+	bus := events.NewEventBus()
+	bus.AttachLog(l)
+	return &testEnv{dir: dir, bus: bus, log: l, clk: &clock{t: time.Unix(1_700_000_000, 0)}}
+}
+
+func testConfig() Config {
+	return Config{
+		MaxAttempts:  3,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   time.Minute,
+		PollInterval: 5 * time.Millisecond,
+		Timeout:      time.Second,
+		Workers:      2,
+	}
+}
+
+// open start een manager op de vaste db van env (zelfde pad = restart).
+func (e *testEnv) open(t *testing.T, cfg Config) *Manager {
+	t.Helper()
+	m, err := Open(filepath.Join(e.dir, "webhooks"), e.bus, e.log, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = e.clk.Now
+	m.Start()
+	return m
+}
+
+func (e *testEnv) emitPaid(id uint64) {
+	e.bus.Emit(&events.IntentPaid{
+		IntentInfo: events.IntentInfo{IntentID: id, Merchant: testMerchant, Amount: "100", Token: "GORR", Status: "paid"},
+		Fee:        "1",
+		Net:        "99",
+		PaidTotal:  "100",
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func onlyDelivery(t *testing.T, m *Manager) *Delivery {
+	t.Helper()
+	list, err := m.Deliveries(DeliveryFilter{Merchant: testMerchant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("have %d deliveries, want 1", len(list))
+	}
+	return list[0]
+}
+
+// attempts: pogingen van de enige delivery (0 zolang die er nog niet is).
+func attempts(m *Manager) int {
+	list, _ := m.Deliveries(DeliveryFilter{Merchant: testMerchant})
+	if len(list) != 1 {
+		return 0
+	}
+	return list[0].Attempts
+}
+
+func TestDeliverySignature(t *testing.T) {
+	env := newTestEnv(t)
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- request{r.Header.Clone(), body}
+	}))
+	defer srv.Close()
+
+	m := env.open(t, testConfig())
+	defer m.Close()
+	wh, err := m.Register(testMerchant, srv.URL, []string{"paid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.emitPaid(1)
+
+	var req request
+	select {
+	case req = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook request")
+	}
+
+	sig := req.header.Get(SignatureHeader)
+	want := Sign(wh.Secret, env.clk.Now().Unix(), req.body)
+	if sig != want {
+		t.Fatalf("signature header %q, want %q", sig, want)
+	}
+	if !strings.HasPrefix(sig, "t=1700000000,v1=") {
+		t.Fatalf("signature header %q not in t=<unix>,v1=<hex> form", sig)
+	}
+	if err := Verify(wh.Secret, sig, req.body, env.clk.Now(), time.Minute); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := Verify("whsec_other", sig, req.body, env.clk.Now(), time.Minute); err == nil {
+		t.Fatal("verify accepted the wrong secret")
+	}
+	if err := Verify(wh.Secret, sig, append(req.body, ' '), env.clk.Now(), time.Minute); err == nil {
+		t.Fatal("verify accepted a modified body")
+	}
+	if err := Verify(wh.Secret, sig, req.body, env.clk.Now().Add(2*time.Minute), time.Minute); err == nil {
+		t.Fatal("verify accepted a stale timestamp")
+	}
+	if ev := req.header.Get(EventHeader); ev != string(events.TypeIntentPaid) {
+		t.Fatalf("event header %q", ev)
+	}
+	if !strings.Contains(string(req.body), `"type":"intent.paid"`) {
+		t.Fatalf("payload without event type: %s", req.body)
+	}
+
+	waitFor(t, "delivered status", func() bool {
+		list, _ := m.Deliveries(DeliveryFilter{Status: DeliveryDelivered})
+		return len(list) == 1
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	m := &Manager{cfg: Config{BaseBackoff: 5 * time.Second, MaxBackoff: time.Minute}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{4, 40 * time.Second},
+		{5, time.Minute},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := m.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetrySchedule(t *testing.T) {
+	env := newTestEnv(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	m := env.open(t, cfg)
+	defer m.Close()
+	if _, err := m.Register(testMerchant, srv.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	env.emitPaid(1)
+
+	// Poging n mislukt → volgende na Base * 2^(n-1); na MaxAttempts failed
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		waitFor(t, "attempt", func() bool { return attempts(m) == attempt })
+		d := onlyDelivery(t, m)
+		if d.LastStatusCode != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: status code %d", attempt, d.LastStatusCode)
+		}
+		if attempt == cfg.MaxAttempts {
+			if d.Status != DeliveryFailed || d.NextAttempt != 0 {
+				t.Fatalf("after %d attempts: status %s next %d, want failed", attempt, d.Status, d.NextAttempt)
+			}
+			break
+		}
+		wait := m.backoff(attempt)
+		if want := uint64(env.clk.Now().Add(wait).Unix()); d.Status != DeliveryPending || d.NextAttempt != want {
+			t.Fatalf("attempt %d: status %s next %d, want pending at %d", attempt, d.Status, d.NextAttempt, want)
+		}
+
+		// Niet vóór de backoff opnieuw
+		env.clk.Advance(wait - time.Second)
+		time.Sleep(50 * time.Millisecond)
+		if n := int(hits.Load()); n != attempt {
+			t.Fatalf("retried before the backoff: %d requests after attempt %d", n, attempt)
+		}
+		env.clk.Advance(time.Second)
+	}
+
+	// Failed: geen nieuwe pogingen meer, tot Retry
+	env.clk.Advance(time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if n := int(hits.Load()); n != cfg.MaxAttempts {
+		t.Fatalf("%d requests, want %d", n, cfg.MaxAttempts)
+	}
+	if _, err := m.Retry(onlyDelivery(t, m).ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "retry", func() bool { return int(hits.Load()) == cfg.MaxAttempts+1 })
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	env := newTestEnv(t)
+
+	var up atomic.Bool
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	m := env.open(t, testConfig())
+	if _, err := m.Register(testMerchant, srv.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	env.emitPaid(1)
+	waitFor(t, "first attempt", func() bool { return attempts(m) == 1 })
+	m.Close()
+
+	// Event terwijl de manager down is: na de restart alsnog ingepland
+	env.emitPaid(2)
+	up.Store(true)
+	env.clk.Advance(time.Minute)
+
+	m = env.open(t, testConfig())
+	defer m.Close()
+	if len(m.List(testMerchant)) != 1 {
+		t.Fatal("webhook lost on restart")
+	}
+	waitFor(t, "both delivered", func() bool {
+		list, _ := m.Deliveries(DeliveryFilter{Status: DeliveryDelivered})
+		return len(list) == 2
+	})
+	list, _ := m.Deliveries(DeliveryFilter{})
+	if len(list) != 2 {
+		t.Fatalf("have %d deliveries after restart, want 2 (no duplicates)", len(list))
+	}
+	if list[1].Attempts != 2 || list[0].Attempts != 1 {
+		t.Fatalf("attempts %d/%d, want 2/1", list[1].Attempts, list[0].Attempts)
+	}
+}
+
+func TestSlowEndpointDoesNotBlockOthers(t *testing.T) {
+	env := newTestEnv(t)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	var fastHits atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastHits.Add(1)
+	}))
+	defer fast.Close()
+
+	cfg := testConfig()
+	cfg.Timeout = 200 * time.Millisecond
+	m := env.open(t, cfg)
+	defer m.Close()
+
+	slowHook, err := m.Register(testMerchant, slow.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Register(testMerchant, fast.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	env.emitPaid(1)
+	env.emitPaid(2)
+
+	// De snelle endpoint krijgt beide events terwijl de trage hangt
+	waitFor(t, "fast deliveries", func() bool { return fastHits.Load() == 2 })
+
+	// De trage loopt tegen de per-request timeout aan
+	waitFor(t, "slow timeout", func() bool {
+		list, _ := m.Deliveries(DeliveryFilter{WebhookID: slowHook.ID})
+		for _, d := range list {
+			if d.Attempts > 0 {
+				return strings.Contains(d.LastError, "deadline exceeded")
+			}
+		}
+		return false
+	})
+}
@@ -1,5 +1,12 @@
 package node
 
+import (
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
 // Config defines all runtime parameters used by the node.
 type Config struct {
 	DataDir   string
@@ -7,6 +14,38 @@ type Config struct {
 	NetworkID uint64
 	LogLevel  string
 	BlockTime int // number of seconds between blocks
+
+	// How long the durable event log keeps records (0 = forever).
+	EventRetention time.Duration
+
+	// Chain regels: gas limit, fees en fork hoogtes. Alle nodes van een
+	// netwerk moeten dezelfde hebben.
+	ChainConfig *params.ChainConfig
+
+	// Consensus: "poa" (timer producer, default) of "bft" (Tendermint-stijl
+	// rondes met finality certificaten).
+	Consensus string
+
+	// PoA / BFT: initial validator set (empty = the admin wallet) and the file
+	// holding this node's hex signing key (empty = the admin wallet key).
+	Validators   []common.Address
+	ValidatorKey string
+
+	// Mine = deze node produceert blocks (false = alleen importeren).
+	Mine bool
+
+	// DevMode: "interval" (default), "instamine" (block per tx) of
+	// "manual" (alleen evm_mine). SkipEmpty = interval zonder lege blocks.
+	DevMode   string
+	SkipEmpty bool
+
+	// P2P networking. Empty P2PListen = no inbound connections. Listening
+	// is opt-in: any peer can offer blocks and txs (the txpool caps what a
+	// single peer can queue).
+	P2PListen   string
+	StaticPeers []string
+	BootNodes   []string
+	MaxPeers    int
 }
 
 // DefaultConfig provides safe, working defaults.
@@ -17,5 +56,14 @@ func DefaultConfig() *Config {
 		NetworkID: 9999,
 		LogLevel:  "debug",
 		BlockTime: 3, // block every 3 seconds
+
+		EventRetention: 7 * 24 * time.Hour,
+
+		ChainConfig: params.GorrillazzChainConfig(),
+
+		Consensus: "poa",
+		Mine:      true,
+		DevMode:   "interval",
+		MaxPeers:  25,
 	}
 }
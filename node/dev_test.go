@@ -0,0 +1,510 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// devNode start een enkele PoA dev node (admin = validator) zonder p2p.
+func devNode(t *testing.T, mode string, skipEmpty bool) *Node {
+	t.Helper()
+	return devNodeWith(t, mode, skipEmpty, nil)
+}
+
+// devNodeWith: als devNode; prepare past de config aan vóór de start.
+func devNodeWith(t *testing.T, mode string, skipEmpty bool, prepare func(*Config)) *Node {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.RPCPort = 0
+	cfg.LogLevel = "error"
+	cfg.BlockTime = 1
+	cfg.DevMode = mode
+	cfg.SkipEmpty = skipEmpty
+	cfg.P2PListen = ""
+	if prepare != nil {
+		prepare(cfg)
+	}
+
+	node, err := NewNode(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Chain.State.Close() })
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+	return node
+}
+
+// sendTx stuurt value wei van de admin naar to via eth_sendRawTransaction.
+func sendTx(t *testing.T, n *Node, to common.Address, value int64) common.Hash {
+	t.Helper()
+	return sendTxPriced(t, n, to, value, 0)
+}
+
+// sendTxPriced: als sendTx, met gas price gasPrice.
+func sendTxPriced(t *testing.T, n *Node, to common.Address, value, gasPrice int64) common.Hash {
+	t.Helper()
+	key, err := blockchain.AdminKey(n.Config.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonce hexutil.Uint64
+	if err := json.Unmarshal(rpcCall(t, n, "eth_getTransactionCount", crypto.PubkeyToAddress(key.PublicKey).Hex(), "pending"), &nonce); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := gethtypes.SignTx(gethtypes.NewTransaction(uint64(nonce), to, big.NewInt(value), 100_000, big.NewInt(gasPrice), nil),
+		gethtypes.LatestSignerForChainID(new(big.Int).SetUint64(n.Config.NetworkID)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash common.Hash
+	if err := json.Unmarshal(rpcCall(t, n, "eth_sendRawTransaction", hexutil.Encode(raw)), &hash); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func rpcCall(t *testing.T, n *Node, method string, params ...interface{}) json.RawMessage {
+	t.Helper()
+	res, err := rpcResult(t, n, method, params...)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	return res
+}
+
+// rpcResult: zoals rpcCall, maar een JSON-RPC error komt terug als err.
+func rpcResult(t *testing.T, n *Node, method string, params ...interface{}) (json.RawMessage, error) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(n.RPC.HandleJSONRPC))
+	defer srv.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	resp, err := srv.Client().Post(srv.URL, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Error != nil {
+		return nil, errors.New(out.Error.Message)
+	}
+	return out.Result, nil
+}
+
+// waitForHeight wacht tot elke node in nodes op height zit.
+func waitForHeight(t *testing.T, nodes []*Node, height uint64, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for _, n := range nodes {
+		for n.Chain.Head().Header.Number < height {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for block #%d (head #%d)", height, n.Chain.Head().Header.Number)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// stays: de head blijft d lang op number.
+func stays(t *testing.T, n *Node, number uint64, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		if got := n.Chain.Head().Header.Number; got != number {
+			t.Fatalf("head #%d, want it to stay at #%d", got, number)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// txsIn: aantal txs per block 1..head.
+func txsIn(t *testing.T, n *Node) []int {
+	t.Helper()
+	out := []int{}
+	for i := uint64(1); i <= n.Chain.Head().Header.Number; i++ {
+		b, err := n.Chain.LoadBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, len(b.Transactions))
+	}
+	return out
+}
+
+func TestDevModes(t *testing.T) {
+	to := common.HexToAddress("0xb0b")
+
+	tests := []struct {
+		name      string
+		mode      string
+		skipEmpty bool
+		run       func(t *testing.T, n *Node)
+		txs       []int // txs per block na run (nil = niet gecontroleerd)
+	}{
+		{"instamine seals a block per tx", "instamine", false, func(t *testing.T, n *Node) {
+			stays(t, n, 0, 1500*time.Millisecond)
+			sendTx(t, n, to, 1)
+			waitForHeight(t, []*Node{n}, 1, 3*time.Second)
+			sendTx(t, n, to, 2)
+			waitForHeight(t, []*Node{n}, 2, 3*time.Second)
+			stays(t, n, 2, 1500*time.Millisecond)
+		}, []int{1, 1}},
+		{"manual mines only on evm_mine", "manual", false, func(t *testing.T, n *Node) {
+			sendTx(t, n, to, 1)
+			stays(t, n, 0, 1500*time.Millisecond)
+			rpcCall(t, n, "evm_mine")
+			rpcCall(t, n, "evm_mine")
+		}, []int{1, 0}},
+		{"interval skips empty blocks", "interval", true, func(t *testing.T, n *Node) {
+			stays(t, n, 0, 2500*time.Millisecond)
+			sendTx(t, n, to, 1)
+			waitForHeight(t, []*Node{n}, 1, 4*time.Second)
+			stays(t, n, 1, 2500*time.Millisecond)
+		}, []int{1}},
+		{"interval makes empty blocks", "interval", false, func(t *testing.T, n *Node) {
+			waitForHeight(t, []*Node{n}, 2, 5*time.Second)
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := devNode(t, tt.mode, tt.skipEmpty)
+			tt.run(t, n)
+			if tt.txs == nil {
+				return
+			}
+			if got := txsIn(t, n); !slices.Equal(got, tt.txs) {
+				t.Fatalf("txs per block %v, want %v", got, tt.txs)
+			}
+			if bal, _ := n.Chain.State.GetBalance(to); bal.Sign() == 0 {
+				t.Fatal("transfer not applied")
+			}
+		})
+	}
+}
+
+// headTime: timestamp van de head.
+// Een tx die na zijn eerste writes faalt laat niets achter in het block:
+// de andere txs blijven staan en de root klopt met ApplyBlock.
+func TestDevTxFailsMidBlock(t *testing.T) {
+	n := devNodeWith(t, "manual", false, func(cfg *Config) {
+		cfg.ChainConfig.GasChargeBlock = new(uint64)
+	})
+	to, other := common.HexToAddress("0xb0b"), common.HexToAddress("0xc0c")
+	admin := n.Chain.AdminAddr
+	before, _ := n.Chain.State.GetBalance(admin)
+
+	sendTx(t, n, to, 1)             // geen gas price: geen gas fee
+	sendTxPriced(t, n, other, 5, 1) // transfer, daarna faalt chargeGas
+	// Zonder treasury faalt chargeGas pas ná de transfer
+	n.Chain.TreasuryAddr = common.Address{}
+	rpcCall(t, n, "evm_mine")
+
+	if got := txsIn(t, n); !slices.Equal(got, []int{1}) {
+		t.Fatalf("txs per block %v, want [1]", got)
+	}
+	root, err := n.Chain.State.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := n.Chain.Head().Header; head.StateRoot != root {
+		t.Fatalf("head root %s, state root %s", head.StateRoot.Hex(), root.Hex())
+	}
+	if bal, _ := n.Chain.State.GetBalance(other); bal.Sign() != 0 {
+		t.Fatalf("failed tx left %s wei at the recipient", bal)
+	}
+	if bal, _ := n.Chain.State.GetBalance(to); bal.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("recipient of the good tx has %s wei, want 1", bal)
+	}
+	after, _ := n.Chain.State.GetBalance(admin)
+	if spent := new(big.Int).Sub(before, after); spent.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("admin spent %s wei, want 1", spent)
+	}
+	if nonce, _ := n.Chain.State.GetNonce(admin); nonce != 1 {
+		t.Fatalf("admin nonce %d, want 1", nonce)
+	}
+}
+
+func headTime(n *Node) uint64 { return n.Chain.Head().Header.Time }
+
+func TestDevTimeControl(t *testing.T) {
+	n := devNode(t, "manual", false)
+
+	var offset int64
+	if err := json.Unmarshal(rpcCall(t, n, "evm_increaseTime", 3600), &offset); err != nil || offset != 3600 {
+		t.Fatalf("evm_increaseTime = %d, %v; want 3600", offset, err)
+	}
+	rpcCall(t, n, "evm_mine")
+	if wall := uint64(time.Now().Unix()); headTime(n) < wall+3600 {
+		t.Fatalf("block time %d, want at least %d", headTime(n), wall+3600)
+	}
+
+	// Vaste timestamp voor één block; daarna loopt de klok vanaf daar
+	ts := headTime(n) + 1000
+	rpcCall(t, n, "evm_setNextBlockTimestamp", ts)
+	rpcCall(t, n, "evm_mine")
+	if headTime(n) != ts {
+		t.Fatalf("block time %d, want %d", headTime(n), ts)
+	}
+	rpcCall(t, n, "evm_mine")
+	if got := headTime(n); got <= ts || got > ts+5 {
+		t.Fatalf("block after the fixed timestamp at %d, want just after %d", got, ts)
+	}
+
+	for _, bad := range []uint64{headTime(n), headTime(n) - 1} {
+		if _, err := rpcResult(t, n, "evm_setNextBlockTimestamp", bad); err == nil {
+			t.Fatalf("evm_setNextBlockTimestamp(%d) at head time %d accepted", bad, headTime(n))
+		}
+	}
+
+	// evm_mine {blocks, timestamp}: het eerste block krijgt timestamp
+	start, ts := n.Chain.Head().Header.Number, headTime(n)+500
+	rpcCall(t, n, "evm_mine", map[string]interface{}{"blocks": 3, "timestamp": hexutil.EncodeUint64(ts)})
+	if got := n.Chain.Head().Header.Number; got != start+3 {
+		t.Fatalf("head #%d, want #%d", got, start+3)
+	}
+	prev := ts - 1
+	for i := start + 1; i <= start+3; i++ {
+		b, err := n.Chain.LoadBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == start+1 && b.Header.Time != ts || b.Header.Time <= prev {
+			t.Fatalf("block #%d at %d (previous %d, fixed %d)", i, b.Header.Time, prev, ts)
+		}
+		prev = b.Header.Time
+	}
+	if _, err := rpcResult(t, n, "evm_mine", 0); err == nil {
+		t.Fatal("evm_mine(0) accepted")
+	}
+}
+
+// Intent expiry volgt de chain clock: verlopen zonder te wachten.
+func TestDevIntentExpiry(t *testing.T) {
+	n := devNode(t, "manual", false)
+
+	var intent struct {
+		ID     uint64
+		Expiry uint64
+		Status string
+	}
+	get := func() {
+		t.Helper()
+		if err := json.Unmarshal(rpcCall(t, n, "gorr_getPaymentIntent", intent.ID), &intent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := rpcCall(t, n, "gorr_createPaymentIntent", map[string]interface{}{
+		"merchant": "0x0000000000000000000000000000000000000b0b", "amount": "1000", "expiresIn": 600,
+	})
+	if err := json.Unmarshal(res, &intent); err != nil {
+		t.Fatal(err)
+	}
+	if now := n.Chain.Payment.Now(); intent.Expiry != now+600 && intent.Expiry != now+599 {
+		t.Fatalf("expiry %d, want %d", intent.Expiry, now+600)
+	}
+
+	// Opgeslagen (en gemeld) wordt expired pas in het volgende block
+	expiredEvents := func() int {
+		t.Helper()
+		recs, err := n.EventLog.Read(0, 0, events.TopicPayment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, r := range recs {
+			var ev events.Schema
+			if err := json.Unmarshal(r.Event, &ev); err != nil {
+				t.Fatal(err)
+			}
+			if ev.Type == events.TypeIntentExpired {
+				count++
+			}
+		}
+		return count
+	}
+
+	steps := []struct {
+		increase uint64
+		mine     bool
+		want     string
+		events   int
+	}{
+		{300, false, "pending", 0},
+		{301, false, "expired", 0},
+		{0, true, "expired", 1},
+	}
+	for i, st := range steps {
+		if st.increase > 0 {
+			rpcCall(t, n, "evm_increaseTime", st.increase)
+		}
+		if st.mine {
+			rpcCall(t, n, "evm_mine")
+		}
+		get()
+		if intent.Status != st.want || expiredEvents() != st.events {
+			t.Fatalf("step %d: status %s with %d expired events, want %s and %d", i, intent.Status, expiredEvents(), st.want, st.events)
+		}
+	}
+}
+
+// devState: wat evm_revert terug moet zetten.
+type devState struct {
+	head    common.Hash
+	root    common.Hash
+	balance string
+	intents int
+	pending int
+	offset  int64
+}
+
+func captureDev(t *testing.T, n *Node, to common.Address) devState {
+	t.Helper()
+	root, err := n.Chain.State.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bal, err := n.Chain.State.GetBalance(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return devState{
+		head:    n.Chain.Head().Hash(),
+		root:    root,
+		balance: bal.String(),
+		intents: len(n.Chain.Payment.ListMerchantPayments(to)),
+		pending: len(n.Chain.TxPool.Pending()),
+		offset:  n.Producer.Clock().Offset(),
+	}
+}
+
+func snapshot(t *testing.T, n *Node) string {
+	t.Helper()
+	var id string
+	if err := json.Unmarshal(rpcCall(t, n, "evm_snapshot"), &id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func revert(t *testing.T, n *Node, id string) bool {
+	t.Helper()
+	var ok bool
+	if err := json.Unmarshal(rpcCall(t, n, "evm_revert", id), &ok); err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestDevSnapshotRevert(t *testing.T) {
+	n := devNode(t, "manual", false)
+	to := common.HexToAddress("0xb0b")
+
+	// change: een block met een tx, een intent, tijd en een tx in de pool
+	change := func(value int64) {
+		t.Helper()
+		sendTx(t, n, to, value)
+		rpcCall(t, n, "evm_mine")
+		rpcCall(t, n, "gorr_createPaymentIntent", map[string]interface{}{"merchant": to.Hex(), "amount": "1000"})
+		rpcCall(t, n, "evm_increaseTime", 60)
+		sendTx(t, n, to, value)
+	}
+
+	genesis := captureDev(t, n, to)
+	a := snapshot(t, n)
+	change(1)
+	first := captureDev(t, n, to)
+	b := snapshot(t, n)
+	change(2)
+	rpcCall(t, n, "evm_mine", 3)
+
+	steps := []struct {
+		id   string
+		ok   bool
+		want devState
+	}{
+		{b, true, first},
+		{b, false, first}, // een snapshot is na gebruik weg
+		{a, true, genesis},
+		{b, false, genesis}, // latere snapshots vervallen mee
+	}
+	for i, st := range steps {
+		if ok := revert(t, n, st.id); ok != st.ok {
+			t.Fatalf("step %d: evm_revert(%s) = %v, want %v", i, st.id, ok, st.ok)
+		}
+		if got := captureDev(t, n, to); got != st.want {
+			t.Fatalf("step %d: state %+v, want %+v", i, got, st.want)
+		}
+	}
+
+	// Na een revert gaat de chain gewoon verder, ook weer terug te zetten
+	c := snapshot(t, n)
+	change(3)
+	if n.Chain.Head().Header.Number != 1 {
+		t.Fatalf("head #%d after mining on the reverted chain, want #1", n.Chain.Head().Header.Number)
+	}
+	if !revert(t, n, c) || captureDev(t, n, to) != genesis {
+		t.Fatal("revert after mining on a reverted chain")
+	}
+}
+
+// Een interval node is een gewone validator: geen RPC caller mag de klok
+// verzetten of blocks maken.
+func TestDevMethodsRequireDevMode(t *testing.T) {
+	n := devNode(t, "interval", true)
+	calls := []struct {
+		method string
+		params []interface{}
+	}{
+		{"evm_mine", nil},
+		{"evm_mine", []interface{}{map[string]interface{}{"blocks": 1, "timestamp": headTime(n) + 3600}}},
+		{"evm_increaseTime", []interface{}{3600}},
+		{"evm_setNextBlockTimestamp", []interface{}{headTime(n) + 3600}},
+		{"evm_snapshot", nil},
+		{"evm_revert", []interface{}{1}},
+	}
+	for _, c := range calls {
+		if _, err := rpcResult(t, n, c.method, c.params...); err == nil || !strings.Contains(err.Error(), "dev mining not enabled") {
+			t.Fatalf("%s in interval mode: %v", c.method, err)
+		}
+	}
+	if offset := n.Producer.Clock().Offset(); offset != 0 {
+		t.Fatalf("clock moved by %d seconds", offset)
+	}
+	if _, ok := n.Producer.Clock().Next(); ok {
+		t.Fatal("next block timestamp fixed")
+	}
+	if head := n.Chain.Head().Header.Number; head != 0 {
+		t.Fatalf("head #%d, want no blocks", head)
+	}
+}
@@ -1,13 +1,23 @@
 package node
 
 import (
+	"crypto/ecdsa"
 	"fmt"
+	"path/filepath"
+	"time"
 
+	"github.com/Siasom1/gorrillazz-chain/consensus/bft"
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
 	"github.com/Siasom1/gorrillazz-chain/consensus/producer"
 	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/clock"
 	"github.com/Siasom1/gorrillazz-chain/events"
 	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/Siasom1/gorrillazz-chain/modules/webhooks"
+	"github.com/Siasom1/gorrillazz-chain/p2p"
 	"github.com/Siasom1/gorrillazz-chain/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Node is de “container” voor alles:
@@ -18,11 +28,16 @@ import (
 type Node struct {
 	Config *Config
 
-	Chain  *blockchain.Blockchain
-	Logger *log.Logger
-	Bus    *events.EventBus
+	Chain    *blockchain.Blockchain
+	Logger   *log.Logger
+	Bus      *events.EventBus
+	EventLog *events.EventLog
+	Webhooks *webhooks.Manager
 
+	Engine   *poa.Engine // nil bij BFT
+	BFT      *bft.Engine // nil bij PoA
 	Producer *producer.BlockProducer
+	P2P      *p2p.Server
 	RPC      *rpc.Server
 
 	stopChan chan struct{}
@@ -32,38 +47,193 @@ type Node struct {
 func NewNode(cfg *Config) (*Node, error) {
 	logger := log.NewLogger(cfg.LogLevel)
 
-	// Shared event bus
+	// Shared event bus + durable event log (cursor replay voor consumers)
 	bus := events.NewEventBus()
 
+	eventLog, err := events.OpenEventLog(filepath.Join(cfg.DataDir, "events"), cfg.EventRetention)
+	if err != nil {
+		return nil, fmt.Errorf("init event log: %w", err)
+	}
+	bus.AttachLog(eventLog)
+
+	// Merchant webhooks: lezen intent events uit het event log
+	hooks, err := webhooks.Open(filepath.Join(cfg.DataDir, "webhooks"), bus, eventLog, webhooks.DefaultConfig(), logger)
+	if err != nil {
+		return nil, fmt.Errorf("init webhooks: %w", err)
+	}
+
 	// Blockchain
 	chain, err := blockchain.NewBlockchain(cfg.DataDir, cfg.NetworkID)
 	if err != nil {
 		return nil, fmt.Errorf("init blockchain: %w", err)
 	}
 
+	key, err := loadValidatorKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := producer.ParseMode(cfg.DevMode)
+	if err != nil {
+		return nil, err
+	}
+
 	// Block producer
-	chain.Events = bus
+	chain.SetEventBus(bus)
 	prod := producer.NewBlockProducer(
 		chain,
 		logger,
 		uint64(cfg.BlockTime),
 		bus,
 	)
+	prod.SetMode(mode, cfg.SkipEmpty)
+	if cfg.ChainConfig != nil {
+		if err := cfg.ChainConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("chain config: %w", err)
+		}
+		prod.SetChainConfig(cfg.ChainConfig)
+	}
+
+	// Gedeelde chain clock (dev: evm_increaseTime / evm_setNextBlockTimestamp)
+	clk := clock.New()
+	prod.SetClock(clk)
+	chain.Payment.SetClock(clk)
+
+	// Consensus engine: Blockchain weigert vanaf nu ongetekende / foute blocks
+	var (
+		engine    *poa.Engine
+		bftEngine *bft.Engine
+	)
+	switch cfg.Consensus {
+	case "", "poa":
+		engine, err = newEngine(cfg, chain, key)
+		if err != nil {
+			return nil, fmt.Errorf("init poa: %w", err)
+		}
+		engine.SetClock(clk)
+		chain.SetEngine(engine)
+		prod.SetEngine(engine)
+	case "bft":
+		if mode != producer.ModeInterval {
+			return nil, fmt.Errorf("dev mode %s requires poa consensus", mode)
+		}
+		bftEngine, err = newBFT(cfg, chain, key, logger)
+		if err != nil {
+			return nil, fmt.Errorf("init bft: %w", err)
+		}
+		chain.SetEngine(bftEngine)
+		bftEngine.SetBackend(prod)
+		bftEngine.SetEventBus(bus)
+	default:
+		return nil, fmt.Errorf("unknown consensus %q (poa|bft)", cfg.Consensus)
+	}
+
+	// P2P: handshake (chain id + genesis) en gossip van blocks/txs
+	p2pServer, err := p2p.NewServer(p2p.Config{
+		ListenAddr:  cfg.P2PListen,
+		StaticPeers: cfg.StaticPeers,
+		BootNodes:   cfg.BootNodes,
+		MaxPeers:    cfg.MaxPeers,
+	}, chain, prod, bus, logger)
+	if err != nil {
+		return nil, fmt.Errorf("init p2p: %w", err)
+	}
+	prod.SetSyncer(p2pServer)
+	if bftEngine != nil {
+		bftEngine.SetBroadcaster(p2pServer)
+		p2pServer.SetConsensus(bftEngine)
+	}
 
 	// RPC server
 	rpcServer := rpc.NewServer(chain, bus)
+	rpcServer.SetEngine(engine)
+	rpcServer.SetBFT(bftEngine)
+	rpcServer.SetP2P(p2pServer)
+	rpcServer.SetWebhooks(hooks)
+	rpcServer.SetStateLock(prod)
+	if cfg.ChainConfig != nil {
+		rpcServer.SetChainConfig(cfg.ChainConfig)
+	}
+	// evm_* alleen in instamine/manual: in interval mode is dit een
+	// gewone validator
+	if engine != nil && cfg.Mine && mode != producer.ModeInterval {
+		rpcServer.SetProducer(prod)
+	}
 
 	return &Node{
 		Config:   cfg,
 		Chain:    chain,
 		Logger:   logger,
 		Bus:      bus,
+		EventLog: eventLog,
+		Webhooks: hooks,
+		Engine:   engine,
+		BFT:      bftEngine,
 		Producer: prod,
+		P2P:      p2pServer,
 		RPC:      rpcServer,
 		stopChan: make(chan struct{}),
 	}, nil
 }
 
+// validators: zonder configuratie is de admin wallet de enige validator.
+func validators(cfg *Config, chain *blockchain.Blockchain) []common.Address {
+	if len(cfg.Validators) == 0 {
+		return []common.Address{chain.AdminAddr}
+	}
+	return cfg.Validators
+}
+
+// loadValidatorKey: de key uit -validator.key, anders de admin key (DEV).
+func loadValidatorKey(cfg *Config) (*ecdsa.PrivateKey, error) {
+	var (
+		key *ecdsa.PrivateKey
+		err error
+	)
+	if cfg.ValidatorKey != "" {
+		key, err = crypto.LoadECDSA(cfg.ValidatorKey)
+	} else {
+		key, err = blockchain.AdminKey(cfg.DataDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load validator key: %w", err)
+	}
+	return key, nil
+}
+
+// newEngine bouwt de PoA engine. In instamine/manual mode wordt er niet
+// op de block time gewacht: de minimale afstand is dan 1 seconde.
+func newEngine(cfg *Config, chain *blockchain.Blockchain, key *ecdsa.PrivateKey) (*poa.Engine, error) {
+	period := uint64(cfg.BlockTime)
+	if mode, _ := producer.ParseMode(cfg.DevMode); mode != producer.ModeInterval {
+		period = 1
+	}
+
+	engine, err := poa.New(poa.Config{
+		Period:       period,
+		Validators:   validators(cfg, chain),
+		SnapshotPath: filepath.Join(chain.DataDir(), "poa_snapshot.json"),
+	}, chain.Head().Header)
+	if err != nil {
+		return nil, err
+	}
+	engine.Authorize(key)
+
+	return engine, nil
+}
+
+// newBFT bouwt de Tendermint-stijl engine voor een vaste committee.
+func newBFT(cfg *Config, chain *blockchain.Blockchain, key *ecdsa.PrivateKey, logger *log.Logger) (*bft.Engine, error) {
+	blockTime := time.Duration(cfg.BlockTime) * time.Second
+	engine, err := bft.New(bft.DefaultConfig(validators(cfg, chain), blockTime), chain, logger)
+	if err != nil {
+		return nil, err
+	}
+	engine.Authorize(key)
+
+	return engine, nil
+}
+
 // Start start de RPC-server + block producer
 func (n *Node) Start() error {
 	n.Logger.Info("Starting Gorrillazz Node...")
@@ -71,8 +241,28 @@ func (n *Node) Start() error {
 	// Start RPC in een goroutine
 	go rpc.StartRPCServer(n.Config.RPCPort, n.RPC)
 
-	// Start block producer
-	n.Producer.Start()
+	// Webhook deliveries
+	n.Webhooks.Start()
+
+	// Start p2p
+	if err := n.P2P.Start(); err != nil {
+		return err
+	}
+
+	// BFT: blocks komen uit de consensus rondes, niet uit de timer producer.
+	// Niet-validators volgen via gossip/sync.
+	if n.BFT != nil {
+		if n.BFT.IsValidator() {
+			if err := n.BFT.Start(); err != nil {
+				return err
+			}
+		} else {
+			n.Logger.Info("BFT: not a validator, following the chain only")
+		}
+	} else if n.Config.Mine {
+		// Start block producer (alleen als deze node mag minen)
+		n.Producer.Start()
+	}
 
 	n.Logger.Info("Node started successfully.")
 	return nil
@@ -83,9 +273,25 @@ func (n *Node) Stop() {
 	n.Logger.Info("Stopping node...")
 	close(n.stopChan)
 
-	if n.Producer != nil {
+	if n.BFT != nil {
+		if n.BFT.IsValidator() {
+			n.BFT.Stop()
+		}
+	} else if n.Producer != nil && n.Config.Mine {
 		n.Producer.Stop()
 	}
 
+	if n.P2P != nil {
+		n.P2P.Stop()
+	}
+
+	if n.Webhooks != nil {
+		n.Webhooks.Close()
+	}
+
+	if n.EventLog != nil {
+		n.EventLog.Close()
+	}
+
 	n.Logger.Info("Node stopped.")
 }
@@ -0,0 +1,200 @@
+package node
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// freePort: een poort op 127.0.0.1 die net vrij was, zodat de static peers
+// vooraf bekend zijn.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// bftNodes bouwt een committee van n validators; alleen de nodes waarvoor
+// online(i) true is worden gestart. Ze bellen elkaar via loopback.
+func bftNodes(t *testing.T, n int, online func(i int) bool) ([]*Node, []common.Address) {
+	t.Helper()
+	keys := make([]*ecdsa.PrivateKey, n)
+	addrs := make([]common.Address, n)
+	listen := make([]string, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], addrs[i], listen[i] = key, crypto.PubkeyToAddress(key.PublicKey), freePort(t)
+	}
+
+	nodes := make([]*Node, n)
+	for i := range nodes {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "validator.key")
+		if err := crypto.SaveECDSA(keyFile, keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig()
+		cfg.DataDir = dir
+		cfg.RPCPort = 0
+		cfg.LogLevel = "error"
+		cfg.BlockTime = 1
+		cfg.Consensus = "bft"
+		cfg.Validators = addrs
+		cfg.ValidatorKey = keyFile
+		cfg.P2PListen = listen[i]
+		for j := range listen {
+			if j != i {
+				cfg.StaticPeers = append(cfg.StaticPeers, listen[j])
+			}
+		}
+
+		node, err := NewNode(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = node
+		t.Cleanup(func() { node.Chain.State.Close() })
+		if !online(i) {
+			t.Cleanup(func() { node.Webhooks.Close(); node.EventLog.Close() })
+			continue
+		}
+		if err := node.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(node.Stop)
+	}
+	return nodes, addrs
+}
+
+// checkCertificate: het block heeft een geldig 2f+1 certificaat.
+func checkCertificate(t *testing.T, n *Node, block *types.Block) {
+	t.Helper()
+	cert := block.Certificate
+	if cert == nil {
+		t.Fatalf("block #%d has no certificate", block.Header.Number)
+	}
+	if len(cert.Signatures) < 3 {
+		t.Fatalf("block #%d: %d precommits, want at least 3 of 4", block.Header.Number, len(cert.Signatures))
+	}
+	if err := n.BFT.VerifyCertificate(block); err != nil {
+		t.Fatalf("block #%d: %v", block.Header.Number, err)
+	}
+}
+
+func TestBFTCommitsWithCertificate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts four validators")
+	}
+	nodes, _ := bftNodes(t, 4, func(int) bool { return true })
+	waitForHeight(t, nodes, 2, 20*time.Second)
+
+	// Alle nodes hebben hetzelfde block #1 met een geldig certificaat
+	want, err := nodes[0].Chain.LoadBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range nodes {
+		block, err := n.Chain.LoadBlock(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Hash() != want.Hash() {
+			t.Fatalf("node %d: block #1 %s, want %s", i, block.Hash().Hex(), want.Hash().Hex())
+		}
+		checkCertificate(t, n, block)
+	}
+
+	// gorr_getFinalizedBlock geeft het opgeslagen certificaat
+	for _, param := range []interface{}{"0x1", "latest"} {
+		var res struct {
+			Number      uint64             `json:"number"`
+			Hash        common.Hash        `json:"hash"`
+			Certificate *types.Certificate `json:"certificate"`
+		}
+		if err := json.Unmarshal(rpcCall(t, nodes[1], "gorr_getFinalizedBlock", param), &res); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := nodes[1].Chain.LoadBlock(res.Number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Hash != stored.Hash() || res.Certificate == nil {
+			t.Fatalf("%v: block #%d %s, want %s with a certificate", param, res.Number, res.Hash.Hex(), stored.Hash().Hex())
+		}
+		got, _ := json.Marshal(res.Certificate)
+		exp, _ := json.Marshal(stored.Certificate)
+		if string(got) != string(exp) {
+			t.Fatalf("%v: certificate %s, want %s", param, got, exp)
+		}
+		if param == "0x1" && res.Number != 1 {
+			t.Fatalf("got block #%d, want #1", res.Number)
+		}
+	}
+}
+
+func TestBFTRoundTimeoutWithProposerOffline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts three validators")
+	}
+	// Committee van 4 waarvan er één offline blijft. De andere 3 zijn nog
+	// 2f+1: op zijn height loopt round 0 af en commit een latere round.
+	all, addrs := bftNodes(t, 4, func(i int) bool { return i != 0 })
+	nodes, offline := all[1:], addrs[0]
+
+	// De height waarop offline in round 0 aan de beurt is
+	validators := nodes[0].BFT.Validators()
+	var height uint64
+	for h := uint64(1); h <= uint64(len(validators)); h++ {
+		if validators[h%uint64(len(validators))] == offline {
+			height = h
+			break
+		}
+	}
+	if height == 0 {
+		t.Fatal("offline validator never proposes")
+	}
+	waitForHeight(t, nodes, height, 40*time.Second)
+
+	block, err := nodes[0].Chain.LoadBlock(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCertificate(t, nodes[0], block)
+	if block.Certificate.Round == 0 {
+		t.Fatalf("block #%d committed in round 0, want a round timeout first", height)
+	}
+	for _, cs := range block.Certificate.Signatures {
+		if cs.Validator == offline {
+			t.Fatalf("certificate of #%d contains the offline validator", height)
+		}
+	}
+	proposer, err := recoverSigner(block.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposer == offline {
+		t.Fatalf("block #%d proposed by the offline validator", height)
+	}
+}
+
+func recoverSigner(header *types.Header) (common.Address, error) {
+	pub, err := crypto.SigToPub(header.SealHash().Bytes(), header.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
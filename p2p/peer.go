@@ -0,0 +1,306 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	peerSendQueue = 256
+	knownCacheCap = 4096
+
+	handshakeTimeout = 5 * time.Second
+	writeTimeout     = 10 * time.Second
+
+	// Frames: 4 bytes lengte (big-endian) + JSON. Een groter frame
+	// verbreekt de verbinding vóórdat er iets gealloceerd wordt; vóór de
+	// handshake is alleen een status bericht toegestaan.
+	frameHeaderSize = 4
+	maxMsgSize      = 16 << 20
+	maxStatusSize   = 4 << 10
+)
+
+var (
+	errPeerClosed     = errors.New("peer closed")
+	errRequestTimeout = errors.New("request timeout")
+	errMsgTooLarge    = errors.New("message too large")
+)
+
+// ----------------------------------------------------------------
+// knownCache: begrensde set van hashes (FIFO eviction) voor dedup
+// ----------------------------------------------------------------
+
+type knownCache struct {
+	mu    sync.Mutex
+	set   map[common.Hash]struct{}
+	order []common.Hash
+	cap   int
+}
+
+func newKnownCache(cap int) *knownCache {
+	return &knownCache{set: make(map[common.Hash]struct{}, cap), cap: cap}
+}
+
+// Add geeft false als de hash al bekend was.
+func (k *knownCache) Add(h common.Hash) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.set[h]; ok {
+		return false
+	}
+	if len(k.order) >= k.cap {
+		old := k.order[0]
+		k.order = k.order[1:]
+		delete(k.set, old)
+	}
+	k.set[h] = struct{}{}
+	k.order = append(k.order, h)
+	return true
+}
+
+func (k *knownCache) Has(h common.Hash) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.set[h]
+	return ok
+}
+
+// ----------------------------------------------------------------
+// Peer
+// ----------------------------------------------------------------
+
+type Peer struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	inbound bool
+
+	// Gezet na de handshake
+	status Status
+	// Adres waarop de peer te bereiken is (dial addr of geadverteerd)
+	addr string
+
+	knownBlocks *knownCache
+	knownTxs    *knownCache
+	knownMsgs   *knownCache // consensus berichten
+
+	// Hoogste block number dat we van deze peer kennen (status + gossip)
+	head atomic.Uint64
+
+	// Openstaande requests (sync) → response channel
+	reqMu   sync.Mutex
+	nextReq uint64
+	pending map[uint64]chan *Msg
+
+	send chan *Msg
+	done chan struct{}
+	once sync.Once
+}
+
+func newPeer(conn net.Conn, inbound bool) *Peer {
+	return &Peer{
+		conn:        conn,
+		r:           bufio.NewReader(conn),
+		inbound:     inbound,
+		knownBlocks: newKnownCache(knownCacheCap),
+		knownTxs:    newKnownCache(knownCacheCap),
+		knownMsgs:   newKnownCache(knownCacheCap),
+		pending:     map[uint64]chan *Msg{},
+		send:        make(chan *Msg, peerSendQueue),
+		done:        make(chan struct{}),
+	}
+}
+
+func (p *Peer) ID() string         { return p.status.NodeID }
+func (p *Peer) Addr() string       { return p.addr }
+func (p *Peer) Status() Status     { return p.status }
+func (p *Peer) RemoteAddr() string { return p.conn.RemoteAddr().String() }
+func (p *Peer) Head() uint64       { return p.head.Load() }
+
+// setHead verhoogt de bekende head van de peer (nooit omlaag).
+func (p *Peer) setHead(number uint64) {
+	for {
+		cur := p.head.Load()
+		if number <= cur || p.head.CompareAndSwap(cur, number) {
+			return
+		}
+	}
+}
+
+// handshake: status versturen en die van de peer lezen.
+func (p *Peer) handshake(ours Status) (Status, error) {
+	_ = p.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer p.conn.SetDeadline(time.Time{})
+
+	msg, err := encodeMsg(MsgStatus, ours)
+	if err != nil {
+		return Status{}, err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.writeMsg(msg) }()
+
+	in, err := p.readFrame(maxStatusSize)
+	if err != nil {
+		return Status{}, err
+	}
+	if err := <-errc; err != nil {
+		return Status{}, err
+	}
+	if in.Code != MsgStatus {
+		return Status{}, errors.New("expected status message")
+	}
+
+	var theirs Status
+	if err := json.Unmarshal(in.Data, &theirs); err != nil {
+		return Status{}, err
+	}
+	return theirs, nil
+}
+
+// Send zet een bericht in de queue; volle queue → bericht vervalt.
+func (p *Peer) Send(msg *Msg) error {
+	select {
+	case <-p.done:
+		return errPeerClosed
+	case p.send <- msg:
+		return nil
+	default:
+		return errors.New("peer send queue full")
+	}
+}
+
+func (p *Peer) writeLoop() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case msg := <-p.send:
+			_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := p.writeMsg(msg)
+			if errors.Is(err, errMsgTooLarge) {
+				// Ons eigen bericht: de peer zou het weigeren, niet sturen
+				continue
+			}
+			if err != nil {
+				p.Close()
+				return
+			}
+		}
+	}
+}
+
+func (p *Peer) readMsg() (*Msg, error) {
+	return p.readFrame(maxMsgSize)
+}
+
+// readFrame leest één frame van ten hoogste limit bytes.
+func (p *Peer) readFrame(limit uint32) (*Msg, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > limit {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", errMsgTooLarge, size, limit)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return nil, err
+	}
+	var msg Msg
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// writeMsg schrijft msg als één frame.
+func (p *Peer) writeMsg(msg *Msg) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMsgSize {
+		return fmt.Errorf("%w: %s of %d bytes", errMsgTooLarge, msg.Code, len(data))
+	}
+	frame := make([]byte, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[frameHeaderSize:], data)
+	_, err = p.conn.Write(frame)
+	return err
+}
+
+// request stuurt een bericht met een nieuwe ReqID en wacht op de response.
+func (p *Peer) request(code string, build func(reqID uint64) interface{}, timeout time.Duration) (*Msg, error) {
+	p.reqMu.Lock()
+	p.nextReq++
+	id := p.nextReq
+	ch := make(chan *Msg, 1)
+	p.pending[id] = ch
+	p.reqMu.Unlock()
+
+	defer func() {
+		p.reqMu.Lock()
+		delete(p.pending, id)
+		p.reqMu.Unlock()
+	}()
+
+	msg, err := encodeMsg(code, build(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Send(msg); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-timer.C:
+		return nil, errRequestTimeout
+	case <-p.done:
+		return nil, errPeerClosed
+	}
+}
+
+// deliver koppelt een response aan het openstaande request.
+func (p *Peer) deliver(msg *Msg) error {
+	var id reqIDOnly
+	if err := json.Unmarshal(msg.Data, &id); err != nil {
+		return err
+	}
+
+	p.reqMu.Lock()
+	ch, ok := p.pending[id.ReqID]
+	p.reqMu.Unlock()
+	if !ok {
+		return errors.New("unsolicited response")
+	}
+
+	select {
+	case ch <- msg:
+	default:
+	}
+	return nil
+}
+
+func (p *Peer) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.conn.Close()
+	})
+}
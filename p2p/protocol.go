@@ -0,0 +1,117 @@
+package p2p
+
+import (
+	"encoding/json"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ----------------------------------------------------------------
+// Wire protocol: JSON berichten in frames met lengte prefix over TCP
+// ----------------------------------------------------------------
+//
+// Elk frame is 4 bytes lengte (big-endian) gevolgd door de JSON van een
+// Msg, ten hoogste maxMsgSize bytes (peer.go). Versie 1 was
+// newline-delimited JSON zonder limiet.
+
+const ProtocolVersion = 2
+
+// Message codes
+const (
+	MsgStatus   = "status"   // handshake (eerste bericht, beide kanten)
+	MsgNewBlock = "newBlock" // gossip: nieuw block
+	MsgTx       = "tx"       // gossip: pending tx
+	MsgGetPeers = "getPeers" // peer exchange: vraag naar bekende peers
+	MsgPeers    = "peers"    // peer exchange: lijst listen-adressen
+
+	// Sync (request/response, gekoppeld via ReqID)
+	MsgGetHeaders = "getHeaders"
+	MsgHeaders    = "headers"
+	MsgGetBodies  = "getBodies"
+	MsgBodies     = "bodies"
+
+	// Consensus berichten (consensus/bft), geflood met dedup
+	MsgConsensus = "consensus"
+)
+
+// Maximaal aantal headers/bodies per response. Bodies stoppen ook zodra
+// de response softResponseLimit bytes aan txs heeft (minstens één body),
+// zodat hij ruim onder maxMsgSize blijft.
+const (
+	maxHeadersServe   = 256
+	maxBodiesServe    = 128
+	softResponseLimit = 2 << 20
+)
+
+// Msg is de envelope van elk bericht.
+type Msg struct {
+	Code string          `json:"code"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Status wordt bij de handshake uitgewisseld. ChainID + Genesis moeten
+// gelijk zijn, anders wordt de verbinding verbroken.
+type Status struct {
+	Version    uint64      `json:"version"`
+	ChainID    uint64      `json:"chainId"`
+	Genesis    common.Hash `json:"genesis"`
+	HeadNumber uint64      `json:"headNumber"`
+	HeadHash   common.Hash `json:"headHash"`
+	NodeID     string      `json:"nodeId"`
+	ListenAddr string      `json:"listenAddr,omitempty"` // "" = accepteert geen inbound
+}
+
+type NewBlockMsg struct {
+	Block *types.Block `json:"block"`
+}
+
+type TxMsg struct {
+	Tx *types.Transaction `json:"tx"`
+}
+
+type PeersMsg struct {
+	Addrs []string `json:"addrs"`
+}
+
+func encodeMsg(code string, data interface{}) (*Msg, error) {
+	if data == nil {
+		return &Msg{Code: code}, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Msg{Code: code, Data: raw}, nil
+}
+
+// GetHeadersMsg vraagt Count headers vanaf block From (oplopend).
+type GetHeadersMsg struct {
+	ReqID uint64 `json:"reqId"`
+	From  uint64 `json:"from"`
+	Count uint64 `json:"count"`
+}
+
+type HeadersMsg struct {
+	ReqID   uint64          `json:"reqId"`
+	Headers []*types.Header `json:"headers"`
+}
+
+// GetBodiesMsg vraagt de transacties van de blocks met deze nummers.
+type GetBodiesMsg struct {
+	ReqID   uint64   `json:"reqId"`
+	Numbers []uint64 `json:"numbers"`
+}
+
+type BodiesMsg struct {
+	ReqID  uint64                 `json:"reqId"`
+	Bodies [][]*types.Transaction `json:"bodies"`
+
+	// Finality certificaten (BFT), zelfde volgorde als Bodies
+	Certificates []*types.Certificate `json:"certificates,omitempty"`
+}
+
+// reqIDOnly leest alleen de ReqID uit een response.
+type reqIDOnly struct {
+	ReqID uint64 `json:"reqId"`
+}
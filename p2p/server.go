@@ -0,0 +1,710 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/txpool"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	defaultMaxPeers = 25
+	redialInterval  = 5 * time.Second
+	dialTimeout     = 5 * time.Second
+)
+
+// Config van de p2p laag.
+type Config struct {
+	// ListenAddr, bv ":30303". Leeg = geen inbound verbindingen.
+	ListenAddr string
+
+	// StaticPeers worden altijd (opnieuw) gebeld.
+	StaticPeers []string
+
+	// BootNodes worden gebeld zolang we geen peers hebben; via peer
+	// exchange (getPeers) vinden we daarna de rest van het netwerk.
+	BootNodes []string
+
+	MaxPeers int
+}
+
+// ConsensusHandler verwerkt consensus berichten van peers (consensus/bft).
+type ConsensusHandler interface {
+	HandleMessage(data []byte) error
+}
+
+// BlockImporter voert een block van een peer uit en zet het als head
+// (consensus/producer.BlockProducer).
+type BlockImporter interface {
+	ImportBlock(block *types.Block) error
+}
+
+type Server struct {
+	cfg       Config
+	chain     *blockchain.Blockchain
+	pool      *txpool.TxPool
+	bus       *events.EventBus
+	logger    *log.Logger
+	importer  BlockImporter
+	consensus ConsensusHandler
+
+	nodeID  string
+	genesis common.Hash
+
+	listener net.Listener
+
+	mu      sync.RWMutex
+	peers   map[string]*Peer // nodeID → peer
+	dialing map[string]bool  // addr → bezig
+	learned map[string]bool  // via peer exchange geleerde addrs
+
+	seenBlocks *knownCache
+	seenTxs    *knownCache
+	seenMsgs   *knownCache
+
+	sync *syncer
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewServer(cfg Config, chain *blockchain.Blockchain, importer BlockImporter, bus *events.EventBus, logger *log.Logger) (*Server, error) {
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = defaultMaxPeers
+	}
+
+	genesis, err := chain.LoadBlock(0)
+	if err != nil {
+		return nil, fmt.Errorf("load genesis: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		cfg:        cfg,
+		chain:      chain,
+		pool:       chain.TxPool,
+		bus:        bus,
+		logger:     logger,
+		importer:   importer,
+		nodeID:     hex.EncodeToString(id),
+		genesis:    genesis.Hash(),
+		peers:      map[string]*Peer{},
+		dialing:    map[string]bool{},
+		learned:    map[string]bool{},
+		seenBlocks: newKnownCache(knownCacheCap),
+		seenTxs:    newKnownCache(knownCacheCap),
+		seenMsgs:   newKnownCache(knownCacheCap),
+		sync:       newSyncer(),
+		quit:       make(chan struct{}),
+	}, nil
+}
+
+// SetConsensus laat consensus berichten van peers door naar h.
+func (s *Server) SetConsensus(h ConsensusHandler) {
+	s.consensus = h
+}
+
+func (s *Server) NodeID() string       { return s.nodeID }
+func (s *Server) Genesis() common.Hash { return s.genesis }
+
+// ----------------------------------------------------------------
+// Start / Stop
+// ----------------------------------------------------------------
+
+func (s *Server) Start() error {
+	if s.cfg.ListenAddr != "" {
+		ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+		if err != nil {
+			return fmt.Errorf("p2p listen: %w", err)
+		}
+		s.listener = ln
+		s.logger.Info(fmt.Sprintf("[P2P] Listening on %s (node %s)", ln.Addr(), s.nodeID[:8]))
+
+		s.wg.Add(1)
+		go s.acceptLoop()
+	}
+
+	// Lokale blocks + pending txs doorgeven aan peers
+	sub := s.bus.Subscribe(1024, events.DropOldest, events.TopicBlock, events.TopicTx)
+	s.wg.Add(1)
+	go s.gossipLoop(sub)
+
+	s.wg.Add(1)
+	go s.dialLoop()
+
+	s.wg.Add(1)
+	go s.syncLoop()
+
+	return nil
+}
+
+func (s *Server) Stop() {
+	close(s.quit)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	s.mu.Lock()
+	for _, p := range s.peers {
+		p.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Peers geeft een snapshot van de verbonden peers.
+func (s *Server) Peers() []*Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID() < out[j].ID() })
+	return out
+}
+
+func (s *Server) PeerCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.peers)
+}
+
+// Networked: de node deelt blocks met andere nodes (listen adres, static
+// peers of bootnodes geconfigureerd), ook als er nu geen peer verbonden is.
+func (s *Server) Networked() bool {
+	return s.cfg.ListenAddr != "" || len(s.cfg.StaticPeers) > 0 || len(s.cfg.BootNodes) > 0
+}
+
+// ----------------------------------------------------------------
+// Verbindingen
+// ----------------------------------------------------------------
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.logger.Error(fmt.Sprintf("[P2P] accept: %v", err))
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if s.PeerCount() >= s.cfg.MaxPeers {
+			conn.Close()
+			continue
+		}
+		go s.setupConn(conn, true, "")
+	}
+}
+
+func (s *Server) dialLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(redialInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dialPeers()
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// dialPeers: static peers altijd, bootnodes + geleerde addrs zolang er
+// ruimte is.
+func (s *Server) dialPeers() {
+	targets := append([]string{}, s.cfg.StaticPeers...)
+
+	s.mu.RLock()
+	free := s.cfg.MaxPeers - len(s.peers)
+	if len(s.peers) == 0 {
+		targets = append(targets, s.cfg.BootNodes...)
+	}
+	for addr := range s.learned {
+		targets = append(targets, addr)
+	}
+	s.mu.RUnlock()
+
+	for _, addr := range targets {
+		if free <= 0 {
+			return
+		}
+		if s.startDial(addr) {
+			free--
+		}
+	}
+}
+
+// startDial belt addr als we er nog niet mee verbonden zijn of bellen.
+func (s *Server) startDial(addr string) bool {
+	if addr == "" || s.isSelf(addr) {
+		return false
+	}
+
+	s.mu.Lock()
+	if s.dialing[addr] {
+		s.mu.Unlock()
+		return false
+	}
+	for _, p := range s.peers {
+		if p.addr == addr {
+			s.mu.Unlock()
+			return false
+		}
+	}
+	s.dialing[addr] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.dialing, addr)
+			s.mu.Unlock()
+		}()
+
+		conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+		if err != nil {
+			s.logger.Debug(fmt.Sprintf("[P2P] dial %s: %v", addr, err))
+			return
+		}
+		s.setupConn(conn, false, addr)
+	}()
+	return true
+}
+
+func (s *Server) isSelf(addr string) bool {
+	if s.listener == nil {
+		return false
+	}
+	return addr == s.advertisedAddr(nil)
+}
+
+// advertisedAddr: listen-adres zoals peers het kunnen bellen. Zonder host
+// (":30303") nemen we het lokale IP van de verbinding.
+func (s *Server) advertisedAddr(conn net.Conn) string {
+	if s.listener == nil {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		return ""
+	}
+	host, _, _ := net.SplitHostPort(s.cfg.ListenAddr)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+		if conn != nil {
+			if h, _, err := net.SplitHostPort(conn.LocalAddr().String()); err == nil {
+				host = h
+			}
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (s *Server) localStatus(conn net.Conn) Status {
+	head := s.chain.Head()
+	return Status{
+		Version:    ProtocolVersion,
+		ChainID:    s.chain.NetworkID(),
+		Genesis:    s.genesis,
+		HeadNumber: head.Header.Number,
+		HeadHash:   head.Hash(),
+		NodeID:     s.nodeID,
+		ListenAddr: s.advertisedAddr(conn),
+	}
+}
+
+// setupConn doet de handshake en registreert de peer.
+func (s *Server) setupConn(conn net.Conn, inbound bool, dialAddr string) {
+	p := newPeer(conn, inbound)
+
+	theirs, err := p.handshake(s.localStatus(conn))
+	if err != nil {
+		s.logger.Debug(fmt.Sprintf("[P2P] handshake with %s failed: %v", conn.RemoteAddr(), err))
+		p.Close()
+		return
+	}
+	if err := s.checkStatus(theirs); err != nil {
+		s.logger.Info(fmt.Sprintf("[P2P] rejecting %s: %v", conn.RemoteAddr(), err))
+		p.Close()
+		return
+	}
+
+	p.status = theirs
+	p.setHead(theirs.HeadNumber)
+	p.addr = dialAddr
+	if p.addr == "" {
+		p.addr = theirs.ListenAddr
+	}
+
+	if err := s.addPeer(p); err != nil {
+		s.logger.Debug(fmt.Sprintf("[P2P] %s: %v", conn.RemoteAddr(), err))
+		p.Close()
+		return
+	}
+
+	s.logger.Info(fmt.Sprintf("[P2P] peer %s connected (%s, head #%d)", p.ID()[:8], p.RemoteAddr(), theirs.HeadNumber))
+
+	go p.writeLoop()
+
+	// Peer exchange: vraag om meer peers
+	if msg, err := encodeMsg(MsgGetPeers, nil); err == nil {
+		_ = p.Send(msg)
+	}
+
+	// Peer is verder dan wij → inhalen
+	if theirs.HeadNumber > s.chain.Head().Header.Number {
+		s.requestSync()
+	}
+
+	s.readLoop(p)
+}
+
+func (s *Server) checkStatus(st Status) error {
+	if st.Version != ProtocolVersion {
+		return fmt.Errorf("protocol version mismatch: %d != %d", st.Version, ProtocolVersion)
+	}
+	if st.ChainID != s.chain.NetworkID() {
+		return fmt.Errorf("chain id mismatch: %d != %d", st.ChainID, s.chain.NetworkID())
+	}
+	if st.Genesis != s.genesis {
+		return fmt.Errorf("genesis mismatch: %s != %s", st.Genesis.Hex(), s.genesis.Hex())
+	}
+	// Logs en peer map gaan uit van ons eigen formaat (16 bytes hex)
+	if _, err := hex.DecodeString(st.NodeID); err != nil || len(st.NodeID) != 32 {
+		return fmt.Errorf("invalid node id %q", st.NodeID)
+	}
+	if st.NodeID == s.nodeID {
+		return errors.New("connected to self")
+	}
+	return nil
+}
+
+func (s *Server) addPeer(p *Peer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.peers[p.ID()]; ok {
+		return errors.New("already connected")
+	}
+	if len(s.peers) >= s.cfg.MaxPeers {
+		return errors.New("too many peers")
+	}
+	s.peers[p.ID()] = p
+	if p.addr != "" {
+		delete(s.learned, p.addr)
+	}
+	return nil
+}
+
+func (s *Server) removePeer(p *Peer) {
+	s.mu.Lock()
+	if cur, ok := s.peers[p.ID()]; ok && cur == p {
+		delete(s.peers, p.ID())
+	}
+	s.mu.Unlock()
+
+	p.Close()
+	s.logger.Info(fmt.Sprintf("[P2P] peer %s disconnected", p.ID()[:8]))
+}
+
+// ----------------------------------------------------------------
+// Berichten van peers
+// ----------------------------------------------------------------
+
+func (s *Server) readLoop(p *Peer) {
+	defer s.removePeer(p)
+
+	for {
+		msg, err := p.readMsg()
+		if err != nil {
+			return
+		}
+		if err := s.handleMsg(p, msg); err != nil {
+			s.logger.Debug(fmt.Sprintf("[P2P] peer %s: %s: %v", p.ID()[:8], msg.Code, err))
+		}
+	}
+}
+
+func (s *Server) handleMsg(p *Peer, msg *Msg) error {
+	switch msg.Code {
+	case MsgNewBlock:
+		var m NewBlockMsg
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			return err
+		}
+		return s.handleBlock(p, m.Block)
+
+	case MsgTx:
+		var m TxMsg
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			return err
+		}
+		return s.handleTx(p, m.Tx)
+
+	case MsgGetHeaders:
+		var m GetHeadersMsg
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			return err
+		}
+		return s.serveHeaders(p, m)
+
+	case MsgGetBodies:
+		var m GetBodiesMsg
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			return err
+		}
+		return s.serveBodies(p, m)
+
+	case MsgHeaders, MsgBodies:
+		return p.deliver(msg)
+
+	case MsgConsensus:
+		return s.handleConsensus(p, msg.Data)
+
+	case MsgGetPeers:
+		out, err := encodeMsg(MsgPeers, PeersMsg{Addrs: s.peerAddrs(p)})
+		if err != nil {
+			return err
+		}
+		return p.Send(out)
+
+	case MsgPeers:
+		var m PeersMsg
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			return err
+		}
+		s.learn(m.Addrs)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown message code %q", msg.Code)
+	}
+}
+
+func (s *Server) handleBlock(p *Peer, block *types.Block) error {
+	if block == nil || block.Header == nil {
+		return errors.New("empty block")
+	}
+	hash := block.Hash()
+	p.knownBlocks.Add(hash)
+	p.setHead(block.Header.Number)
+
+	// Dedup: elk block maar één keer verwerken
+	if !s.seenBlocks.Add(hash) {
+		return nil
+	}
+
+	// Tijdens sync importeert de syncer; gossip pas daarna weer
+	if s.Syncing() {
+		return nil
+	}
+
+	head := s.chain.Head()
+	if block.Header.Number > head.Header.Number+1 {
+		// Gat → via sync inhalen
+		s.requestSync()
+		return fmt.Errorf("block #%d ahead of head #%d, syncing", block.Header.Number, head.Header.Number)
+	}
+	if block.Header.Number != head.Header.Number+1 {
+		// Oud block → geen gossip-import
+		return fmt.Errorf("block #%d does not extend head #%d", block.Header.Number, head.Header.Number)
+	}
+
+	// Bij succes emit de importer BlockCommitted → gossipLoop stuurt het
+	// door naar peers die het nog niet kennen.
+	if err := s.importer.ImportBlock(block); err != nil {
+		return fmt.Errorf("import block #%d: %w", block.Header.Number, err)
+	}
+	return nil
+}
+
+func (s *Server) handleTx(p *Peer, tx *types.Transaction) error {
+	if tx == nil {
+		return errors.New("empty tx")
+	}
+	hash := tx.Hash()
+	p.knownTxs.Add(hash)
+
+	if !s.seenTxs.Add(hash) {
+		return nil
+	}
+
+	// Sender nooit van de peer overnemen
+	from, err := tx.From()
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	tx.Sender = from
+
+	if tx.To == nil || *tx.To == (common.Address{}) {
+		return errors.New("missing to")
+	}
+	nonce, err := s.chain.State.GetNonce(from)
+	if err != nil {
+		return err
+	}
+
+	// Pool limieten en nonce gap: een peer kan de pool niet vullen met
+	// txs die nooit uitvoerbaar worden
+	if err := s.pool.AddWithNonce(tx, nonce); err != nil {
+		if errors.Is(err, txpool.ErrAlreadyKnown) {
+			return nil
+		}
+		return err
+	}
+
+	// Zelfde pad als eth_sendRawTransaction → TxPending → verder gossippen
+	s.bus.Emit(&events.TxPending{Hash: hash, From: from})
+	return nil
+}
+
+// peerAddrs: bereikbare adressen van onze peers (behalve de vrager).
+func (s *Server) peerAddrs(except *Peer) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := []string{}
+	for _, p := range s.peers {
+		if p == except || p.status.ListenAddr == "" {
+			continue
+		}
+		out = append(out, p.status.ListenAddr)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Server) learn(addrs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			continue
+		}
+		s.learned[addr] = true
+	}
+}
+
+// ----------------------------------------------------------------
+// Gossip
+// ----------------------------------------------------------------
+
+func (s *Server) gossipLoop(sub *events.Subscription) {
+	defer s.wg.Done()
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case ev, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			switch e := ev.Data.(type) {
+			case *events.BlockCommitted:
+				if e.Block != nil {
+					s.BroadcastBlock(e.Block)
+				}
+			case *events.TxPending:
+				if tx := s.pool.Get(e.Hash); tx != nil {
+					s.BroadcastTx(tx)
+				}
+			}
+		}
+	}
+}
+
+// BroadcastBlock stuurt block naar alle peers die het nog niet kennen.
+func (s *Server) BroadcastBlock(block *types.Block) {
+	hash := block.Hash()
+	s.seenBlocks.Add(hash)
+
+	msg, err := encodeMsg(MsgNewBlock, NewBlockMsg{Block: block})
+	if err != nil {
+		return
+	}
+	for _, p := range s.Peers() {
+		if p.knownBlocks.Add(hash) {
+			_ = p.Send(msg)
+		}
+	}
+}
+
+// BroadcastTx stuurt tx naar alle peers die hem nog niet kennen.
+func (s *Server) BroadcastTx(tx *types.Transaction) {
+	hash := tx.Hash()
+	s.seenTxs.Add(hash)
+
+	msg, err := encodeMsg(MsgTx, TxMsg{Tx: tx})
+	if err != nil {
+		return
+	}
+	for _, p := range s.Peers() {
+		if p.knownTxs.Add(hash) {
+			_ = p.Send(msg)
+		}
+	}
+}
+
+// handleConsensus: nieuw bericht → aan de engine geven en doorsturen, zodat
+// ook validators zonder directe verbinding het ontvangen.
+func (s *Server) handleConsensus(p *Peer, data []byte) error {
+	hash := crypto.Keccak256Hash(data)
+	p.knownMsgs.Add(hash)
+
+	if !s.seenMsgs.Add(hash) {
+		return nil
+	}
+	s.relayConsensus(hash, data)
+
+	if s.consensus == nil {
+		return nil
+	}
+	return s.consensus.HandleMessage(data)
+}
+
+// BroadcastConsensus verspreidt een eigen consensus bericht.
+func (s *Server) BroadcastConsensus(data []byte) {
+	hash := crypto.Keccak256Hash(data)
+	s.seenMsgs.Add(hash)
+	s.relayConsensus(hash, data)
+}
+
+func (s *Server) relayConsensus(hash common.Hash, data []byte) {
+	msg := &Msg{Code: MsgConsensus, Data: data}
+	for _, p := range s.Peers() {
+		if p.knownMsgs.Add(hash) {
+			_ = p.Send(msg)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// importer: telt de geïmporteerde blocks en meldt ze zoals de producer,
+// zodat de gossipLoop ze doorstuurt. Met chain worden ze ook head (sync).
+type importer struct {
+	bus   *events.EventBus
+	chain *blockchain.Blockchain
+
+	mu     sync.Mutex
+	blocks map[common.Hash]int
+}
+
+func (im *importer) ImportBlock(block *types.Block) error {
+	if im.chain != nil {
+		if err := im.chain.SetHead(block); err != nil {
+			return err
+		}
+	}
+	im.mu.Lock()
+	im.blocks[block.Hash()]++
+	im.mu.Unlock()
+	im.bus.Emit(&events.BlockCommitted{Number: block.Header.Number, Hash: block.Hash(), Block: block})
+	return nil
+}
+
+func (im *importer) imported(hash common.Hash) int {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.blocks[hash]
+}
+
+type testNode struct {
+	srv   *Server
+	chain *blockchain.Blockchain
+	imp   *importer
+	stop  func()
+}
+
+// startNode: node op 127.0.0.1:0 die static naar peers belt.
+func startNode(t *testing.T, networkID, genesisTime uint64, peers ...*testNode) *testNode {
+	t.Helper()
+	return startNodeWith(t, networkID, genesisTime, nil, peers...)
+}
+
+// startNodeWith: als startNode; prepare vult de chain vóór de start.
+// Met prepare zet de importer blocks ook echt als head.
+func startNodeWith(t *testing.T, networkID, genesisTime uint64, prepare func(*blockchain.Blockchain), peers ...*testNode) *testNode {
+	t.Helper()
+	cfg := blockchain.DefaultChainConfig(t.TempDir(), networkID)
+	cfg.GenesisTime = genesisTime
+	chain, err := blockchain.NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.State.Close() })
+
+	p2pCfg := Config{ListenAddr: "127.0.0.1:0"}
+	for _, p := range peers {
+		p2pCfg.StaticPeers = append(p2pCfg.StaticPeers, p.srv.listener.Addr().String())
+	}
+	imp := &importer{bus: chain.Events, blocks: map[common.Hash]int{}}
+	if prepare != nil {
+		prepare(chain)
+		imp.chain = chain
+	}
+	srv, err := NewServer(p2pCfg, chain, imp, chain.Events, log.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := sync.OnceFunc(srv.Stop)
+	t.Cleanup(stop)
+	return &testNode{srv: srv, chain: chain, imp: imp, stop: stop}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandshakeRejectsOtherChain(t *testing.T) {
+	const genesisTime = blockchain.DefaultGenesisTime
+	a := startNode(t, 9999, genesisTime)
+
+	tests := []struct {
+		name        string
+		networkID   uint64
+		genesisTime uint64
+		connect     bool
+	}{
+		{"other chain id", 1234, genesisTime, false},
+		{"other genesis", 9999, genesisTime + 1, false},
+		{"same chain", 9999, genesisTime, true},
+	}
+	for _, tt := range tests {
+		b := startNode(t, tt.networkID, tt.genesisTime, a)
+		if tt.connect {
+			waitFor(t, tt.name, func() bool { return a.srv.PeerCount() == 1 && b.srv.PeerCount() == 1 })
+			continue
+		}
+		// Een paar dial pogingen de tijd geven
+		time.Sleep(300 * time.Millisecond)
+		if n := a.srv.PeerCount() + b.srv.PeerCount(); n != 0 {
+			t.Fatalf("%s: %d peers, want the connection rejected", tt.name, n)
+		}
+		b.stop()
+	}
+}
+
+// connected: a ↔ b ↔ c ↔ a, zodat elk bericht langs twee wegen aankomt.
+func connected(t *testing.T) (a, b, c *testNode) {
+	t.Helper()
+	a = startNode(t, 9999, blockchain.DefaultGenesisTime)
+	b = startNode(t, 9999, blockchain.DefaultGenesisTime, a)
+	c = startNode(t, 9999, blockchain.DefaultGenesisTime, a, b)
+	waitFor(t, "full mesh", func() bool {
+		return a.srv.PeerCount() == 2 && b.srv.PeerCount() == 2 && c.srv.PeerCount() == 2
+	})
+	return a, b, c
+}
+
+func TestBlockGossipDedup(t *testing.T) {
+	a, b, c := connected(t)
+
+	genesis := a.chain.Head()
+	block := &types.Block{Header: &types.Header{ParentHash: genesis.Hash(), Number: 1, Time: genesis.Header.Time + 1}}
+	hash := block.Hash()
+	a.srv.BroadcastBlock(block)
+
+	// b en c krijgen het van a én van elkaar (relay na import)
+	waitFor(t, "block on b and c", func() bool { return b.imp.imported(hash) > 0 && c.imp.imported(hash) > 0 })
+	time.Sleep(200 * time.Millisecond)
+	for name, n := range map[string]*testNode{"a": a, "b": b, "c": c} {
+		want := 1
+		if n == a {
+			want = 0 // eigen block komt niet terug
+		}
+		if got := n.imp.imported(hash); got != want {
+			t.Fatalf("%s imported the block %d times, want %d", name, got, want)
+		}
+	}
+}
+
+func TestTxGossipDedup(t *testing.T) {
+	a, b, c := connected(t)
+
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0xb0b")
+	gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+		To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: new(big.Int),
+	}), gethtypes.HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.FromGeth(gtx)
+
+	subs := map[*testNode]*events.Subscription{}
+	for _, n := range []*testNode{b, c} {
+		subs[n] = n.chain.Events.Subscribe(16, events.DropOldest, events.TopicTx)
+	}
+	if err := a.chain.TxPool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	a.srv.BroadcastTx(tx)
+
+	waitFor(t, "tx on b and c", func() bool {
+		return b.chain.TxPool.Get(tx.Hash()) != nil && c.chain.TxPool.Get(tx.Hash()) != nil
+	})
+	time.Sleep(200 * time.Millisecond)
+	for n, sub := range subs {
+		if got := len(sub.C()); got != 1 {
+			t.Fatalf("%d TxPending events, want 1", got)
+		}
+		if len(n.chain.TxPool.Pending()) != 1 {
+			t.Fatalf("%d pending txs, want 1", len(n.chain.TxPool.Pending()))
+		}
+	}
+}
+
+func TestOversizedFrameDisconnects(t *testing.T) {
+	a := startNode(t, 9999, blockchain.DefaultGenesisTime)
+	addr := a.srv.listener.Addr().String()
+
+	frame := func(size uint32) []byte {
+		var hdr [frameHeaderSize]byte
+		binary.BigEndian.PutUint32(hdr[:], size)
+		return hdr[:]
+	}
+
+	// Vóór de handshake: alleen een status bericht past
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(frame(maxStatusSize + 1)); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for {
+		// Eerst komt de status van a; daarna moet de verbinding dicht
+		if _, err := conn.Read(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatal("connection still open after an oversized status frame")
+			}
+			break
+		}
+	}
+
+	// Na de handshake: frame boven maxMsgSize → peer weg
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	p := newPeer(conn2, false)
+	st := Status{
+		Version: ProtocolVersion, ChainID: 9999, Genesis: a.srv.Genesis(), NodeID: "00112233445566778899aabbccddeeff",
+	}
+	if _, err := p.handshake(st); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "peer", func() bool { return a.srv.PeerCount() == 1 })
+	if _, err := conn2.Write(frame(maxMsgSize + 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "disconnect", func() bool { return a.srv.PeerCount() == 0 })
+}
+
+func TestHandshakeRejectsBadNodeID(t *testing.T) {
+	a := startNode(t, 9999, blockchain.DefaultGenesisTime)
+	conn, err := net.Dial("tcp", a.srv.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	p := newPeer(conn, false)
+	if _, err := p.handshake(Status{Version: ProtocolVersion, ChainID: 9999, Genesis: a.srv.Genesis(), NodeID: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := p.readMsg(); err == nil {
+		t.Fatal("peer with a malformed node id was accepted")
+	}
+	if n := a.srv.PeerCount(); n != 0 {
+		t.Fatalf("%d peers, want 0", n)
+	}
+}
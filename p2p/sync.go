@@ -0,0 +1,341 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+)
+
+// ----------------------------------------------------------------
+// Block sync: inhalen van peers die verder zijn
+// ----------------------------------------------------------------
+//
+// 1. beste peer kiezen (hoogste head uit status / gossip)
+// 2. headers in batches ophalen vanaf onze head+1, keten controleren
+// 3. bodies (txs) van die headers ophalen
+// 4. elk block via de importer opnieuw uitvoeren op de lokale state
+// Zodra we bij zijn, neemt de gewone block-gossip het weer over.
+
+const (
+	syncHeaderBatch = 128
+	syncBodyBatch   = 64
+	syncReqTimeout  = 10 * time.Second
+	syncInterval    = 10 * time.Second
+)
+
+// SyncProgress zoals eth_syncing het toont.
+type SyncProgress struct {
+	StartingBlock uint64 `json:"startingBlock"`
+	CurrentBlock  uint64 `json:"currentBlock"`
+	HighestBlock  uint64 `json:"highestBlock"`
+}
+
+type syncer struct {
+	mu       sync.RWMutex
+	syncing  bool
+	progress SyncProgress
+
+	trigger chan struct{}
+}
+
+func newSyncer() *syncer {
+	return &syncer{trigger: make(chan struct{}, 1)}
+}
+
+// Syncing: is de node aan het inhalen?
+func (s *Server) Syncing() bool {
+	s.sync.mu.RLock()
+	defer s.sync.mu.RUnlock()
+	return s.sync.syncing
+}
+
+// SyncProgress geeft de voortgang; false als er niet gesynct wordt.
+func (s *Server) SyncProgress() (SyncProgress, bool) {
+	s.sync.mu.RLock()
+	defer s.sync.mu.RUnlock()
+	return s.sync.progress, s.sync.syncing
+}
+
+// requestSync laat de sync loop (zo snel mogelijk) opnieuw kijken.
+func (s *Server) requestSync() {
+	select {
+	case s.sync.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		case <-s.sync.trigger:
+		}
+		s.synchronise()
+	}
+}
+
+// bestPeer: peer met de hoogste head boven de onze.
+func (s *Server) bestPeer() *Peer {
+	local := s.chain.Head().Header.Number
+
+	var best *Peer
+	for _, p := range s.Peers() {
+		if p.Head() <= local {
+			continue
+		}
+		if best == nil || p.Head() > best.Head() {
+			best = p
+		}
+	}
+	return best
+}
+
+func (s *Server) synchronise() {
+	peer := s.bestPeer()
+	if peer == nil {
+		return
+	}
+
+	start := s.chain.Head().Header.Number
+	s.setProgress(true, SyncProgress{
+		StartingBlock: start,
+		CurrentBlock:  start,
+		HighestBlock:  peer.Head(),
+	})
+	defer s.setProgress(false, SyncProgress{})
+
+	s.logger.Info(fmt.Sprintf("[SYNC] syncing from #%d to #%d with peer %s", start, peer.Head(), peer.ID()[:8]))
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		head := s.chain.Head()
+		local := head.Header.Number
+		target := peer.Head()
+		if local >= target {
+			break
+		}
+
+		count := target - local
+		if count > syncHeaderBatch {
+			count = syncHeaderBatch
+		}
+
+		headers, err := s.fetchHeaders(peer, local+1, count)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("[SYNC] headers from %s: %v", peer.ID()[:8], err))
+			return
+		}
+		if len(headers) == 0 {
+			break
+		}
+		if err := checkHeaderChain(head, headers); err != nil {
+			// Peer zit op een andere keten (of liegt): niet meer van syncen
+			s.logger.Error(fmt.Sprintf("[SYNC] peer %s: %v", peer.ID()[:8], err))
+			peer.Close()
+			return
+		}
+
+		// Een peer kan minder bodies geven dan gevraagd (softResponseLimit);
+		// de rest komt met het volgende request
+		for i := 0; i < len(headers); {
+			end := i + syncBodyBatch
+			if end > len(headers) {
+				end = len(headers)
+			}
+			batch := headers[i:end]
+
+			bodies, certs, err := s.fetchBodies(peer, batch)
+			if err != nil {
+				s.logger.Error(fmt.Sprintf("[SYNC] bodies from %s: %v", peer.ID()[:8], err))
+				return
+			}
+			i += len(bodies)
+
+			for j, h := range batch[:len(bodies)] {
+				block := &types.Block{Header: h, Transactions: bodies[j], Certificate: certs[j]}
+				s.seenBlocks.Add(block.Hash())
+
+				// Importer verifieert (PoA) en voert het block opnieuw uit
+				if err := s.importer.ImportBlock(block); err != nil {
+					s.logger.Error(fmt.Sprintf("[SYNC] import block #%d: %v", h.Number, err))
+					peer.Close()
+					return
+				}
+				s.updateProgress(h.Number, peer.Head())
+			}
+		}
+	}
+
+	s.logger.Info(fmt.Sprintf("[SYNC] done at #%d", s.chain.Head().Header.Number))
+}
+
+func (s *Server) setProgress(syncing bool, p SyncProgress) {
+	s.sync.mu.Lock()
+	defer s.sync.mu.Unlock()
+	s.sync.syncing = syncing
+	s.sync.progress = p
+}
+
+func (s *Server) updateProgress(current, highest uint64) {
+	s.sync.mu.Lock()
+	defer s.sync.mu.Unlock()
+	s.sync.progress.CurrentBlock = current
+	if highest > s.sync.progress.HighestBlock {
+		s.sync.progress.HighestBlock = highest
+	}
+}
+
+// checkHeaderChain: headers moeten aaneengesloten op head aansluiten.
+func checkHeaderChain(head *types.Block, headers []*types.Header) error {
+	parentHash := head.Hash()
+	number := head.Header.Number
+	for _, h := range headers {
+		if h == nil {
+			return errors.New("nil header")
+		}
+		if h.Number != number+1 {
+			return fmt.Errorf("non-contiguous header #%d after #%d", h.Number, number)
+		}
+		if h.ParentHash != parentHash {
+			return fmt.Errorf("header #%d does not link to our chain", h.Number)
+		}
+		parentHash = h.Hash()
+		number = h.Number
+	}
+	return nil
+}
+
+func (s *Server) fetchHeaders(p *Peer, from, count uint64) ([]*types.Header, error) {
+	resp, err := p.request(MsgGetHeaders, func(id uint64) interface{} {
+		return GetHeadersMsg{ReqID: id, From: from, Count: count}
+	}, syncReqTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var m HeadersMsg
+	if err := json.Unmarshal(resp.Data, &m); err != nil {
+		return nil, err
+	}
+	if uint64(len(m.Headers)) > count {
+		return nil, errors.New("too many headers")
+	}
+	return m.Headers, nil
+}
+
+func (s *Server) fetchBodies(p *Peer, headers []*types.Header) ([][]*types.Transaction, []*types.Certificate, error) {
+	numbers := make([]uint64, len(headers))
+	for i, h := range headers {
+		numbers[i] = h.Number
+	}
+
+	resp, err := p.request(MsgGetBodies, func(id uint64) interface{} {
+		return GetBodiesMsg{ReqID: id, Numbers: numbers}
+	}, syncReqTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var m BodiesMsg
+	if err := json.Unmarshal(resp.Data, &m); err != nil {
+		return nil, nil, err
+	}
+	if len(m.Bodies) == 0 || len(m.Bodies) > len(headers) {
+		return nil, nil, fmt.Errorf("got %d bodies for %d headers", len(m.Bodies), len(headers))
+	}
+	if m.Certificates == nil {
+		m.Certificates = make([]*types.Certificate, len(m.Bodies))
+	}
+	if len(m.Certificates) != len(m.Bodies) {
+		return nil, nil, fmt.Errorf("got %d certificates for %d bodies", len(m.Certificates), len(m.Bodies))
+	}
+	return m.Bodies, m.Certificates, nil
+}
+
+// ----------------------------------------------------------------
+// Serveren van sync requests
+// ----------------------------------------------------------------
+
+func (s *Server) serveHeaders(p *Peer, req GetHeadersMsg) error {
+	count := req.Count
+	if count > maxHeadersServe {
+		count = maxHeadersServe
+	}
+
+	head := s.chain.Head().Header.Number
+	headers := []*types.Header{}
+	for n := req.From; n < req.From+count && n <= head; n++ {
+		b, err := s.chain.LoadBlock(n)
+		if err != nil {
+			break
+		}
+		headers = append(headers, b.Header)
+	}
+
+	msg, err := encodeMsg(MsgHeaders, HeadersMsg{ReqID: req.ReqID, Headers: headers})
+	if err != nil {
+		return err
+	}
+	return p.Send(msg)
+}
+
+func (s *Server) serveBodies(p *Peer, req GetBodiesMsg) error {
+	numbers := req.Numbers
+	if len(numbers) > maxBodiesServe {
+		numbers = numbers[:maxBodiesServe]
+	}
+
+	bodies := make([][]*types.Transaction, 0, len(numbers))
+	certs := make([]*types.Certificate, 0, len(numbers))
+	hasCerts := false
+	size := 0
+	for _, n := range numbers {
+		if size >= softResponseLimit {
+			break
+		}
+		b, err := s.chain.LoadBlock(n)
+		if err != nil {
+			// Onvolledig antwoord: de requester vraagt de rest opnieuw
+			// (of haakt af als er geen enkele body is)
+			break
+		}
+		txs := b.Transactions
+		if txs == nil {
+			txs = []*types.Transaction{}
+		}
+		raw, err := json.Marshal(txs)
+		if err != nil {
+			return err
+		}
+		size += len(raw)
+		bodies = append(bodies, txs)
+		certs = append(certs, b.Certificate)
+		hasCerts = hasCerts || b.Certificate != nil
+	}
+
+	resp := BodiesMsg{ReqID: req.ReqID, Bodies: bodies}
+	if hasCerts {
+		resp.Certificates = certs
+	}
+	msg, err := encodeMsg(MsgBodies, resp)
+	if err != nil {
+		return err
+	}
+	return p.Send(msg)
+}
@@ -0,0 +1,116 @@
+package p2p
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// extend zet n blocks op de head van chain; de eerste withData blocks
+// krijgen een tx met size bytes data.
+func extend(t *testing.T, chain *blockchain.Blockchain, n, withData, size int) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0xb0b")
+	for i := 0; i < n; i++ {
+		head := chain.Head()
+		block := &types.Block{Header: &types.Header{
+			ParentHash: head.Hash(),
+			Number:     head.Header.Number + 1,
+			Time:       head.Header.Time + 1,
+		}}
+		if i < withData {
+			gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+				Nonce: uint64(i), To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: new(big.Int),
+				Data: bytes.Repeat([]byte{byte(i)}, size),
+			}), gethtypes.HomesteadSigner{}, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.Transactions = []*types.Transaction{types.FromGeth(gtx)}
+			block.Header.TxRoot = types.DeriveTxRoot(block.Transactions)
+		}
+		if err := chain.SetHead(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncCatchesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		blocks   int
+		withData int
+		size     int
+	}{
+		// Meer dan syncHeaderBatch headers → meerdere header rondes
+		{"header batches", 2*syncHeaderBatch + 10, 0, 0},
+		// Bodies boven softResponseLimit → onvolledige antwoorden
+		{"partial bodies", 24, 24, softResponseLimit / 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := startNodeWith(t, 9999, blockchain.DefaultGenesisTime, func(c *blockchain.Blockchain) {
+				extend(t, c, tt.blocks, tt.withData, tt.size)
+			})
+			b := startNodeWith(t, 9999, blockchain.DefaultGenesisTime, func(*blockchain.Blockchain) {}, a)
+
+			want := uint64(tt.blocks)
+			deadline := time.Now().Add(20 * time.Second)
+			for b.chain.Head().Header.Number < want {
+				if time.Now().After(deadline) {
+					t.Fatalf("head #%d, want #%d", b.chain.Head().Header.Number, want)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if b.chain.Head().Hash() != a.chain.Head().Hash() {
+				t.Fatal("synced head differs from the peer")
+			}
+			for n := uint64(1); n <= uint64(tt.withData); n++ {
+				got, err := b.chain.LoadBlock(n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got.Transactions) != 1 || len(got.Transactions[0].Data) != tt.size {
+					t.Fatalf("block #%d body not synced", n)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckHeaderChain(t *testing.T) {
+	head := &types.Block{Header: &types.Header{Number: 10, Time: 100}}
+	h11 := &types.Header{ParentHash: head.Hash(), Number: 11, Time: 101}
+	h12 := &types.Header{ParentHash: h11.Hash(), Number: 12, Time: 102}
+	other := &types.Header{ParentHash: common.Hash{1}, Number: 12, Time: 102}
+	gap := &types.Header{ParentHash: h11.Hash(), Number: 13, Time: 103}
+
+	tests := []struct {
+		name    string
+		headers []*types.Header
+		ok      bool
+	}{
+		{"linked", []*types.Header{h11, h12}, true},
+		{"empty", nil, true},
+		{"gap", []*types.Header{h11, gap}, false},
+		{"other parent", []*types.Header{h11, other}, false},
+		{"not on head", []*types.Header{h12}, false},
+		{"nil header", []*types.Header{h11, nil}, false},
+	}
+	for _, tt := range tests {
+		if err := checkHeaderChain(head, tt.headers); (err == nil) != tt.ok {
+			t.Errorf("%s: err %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
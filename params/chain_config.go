@@ -1,15 +1,328 @@
 package params
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// USDCcTokenAddress: systeemadres van USDCc. Vanaf de USDCc fork is een tx
+// hiernaartoe een ERC-20 call op de native USDCc balances (core/usdcc.go).
+var USDCcTokenAddress = common.HexToAddress("0x000000000000000000000000000000000000Cc01")
+
+// MerchantRegistryAddress: systeemadres van de merchant registry. Vanaf de
+// merchants fork is een tx hiernaartoe een registry call (core/merchant.go).
+var MerchantRegistryAddress = common.HexToAddress("0x000000000000000000000000000000000000Cc02")
+
+// SubscriptionsAddress: systeemadres van de subscriptions. Vanaf de
+// subscriptions fork is een tx hiernaartoe een subscription call
+// (core/subscription.go).
+var SubscriptionsAddress = common.HexToAddress("0x000000000000000000000000000000000000Cc03")
+
 type ChainConfig struct {
 	ChainID          uint64 `json:"chainId"`
 	BlockTimeSeconds uint64 `json:"blockTimeSeconds"`
 	GasLimit         uint64 `json:"gasLimit"`
+
+	// GORR_PAY treasury fee in basispunten (250 = 2.5%) tot FeeForkBlock.
+	PaymentFeeBps uint64 `json:"paymentFeeBps"`
+
+	// ------------------------------------------------------------
+	// Forks: hoogte vanaf waar nieuw gedrag geldt (nil = nog niet
+	// gepland, 0 = vanaf genesis). Oude blocks blijven zo met de oude
+	// regels te valideren.
+	// ------------------------------------------------------------
+
+	// FeeForkBlock: vanaf hier geldt FeeForkPaymentBps als payment fee.
+	FeeForkBlock      *uint64 `json:"feeForkBlock,omitempty"`
+	FeeForkPaymentBps uint64  `json:"feeForkPaymentBps,omitempty"`
+
+	// TypedTxBlock: EIP-2718 typed txs (2930 access list, 1559 dynamic fee).
+	TypedTxBlock *uint64 `json:"typedTxBlock,omitempty"`
+
+	// GasChargeBlock: gas kost GORR (gasUsed * gasPrice van de sender).
+	GasChargeBlock *uint64 `json:"gasChargeBlock,omitempty"`
+
+	// RewardsBlock: vanaf hier gaan fees (payment fee + gas, GORR en
+	// USDCc) niet meer direct naar de treasury maar worden per block
+	// verdeeld volgens FeeSplit, en komt er optioneel BlockReward issuance
+	// bij.
+	RewardsBlock *uint64 `json:"rewardsBlock,omitempty"`
+
+	FeeSplit Split `json:"feeSplit"`
+
+	// Issuance per block (wei, nil = geen), gehalveerd elke
+	// RewardHalvingInterval blocks na RewardsBlock (0 = nooit).
+	BlockReward           *big.Int `json:"blockReward,omitempty"`
+	RewardHalvingInterval uint64   `json:"rewardHalvingInterval,omitempty"`
+	RewardSplit           Split    `json:"rewardSplit"`
+
+	// USDCcBlock: on-chain USDCc transfers en USDCc payment intents via
+	// transfer(address,uint256) naar USDCcTokenAddress.
+	USDCcBlock *uint64 `json:"usdccBlock,omitempty"`
+
+	// RefundsBlock: GORR_REFUND txs van de merchant naar de payer van een
+	// intent. Met RefundFees mag een refund ook (een deel van) de payment
+	// fee uit de treasury teruggeven.
+	RefundsBlock *uint64 `json:"refundsBlock,omitempty"`
+	RefundFees   bool    `json:"refundFees,omitempty"`
+
+	// MerchantsBlock: on-chain merchant registry via txs naar
+	// MerchantRegistryAddress. Een geregistreerde merchant met een tier
+	// betaalt de payment fee van die tier uit MerchantFeeTiers; zonder
+	// tier geldt PaymentFeeBps.
+	MerchantsBlock   *uint64           `json:"merchantsBlock,omitempty"`
+	MerchantFeeTiers map[string]uint64 `json:"merchantFeeTiers,omitempty"`
+
+	// SubscriptionsBlock: terugkerende betalingen. De payer tekent één
+	// autorisatie naar SubscriptionsAddress; daarna trekt de merchant (of
+	// het block zelf, bij autoPull) elke periode een termijn af.
+	SubscriptionsBlock *uint64 `json:"subscriptionsBlock,omitempty"`
+
+	// SettlementsBlock: een transfer van merchant naar payout adres mag
+	// een "GORR_SETTLE:<id>" marker dragen (ook achter een USDCc transfer),
+	// zodat de node de settlement run kan afronden.
+	SettlementsBlock *uint64 `json:"settlementsBlock,omitempty"`
+
+	// PaymentTermsBlock: een GORR_PAY marker draagt ook het bedrag en de
+	// expiry van het intent ("GORR_PAY:<id>:<amount>:<expiry>"), en de
+	// state houdt per intent bij wat er betaald en terugbetaald is. Zo
+	// weigert elk block (ook geïmporteerde) betalingen voor verlopen,
+	// terugbetaalde of al volledig betaalde intents.
+	PaymentTermsBlock *uint64 `json:"paymentTermsBlock,omitempty"`
+}
+
+// Split verdeelt een bedrag in basispunten; de som moet 10000 zijn. Wat
+// door afronding overblijft gaat naar de treasury.
+type Split struct {
+	ProducerBps uint64 `json:"producerBps"`
+	TreasuryBps uint64 `json:"treasuryBps"`
+	BurnBps     uint64 `json:"burnBps"`
 }
 
+func (s Split) validate() error {
+	if s.ProducerBps+s.TreasuryBps+s.BurnBps != 10000 {
+		return fmt.Errorf("split %d/%d/%d does not add up to 10000 bps", s.ProducerBps, s.TreasuryBps, s.BurnBps)
+	}
+	return nil
+}
+
+// Standaard payment fee: 2.5% naar de treasury.
+const DefaultPaymentFeeBps = 250
+
 func GorrillazzChainConfig() *ChainConfig {
 	return &ChainConfig{
 		ChainID:          9999,
 		BlockTimeSeconds: 3,          // 3 seconden per block (aanpasbaar)
 		GasLimit:         15_000_000, // placeholder
+		PaymentFeeBps:    DefaultPaymentFeeBps,
+
+		// Zoals vóór de rewards fork: fees naar de treasury, issuance
+		// (als die aangezet wordt) naar de producer.
+		FeeSplit:    Split{TreasuryBps: 10000},
+		RewardSplit: Split{ProducerBps: 10000},
+
+		MerchantFeeTiers: map[string]uint64{
+			"growth":     150,
+			"enterprise": 100,
+		},
+	}
+}
+
+// Validate controleert de splits en de issuance instellingen.
+func (c *ChainConfig) Validate() error {
+	if err := c.FeeSplit.validate(); err != nil {
+		return fmt.Errorf("feeSplit: %w", err)
+	}
+	if err := c.RewardSplit.validate(); err != nil {
+		return fmt.Errorf("rewardSplit: %w", err)
+	}
+	if c.BlockReward != nil && c.BlockReward.Sign() < 0 {
+		return errors.New("blockReward must not be negative")
+	}
+	if c.PaymentFeeBps > 10000 || c.FeeForkPaymentBps > 10000 {
+		return errors.New("payment fee above 10000 bps")
+	}
+	for name, bps := range c.MerchantFeeTiers {
+		if name == "" {
+			return errors.New("merchant fee tier without a name")
+		}
+		if bps > 10000 {
+			return fmt.Errorf("merchant fee tier %q above 10000 bps", name)
+		}
+	}
+	return nil
+}
+
+// BlockRewardAt: issuance voor block number (0 vóór de rewards fork).
+func (c *ChainConfig) BlockRewardAt(number uint64) *big.Int {
+	if !c.IsRewards(number) || c.BlockReward == nil {
+		return new(big.Int)
+	}
+	reward := new(big.Int).Set(c.BlockReward)
+	if c.RewardHalvingInterval > 0 {
+		halvings := (number - *c.RewardsBlock) / c.RewardHalvingInterval
+		if halvings >= 256 {
+			return new(big.Int)
+		}
+		reward.Rsh(reward, uint(halvings))
+	}
+	return reward
+}
+
+// isForked: fork op hoogte s is actief voor block number.
+func isForked(s *uint64, number uint64) bool {
+	return s != nil && *s <= number
+}
+
+func (c *ChainConfig) IsFeeFork(number uint64) bool   { return isForked(c.FeeForkBlock, number) }
+func (c *ChainConfig) IsTypedTx(number uint64) bool   { return isForked(c.TypedTxBlock, number) }
+func (c *ChainConfig) IsGasCharge(number uint64) bool { return isForked(c.GasChargeBlock, number) }
+func (c *ChainConfig) IsRewards(number uint64) bool   { return isForked(c.RewardsBlock, number) }
+func (c *ChainConfig) IsUSDCc(number uint64) bool     { return isForked(c.USDCcBlock, number) }
+func (c *ChainConfig) IsRefunds(number uint64) bool   { return isForked(c.RefundsBlock, number) }
+func (c *ChainConfig) IsMerchants(number uint64) bool { return isForked(c.MerchantsBlock, number) }
+func (c *ChainConfig) IsSubscriptions(number uint64) bool {
+	return isForked(c.SubscriptionsBlock, number)
+}
+func (c *ChainConfig) IsSettlements(number uint64) bool {
+	return isForked(c.SettlementsBlock, number)
+}
+func (c *ChainConfig) IsPaymentTerms(number uint64) bool {
+	return isForked(c.PaymentTermsBlock, number)
+}
+
+// ------------------------------------------------------------
+// Rules: de regels voor één block number
+// ------------------------------------------------------------
+
+// Rules wordt per block opgevraagd door de state transition en de RPC
+// laag, zodat niemand zelf fork hoogtes hoeft te vergelijken.
+type Rules struct {
+	Number uint64 `json:"number"`
+
+	IsFeeFork       bool `json:"isFeeFork"`
+	IsTypedTx       bool `json:"isTypedTx"`
+	IsGasCharge     bool `json:"isGasCharge"`
+	IsRewards       bool `json:"isRewards"`
+	IsUSDCc         bool `json:"isUSDCc"`
+	IsRefunds       bool `json:"isRefunds"`
+	IsMerchants     bool `json:"isMerchants"`
+	IsSubscriptions bool `json:"isSubscriptions"`
+	IsSettlements   bool `json:"isSettlements"`
+	IsPaymentTerms  bool `json:"isPaymentTerms"`
+
+	// GORR_PAY treasury fee die voor dit block geldt
+	PaymentFeeBps uint64 `json:"paymentFeeBps"`
+
+	// Refunds mogen fee uit de treasury teruggeven (alleen met IsRefunds)
+	RefundFees bool `json:"refundFees"`
+
+	// Fee per merchant tier (alleen met IsMerchants)
+	MerchantFeeTiers map[string]uint64 `json:"merchantFeeTiers,omitempty"`
+}
+
+func (c *ChainConfig) Rules(number uint64) Rules {
+	r := Rules{
+		Number:          number,
+		IsFeeFork:       c.IsFeeFork(number),
+		IsTypedTx:       c.IsTypedTx(number),
+		IsGasCharge:     c.IsGasCharge(number),
+		IsRewards:       c.IsRewards(number),
+		IsUSDCc:         c.IsUSDCc(number),
+		IsRefunds:       c.IsRefunds(number),
+		IsMerchants:     c.IsMerchants(number),
+		IsSubscriptions: c.IsSubscriptions(number),
+		IsSettlements:   c.IsSettlements(number),
+		IsPaymentTerms:  c.IsPaymentTerms(number),
+		PaymentFeeBps:   c.PaymentFeeBps,
+	}
+	r.RefundFees = r.IsRefunds && c.RefundFees
+	if r.IsFeeFork {
+		r.PaymentFeeBps = c.FeeForkPaymentBps
+	}
+	if r.IsMerchants {
+		r.MerchantFeeTiers = c.MerchantFeeTiers
+	}
+	return r
+}
+
+// Forks geeft de geplande forks op naam (gorr_chainConfig).
+func (c *ChainConfig) Forks() map[string]*uint64 {
+	out := map[string]*uint64{}
+	for name, field := range c.forkFields() {
+		out[name] = *field
+	}
+	return out
+}
+
+func (c *ChainConfig) forkFields() map[string]**uint64 {
+	return map[string]**uint64{
+		"feeFork":       &c.FeeForkBlock,
+		"typedTx":       &c.TypedTxBlock,
+		"gasCharge":     &c.GasChargeBlock,
+		"rewards":       &c.RewardsBlock,
+		"usdcc":         &c.USDCcBlock,
+		"refunds":       &c.RefundsBlock,
+		"merchants":     &c.MerchantsBlock,
+		"subscriptions": &c.SubscriptionsBlock,
+		"settlements":   &c.SettlementsBlock,
+		"paymentTerms":  &c.PaymentTermsBlock,
+	}
+}
+
+// SetForks plant forks uit "naam=block" items (de -forks flag), met de
+// namen van Forks. "all=block" plant elke fork behalve feeFork: die
+// verandert alleen de payment fee (naar FeeForkPaymentBps).
+func (c *ChainConfig) SetForks(items []string) error {
+	fields := c.forkFields()
+	for _, item := range items {
+		name, height, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("fork %q: want name=block", item)
+		}
+		number, err := strconv.ParseUint(strings.TrimSpace(height), 10, 64)
+		if err != nil {
+			return fmt.Errorf("fork %q: bad block number", item)
+		}
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			for n, field := range fields {
+				if n != "feeFork" {
+					v := number
+					*field = &v
+				}
+			}
+			continue
+		}
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("unknown fork %q", name)
+		}
+		*field = &number
+	}
+	return nil
+}
+
+// LoadChainConfig leest een JSON chain config; ontbrekende velden houden
+// de waarde van GorrillazzChainConfig.
+func LoadChainConfig(path string) (*ChainConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := GorrillazzChainConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse chain config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("chain config %s: %w", path, err)
 	}
+	return cfg, nil
 }
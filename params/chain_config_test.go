@@ -0,0 +1,173 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func at(n uint64) *uint64 { return &n }
+
+// active: namen van de Is* velden die aan staan.
+func active(r Rules) []string {
+	out := []string{}
+	v := reflect.ValueOf(r)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if strings.HasPrefix(name, "Is") && v.Field(i).Bool() {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func TestRulesByBlockNumber(t *testing.T) {
+	cfg := GorrillazzChainConfig()
+	cfg.TypedTxBlock = at(0)
+	cfg.FeeForkBlock, cfg.FeeForkPaymentBps = at(10), 100
+	cfg.RefundsBlock, cfg.RefundFees = at(15), true
+	cfg.GasChargeBlock = at(20)
+	cfg.MerchantsBlock = at(30)
+
+	tests := []struct {
+		number     uint64
+		active     []string
+		feeBps     uint64
+		refundFees bool
+		tiers      bool
+	}{
+		{0, []string{"IsTypedTx"}, 250, false, false},
+		{9, []string{"IsTypedTx"}, 250, false, false},
+		{10, []string{"IsFeeFork", "IsTypedTx"}, 100, false, false},
+		{14, []string{"IsFeeFork", "IsTypedTx"}, 100, false, false},
+		{15, []string{"IsFeeFork", "IsTypedTx", "IsRefunds"}, 100, true, false},
+		{20, []string{"IsFeeFork", "IsTypedTx", "IsGasCharge", "IsRefunds"}, 100, true, false},
+		{29, []string{"IsFeeFork", "IsTypedTx", "IsGasCharge", "IsRefunds"}, 100, true, false},
+		{30, []string{"IsFeeFork", "IsTypedTx", "IsGasCharge", "IsRefunds", "IsMerchants"}, 100, true, true},
+		{1 << 40, []string{"IsFeeFork", "IsTypedTx", "IsGasCharge", "IsRefunds", "IsMerchants"}, 100, true, true},
+	}
+	for _, tt := range tests {
+		r := cfg.Rules(tt.number)
+		if got := active(r); !slices.Equal(got, tt.active) {
+			t.Errorf("block %d: active %v, want %v", tt.number, got, tt.active)
+		}
+		if r.Number != tt.number || r.PaymentFeeBps != tt.feeBps || r.RefundFees != tt.refundFees || (r.MerchantFeeTiers != nil) != tt.tiers {
+			t.Errorf("block %d: rules %+v", tt.number, r)
+		}
+	}
+}
+
+// Elke fork in Forks() schakelt precies één regel, op zijn eigen hoogte.
+func TestEveryForkHasARule(t *testing.T) {
+	if got := active(GorrillazzChainConfig().Rules(1 << 40)); len(got) != 0 {
+		t.Fatalf("default config has active forks %v", got)
+	}
+	seen := map[string]string{}
+	for name := range GorrillazzChainConfig().Forks() {
+		cfg := GorrillazzChainConfig()
+		// De JSON naam is de fork naam + "Block"
+		if err := json.Unmarshal([]byte(fmt.Sprintf(`{"%sBlock": 5}`, name)), cfg); err != nil {
+			t.Fatal(err)
+		}
+		if s := cfg.Forks()[name]; s == nil || *s != 5 {
+			t.Errorf("%s: not set by %sBlock", name, name)
+			continue
+		}
+		if got := active(cfg.Rules(4)); len(got) != 0 {
+			t.Errorf("%s: active %v before the fork", name, got)
+		}
+		got := active(cfg.Rules(5))
+		if len(got) != 1 {
+			t.Errorf("%s: active %v at the fork, want one rule", name, got)
+			continue
+		}
+		if other, dup := seen[got[0]]; dup {
+			t.Errorf("%s and %s both switch %s", name, other, got[0])
+		}
+		seen[got[0]] = name
+	}
+}
+
+func TestLoadChainConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		check func(*ChainConfig) bool
+		ok    bool
+	}{
+		{"defaults kept", `{"gasLimit": 1000}`, func(c *ChainConfig) bool {
+			return c.GasLimit == 1000 && c.PaymentFeeBps == DefaultPaymentFeeBps && c.FeeForkBlock == nil
+		}, true},
+		{"fork from genesis", `{"usdccBlock": 0}`, func(c *ChainConfig) bool {
+			return c.IsUSDCc(0) && !c.IsRefunds(0)
+		}, true},
+		{"bad split", `{"feeSplit": {"treasuryBps": 9000}}`, nil, false},
+		{"fee above 100%", `{"feeForkPaymentBps": 10001}`, nil, false},
+		{"not json", `{`, nil, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "chain.json")
+		if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadChainConfig(path)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err %v, want ok=%v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && !tt.check(cfg) {
+			t.Errorf("%s: config %+v", tt.name, cfg)
+		}
+	}
+}
+
+func TestSetForks(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []string
+		active []string // bij block 10
+		ok     bool
+	}{
+		{"none", nil, []string{}, true},
+		{"one fork", []string{"merchants=0"}, []string{"IsMerchants"}, true},
+		{"later fork stays off", []string{"merchants=0", "subscriptions=11"}, []string{"IsMerchants"}, true},
+		{"all but feeFork", []string{"all=0"}, []string{"IsTypedTx", "IsGasCharge", "IsRewards", "IsUSDCc", "IsRefunds", "IsMerchants", "IsSubscriptions", "IsSettlements", "IsPaymentTerms"}, true},
+		{"all, then one later", []string{"all=0", "rewards=20"}, []string{"IsTypedTx", "IsGasCharge", "IsUSDCc", "IsRefunds", "IsMerchants", "IsSubscriptions", "IsSettlements", "IsPaymentTerms"}, true},
+		{"unknown fork", []string{"bogus=0"}, nil, false},
+		{"no height", []string{"merchants"}, nil, false},
+		{"bad height", []string{"merchants=x"}, nil, false},
+	}
+	for _, tt := range tests {
+		cfg := GorrillazzChainConfig()
+		err := cfg.SetForks(tt.items)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err %v, want ok=%v", tt.name, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if got := active(cfg.Rules(10)); !slices.Equal(got, tt.active) {
+			t.Errorf("%s: active %v, want %v", tt.name, got, tt.active)
+		}
+	}
+}
+
+// chainconfig.example.json (README) zet elke fork behalve feeFork vanaf
+// genesis aan.
+func TestExampleChainConfig(t *testing.T) {
+	cfg, err := LoadChainConfig(filepath.Join("..", "chainconfig.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range cfg.Forks() {
+		if on := block != nil && *block == 0; on != (name != "feeFork") {
+			t.Errorf("%s: block %v", name, block)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/bft"
+)
+
+//
+// ------------------------------------------------------------
+// BFT: finality certificaten + consensus status
+// ------------------------------------------------------------
+//
+
+var errNoBFT = errors.New("BFT consensus not enabled")
+
+// Hoe ver gorr_getFinalizedBlock("latest") terugzoekt naar een certificaat.
+const maxFinalizedLookback = 256
+
+// SetBFT maakt gorr_bftStatus beschikbaar.
+func (s *Server) SetBFT(engine *bft.Engine) {
+	s.bft = engine
+}
+
+// gorr_bftStatus → height/round/step van de lokale consensus loop.
+func (s *Server) handleBftStatus() (interface{}, error) {
+	if s.bft == nil {
+		return nil, errNoBFT
+	}
+	return s.bft.Status(), nil
+}
+
+// gorr_getFinalizedBlock [number | "latest"] → block + finality certificaat.
+// Blocks zonder certificaat (PoA / van vóór BFT) zijn niet final.
+func (s *Server) handleGetFinalizedBlock(params []interface{}) (interface{}, error) {
+	head := s.bc.Head().Header.Number
+
+	number := head
+	latest := true
+	if len(params) > 0 && params[0] != "latest" {
+		var n uint64
+		var err error
+		if str, ok := params[0].(string); ok && strings.HasPrefix(str, "0x") {
+			n, err = strconv.ParseUint(str[2:], 16, 64)
+		} else {
+			n, err = parseUint64(params[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid block number: %v", err)
+		}
+		number, latest = n, false
+	}
+	if number > head {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+
+	for i := 0; i <= maxFinalizedLookback; i++ {
+		block, err := s.bc.LoadBlock(number)
+		if err != nil {
+			return nil, err
+		}
+		if block.Certificate != nil {
+			return map[string]interface{}{
+				"number":      block.Header.Number,
+				"hash":        block.Hash(),
+				"block":       block,
+				"certificate": block.Certificate,
+			}, nil
+		}
+		if !latest || number == 0 {
+			break
+		}
+		number--
+	}
+
+	if latest {
+		return nil, errors.New("no finalized block")
+	}
+	return nil, fmt.Errorf("block #%d is not finalized", number)
+}
@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// CHAIN CONFIG: fork hoogtes + actieve regels
+// ------------------------------------------------------------
+//
+
+// SetChainConfig: gas limit en fork regels voor eth_* (default
+// params.GorrillazzChainConfig).
+func (s *Server) SetChainConfig(config *params.ChainConfig) {
+	s.eth.config = config
+}
+
+// gorr_chainConfig → de config, de geplande forks en de regels voor het
+// volgende block.
+func (s *Server) handleChainConfig() (interface{}, error) {
+	config := s.eth.config
+	next := s.bc.Head().Header.Number + 1
+
+	forks := map[string]interface{}{}
+	for name, block := range config.Forks() {
+		if block == nil {
+			forks[name] = nil
+			continue
+		}
+		forks[name] = map[string]interface{}{
+			"block":  *block,
+			"active": *block <= next,
+		}
+	}
+
+	return map[string]interface{}{
+		"config": config,
+		"forks":  forks,
+		"rules":  config.Rules(next),
+	}, nil
+}
+
+// gorr_getBlockRewards [number | "latest"] → de fee verdeling en issuance
+// van een block, of null voor blocks van vóór de rewards fork.
+func (s *Server) handleGetBlockRewards(params []interface{}) (interface{}, error) {
+	number := s.bc.Head().Header.Number
+	if len(params) > 0 && params[0] != "latest" {
+		var n uint64
+		var err error
+		if str, ok := params[0].(string); ok && strings.HasPrefix(str, "0x") {
+			n, err = hexutil.DecodeUint64(str)
+		} else {
+			n, err = parseUint64(params[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid block number: %v", err)
+		}
+		if n > number {
+			return nil, fmt.Errorf("block #%d not found", n)
+		}
+		number = n
+	}
+
+	rewards, err := s.bc.LoadRewards(number)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
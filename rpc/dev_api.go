@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/producer"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// DEV: evm_* methods (Hardhat / Ganache compatibel)
+// ------------------------------------------------------------
+//
+
+var errNoProducer = errors.New("dev mining not enabled (poa + -mine + -dev.mode instamine|manual required)")
+
+// Maximaal aantal blocks per evm_mine call
+const maxEvmMineBlocks = 10000
+
+// SetProducer maakt de evm_* methods beschikbaar (alleen in instamine of
+// manual mode, zie dev).
+func (s *Server) SetProducer(prod *producer.BlockProducer) {
+	s.producer = prod
+}
+
+// dev: de producer voor de evm_* methods. In interval mode draait de node
+// als gewone validator; dan mag geen RPC caller de klok verzetten of
+// blocks maken.
+func (s *Server) dev() (*producer.BlockProducer, error) {
+	if s.producer == nil || s.producer.Mode() == producer.ModeInterval {
+		return nil, errNoProducer
+	}
+	return s.producer, nil
+}
+
+// evm_mine [count | {blocks, timestamp}] → maakt direct count blocks (ook
+// zonder txs). Antwoord "0x0" zoals Hardhat en Ganache.
+func (s *Server) handleEvmMine(params []interface{}) (interface{}, error) {
+	prod, err := s.dev()
+	if err != nil {
+		return nil, err
+	}
+
+	count := uint64(1)
+	if len(params) > 0 && params[0] != nil {
+		switch p := params[0].(type) {
+		case map[string]interface{}:
+			if v, ok := p["blocks"]; ok {
+				n, err := parseQuantity(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid blocks: %v", err)
+				}
+				count = n
+			}
+			if v, ok := p["timestamp"]; ok {
+				ts, err := parseQuantity(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid timestamp: %v", err)
+				}
+				if err := s.setNextBlockTimestamp(prod, ts); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			n, err := parseQuantity(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid block count: %v", err)
+			}
+			count = n
+		}
+	}
+	if count == 0 || count > maxEvmMineBlocks {
+		return nil, fmt.Errorf("block count must be between 1 and %d", maxEvmMineBlocks)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		if _, err := prod.Mine(); err != nil {
+			return nil, err
+		}
+	}
+	return "0x0", nil
+}
+
+// evm_increaseTime [seconds] → zet de chain clock vooruit; geeft de totale
+// verschuiving in seconden.
+func (s *Server) handleEvmIncreaseTime(params []interface{}) (interface{}, error) {
+	prod, err := s.dev()
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, errors.New("missing seconds")
+	}
+	secs, err := parseQuantity(params[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid seconds: %v", err)
+	}
+	return prod.Clock().Increase(secs), nil
+}
+
+// evm_setNextBlockTimestamp [timestamp] → het volgende block krijgt
+// precies deze timestamp; daarna loopt de klok vanaf daar verder.
+func (s *Server) handleEvmSetNextBlockTimestamp(params []interface{}) (interface{}, error) {
+	prod, err := s.dev()
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, errors.New("missing timestamp")
+	}
+	ts, err := parseQuantity(params[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	if err := s.setNextBlockTimestamp(prod, ts); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// setNextBlockTimestamp: ts moet na de head liggen en (PoA) niet vóór ons
+// volgende slot, anders kan er nooit een block met die tijd komen.
+func (s *Server) setNextBlockTimestamp(prod *producer.BlockProducer, ts uint64) error {
+	head := s.bc.Head().Header
+	if ts <= head.Time {
+		return fmt.Errorf("timestamp %d is not after the latest block timestamp %d", ts, head.Time)
+	}
+	if s.poa != nil {
+		if at, err := s.poa.NextSealTime(head); err == nil && ts < at {
+			return fmt.Errorf("timestamp %d is before the next sealing slot %d", ts, at)
+		}
+	}
+	prod.Clock().SetNext(ts)
+	return nil
+}
+
+// evm_snapshot → id (hex) voor evm_revert. Alleen in instamine/manual.
+func (s *Server) handleEvmSnapshot() (interface{}, error) {
+	prod, err := s.dev()
+	if err != nil {
+		return nil, err
+	}
+	id, err := prod.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.EncodeUint64(id), nil
+}
+
+// evm_revert [id] → true als er teruggezet is, false bij een onbekend
+// (of al gebruikt) id, zoals Hardhat.
+func (s *Server) handleEvmRevert(params []interface{}) (interface{}, error) {
+	prod, err := s.dev()
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, errors.New("missing snapshot id")
+	}
+	id, err := parseQuantity(params[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot id: %v", err)
+	}
+
+	err = prod.Revert(id)
+	if errors.Is(err, producer.ErrUnknownSnapshot) {
+		return false, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// parseQuantity: JSON number, decimale string of 0x-hex.
+func parseQuantity(v interface{}) (uint64, error) {
+	if str, ok := v.(string); ok && strings.HasPrefix(str, "0x") {
+		return hexutil.DecodeUint64(str)
+	}
+	return parseUint64(v)
+}
@@ -0,0 +1,30 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/producer"
+	"github.com/Siasom1/gorrillazz-chain/log"
+)
+
+// Ook met een producer weigeren de evm_* methods in interval mode.
+func TestDevMethodsRejectIntervalMode(t *testing.T) {
+	e := newWSEnv(t)
+	prod := producer.NewBlockProducer(e.bc, log.NewLogger("error"), 1, e.bus)
+	e.server.SetProducer(prod)
+
+	for _, method := range []string{"evm_mine", "evm_increaseTime", "evm_setNextBlockTimestamp", "evm_snapshot", "evm_revert"} {
+		if _, err := e.call(method, 1); err == nil || !strings.Contains(err.Error(), "dev mining not enabled") {
+			t.Fatalf("%s in interval mode: %v", method, err)
+		}
+	}
+	if offset := prod.Clock().Offset(); offset != 0 {
+		t.Fatalf("clock moved by %d seconds", offset)
+	}
+
+	prod.SetMode(producer.ModeManual, false)
+	if _, err := e.call("evm_increaseTime", 60); err != nil {
+		t.Fatalf("evm_increaseTime in manual mode: %v", err)
+	}
+}
@@ -2,53 +2,53 @@ package rpc
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
-	"net/http"
 	"strings"
 	"sync"
-	"time"
 
+	"github.com/Siasom1/gorrillazz-chain/core"
 	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/p2p"
+	"github.com/Siasom1/gorrillazz-chain/params"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	gethtypes "github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
 //
 // ------------------------------------------------------------
-// Ethereum JSON-RPC (LEGACY, MINIMAL) — D.5.2
+// Ethereum JSON-RPC (MINIMAL) — D.5.2
 // ------------------------------------------------------------
-// ✅ Accept legacy signed tx (RLP), recover sender, apply state transfer,
-// and return txHash + receipt immediately (dev-mode).
+// ✅ Accept signed legacy tx (RLP) en, vanaf de TypedTx fork, typed txs
+// (EIP-2930 / 1559), recover sender en zet de tx in de TxPool. De
+// BlockProducer voert hem uit; receipts komen uit de chain.
 //
 
 type ethRPC struct {
 	bc      *blockchain.Blockchain
+	bus     *events.EventBus
 	chainID uint64
 
-	mu     sync.Mutex
-	nonces map[common.Address]uint64
-	txs    map[common.Hash]*ethTxRecord
-}
+	// Gas limit + fork regels per block
+	config *params.ChainConfig
+
+	// serialiseert nonce-check + pool.Add
+	mu sync.Mutex
 
-type ethTxRecord struct {
-	Hash        common.Hash
-	From        common.Address
-	To          *common.Address
-	ValueWei    *big.Int
-	Nonce       uint64
-	BlockNumber uint64
-	Time        uint64
-	Status      uint64 // 1 success, 0 fail
+	// sync voortgang (p2p); nil = single node
+	sync *p2p.Server
 }
 
-func newEthRPC(bc *blockchain.Blockchain) *ethRPC {
+func newEthRPC(bc *blockchain.Blockchain, bus *events.EventBus) *ethRPC {
 	return &ethRPC{
 		bc:      bc,
+		bus:     bus,
 		chainID: bc.NetworkID(),
-		nonces:  make(map[common.Address]uint64),
-		txs:     make(map[common.Hash]*ethTxRecord),
+		config:  params.GorrillazzChainConfig(),
 	}
 }
 
@@ -56,39 +56,36 @@ func newEthRPC(bc *blockchain.Blockchain) *ethRPC {
 // ------------------------------------------------------------
 // ETH RPC ROUTER
 // ------------------------------------------------------------
-// Server.go calls: HandleEthRPC(w, req, s.eth)
+// Server.dispatch calls: HandleEthRPC(req, s.eth)
 //
 
-func HandleEthRPC(w http.ResponseWriter, req rpcReq, eth *ethRPC) {
+func HandleEthRPC(req rpcReq, eth *ethRPC) (interface{}, error) {
 	switch req.Method {
 
 	case "eth_chainId":
-		writeJSON(w, req.ID, fmt.Sprintf("0x%x", eth.chainID), nil)
+		return fmt.Sprintf("0x%x", eth.chainID), nil
 
 	case "net_version":
-		writeJSON(w, req.ID, fmt.Sprintf("%d", eth.chainID), nil)
+		return fmt.Sprintf("%d", eth.chainID), nil
 
 	case "web3_clientVersion":
-		writeJSON(w, req.ID, "Gorrillazz/v0.5.2", nil)
+		return "Gorrillazz/v0.5.2", nil
 
 	case "eth_blockNumber":
 		head := eth.bc.Head()
 		if head == nil || head.Header == nil {
-			writeJSON(w, req.ID, "0x0", nil)
-			return
+			return "0x0", nil
 		}
-		writeJSON(w, req.ID, fmt.Sprintf("0x%x", head.Header.Number), nil)
+		return fmt.Sprintf("0x%x", head.Header.Number), nil
 
 	case "eth_getBalance":
 		// params: [address, "latest"]
 		if len(req.Params) < 1 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("missing address"))
-			return
+			return nil, fmt.Errorf("missing address")
 		}
 		addrHex, ok := req.Params[0].(string)
 		if !ok {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid address"))
-			return
+			return nil, fmt.Errorf("invalid address")
 		}
 		addr := common.HexToAddress(addrHex)
 
@@ -97,193 +94,216 @@ func HandleEthRPC(w http.ResponseWriter, req rpcReq, eth *ethRPC) {
 		if bal == nil {
 			bal = big.NewInt(0)
 		}
-		writeJSON(w, req.ID, "0x"+bal.Text(16), nil)
+		return "0x" + bal.Text(16), nil
 
 	case "eth_getTransactionCount":
 		// params: [address, "latest" | "pending"]
 		if len(req.Params) < 1 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("missing address"))
-			return
+			return nil, fmt.Errorf("missing address")
 		}
 
 		addrHex, ok := req.Params[0].(string)
 		if !ok {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid address"))
-			return
+			return nil, fmt.Errorf("invalid address")
 		}
 
 		addr := common.HexToAddress(addrHex)
 
-		eth.mu.Lock()
-		nonce := eth.nonces[addr]
-		eth.mu.Unlock()
+		nonce, err := eth.bc.State.GetNonce(addr)
+		if err != nil {
+			return nil, err
+		}
+		if len(req.Params) > 1 && req.Params[1] == "pending" {
+			nonce = eth.bc.TxPool.PendingNonce(addr, nonce)
+		}
 
-		writeJSON(w, req.ID, fmt.Sprintf("0x%x", nonce), nil)
+		return fmt.Sprintf("0x%x", nonce), nil
+
+	case "eth_syncing":
+		if eth.sync == nil {
+			return false, nil
+		}
+		p, ok := eth.sync.SyncProgress()
+		if !ok {
+			return false, nil
+		}
+		return map[string]string{
+			"startingBlock": fmt.Sprintf("0x%x", p.StartingBlock),
+			"currentBlock":  fmt.Sprintf("0x%x", p.CurrentBlock),
+			"highestBlock":  fmt.Sprintf("0x%x", p.HighestBlock),
+		}, nil
 
 	case "eth_gasPrice":
 		// dev: free tx
-		writeJSON(w, req.ID, "0x0", nil)
+		return "0x0", nil
 
 	case "eth_estimateGas":
-		// legacy transfer gas
-		writeJSON(w, req.ID, "0x5208", nil)
+		// params: [{from, to, value, data}]
+		return eth.estimateGas(req.Params)
 
 	case "eth_sendRawTransaction":
 		// params: ["0x...rawRLP..."]
 		if len(req.Params) < 1 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("missing raw tx"))
-			return
+			return nil, fmt.Errorf("missing raw tx")
 		}
 		rawHex, ok := req.Params[0].(string)
 		if !ok {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid raw tx"))
-			return
+			return nil, fmt.Errorf("invalid raw tx")
 		}
 
-		tx, from, err := decodeAndRecoverLegacyTx(rawHex, eth.chainID)
+		gtx, from, err := decodeAndRecoverTx(rawHex, eth.chainID)
 		if err != nil {
-			writeJSON(w, req.ID, nil, err)
-			return
+			return nil, err
 		}
 
-		// nonce check (dev)
-		eth.mu.Lock()
-		expected := eth.nonces[from]
-		eth.mu.Unlock()
-
-		if tx.Nonce() != expected {
-			writeJSON(w, req.ID, nil, fmt.Errorf("bad nonce: got %d want %d", tx.Nonce(), expected))
-			return
+		// Regels van het block waar de tx op z'n vroegst in komt
+		rules := eth.pendingRules()
+		if gtx.Type() != gethtypes.LegacyTxType && !rules.IsTypedTx {
+			return nil, fmt.Errorf("%w: type %d before the typed tx fork", core.ErrTxTypeNotSupported, gtx.Type())
 		}
 
 		// basic checks
-		to := tx.To()
+		to := gtx.To()
 		if to == nil || *to == (common.Address{}) {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid to address"))
-			return
+			return nil, fmt.Errorf("invalid to address")
 		}
 
-		value := tx.Value()
-		if value == nil || value.Sign() <= 0 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid amount"))
-			return
+		// USDCc fork: token call met Value 0 i.p.v. een GORR bedrag
+		value := gtx.Value()
+		if core.IsUSDCcCall(rules, &types.Transaction{To: to}) {
+			t, err := core.ParseUSDCcTransfer(rules, gtx.Data())
+			if err != nil {
+				return nil, err
+			}
+			if value.Sign() != 0 {
+				return nil, fmt.Errorf("%w: value must be 0", core.ErrInvalidUSDCcCall)
+			}
+			if t.Amount.Sign() <= 0 || t.To == (common.Address{}) {
+				return nil, fmt.Errorf("invalid USDCc transfer")
+			}
+		} else if core.IsMerchantCall(rules, &types.Transaction{To: to}) {
+			// Merchants fork: registry call, ook met Value 0
+			if _, err := core.ParseMerchantCall(gtx.Data()); err != nil {
+				return nil, err
+			}
+			if value.Sign() != 0 {
+				return nil, fmt.Errorf("%w: value must be 0", core.ErrInvalidMerchantCall)
+			}
+		} else if core.IsSubscriptionCall(rules, &types.Transaction{To: to}) {
+			// Subscriptions fork: subscription call, ook met Value 0
+			if _, err := core.ParseSubscriptionCall(gtx.Data()); err != nil {
+				return nil, err
+			}
+			if value.Sign() != 0 {
+				return nil, fmt.Errorf("%w: value must be 0", core.ErrInvalidSubscriptionCall)
+			}
+		} else if value == nil || value.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid amount")
 		}
 
-		// Apply state (GORR native in wei)
-		if err := eth.bc.State.SubBalance(from, value); err != nil {
-			writeJSON(w, req.ID, nil, err)
-			return
+		// gas: minstens intrinsiek, maximaal een heel block
+		gas, err := core.TxIntrinsicGas(rules, to, gtx.Data())
+		if err != nil {
+			return nil, err
 		}
-		eth.bc.State.AddBalance(*to, value)
-
-		// store record + bump nonce
-		txHash := tx.Hash()
-		head := eth.bc.Head()
-		var bn uint64
-		if head != nil && head.Header != nil {
-			bn = head.Header.Number
+		if gtx.Gas() < gas {
+			return nil, fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, gtx.Gas(), gas)
 		}
-
-		rec := &ethTxRecord{
-			Hash:        txHash,
-			From:        from,
-			To:          to,
-			ValueWei:    new(big.Int).Set(value),
-			Nonce:       tx.Nonce(),
-			BlockNumber: bn, // dev: treat as mined "now"
-			Time:        uint64(time.Now().Unix()),
-			Status:      1,
+		if gtx.Gas() > eth.config.GasLimit {
+			return nil, fmt.Errorf("exceeds block gas limit: %d > %d", gtx.Gas(), eth.config.GasLimit)
 		}
 
 		eth.mu.Lock()
-		eth.txs[txHash] = rec
-		eth.nonces[from] = expected + 1
-		eth.mu.Unlock()
+		defer eth.mu.Unlock()
 
-		// Return tx hash
-		writeJSON(w, req.ID, txHash.Hex(), nil)
+		// nonce: lager dan state = al gebruikt; hoger mag (future), tot de
+		// nonce gap van de pool (AddWithNonce)
+		stateNonce, err := eth.bc.State.GetNonce(from)
+		if err != nil {
+			return nil, err
+		}
 
-	case "eth_getTransactionByHash":
-		if len(req.Params) < 1 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("missing tx hash"))
-			return
+		tx := types.FromGeth(gtx)
+		tx.Sender = from
+
+		// GasCharge fork: gas budget + value moet betaalbaar zijn
+		if rules.IsGasCharge {
+			bal, err := eth.bc.State.GetBalance(from)
+			if err != nil {
+				return nil, err
+			}
+			cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas), tx.EffectiveGasPrice())
+			cost.Add(cost, tx.Value)
+			if bal.Cmp(cost) < 0 {
+				return nil, fmt.Errorf("%w: have %s want %s", core.ErrInsufficientFunds, bal, cost)
+			}
 		}
-		hx, ok := req.Params[0].(string)
-		if !ok {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid tx hash"))
-			return
+
+		if err := eth.bc.TxPool.AddWithNonce(tx, stateNonce); err != nil {
+			return nil, err
 		}
-		h := common.HexToHash(hx)
 
-		eth.mu.Lock()
-		rec := eth.txs[h]
-		eth.mu.Unlock()
+		// newPendingTransactions subscribers
+		if eth.bus != nil {
+			eth.bus.Emit(&events.TxPending{Hash: tx.Hash(), From: from})
+		}
+
+		// Return tx hash
+		return tx.Hash().Hex(), nil
 
-		if rec == nil {
-			writeJSON(w, req.ID, nil, nil) // JSON-RPC expects null when not found
-			return
+	case "eth_getTransactionByHash":
+		h, err := hashParam(req.Params)
+		if err != nil {
+			return nil, err
 		}
 
-		toHex := "0x"
-		if rec.To != nil {
-			toHex = rec.To.Hex()
+		// Nog in de pool → pending (blockNumber null)
+		if tx := eth.bc.TxPool.Get(h); tx != nil {
+			return marshalTx(tx, tx.Sender, nil, 0), nil
 		}
 
-		// Minimal tx object for MetaMask/dev tooling
-		writeJSON(w, req.ID, map[string]interface{}{
-			"hash":             rec.Hash.Hex(),
-			"nonce":            fmt.Sprintf("0x%x", rec.Nonce),
-			"from":             rec.From.Hex(),
-			"to":               toHex,
-			"value":            "0x" + rec.ValueWei.Text(16),
-			"blockNumber":      fmt.Sprintf("0x%x", rec.BlockNumber),
-			"transactionIndex": "0x0",
-		}, nil)
+		block, idx, ok := eth.findTx(h)
+		if !ok {
+			return nil, nil // JSON-RPC expects null when not found
+		}
+		tx := block.Transactions[idx]
+		from, _ := tx.From()
+		return marshalTx(tx, from, block, uint64(idx)), nil
 
 	case "eth_getTransactionReceipt":
-		if len(req.Params) < 1 {
-			writeJSON(w, req.ID, nil, fmt.Errorf("missing tx hash"))
-			return
+		h, err := hashParam(req.Params)
+		if err != nil {
+			return nil, err
 		}
-		hx, ok := req.Params[0].(string)
+
+		block, idx, ok := eth.findTx(h)
 		if !ok {
-			writeJSON(w, req.ID, nil, fmt.Errorf("invalid tx hash"))
-			return
+			return nil, nil
 		}
-		h := common.HexToHash(hx)
 
-		eth.mu.Lock()
-		rec := eth.txs[h]
-		eth.mu.Unlock()
-
-		if rec == nil {
-			writeJSON(w, req.ID, nil, nil)
-			return
-		}
-
-		toHex := "0x"
-		if rec.To != nil {
-			toHex = rec.To.Hex()
-		}
-
-		// Minimal receipt
-		writeJSON(w, req.ID, map[string]interface{}{
-			"transactionHash":   rec.Hash.Hex(),
-			"transactionIndex":  "0x0",
-			"blockNumber":       fmt.Sprintf("0x%x", rec.BlockNumber),
-			"blockHash":         "0x" + strings.Repeat("0", 64), // dev placeholder
-			"from":              rec.From.Hex(),
-			"to":                toHex,
-			"cumulativeGasUsed": "0x0",
-			"gasUsed":           "0x0",
-			"effectiveGasPrice": "0x0",
-			"status":            fmt.Sprintf("0x%x", rec.Status),
-			"logs":              []interface{}{},
-			"logsBloom":         "0x" + strings.Repeat("0", 512),
-		}, nil)
+		receipts, err := eth.bc.LoadReceipts(block.Header.Number)
+		if err != nil {
+			return nil, err
+		}
+
+		var cumulative uint64
+		for _, r := range receipts {
+			cumulative += r.GasUsed
+			if r.CumulativeGasUsed != 0 {
+				cumulative = r.CumulativeGasUsed
+			}
+			if r.TxHash == h {
+				return marshalReceipt(r, block.Transactions[idx], cumulative), nil
+			}
+		}
+		return nil, nil
+
+	case "eth_subscribe", "eth_unsubscribe":
+		// Alleen via /ws: over HTTP kunnen we geen notificaties pushen
+		return nil, errNotificationsUnsupported
 
 	default:
-		writeJSON(w, req.ID, nil, fmt.Errorf("unsupported eth method: %s", req.Method))
+		return nil, fmt.Errorf("unsupported eth method: %s", req.Method)
 	}
 }
 
@@ -292,21 +312,294 @@ func HandleEthRPC(w http.ResponseWriter, req rpcReq, eth *ethRPC) {
 // Helpers
 // ------------------------------------------------------------
 
-func decodeAndRecoverLegacyTx(rawHex string, chainID uint64) (*gethtypes.Transaction, common.Address, error) {
+var errNotificationsUnsupported = errors.New("notifications not supported")
+
+// estimateGas: er is geen EVM, dus het verbruik is het intrinsieke gas
+// (calldata + GORR_PAY toeslag). Een call die zou falen geeft een error.
+func (eth *ethRPC) estimateGas(params []interface{}) (interface{}, error) {
+	if len(params) < 1 {
+		return nil, fmt.Errorf("missing call object")
+	}
+	call, ok := params[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid call object")
+	}
+
+	toStr, _ := call["to"].(string)
+	if !common.IsHexAddress(toStr) {
+		return nil, fmt.Errorf("contract creation not supported")
+	}
+	to := common.HexToAddress(toStr)
+
+	var data []byte
+	for _, key := range []string{"input", "data"} {
+		if raw, ok := call[key].(string); ok && raw != "" {
+			b, err := hexutil.Decode(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", key, err)
+			}
+			data = b
+			break
+		}
+	}
+
+	rules := eth.pendingRules()
+	if core.IsUSDCcCall(rules, &types.Transaction{To: &to}) {
+		if _, err := core.ParseUSDCcTransfer(rules, data); err != nil {
+			return nil, err
+		}
+	}
+	if core.IsMerchantCall(rules, &types.Transaction{To: &to}) {
+		if _, err := core.ParseMerchantCall(data); err != nil {
+			return nil, err
+		}
+	}
+	if core.IsSubscriptionCall(rules, &types.Transaction{To: &to}) {
+		if _, err := core.ParseSubscriptionCall(data); err != nil {
+			return nil, err
+		}
+	}
+	gas, err := core.TxIntrinsicGas(rules, &to, data)
+	if err != nil {
+		return nil, err
+	}
+	if gas > eth.config.GasLimit {
+		return nil, fmt.Errorf("exceeds block gas limit: %d > %d", gas, eth.config.GasLimit)
+	}
+	if raw, ok := call["gas"].(string); ok && raw != "" {
+		allowance, err := hexutil.DecodeUint64(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gas: %v", err)
+		}
+		if allowance < gas {
+			return nil, fmt.Errorf("gas required exceeds allowance (%d)", allowance)
+		}
+	}
+
+	// Saldo controleren als from bekend is: value, en vanaf de GasCharge
+	// fork ook gas * gasPrice (als de call een prijs meegeeft)
+	value := new(big.Int)
+	if raw, ok := call["value"].(string); ok && raw != "" {
+		v, err := hexutil.DecodeBig(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		value = v
+	}
+	gasCost := new(big.Int)
+	if rules.IsGasCharge {
+		for _, key := range []string{"gasPrice", "maxPriorityFeePerGas"} {
+			if raw, ok := call[key].(string); ok && raw != "" {
+				price, err := hexutil.DecodeBig(raw)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %v", key, err)
+				}
+				gasCost.Mul(new(big.Int).SetUint64(gas), price)
+				break
+			}
+		}
+	}
+	if from, _ := call["from"].(string); common.IsHexAddress(from) && (value.Sign() > 0 || gasCost.Sign() > 0) {
+		bal, err := eth.bc.State.GetBalance(common.HexToAddress(from))
+		if err != nil {
+			return nil, err
+		}
+		if bal.Cmp(value) < 0 {
+			return nil, fmt.Errorf("insufficient funds for transfer")
+		}
+		if bal.Cmp(new(big.Int).Add(value, gasCost)) < 0 {
+			return nil, fmt.Errorf("insufficient funds for gas * price + value")
+		}
+	}
+
+	return hexutil.EncodeUint64(gas), nil
+}
+
+func hashParam(params []interface{}) (common.Hash, error) {
+	if len(params) < 1 {
+		return common.Hash{}, fmt.Errorf("missing tx hash")
+	}
+	hx, ok := params[0].(string)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("invalid tx hash")
+	}
+	return common.HexToHash(hx), nil
+}
+
+// findTx zoekt een gemined tx op via de tx index.
+func (eth *ethRPC) findTx(h common.Hash) (*types.Block, int, bool) {
+	num, err := eth.bc.FindTxBlock(h)
+	if err != nil {
+		return nil, 0, false
+	}
+	block, err := eth.bc.LoadBlock(num)
+	if err != nil {
+		return nil, 0, false
+	}
+	for i, tx := range block.Transactions {
+		if tx.Hash() == h {
+			return block, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+func hexBig(v *big.Int) string {
+	if v == nil {
+		return "0x0"
+	}
+	return "0x" + v.Text(16)
+}
+
+// marshalTx geeft een tx in Ethereum JSON-RPC vorm; block == nil = pending.
+func marshalTx(tx *types.Transaction, from common.Address, block *types.Block, index uint64) map[string]interface{} {
+	var to interface{}
+	if tx.To != nil {
+		to = tx.To.Hex()
+	}
+
+	out := map[string]interface{}{
+		"hash":             tx.Hash().Hex(),
+		"nonce":            fmt.Sprintf("0x%x", tx.Nonce),
+		"from":             from.Hex(),
+		"to":               to,
+		"value":            hexBig(tx.Value),
+		"gas":              fmt.Sprintf("0x%x", tx.Gas),
+		"gasPrice":         hexBig(tx.GasPrice),
+		"input":            "0x" + hex.EncodeToString(tx.Data),
+		"v":                hexBig(tx.V),
+		"r":                hexBig(tx.R),
+		"s":                hexBig(tx.S),
+		"type":             fmt.Sprintf("0x%x", tx.Type),
+		"blockHash":        nil,
+		"blockNumber":      nil,
+		"transactionIndex": nil,
+	}
+	if tx.Type != types.LegacyTxType {
+		out["chainId"] = hexBig(tx.ChainID)
+		out["accessList"] = tx.AccessList
+		if tx.AccessList == nil {
+			out["accessList"] = gethtypes.AccessList{}
+		}
+		out["yParity"] = hexBig(tx.V)
+	}
+	if tx.Type == types.DynamicFeeTxType {
+		out["gasPrice"] = hexBig(tx.EffectiveGasPrice())
+		out["maxFeePerGas"] = hexBig(tx.GasFeeCap)
+		out["maxPriorityFeePerGas"] = hexBig(tx.GasTipCap)
+	}
+	if block != nil {
+		out["blockHash"] = block.Hash().Hex()
+		out["blockNumber"] = fmt.Sprintf("0x%x", block.Header.Number)
+		out["transactionIndex"] = fmt.Sprintf("0x%x", index)
+	}
+	return out
+}
+
+func marshalReceipt(r *types.Receipt, tx *types.Transaction, cumulativeGas uint64) map[string]interface{} {
+	logs := make([]interface{}, len(r.Logs))
+	for i, l := range r.Logs {
+		logs[i] = marshalLog(l)
+	}
+
+	out := map[string]interface{}{
+		"transactionHash":   r.TxHash.Hex(),
+		"transactionIndex":  fmt.Sprintf("0x%x", r.TransactionIndex),
+		"blockNumber":       fmt.Sprintf("0x%x", r.BlockNumber),
+		"blockHash":         r.BlockHash.Hex(),
+		"from":              r.From.Hex(),
+		"to":                r.To.Hex(),
+		"contractAddress":   nil,
+		"cumulativeGasUsed": fmt.Sprintf("0x%x", cumulativeGas),
+		"gasUsed":           fmt.Sprintf("0x%x", r.GasUsed),
+		"effectiveGasPrice": hexBig(r.EffectiveGasPrice),
+		"type":              fmt.Sprintf("0x%x", tx.Type),
+		"status":            fmt.Sprintf("0x%x", r.Status),
+		"logs":              logs,
+		"logsBloom":         "0x" + strings.Repeat("0", 512),
+	}
+	// Niet-standaard: payment fee + gas kosten (zie gorr_getBlockRewards)
+	if r.Fee != nil {
+		out["fee"] = hexBig(r.Fee)
+	}
+	if r.PaymentFee != nil {
+		out["paymentFee"] = hexBig(r.PaymentFee)
+	}
+	if r.FeeUSDCc != nil {
+		out["feeUSDCc"] = hexBig(r.FeeUSDCc)
+	}
+	if r.FeeRefund != nil {
+		out["feeRefund"] = hexBig(r.FeeRefund)
+	}
+	if r.FeeRefundUSDCc != nil {
+		out["feeRefundUSDCc"] = hexBig(r.FeeRefundUSDCc)
+	}
+	return out
+}
+
+// marshalHeader geeft een block header in Ethereum JSON-RPC vorm terug
+// (eth_subscribe newHeads). Velden die we niet kennen krijgen een nulwaarde,
+// zodat ethers' block formatter niet struikelt.
+func marshalHeader(b *types.Block) map[string]interface{} {
+	h := b.Header
+	return map[string]interface{}{
+		"hash":             b.Hash().Hex(),
+		"parentHash":       h.ParentHash.Hex(),
+		"number":           fmt.Sprintf("0x%x", h.Number),
+		"timestamp":        fmt.Sprintf("0x%x", h.Time),
+		"stateRoot":        h.StateRoot.Hex(),
+		"transactionsRoot": h.TxRoot.Hex(),
+		"receiptsRoot":     common.Hash{}.Hex(),
+		"sha3Uncles":       gethtypes.EmptyUncleHash.Hex(),
+		"miner":            h.Coinbase.Hex(),
+		"difficulty":       "0x0",
+		"gasLimit":         fmt.Sprintf("0x%x", h.GasLimit),
+		"gasUsed":          fmt.Sprintf("0x%x", h.GasUsed),
+		"extraData":        "0x",
+		"nonce":            "0x0000000000000000",
+		"logsBloom":        "0x" + strings.Repeat("0", 512),
+	}
+}
+
+// marshalLog geeft een receipt-log in Ethereum JSON-RPC vorm terug.
+func marshalLog(l *types.Log) map[string]interface{} {
+	topics := make([]string, len(l.Topics))
+	for i, t := range l.Topics {
+		topics[i] = t.Hex()
+	}
+	return map[string]interface{}{
+		"address":          l.Address.Hex(),
+		"topics":           topics,
+		"data":             "0x" + hex.EncodeToString(l.Data),
+		"blockNumber":      fmt.Sprintf("0x%x", l.BlockNumber),
+		"blockHash":        l.BlockHash.Hex(),
+		"transactionHash":  l.TxHash.Hex(),
+		"transactionIndex": fmt.Sprintf("0x%x", l.TxIndex),
+		"logIndex":         fmt.Sprintf("0x%x", l.Index),
+		"removed":          false,
+	}
+}
+
+// pendingRules: de fork regels voor het volgende block.
+func (eth *ethRPC) pendingRules() params.Rules {
+	return eth.config.Rules(eth.bc.Head().Header.Number + 1)
+}
+
+func decodeAndRecoverTx(rawHex string, chainID uint64) (*gethtypes.Transaction, common.Address, error) {
 	rawHex = strings.TrimPrefix(rawHex, "0x")
 	b, err := hex.DecodeString(rawHex)
 	if err != nil {
 		return nil, common.Address{}, fmt.Errorf("invalid hex: %w", err)
 	}
 
-	// Legacy tx RLP decode
+	// Legacy RLP of EIP-2718 envelope (type || payload)
 	var tx gethtypes.Transaction
-	if err := rlp.DecodeBytes(b, &tx); err != nil {
+	if err := tx.UnmarshalBinary(b); err != nil {
 		return nil, common.Address{}, fmt.Errorf("rlp decode failed: %w", err)
 	}
 
-	// EIP-155 signer (legacy + chainId)
-	signer := gethtypes.NewEIP155Signer(new(big.Int).SetUint64(chainID))
+	// EIP-155 signer voor legacy, London signer voor typed txs
+	signer := gethtypes.LatestSignerForChainID(new(big.Int).SetUint64(chainID))
 
 	from, err := gethtypes.Sender(signer, &tx)
 	if err != nil {
@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core/txpool"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// call voert één JSON-RPC request uit zoals HandleJSONRPC dat doet. De
+// params gaan eerst door JSON, zodat getallen float64 worden.
+func (e *wsEnv) call(method string, params ...interface{}) (interface{}, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var decoded []interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return e.server.dispatch(rpcReq{JSONRPC: "2.0", Method: method, Params: decoded, ID: 1})
+}
+
+func TestSendRawTransactionQueues(t *testing.T) {
+	e := newWSEnv(t)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xb0b")
+	raw := func(nonce uint64) string {
+		gtx, err := gethtypes.SignTx(gethtypes.NewTx(&gethtypes.LegacyTx{
+			Nonce: nonce, To: &to, Value: big.NewInt(1000), Gas: 21000, GasPrice: new(big.Int),
+		}), gethtypes.NewEIP155Signer(big.NewInt(9999)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := gtx.MarshalBinary()
+		return hexutil.Encode(data)
+	}
+	nonce := func(tag string) string {
+		res, err := e.call("eth_getTransactionCount", from.Hex(), tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(string)
+	}
+
+	steps := []struct {
+		name    string
+		raw     string
+		err     string
+		latest  string
+		pending string
+	}{
+		{"first", raw(0), "", "0x0", "0x1"},
+		{"same tx again", raw(0), "already known", "0x0", "0x1"},
+		{"future nonce stays queued", raw(2), "", "0x0", "0x1"},
+		{"gap filled", raw(1), "", "0x0", "0x3"},
+		{"nonce beyond the pool's gap", raw(3 + txpool.DefaultMaxNonceGap + 1), "too far ahead", "0x0", "0x3"},
+	}
+	var hashes []string
+	for _, st := range steps {
+		res, err := e.call("eth_sendRawTransaction", st.raw)
+		if st.err != "" {
+			if err == nil || !strings.Contains(err.Error(), st.err) {
+				t.Fatalf("%s: %v, want %q", st.name, err, st.err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		} else {
+			hashes = append(hashes, res.(string))
+		}
+		if got := nonce("latest"); got != st.latest {
+			t.Fatalf("%s: latest nonce %s, want %s", st.name, got, st.latest)
+		}
+		if got := nonce("pending"); got != st.pending {
+			t.Fatalf("%s: pending nonce %s, want %s", st.name, got, st.pending)
+		}
+	}
+
+	// Alleen in de pool: nog niets uitgevoerd, geen receipt, blockNumber null
+	if bal, _ := e.bc.State.GetBalance(to); bal.Sign() != 0 {
+		t.Fatalf("recipient has %s before any block", bal)
+	}
+	for _, h := range hashes {
+		tx, err := e.call("eth_getTransactionByHash", h)
+		if err != nil || tx == nil {
+			t.Fatalf("pending tx %s: %v, %v", h, tx, err)
+		}
+		if m := tx.(map[string]interface{}); m["blockNumber"] != nil || m["from"] != from.Hex() {
+			t.Fatalf("pending tx %s: %v", h, m)
+		}
+		if r, err := e.call("eth_getTransactionReceipt", h); err != nil || r != nil {
+			t.Fatalf("receipt of pending tx %s: %v, %v", h, r, err)
+		}
+	}
+
+	// Een nonce onder de state nonce is al gebruikt
+	if err := e.bc.State.IncreaseNonce(from); err != nil {
+		t.Fatal(err)
+	}
+	e.bc.TxPool.Remove(e.bc.TxPool.Get(common.HexToHash(hashes[0])))
+	if _, err := e.call("eth_sendRawTransaction", raw(0)); err == nil || !strings.Contains(err.Error(), "nonce too low") {
+		t.Fatalf("used nonce: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/events"
+)
+
+//
+// ------------------------------------------------------------
+// DURABLE EVENTS — REST /events, SSE /events/stream, gorr_getEvents
+// ------------------------------------------------------------
+// Consumers onthouden de laatste "seq" en hervatten met ?after=<seq>.
+//
+
+const (
+	defaultEventsPage = 100
+	maxEventsPage     = 1000
+
+	// SSE consumers die achterlopen worden afgesloten i.p.v. events te
+	// missen; ze hervatten met Last-Event-ID.
+	sseQueueSize = 1024
+)
+
+var errNoEventLog = errors.New("event log not enabled")
+
+// eventsPage is het antwoord van REST /events en gorr_getEvents.
+type eventsPage struct {
+	Events []events.Record `json:"events"`
+	Next   uint64          `json:"next"` // cursor voor de volgende pagina
+	Head   uint64          `json:"head"` // hoogste seq in het log
+}
+
+func (s *Server) readEvents(after uint64, limit int, topics []events.Topic) (*eventsPage, error) {
+	l := s.bus.Log()
+	if l == nil {
+		return nil, errNoEventLog
+	}
+	if limit <= 0 {
+		limit = defaultEventsPage
+	}
+	if limit > maxEventsPage {
+		limit = maxEventsPage
+	}
+
+	recs, err := l.Read(after, limit, topics...)
+	if err != nil {
+		return nil, err
+	}
+
+	next := after
+	if len(recs) > 0 {
+		next = recs[len(recs)-1].Seq
+	}
+	return &eventsPage{Events: recs, Next: next, Head: l.Head()}, nil
+}
+
+func parseTopics(raw string) []events.Topic {
+	if raw == "" {
+		return nil
+	}
+	var out []events.Topic
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, events.Topic(t))
+		}
+	}
+	return out
+}
+
+// REST: /events?after=<seq>&limit=<n>&topic=payment,tx
+func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var after uint64
+	if v := q.Get("after"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	page, err := s.readEvents(after, limit, parseTopics(q.Get("topic")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// SSE: /events/stream?after=<seq>&topic=payment (of header Last-Event-ID)
+// Eerst de backlog uit het log, daarna live — zonder gat ertussen.
+func (s *Server) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	l := s.bus.Log()
+	if l == nil {
+		http.Error(w, errNoEventLog.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	cursor := r.URL.Query().Get("after")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		cursor = id
+	}
+	var after uint64
+	if cursor != "" {
+		n, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	topics := parseTopics(r.URL.Query().Get("topic"))
+
+	// Eerst subscriben, dan backlog lezen: live events die tijdens het
+	// lezen binnenkomen staan in de queue en worden op seq gededupliceerd.
+	sub := s.bus.Subscribe(sseQueueSize, events.Disconnect, topics...)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeRecord := func(rec events.Record) {
+		data, _ := json.Marshal(rec)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", rec.Seq, rec.Topic, data)
+		flusher.Flush()
+	}
+
+	for {
+		recs, err := l.Read(after, maxEventsPage, topics...)
+		if err != nil {
+			return
+		}
+		for _, rec := range recs {
+			writeRecord(rec)
+			after = rec.Seq
+		}
+		if len(recs) < maxEventsPage {
+			break
+		}
+	}
+
+	ctx := r.Context()
+	for {
+		select {
+		case ev, ok := <-sub.C():
+			if !ok {
+				// slow consumer: client hervat met Last-Event-ID
+				return
+			}
+			if ev.Seq <= after {
+				continue
+			}
+			writeRecord(liveRecord(ev))
+			after = ev.Seq
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// liveRecord zet een bus-event om naar dezelfde vorm als een log-record.
+func liveRecord(ev events.Event) events.Record {
+	data, _ := json.Marshal(ev.Data)
+	return events.Record{
+		Seq:   ev.Seq,
+		Topic: ev.Topic,
+		Time:  uint64(time.Now().Unix()),
+		Event: data,
+	}
+}
+
+// JSON-RPC: gorr_getEvents [{"after": 0, "limit": 100, "topics": ["payment"]}]
+func (s *Server) handleGetEventsRPC(params []interface{}) (interface{}, error) {
+	var after uint64
+	limit := 0
+	var topics []events.Topic
+
+	if len(params) > 0 {
+		raw, ok := params[0].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid params")
+		}
+		if v, ok := raw["after"]; ok {
+			n, err := parseUint64(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid after: %v", err)
+			}
+			after = n
+		}
+		if v, ok := raw["limit"]; ok {
+			n, err := parseUint64(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid limit: %v", err)
+			}
+			limit = int(n)
+		}
+		topics = topicsParam(raw["topics"])
+	}
+
+	return s.readEvents(after, limit, topics)
+}
+
+func topicsParam(v interface{}) []events.Topic {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var out []events.Topic
+	for _, t := range list {
+		if s, ok := t.(string); ok {
+			out = append(out, events.Topic(s))
+		}
+	}
+	return out
+}
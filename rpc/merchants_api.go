@@ -0,0 +1,377 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// MERCHANT REGISTRY — gorr_*Merchant* + API keys voor REST
+// ------------------------------------------------------------
+// De registry staat on-chain: de node leest hem uit de state en geeft
+// voor wijzigingen de (ongetekende) registry tx terug, zoals bij refunds.
+// API keys maakt de node aan maar bewaart hij niet; alleen de hash gaat
+// via de addKey tx de registry in.
+//
+
+// APIKeyHeader: API key van de merchant voor de REST payment API
+// (alternatief: "Authorization: Bearer <key>").
+const APIKeyHeader = "X-Api-Key"
+
+var (
+	errAPIKeyRequired      = errors.New("this merchant requires an API key (" + APIKeyHeader + " header or \"apiKey\" param)")
+	errAPIKeyInvalid       = errors.New("invalid API key for this merchant")
+	errAPIKeyNotConfigured = errors.New("merchant has no API key in the registry (gorr_createMerchantAPIKey)")
+	errFromRequired        = errors.New("the merchant registry is not active (merchants fork): send \"from\" with the merchant or admin address")
+	errNotMerchant         = errors.New("only the merchant or admin can do this")
+)
+
+// merchant: het registry record van addr, of nil (niet geregistreerd of
+// de merchants fork is nog niet actief).
+func (s *Server) merchant(addr common.Address) (*core.Merchant, error) {
+	if !s.eth.pendingRules().IsMerchants {
+		return nil, nil
+	}
+	return core.GetMerchant(s.bc.State, addr)
+}
+
+// merchantTx bouwt de ongetekende registry tx voor call namens from.
+func (s *Server) merchantTx(from common.Address, call *core.MerchantCall) (map[string]interface{}, error) {
+	rules := s.eth.pendingRules()
+	if !rules.IsMerchants {
+		return nil, errors.New("the merchant registry is not active yet (merchants fork)")
+	}
+	data, err := core.MerchantCallData(call)
+	if err != nil {
+		return nil, err
+	}
+	// Zelfde controles als bij inclusie, zodat de merchant geen tx tekent
+	// die toch wordt afgewezen
+	if _, err := core.ParseMerchantCall(data); err != nil {
+		return nil, err
+	}
+	if err := s.checkMerchantCall(from, call, rules); err != nil {
+		return nil, err
+	}
+	to := params.MerchantRegistryAddress
+	gas, err := core.TxIntrinsicGas(rules, &to, data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"from":  from,
+		"to":    to,
+		"value": hexBig(new(big.Int)),
+		"data":  hexutil.Encode(data),
+		"gas":   hexutil.Uint64(gas),
+	}, nil
+}
+
+// checkMerchantCall: de state afhankelijke controles van de registry
+// (bestaat de merchant, admin ops), tegen de huidige head.
+func (s *Server) checkMerchantCall(from common.Address, call *core.MerchantCall, rules params.Rules) error {
+	target := from
+	switch call.Op {
+	case core.MerchantOpSetTier, core.MerchantOpSetStatus:
+		if from != s.bc.AdminAddr {
+			return fmt.Errorf("%s is admin only", call.Op)
+		}
+		target = *call.Merchant
+	}
+	m, err := core.GetMerchant(s.bc.State, target)
+	if err != nil {
+		return err
+	}
+	switch {
+	case call.Op == core.MerchantOpRegister && m != nil:
+		return fmt.Errorf("merchant %s already registered", target.Hex())
+	case call.Op != core.MerchantOpRegister && m == nil:
+		return fmt.Errorf("%w: %s", core.ErrMerchantNotFound, target.Hex())
+	case call.Op == core.MerchantOpAddKey && len(m.APIKeys) >= core.MaxMerchantAPIKeys:
+		return fmt.Errorf("merchant already has %d API keys", core.MaxMerchantAPIKeys)
+	case call.Op == core.MerchantOpSetTier:
+		if _, ok := rules.MerchantFeeTiers[*call.Tier]; !ok && *call.Tier != "" {
+			return fmt.Errorf("unknown fee tier %q", *call.Tier)
+		}
+	}
+	return nil
+}
+
+// marshalMerchant: record + de fee die nu voor de merchant geldt.
+func (s *Server) marshalMerchant(m *core.Merchant) map[string]interface{} {
+	keys := []map[string]interface{}{}
+	for _, k := range m.APIKeys {
+		keys = append(keys, map[string]interface{}{
+			"hash":    k.Hash,
+			"label":   k.Label,
+			"addedAt": k.AddedAt,
+		})
+	}
+	tier := m.Tier
+	if tier == "" {
+		tier = "standard"
+	}
+	return map[string]interface{}{
+		"address":      m.Address,
+		"name":         m.Name,
+		"payout":       m.Payout,
+		"tier":         tier,
+		"feeBps":       m.FeeBps(s.eth.pendingRules()),
+		"status":       m.Status,
+		"apiKeys":      keys,
+		"registeredAt": m.RegisteredAt,
+		"updatedAt":    m.UpdatedAt,
+	}
+}
+
+// ---------------- JSON-RPC ----------------
+
+// gorr_getMerchant [address | {address}]
+func (s *Server) handleGetMerchant(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing merchant address")
+	}
+	v := args[0]
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["address"]
+	}
+	addr, _ := v.(string)
+	if !common.IsHexAddress(addr) {
+		return nil, errors.New("invalid merchant address")
+	}
+	m, err := s.merchant(common.HexToAddress(addr))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, nil
+	}
+	return s.marshalMerchant(m), nil
+}
+
+// gorr_listMerchants [{tier?, status?}?] → alle records op adres volgorde
+func (s *Server) handleListMerchants(args []interface{}) (interface{}, error) {
+	var tier, status string
+	if len(args) > 0 {
+		if raw, ok := args[0].(map[string]interface{}); ok {
+			tier, _ = raw["tier"].(string)
+			status, _ = raw["status"].(string)
+		}
+	}
+
+	list := []map[string]interface{}{}
+	if !s.eth.pendingRules().IsMerchants {
+		return list, nil
+	}
+	err := s.bc.State.ForEachMerchant(func(addr common.Address, _ []byte) error {
+		m, err := core.GetMerchant(s.bc.State, addr)
+		if err != nil || m == nil {
+			return err
+		}
+		out := s.marshalMerchant(m)
+		if tier != "" && out["tier"] != tier {
+			return nil
+		}
+		if status != "" && m.Status != status {
+			return nil
+		}
+		list = append(list, out)
+		return nil
+	})
+	return list, err
+}
+
+// gorr_merchantTx [{from, op, name?, payout?, keyHash?, label?, merchant?,
+// tier?, status?}] → te tekenen registry tx
+func (s *Server) handleMerchantTx(args []interface{}) (interface{}, error) {
+	raw, err := objectParam(args)
+	if err != nil {
+		return nil, err
+	}
+	from, _ := raw["from"].(string)
+	if !common.IsHexAddress(from) {
+		return nil, errors.New("invalid from address")
+	}
+
+	call := &core.MerchantCall{}
+	call.Op, _ = raw["op"].(string)
+	if v, ok := raw["name"].(string); ok {
+		call.Name = &v
+	}
+	if v, ok := raw["tier"].(string); ok {
+		call.Tier = &v
+	}
+	call.Status, _ = raw["status"].(string)
+	call.Label, _ = raw["label"].(string)
+	for key, dst := range map[string]**common.Address{"payout": &call.Payout, "merchant": &call.Merchant} {
+		v, ok := raw[key]
+		if !ok {
+			continue
+		}
+		str, _ := v.(string)
+		if !common.IsHexAddress(str) {
+			return nil, fmt.Errorf("invalid %s address", key)
+		}
+		addr := common.HexToAddress(str)
+		*dst = &addr
+	}
+	if v, ok := raw["keyHash"]; ok {
+		str, _ := v.(string)
+		b, err := hexutil.Decode(str)
+		if err != nil || len(b) != common.HashLength {
+			return nil, errors.New("keyHash must be a 32 byte hex hash")
+		}
+		h := common.BytesToHash(b)
+		call.KeyHash = &h
+	}
+	return s.merchantTx(common.HexToAddress(from), call)
+}
+
+// gorr_createMerchantAPIKey [{merchant, label?}] → nieuwe API key (alleen
+// hier zichtbaar) + de addKey tx die de merchant moet tekenen
+func (s *Server) handleCreateMerchantAPIKey(args []interface{}) (interface{}, error) {
+	raw, err := objectParam(args)
+	if err != nil {
+		return nil, err
+	}
+	merchantStr, _ := raw["merchant"].(string)
+	if !common.IsHexAddress(merchantStr) {
+		return nil, errors.New("invalid merchant address")
+	}
+	label, _ := raw["label"].(string)
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	key := "gk_" + hex.EncodeToString(buf)
+	hash := core.HashAPIKey(key)
+
+	tx, err := s.merchantTx(common.HexToAddress(merchantStr), &core.MerchantCall{
+		Op:      core.MerchantOpAddKey,
+		KeyHash: &hash,
+		Label:   label,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"apiKey":  key,
+		"keyHash": hash,
+		"tx":      tx,
+	}, nil
+}
+
+// ---------------- REST auth ----------------
+
+// authorizeMerchant: heeft merchant API keys in de registry, dan moet het
+// request er één meesturen. Geeft true als een geldige key is
+// meegestuurd (het request komt dan van de merchant, "from" is niet
+// nodig). Merchants zonder keys houden het oude gedrag.
+func (s *Server) authorizeMerchant(r *http.Request, merchant common.Address) (bool, error) {
+	m, err := s.merchant(merchant)
+	if err != nil {
+		return false, err
+	}
+	key := requestAPIKey(r)
+	if m == nil || len(m.APIKeys) == 0 {
+		return false, nil
+	}
+	if key == "" {
+		return false, errAPIKeyRequired
+	}
+	if !m.HasAPIKey(key) {
+		return false, errAPIKeyInvalid
+	}
+	return true, nil
+}
+
+// merchantCreds: waarmee een call namens een merchant zich meldt: een API
+// key uit de registry, of zolang er geen registry is "from".
+type merchantCreds struct {
+	key  string
+	from string
+}
+
+// requireMerchant: voor wijzigende calls namens merchant. Met de registry
+// (merchants fork) is een API key verplicht: een merchant die niet
+// geregistreerd is of geen keys heeft, wordt geweigerd. Zonder registry
+// bestaan er geen keys; dan geldt "from" = merchant of admin, zoals bij
+// de admin methods.
+func (s *Server) requireMerchant(merchant common.Address, creds merchantCreds) error {
+	if !s.eth.pendingRules().IsMerchants {
+		if !common.IsHexAddress(creds.from) {
+			return errFromRequired
+		}
+		if from := common.HexToAddress(creds.from); from != merchant && from != s.bc.AdminAddr {
+			return errNotMerchant
+		}
+		return nil
+	}
+	m, err := s.merchant(merchant)
+	if err != nil {
+		return err
+	}
+	if m == nil || len(m.APIKeys) == 0 {
+		return errAPIKeyNotConfigured
+	}
+	if creds.key == "" {
+		return errAPIKeyRequired
+	}
+	if !m.HasAPIKey(creds.key) {
+		return errAPIKeyInvalid
+	}
+	return nil
+}
+
+// paramAPIKey: JSON-RPC variant van requestAPIKey, {"apiKey": "..."}.
+func paramAPIKey(raw map[string]interface{}) string {
+	key, _ := raw["apiKey"].(string)
+	return strings.TrimSpace(key)
+}
+
+// paramCreds: JSON-RPC {"apiKey": ..., "from": ...}.
+func paramCreds(raw map[string]interface{}) merchantCreds {
+	from, _ := raw["from"].(string)
+	return merchantCreds{key: paramAPIKey(raw), from: from}
+}
+
+// requestCreds: REST, de key uit de headers en "from" uit body.
+func requestCreds(r *http.Request, body map[string]interface{}) merchantCreds {
+	from, _ := body["from"].(string)
+	return merchantCreds{key: requestAPIKey(r), from: from}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// writeAuthError: 401 zonder of met een verkeerde key, 403 als de
+// merchant geen keys heeft.
+func writeAuthError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errAPIKeyRequired), errors.Is(err, errAPIKeyInvalid), errors.Is(err, errFromRequired):
+		status = http.StatusUnauthorized
+	case errors.Is(err, errAPIKeyNotConfigured), errors.Is(err, errNotMerchant):
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// enableMerchants zet de merchants fork aan vanaf genesis.
+func (e *wsEnv) enableMerchants() {
+	cfg := params.GorrillazzChainConfig()
+	zero := uint64(0)
+	cfg.MerchantsBlock = &zero
+	e.server.SetChainConfig(cfg)
+}
+
+// setMerchant schrijft een registry record zoals een register + addKey
+// tx dat zou doen.
+func (e *wsEnv) setMerchant(t *testing.T, addr common.Address, status string, apiKeys ...string) {
+	t.Helper()
+	m := &core.Merchant{Address: addr, Name: "Shop", Payout: addr, Status: status}
+	for _, key := range apiKeys {
+		m.APIKeys = append(m.APIKeys, core.MerchantAPIKey{Hash: core.HashAPIKey(key)})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bc.State.SetMerchant(addr, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMerchantRPC(t *testing.T) {
+	e := newWSEnv(t)
+	register := map[string]interface{}{"from": intentMerchant.Hex(), "op": "register", "name": "Shop"}
+
+	// Vóór de fork is er geen registry
+	if _, err := e.call("gorr_merchantTx", register); err == nil || !strings.Contains(err.Error(), "not active") {
+		t.Fatalf("gorr_merchantTx before the fork: %v", err)
+	}
+	e.enableMerchants()
+
+	res, err := e.call("gorr_merchantTx", register)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := res.(map[string]interface{})
+	data, err := hexutil.Decode(tx["data"].(string))
+	if err != nil || tx["to"] != params.MerchantRegistryAddress || !strings.HasPrefix(string(data), core.MerchantDataPrefix) {
+		t.Fatalf("register tx %+v", tx)
+	}
+	if call, err := core.ParseMerchantCall(data); err != nil || call.Op != core.MerchantOpRegister || *call.Name != "Shop" {
+		t.Fatalf("register tx data %q: %v", data, err)
+	}
+
+	if res, err := e.call("gorr_getMerchant", intentMerchant.Hex()); err != nil || res != nil {
+		t.Fatalf("unregistered merchant: %v, %v", res, err)
+	}
+	e.setMerchant(t, intentMerchant, core.MerchantStatusActive)
+
+	steps := []struct {
+		name string
+		raw  map[string]interface{}
+		err  string
+	}{
+		{"register twice", register, "already registered"},
+		{"setTier by the merchant", map[string]interface{}{"from": intentMerchant.Hex(), "op": "setTier", "merchant": intentMerchant.Hex(), "tier": "gold"}, "admin"},
+		{"unknown tier", map[string]interface{}{"from": e.bc.AdminAddr.Hex(), "op": "setTier", "merchant": intentMerchant.Hex(), "tier": "platinum"}, "unknown fee tier"},
+		{"bad keyHash", map[string]interface{}{"from": intentMerchant.Hex(), "op": "addKey", "keyHash": "0x12"}, "keyHash"},
+		{"update", map[string]interface{}{"from": intentMerchant.Hex(), "op": "update", "payout": intentPayer.Hex()}, ""},
+	}
+	for _, st := range steps {
+		_, err := e.call("gorr_merchantTx", st.raw)
+		if st.err == "" && err != nil || st.err != "" && (err == nil || !strings.Contains(err.Error(), st.err)) {
+			t.Fatalf("%s: error %v, want %q", st.name, err, st.err)
+		}
+	}
+
+	// De nieuwe key hoort bij de hash in de addKey tx
+	res, err = e.call("gorr_createMerchantAPIKey", map[string]interface{}{"merchant": intentMerchant.Hex(), "label": "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := res.(map[string]interface{})
+	key := created["apiKey"].(string)
+	if created["keyHash"] != core.HashAPIKey(key) {
+		t.Fatalf("keyHash %v for key %s", created["keyHash"], key)
+	}
+
+	res, err = e.call("gorr_getMerchant", map[string]interface{}{"address": intentMerchant.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := res.(map[string]interface{}); m["feeBps"] != uint64(params.DefaultPaymentFeeBps) || m["tier"] != "standard" {
+		t.Fatalf("merchant %+v", m)
+	}
+
+	// Een geschorste merchant krijgt geen nieuwe intents
+	e.setMerchant(t, intentMerchant, core.MerchantStatusSuspended)
+	if _, err := e.call("gorr_createPaymentIntent", map[string]interface{}{"merchant": intentMerchant.Hex(), "amount": "1"}); err == nil || !strings.Contains(err.Error(), "suspended") {
+		t.Fatalf("intent for a suspended merchant: %v", err)
+	}
+}
+
+// Heeft de merchant API keys, dan vraagt REST er één; zonder keys blijft
+// "from" werken.
+func TestMerchantAPIKeyREST(t *testing.T) {
+	e := newWSEnv(t)
+	e.enableMerchants()
+	e.setMerchant(t, intentMerchant, core.MerchantStatusActive, "secret")
+	keyless := common.HexToAddress("0xa12")
+
+	create := func(m common.Address) map[string]interface{} {
+		return map[string]interface{}{"merchant": m.Hex(), "amount": "1000"}
+	}
+	first := e.createIntent(t, nil)
+	second := e.createIntent(t, nil)
+	path := func(id uint64, action string) string {
+		return "/payments/intents/" + strconv.FormatUint(id, 10) + "/" + action
+	}
+	list := "/payments/intents?merchant=" + intentMerchant.Hex()
+	from := map[string]string{"from": intentMerchant.Hex()}
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   interface{}
+		code   int
+	}{
+		{"create without key", "", http.MethodPost, "/payments/intents", create(intentMerchant), http.StatusUnauthorized},
+		{"create with a wrong key", "other", http.MethodPost, "/payments/intents", create(intentMerchant), http.StatusUnauthorized},
+		{"create with the key", "secret", http.MethodPost, "/payments/intents", create(intentMerchant), http.StatusCreated},
+		{"create for a merchant without keys", "", http.MethodPost, "/payments/intents", create(keyless), http.StatusCreated},
+		{"list without key", "", http.MethodGet, list, nil, http.StatusUnauthorized},
+		{"list with the key", "secret", http.MethodGet, list, nil, http.StatusOK},
+		{"cancel with from but without key", "", http.MethodPost, path(first.ID, "cancel"), from, http.StatusUnauthorized},
+		{"cancel with the key and no body", "secret", http.MethodPost, path(first.ID, "cancel"), nil, http.StatusOK},
+		{"settle a pending intent with the key", "secret", http.MethodPost, path(second.ID, "settle"), nil, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := e.restKey(t, tt.key, tt.method, tt.path, tt.body); rec.Code != tt.code {
+			t.Fatalf("%s: %d %s, want %d", tt.name, rec.Code, rec.Body, tt.code)
+		}
+	}
+	if got, _ := e.bc.Payment.GetIntent(first.ID); got.Status != "cancelled" {
+		t.Fatalf("status %s after cancel with the key", got.Status)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/Siasom1/gorrillazz-chain/core"
 	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/params"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -50,6 +52,10 @@ func HandleSendUSDCc(bc *blockchain.Blockchain, params []interface{}) (interface
 	return map[string]interface{}{
 		"success": true,
 		"txHash":  "usdcc_" + from.Hex(),
+		"from":    from.Hex(),
+		"to":      to.Hex(),
+		"net":     amount.String(),
+		"fee":     "0",
 	}, nil
 }
 
@@ -263,12 +269,12 @@ func HandleAdminMintToTreasury(bc *blockchain.Blockchain, params []interface{})
 	}, nil
 }
 
-func HandleSendNative(bc *blockchain.Blockchain, params []interface{}) (interface{}, error) {
-	if len(params) == 0 {
+func HandleSendNative(bc *blockchain.Blockchain, rules params.Rules, args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
 		return nil, errors.New("missing params")
 	}
 
-	raw := params[0].(map[string]interface{})
+	raw := args[0].(map[string]interface{})
 
 	from := common.HexToAddress(raw["from"].(string))
 	to := common.HexToAddress(raw["to"].(string))
@@ -286,8 +292,23 @@ func HandleSendNative(bc *blockchain.Blockchain, params []interface{}) (interfac
 	// convert to wei (18 decimals)
 	amount := new(big.Int).Mul(baseAmount, big.NewInt(1e18))
 
-	// 2️⃣ fee calculation
-	bps := bc.State.GetMerchantFeeBps()
+	// paused: weigeren vóór er balances veranderen
+	if bc.State.Paused {
+		return nil, errors.New("transfers paused")
+	}
+
+	// 2️⃣ fee calculation: een geregistreerde merchant betaalt zijn eigen
+	// fee (tier) en ontvangt op zijn payout adres
+	bps, payout := bc.State.GetMerchantFeeBps(), to
+	if rules.IsMerchants {
+		m, err := core.GetMerchant(bc.State, to)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			bps, payout = m.FeeBps(rules), m.Payout
+		}
+	}
 	fee := calculateFee(amount, bps)
 	net := new(big.Int).Sub(amount, fee)
 
@@ -297,7 +318,7 @@ func HandleSendNative(bc *blockchain.Blockchain, params []interface{}) (interfac
 	}
 
 	// 4️⃣ receiver gets net
-	bc.State.AddBalance(to, net)
+	bc.State.AddBalance(payout, net)
 
 	// 5️⃣ treasury gets fee
 	if fee.Sign() > 0 {
@@ -305,14 +326,11 @@ func HandleSendNative(bc *blockchain.Blockchain, params []interface{}) (interfac
 		bc.State.AddCollectedFee("GORR", fee)
 	}
 
-	if bc.State.Paused {
-		return nil, errors.New("transfers paused")
-	}
-
 	return map[string]interface{}{
 		"success": true,
 		"from":    from.Hex(),
 		"to":      to.Hex(),
+		"payout":  payout.Hex(),
 		"net":     net.String(),
 		"fee":     fee.String(),
 	}, nil
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Siasom1/gorrillazz-chain/p2p"
+)
+
+//
+// ------------------------------------------------------------
+// P2P: peers
+// ------------------------------------------------------------
+//
+
+var errNoP2P = errors.New("p2p not enabled")
+
+// SetP2P maakt net_peerCount / gorr_peers / eth_syncing beschikbaar.
+func (s *Server) SetP2P(srv *p2p.Server) {
+	s.p2p = srv
+	s.eth.sync = srv
+}
+
+// net_peerCount
+func (s *Server) handlePeerCount() (interface{}, error) {
+	if s.p2p == nil {
+		return "0x0", nil
+	}
+	return fmt.Sprintf("0x%x", s.p2p.PeerCount()), nil
+}
+
+// gorr_peers → verbonden peers + hun status uit de handshake.
+func (s *Server) handlePeers() (interface{}, error) {
+	if s.p2p == nil {
+		return nil, errNoP2P
+	}
+
+	peers := []map[string]interface{}{}
+	for _, p := range s.p2p.Peers() {
+		st := p.Status()
+		peers = append(peers, map[string]interface{}{
+			"id":         p.ID(),
+			"remoteAddr": p.RemoteAddr(),
+			"listenAddr": st.ListenAddr,
+			"headNumber": st.HeadNumber,
+			"headHash":   st.HeadHash,
+		})
+	}
+
+	return map[string]interface{}{
+		"nodeId":  s.p2p.NodeID(),
+		"genesis": s.p2p.Genesis(),
+		"peers":   peers,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	payment_gateway "github.com/Siasom1/gorrillazz-chain/modules/payment_gateway"
+	"github.com/Siasom1/gorrillazz-chain/modules/qrcode"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// PAYMENT LINKS — EIP-681 URI + QR code per intent
+// ------------------------------------------------------------
+// Voor kassa's: een wallet scant de QR code en heeft dan de hele tx
+// (ontvanger, bedrag, GORR_PAY memo), zonder dat de klant iets typt.
+//
+//	GORR:  ethereum:<merchant>@<chainId>?value=<wei>&gasLimit=<gas>&data=0x<"GORR_PAY:<id>[:<amount>:<expiry>]">
+//	USDCc: ethereum:<USDCc>@<chainId>?value=0&gasLimit=<gas>&data=0x<transfer + memo>
+//
+// De memo staat hex in data, zoals wallets tx data verwachten. Voor USDCc
+// is het geen /transfer?address=..&uint256=.. link: daarin past de memo
+// achter de calldata niet. Het bedrag is wat er nog openstaat, dus na een
+// deelbetaling geeft dezelfde endpoint een link voor de rest.
+//
+
+// Pixels per QR module: standaard en maximum voor ?scale=
+const (
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// paymentLink bouwt de link voor intent id; alleen voor intents waar nog
+// betaald kan worden.
+func (s *Server) paymentLink(id uint64) (map[string]interface{}, error) {
+	if s.bc.Payment == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+	intent, err := s.bc.Payment.GetIntent(id)
+	if err != nil {
+		return nil, err
+	}
+	if intent.Status != payment_gateway.StatusPending && intent.Status != payment_gateway.StatusPartiallyPaid {
+		return nil, fmt.Errorf("intent %d can no longer be paid (status %s)", id, intent.Status)
+	}
+	due := payment_gateway.Outstanding(intent)
+	if due.Sign() == 0 {
+		return nil, fmt.Errorf("intent %d has nothing left to pay", id)
+	}
+
+	// Vanaf de paymentTerms fork tekent de payer de terms van het intent mee
+	rules := s.eth.pendingRules()
+	var terms *core.PaymentTerms
+	if rules.IsPaymentTerms {
+		terms = &core.PaymentTerms{Amount: intent.Amount, Expiry: intent.Expiry}
+	}
+	memo := string(core.PaymentData(id, terms))
+	to, value, data := intent.Merchant, due, []byte(memo)
+	if intent.Token == "USDCc" {
+		to, value = params.USDCcTokenAddress, new(big.Int)
+		data = core.USDCcPaymentData(intent.Merchant, due, id, terms)
+	}
+	gas, err := core.TxIntrinsicGas(rules, &to, data)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("ethereum:%s@%d?value=%s&gasLimit=%d&data=%s",
+		to.Hex(), s.eth.chainID, value, gas, hexutil.Encode(data))
+
+	return map[string]interface{}{
+		"intentId": id,
+		"token":    intent.Token,
+		"amount":   due.String(),
+		"memo":     memo,
+		"uri":      uri,
+		"qr":       fmt.Sprintf("/payments/intents/%d/qr.png", id),
+		"tx": map[string]interface{}{
+			"to":      to,
+			"value":   hexBig(value),
+			"data":    hexutil.Encode(data),
+			"gas":     hexutil.Uint64(gas),
+			"chainId": hexutil.Uint64(s.eth.chainID),
+		},
+	}, nil
+}
+
+// paymentQR: de URI van de link als PNG.
+func (s *Server) paymentQR(id uint64, scale int) ([]byte, error) {
+	link, err := s.paymentLink(id)
+	if err != nil {
+		return nil, err
+	}
+	code, err := qrcode.Encode([]byte(link["uri"].(string)))
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(scale)
+}
+
+// ---------------- JSON-RPC ----------------
+
+// gorr_getPaymentLink [id | {id, qr?}] → link; met qr=true ook de PNG als
+// data: URI
+func (s *Server) handleGetPaymentLink(params []interface{}) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, errors.New("missing intent id")
+	}
+	v := params[0]
+	var withQR bool
+	if m, ok := params[0].(map[string]interface{}); ok {
+		v = m["id"]
+		withQR, _ = m["qr"].(bool)
+	}
+	id, err := parseQuantity(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid intent id: %v", err)
+	}
+	link, err := s.paymentLink(id)
+	if err != nil || !withQR {
+		return link, err
+	}
+	png, err := s.paymentQR(id, defaultQRScale)
+	if err != nil {
+		return nil, err
+	}
+	link["qrDataUri"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	return link, nil
+}
+
+// ---------------- REST ----------------
+
+// GET /payments/intents/{id}/link
+func (s *Server) handlePaymentLinkREST(w http.ResponseWriter, r *http.Request, id uint64) {
+	link, err := s.paymentLink(id)
+	if err != nil {
+		http.Error(w, err.Error(), intentErrorStatus(err))
+		return
+	}
+	writeREST(w, http.StatusOK, link)
+}
+
+// GET /payments/intents/{id}/qr.png[?scale=1..32]
+func (s *Server) handlePaymentQR(w http.ResponseWriter, r *http.Request, id uint64) {
+	scale := defaultQRScale
+	if v := r.URL.Query().Get("scale"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQRScale {
+			http.Error(w, fmt.Sprintf("scale must be 1-%d", maxQRScale), http.StatusBadRequest)
+			return
+		}
+		scale = n
+	}
+	png, err := s.paymentQR(id, scale)
+	if err != nil {
+		http.Error(w, err.Error(), intentErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(png)
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+func TestPaymentLink(t *testing.T) {
+	e := newWSEnv(t)
+	gorr := e.createIntent(t, nil)
+	usdcc := e.createIntent(t, map[string]interface{}{"token": "USDCc"})
+	paid := e.createIntent(t, nil)
+	e.pay(t, paid.ID)
+
+	link := func(id uint64) map[string]interface{} {
+		t.Helper()
+		res, err := e.call("gorr_getPaymentLink", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(map[string]interface{})
+	}
+
+	// GORR: naar de merchant, met de memo als data
+	got := link(gorr.ID)
+	memo := fmt.Sprintf("GORR_PAY:%d", gorr.ID)
+	want := fmt.Sprintf("ethereum:%s@9999?value=1000&gasLimit=", intentMerchant.Hex())
+	if !strings.HasPrefix(got["uri"].(string), want) || !strings.HasSuffix(got["uri"].(string), "&data="+hexutil.Encode([]byte(memo))) {
+		t.Fatalf("GORR uri %s", got["uri"])
+	}
+	if got["memo"] != memo || got["amount"] != "1000" || got["token"] != "GORR" {
+		t.Fatalf("GORR link %+v", got)
+	}
+
+	// USDCc: een transfer call op het token met de memo erachter
+	got = link(usdcc.ID)
+	tx := got["tx"].(map[string]interface{})
+	data, err := hexutil.Decode(tx["data"].(string))
+	if err != nil || tx["to"] != params.USDCcTokenAddress {
+		t.Fatalf("USDCc tx %+v", tx)
+	}
+	tr, err := core.ParseUSDCcTransfer(e.server.eth.pendingRules(), data)
+	if err != nil || tr.To != intentMerchant || tr.Amount.Int64() != 1000 || tr.IntentID != usdcc.ID || !tr.IsPayment {
+		t.Fatalf("USDCc transfer %+v, %v", tr, err)
+	}
+	if !strings.HasPrefix(got["uri"].(string), "ethereum:"+params.USDCcTokenAddress.Hex()+"@9999?value=0&") {
+		t.Fatalf("USDCc uri %s", got["uri"])
+	}
+
+	// Een betaald intent heeft geen link meer
+	if _, err := e.call("gorr_getPaymentLink", paid.ID); err == nil || !strings.Contains(err.Error(), "can no longer be paid") {
+		t.Fatalf("link for a paid intent: %v", err)
+	}
+
+	// Met qr=true komt de PNG als data URI mee
+	res, err := e.call("gorr_getPaymentLink", map[string]interface{}{"id": gorr.ID, "qr": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := res.(map[string]interface{})["qrDataUri"].(string)
+	png, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/png;base64,"))
+	if err != nil || !bytes.HasPrefix(png, pngMagic) {
+		t.Fatalf("qrDataUri %.40s...: %v", uri, err)
+	}
+}
+
+func TestPaymentLinkREST(t *testing.T) {
+	e := newWSEnv(t)
+	open := e.createIntent(t, nil)
+	paid := e.createIntent(t, nil)
+	e.pay(t, paid.ID)
+	path := func(id uint64, rest string) string {
+		return "/payments/intents/" + strconv.FormatUint(id, 10) + "/" + rest
+	}
+
+	tests := []struct {
+		name string
+		path string
+		code int
+		png  bool
+	}{
+		{"link", path(open.ID, "link"), http.StatusOK, false},
+		{"qr", path(open.ID, "qr.png"), http.StatusOK, true},
+		{"qr with scale", path(open.ID, "qr.png?scale=2"), http.StatusOK, true},
+		{"scale 0", path(open.ID, "qr.png?scale=0"), http.StatusBadRequest, false},
+		{"scale too big", path(open.ID, "qr.png?scale=33"), http.StatusBadRequest, false},
+		{"paid intent", path(paid.ID, "link"), http.StatusConflict, false},
+		{"unknown intent", path(99, "qr.png"), http.StatusNotFound, false},
+		{"unknown resource", path(open.ID, "qr.svg"), http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		rec := e.rest(t, http.MethodGet, tt.path, nil)
+		if rec.Code != tt.code {
+			t.Fatalf("%s: %d %s, want %d", tt.name, rec.Code, rec.Body, tt.code)
+		}
+		if tt.png && (rec.Header().Get("Content-Type") != "image/png" || !bytes.HasPrefix(rec.Body.Bytes(), pngMagic)) {
+			t.Fatalf("%s: not a PNG (%s)", tt.name, rec.Header().Get("Content-Type"))
+		}
+	}
+}
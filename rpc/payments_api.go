@@ -0,0 +1,435 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	payment_gateway "github.com/Siasom1/gorrillazz-chain/modules/payment_gateway"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// PAYMENT INTENTS — gorr_*PaymentIntent + REST /payments/intents
+// ------------------------------------------------------------
+// Aanmaken mag iedereen (de merchant zit in het intent). Intrekken,
+// refunden en settlen alleen met een API key van de merchant, via
+// JSON-RPC ({"apiKey": ...}) en REST (X-Api-Key) gelijk; merchants
+// zonder key in de registry kunnen dat niet. Vóór de merchants fork is
+// er geen registry en geldt {"from": merchant of admin} (requireMerchant). Een
+// refund verplaatst geld van de merchant en gaat dus on-chain: de node
+// geeft de GORR_REFUND tx terug die de merchant tekent.
+//
+
+// Beheeracties op een bestaande intent
+const (
+	intentActionCancel = "cancel"
+	intentActionRefund = "refund"
+	intentActionSettle = "settle"
+)
+
+// createPaymentIntent: {merchant, amount (wei), token?, expiresIn?,
+// orderRef?, metadata?}. Token is standaard GORR.
+func (s *Server) createPaymentIntent(raw map[string]interface{}) (*payment_gateway.PaymentIntent, error) {
+	if s.bc.Payment == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+
+	merchantStr, _ := raw["merchant"].(string)
+	if !common.IsHexAddress(merchantStr) {
+		return nil, errors.New("invalid merchant address")
+	}
+
+	v, ok := raw["amount"]
+	if !ok {
+		return nil, errors.New("missing amount")
+	}
+	amount, err := parseAmount(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount: %v", err)
+	}
+
+	token := "GORR"
+	if v, ok := raw["token"]; ok {
+		t, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid token")
+		}
+		token = t
+	}
+
+	var opts payment_gateway.IntentOptions
+	if v, ok := raw["expiresIn"]; ok {
+		secs, err := parseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresIn: %v", err)
+		}
+		opts.ExpirySeconds = secs
+	}
+	if v, ok := raw["orderRef"]; ok {
+		ref, ok := v.(string)
+		if !ok {
+			return nil, errors.New("orderRef must be a string")
+		}
+		opts.OrderRef = ref
+	}
+	if v, ok := raw["metadata"]; ok && v != nil {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("metadata must be an object")
+		}
+		opts.Metadata = make(map[string]string, len(m))
+		for k, val := range m {
+			str, ok := val.(string)
+			if !ok {
+				return nil, fmt.Errorf("metadata value for %q must be a string", k)
+			}
+			opts.Metadata[k] = str
+		}
+	}
+
+	m, err := s.merchant(common.HexToAddress(merchantStr))
+	if err != nil {
+		return nil, err
+	}
+	if m != nil && m.Status == core.MerchantStatusSuspended {
+		return nil, fmt.Errorf("merchant %s is suspended", m.Address.Hex())
+	}
+
+	pg := s.bc.Payment
+	intent, _, err := pg.CreateIntentWithOptions(common.HexToAddress(merchantStr), amount, token, pg.Now(), opts)
+	return intent, err
+}
+
+// managePaymentIntent voert action uit namens de merchant (creds).
+func (s *Server) managePaymentIntent(action string, id uint64, creds merchantCreds) (*payment_gateway.PaymentIntent, error) {
+	pg := s.bc.Payment
+	if pg == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+
+	intent, err := pg.GetIntent(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireMerchant(intent.Merchant, creds); err != nil {
+		return nil, err
+	}
+
+	switch action {
+	case intentActionCancel:
+		return pg.CancelIntent(id)
+	case intentActionSettle:
+		return pg.SettleIntent(id)
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+// refundTx bouwt de (ongetekende) GORR_REFUND tx voor intent id namens
+// de merchant (creds): {amount?, refundFee?}. Zonder amount wordt alles wat nog open
+// staat teruggestort; refundFee geeft het evenredige deel van de fee uit
+// de treasury terug (chain config refundFees).
+func (s *Server) refundTx(id uint64, creds merchantCreds, raw map[string]interface{}) (map[string]interface{}, error) {
+	pg := s.bc.Payment
+	if pg == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+	intent, err := pg.GetIntent(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireMerchant(intent.Merchant, creds); err != nil {
+		return nil, err
+	}
+	rules := s.eth.pendingRules()
+	if !rules.IsRefunds {
+		return nil, errors.New("on-chain refunds are not active yet (refunds fork)")
+	}
+
+	open, openFee := payment_gateway.Refundable(intent)
+	amount := open
+	if v, ok := raw["amount"]; ok {
+		if amount, err = parseAmount(v); err != nil {
+			return nil, fmt.Errorf("invalid amount: %v", err)
+		}
+	}
+	fee := new(big.Int)
+	if withFee, _ := raw["refundFee"].(bool); withFee {
+		if !rules.RefundFees {
+			return nil, core.ErrRefundFeesDisabled
+		}
+		fee.Set(openFee)
+		if amount.Cmp(open) < 0 && open.Sign() > 0 {
+			fee.Mul(openFee, amount).Div(fee, open)
+		}
+	}
+	// Vanaf de paymentTerms fork alleen een fee refund met payment record
+	if fee.Sign() > 0 && rules.IsPaymentTerms {
+		rec, err := core.GetPaymentRecord(s.bc.State, intent.Merchant, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			return nil, fmt.Errorf("intent %d was paid before the paymentTerms fork: refund without refundFee", id)
+		}
+	}
+	if err := pg.CheckRefund(id, intent.Merchant, intent.Payer, intent.Token, amount, fee); err != nil {
+		return nil, err
+	}
+
+	to, value := intent.Payer, amount
+	data := core.RefundData(id, fee)
+	if intent.Token == "USDCc" {
+		to, value = params.USDCcTokenAddress, new(big.Int)
+		data = core.USDCcRefundData(intent.Payer, amount, id, fee)
+	}
+	gas, err := core.TxIntrinsicGas(rules, &to, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"intent": intent,
+		"refund": map[string]string{
+			"amount": amount.String(),
+			"fee":    fee.String(),
+		},
+		"tx": map[string]interface{}{
+			"from":  intent.Merchant,
+			"to":    to,
+			"value": hexBig(value),
+			"data":  hexutil.Encode(data),
+			"gas":   hexutil.Uint64(gas),
+		},
+	}, nil
+}
+
+// ---------------- JSON-RPC ----------------
+
+// gorr_createPaymentIntent [{merchant, amount, token, expiresIn, orderRef, metadata}]
+func (s *Server) handleCreatePaymentIntent(params []interface{}) (interface{}, error) {
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.createPaymentIntent(raw)
+}
+
+// gorr_getPaymentIntent [id | {id}]
+func (s *Server) handleGetPaymentIntent(params []interface{}) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, errors.New("missing intent id")
+	}
+	v := params[0]
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["id"]
+	}
+	id, err := parseQuantity(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid intent id: %v", err)
+	}
+	if s.bc.Payment == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+	return s.bc.Payment.GetIntent(id)
+}
+
+// gorr_cancelPaymentIntent / gorr_settlePaymentIntent [{id, apiKey | from}]
+// gorr_refundPaymentIntent [{id, apiKey | from, amount?, refundFee?}] → te tekenen tx
+func (s *Server) handleManagePaymentIntent(action string, params []interface{}) (interface{}, error) {
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseQuantity(raw["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid intent id: %v", err)
+	}
+	if action == intentActionRefund {
+		return s.refundTx(id, paramCreds(raw), raw)
+	}
+	return s.managePaymentIntent(action, id, paramCreds(raw))
+}
+
+// ---------------- REST ----------------
+
+// POST /payments/intents                       → nieuw intent (201)
+// GET  /payments/intents?merchant=0x..[&status=][&orderRef=]
+func (s *Server) handlePaymentIntents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var raw map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if merchant, _ := raw["merchant"].(string); common.IsHexAddress(merchant) {
+			if _, err := s.authorizeMerchant(r, common.HexToAddress(merchant)); err != nil {
+				writeAuthError(w, err)
+				return
+			}
+		}
+		intent, err := s.createPaymentIntent(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeREST(w, http.StatusCreated, intent)
+
+	case http.MethodGet:
+		q := r.URL.Query()
+		merchant := q.Get("merchant")
+		if !common.IsHexAddress(merchant) {
+			http.Error(w, "missing or invalid merchant", http.StatusBadRequest)
+			return
+		}
+		if _, err := s.authorizeMerchant(r, common.HexToAddress(merchant)); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		status, orderRef := q.Get("status"), q.Get("orderRef")
+
+		list := []*payment_gateway.PaymentIntent{}
+		for _, i := range s.bc.Payment.ListMerchantPayments(common.HexToAddress(merchant)) {
+			if status != "" && string(i.Status) != status {
+				continue
+			}
+			if orderRef != "" && i.OrderRef != orderRef {
+				continue
+			}
+			list = append(list, i)
+		}
+		writeREST(w, http.StatusOK, list)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET  /payments/intents/{id}
+// GET  /payments/intents/{id}/link|qr.png     (payment_links_api.go)
+// POST /payments/intents/{id}/cancel|settle
+// POST /payments/intents/{id}/refund          body {"amount"?, "refundFee"?}
+// Acties alleen met een API key van de merchant (X-Api-Key); vóór de
+// merchants fork met body {"from": merchant of admin}.
+func (s *Server) handlePaymentIntent(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/payments/intents/"), "/"), "/")
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		intent, err := s.bc.Payment.GetIntent(id)
+		if err != nil {
+			http.Error(w, err.Error(), intentErrorStatus(err))
+			return
+		}
+		writeREST(w, http.StatusOK, intent)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		switch parts[1] {
+		case "link":
+			s.handlePaymentLinkREST(w, r, id)
+		case "qr.png":
+			s.handlePaymentQR(w, r, id)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	action := parts[1]
+	if action != intentActionCancel && action != intentActionRefund && action != intentActionSettle {
+		http.NotFound(w, r)
+		return
+	}
+	intent, err := s.bc.Payment.GetIntent(id)
+	if err != nil {
+		http.Error(w, err.Error(), intentErrorStatus(err))
+		return
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	creds := requestCreds(r, body)
+	if err := s.requireMerchant(intent.Merchant, creds); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	var res interface{}
+	if action == intentActionRefund {
+		res, err = s.refundTx(id, creds, body)
+	} else {
+		res, err = s.managePaymentIntent(action, id, creds)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), intentErrorStatus(err))
+		return
+	}
+	writeREST(w, http.StatusOK, res)
+}
+
+// ---------------- helpers ----------------
+
+func intentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, payment_gateway.ErrIntentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAPIKeyRequired), errors.Is(err, errAPIKeyInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, errAPIKeyNotConfigured):
+		return http.StatusForbidden
+	default:
+		return http.StatusConflict
+	}
+}
+
+func writeREST(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// objectParam: params[0] als JSON object.
+func objectParam(params []interface{}) (map[string]interface{}, error) {
+	if len(params) == 0 {
+		return nil, errors.New("missing params")
+	}
+	raw, ok := params[0].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("params[0] must be an object")
+	}
+	return raw, nil
+}
+
+// parseAmount: bedrag in wei als decimale string, 0x-hex of JSON number.
+func parseAmount(v interface{}) (*big.Int, error) {
+	if str, ok := v.(string); ok && strings.HasPrefix(str, "0x") {
+		return hexutil.DecodeBig(str)
+	}
+	return parseBigInt(v)
+}
@@ -0,0 +1,323 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	payment_gateway "github.com/Siasom1/gorrillazz-chain/modules/payment_gateway"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	intentMerchant = common.HexToAddress("0xa11")
+	intentPayer    = common.HexToAddress("0xb0b")
+)
+
+// createIntent: gorr_createPaymentIntent voor intentMerchant.
+func (e *wsEnv) createIntent(t *testing.T, extra map[string]interface{}) *payment_gateway.PaymentIntent {
+	t.Helper()
+	raw := map[string]interface{}{"merchant": intentMerchant.Hex(), "amount": "1000"}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	res, err := e.call("gorr_createPaymentIntent", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.(*payment_gateway.PaymentIntent)
+}
+
+// pay: intent id volledig betaald, zoals de producer het in een block doet.
+func (e *wsEnv) pay(t *testing.T, id uint64) {
+	t.Helper()
+	pg := e.bc.Payment
+	if _, err := pg.MarkPaidFromTx(nil, id, intentPayer, intentMerchant, "GORR", big.NewInt(1000), big.NewInt(25), common.Hash{byte(id)}, 1, pg.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreatePaymentIntentValidation(t *testing.T) {
+	e := newWSEnv(t)
+	m := intentMerchant.Hex()
+
+	tests := []struct {
+		name string
+		raw  interface{}
+		err  string
+	}{
+		{"no object", "x", "params[0] must be an object"},
+		{"bad merchant", map[string]interface{}{"merchant": "0x12", "amount": "1"}, "invalid merchant address"},
+		{"no amount", map[string]interface{}{"merchant": m}, "missing amount"},
+		{"zero amount", map[string]interface{}{"merchant": m, "amount": "0"}, "amount must be positive"},
+		{"token not a string", map[string]interface{}{"merchant": m, "amount": "1", "token": 1}, "invalid token"},
+		{"metadata value not a string", map[string]interface{}{"merchant": m, "amount": "1", "metadata": map[string]interface{}{"k": 1}}, "must be a string"},
+		{"expiry too long", map[string]interface{}{"merchant": m, "amount": "1", "expiresIn": payment_gateway.MaxExpirySeconds + 1}, "expiry above"},
+	}
+	for _, tt := range tests {
+		if _, err := e.call("gorr_createPaymentIntent", tt.raw); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	intent := e.createIntent(t, map[string]interface{}{
+		"amount": "0x3e8", "token": "USDCc", "expiresIn": 60, "orderRef": "order-1", "metadata": map[string]interface{}{"sku": "42"},
+	})
+	for _, param := range []interface{}{intent.ID, map[string]interface{}{"id": intent.ID}} {
+		res, err := e.call("gorr_getPaymentIntent", param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := res.(*payment_gateway.PaymentIntent)
+		if got.Amount.Int64() != 1000 || got.Token != "USDCc" || got.OrderRef != "order-1" || got.Metadata["sku"] != "42" ||
+			got.Expiry != got.Timestamp+60 || got.Status != payment_gateway.StatusPending {
+			t.Fatalf("gorr_getPaymentIntent(%v) = %+v", param, got)
+		}
+	}
+	if _, err := e.call("gorr_getPaymentIntent", 99); err == nil {
+		t.Fatal("unknown intent found")
+	}
+}
+
+// Elke stap is een beheeractie via JSON-RPC op intent 1 (pending) of
+// intent 2 (betaald), met een API key van de merchant.
+func TestManagePaymentIntent(t *testing.T) {
+	e := newWSEnv(t)
+	e.enableMerchants()
+	e.setMerchant(t, intentMerchant, core.MerchantStatusActive, "secret")
+	pending := e.createIntent(t, nil)
+	paid := e.createIntent(t, nil)
+	e.pay(t, paid.ID)
+
+	steps := []struct {
+		name   string
+		method string
+		id     uint64
+		key    string
+		err    string
+		status payment_gateway.PaymentStatus
+	}{
+		{"cancel without a key", "gorr_cancelPaymentIntent", pending.ID, "", "requires an API key", payment_gateway.StatusPending},
+		{"cancel with a wrong key", "gorr_cancelPaymentIntent", pending.ID, "other", "invalid API key", payment_gateway.StatusPending},
+		{"settle a pending intent", "gorr_settlePaymentIntent", pending.ID, "secret", "only paid or refunded", payment_gateway.StatusPending},
+		{"cancel", "gorr_cancelPaymentIntent", pending.ID, "secret", "", payment_gateway.StatusCancelled},
+		{"cancel twice", "gorr_cancelPaymentIntent", pending.ID, "secret", "only pending intents", payment_gateway.StatusCancelled},
+		{"settle a cancelled intent", "gorr_settlePaymentIntent", pending.ID, "secret", "only paid or refunded", payment_gateway.StatusCancelled},
+
+		{"cancel after paid", "gorr_cancelPaymentIntent", paid.ID, "secret", "only pending intents", payment_gateway.StatusPaid},
+		{"settle with a wrong key", "gorr_settlePaymentIntent", paid.ID, "other", "invalid API key", payment_gateway.StatusPaid},
+		{"settle", "gorr_settlePaymentIntent", paid.ID, "secret", "", payment_gateway.StatusSettled},
+		{"settle twice", "gorr_settlePaymentIntent", paid.ID, "secret", "only paid or refunded", payment_gateway.StatusSettled},
+
+		{"unknown intent", "gorr_cancelPaymentIntent", 99, "secret", "not found", ""},
+	}
+	for _, st := range steps {
+		_, err := e.call(st.method, map[string]interface{}{"id": st.id, "apiKey": st.key})
+		if st.err == "" && err != nil || st.err != "" && (err == nil || !strings.Contains(err.Error(), st.err)) {
+			t.Fatalf("%s: error %v, want %q", st.name, err, st.err)
+		}
+		if st.status == "" {
+			continue
+		}
+		if got, _ := e.bc.Payment.GetIntent(st.id); got.Status != st.status {
+			t.Fatalf("%s: status %s, want %s", st.name, got.Status, st.status)
+		}
+	}
+
+	// Een merchant zonder keys kan zijn intents niet beheren
+	keyless := e.createIntent(t, map[string]interface{}{"merchant": intentPayer.Hex()})
+	if _, err := e.call("gorr_cancelPaymentIntent", map[string]interface{}{"id": keyless.ID}); err == nil || !strings.Contains(err.Error(), "no API key") {
+		t.Fatalf("cancel for a merchant without keys: %v", err)
+	}
+}
+
+// Zonder merchant registry (de standaard config) beheert de merchant of
+// de admin zijn intents met "from"; met de registry is een key nodig.
+func TestManagePaymentIntentWithoutRegistry(t *testing.T) {
+	e := newWSEnv(t)
+	pending := e.createIntent(t, nil)
+	paid := e.createIntent(t, nil)
+	e.pay(t, paid.ID)
+	merchant, admin, other := intentMerchant.Hex(), e.bc.AdminAddr.Hex(), intentPayer.Hex()
+
+	steps := []struct {
+		name   string
+		method string
+		id     uint64
+		creds  map[string]interface{}
+		err    string
+		status payment_gateway.PaymentStatus
+	}{
+		{"cancel without from", "gorr_cancelPaymentIntent", pending.ID, nil, "send \"from\"", payment_gateway.StatusPending},
+		{"cancel with only a key", "gorr_cancelPaymentIntent", pending.ID, map[string]interface{}{"apiKey": "secret"}, "send \"from\"", payment_gateway.StatusPending},
+		{"cancel by someone else", "gorr_cancelPaymentIntent", pending.ID, map[string]interface{}{"from": other}, "only the merchant or admin", payment_gateway.StatusPending},
+		{"cancel by the merchant", "gorr_cancelPaymentIntent", pending.ID, map[string]interface{}{"from": merchant}, "", payment_gateway.StatusCancelled},
+		{"settle by someone else", "gorr_settlePaymentIntent", paid.ID, map[string]interface{}{"from": other}, "only the merchant or admin", payment_gateway.StatusPaid},
+		{"settle by the admin", "gorr_settlePaymentIntent", paid.ID, map[string]interface{}{"from": admin}, "", payment_gateway.StatusSettled},
+	}
+	for _, st := range steps {
+		raw := map[string]interface{}{"id": st.id}
+		for k, v := range st.creds {
+			raw[k] = v
+		}
+		_, err := e.call(st.method, raw)
+		if st.err == "" && err != nil || st.err != "" && (err == nil || !strings.Contains(err.Error(), st.err)) {
+			t.Fatalf("%s: error %v, want %q", st.name, err, st.err)
+		}
+		if got, _ := e.bc.Payment.GetIntent(st.id); got.Status != st.status {
+			t.Fatalf("%s: status %s, want %s", st.name, got.Status, st.status)
+		}
+	}
+
+	// REST: "from" in de body
+	rest := e.createIntent(t, nil)
+	path := "/payments/intents/" + strconv.FormatUint(rest.ID, 10) + "/cancel"
+	for _, c := range []struct {
+		body   interface{}
+		status int
+	}{
+		{nil, http.StatusUnauthorized},
+		{map[string]string{"from": other}, http.StatusForbidden},
+		{map[string]string{"from": merchant}, http.StatusOK},
+	} {
+		if rec := e.rest(t, http.MethodPost, path, c.body); rec.Code != c.status {
+			t.Fatalf("REST cancel with %v: %d %s, want %d", c.body, rec.Code, rec.Body, c.status)
+		}
+	}
+
+	// Met de registry is "from" niet meer genoeg
+	e.enableMerchants()
+	keyed := e.createIntent(t, nil)
+	if _, err := e.call("gorr_cancelPaymentIntent", map[string]interface{}{"id": keyed.ID, "from": merchant}); err == nil || !strings.Contains(err.Error(), "no API key") {
+		t.Fatalf("cancel with from after the merchants fork: %v", err)
+	}
+}
+
+// rest: request op de /payments/intents handlers.
+func (e *wsEnv) rest(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.restKey(t, "", method, path, body)
+}
+
+// restKey: zoals rest, met apiKey in de X-Api-Key header.
+func (e *wsEnv) restKey(t *testing.T, apiKey, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if apiKey != "" {
+		req.Header.Set(APIKeyHeader, apiKey)
+	}
+	rec := httptest.NewRecorder()
+	if path == "/payments/intents" || strings.HasPrefix(path, "/payments/intents?") {
+		e.server.handlePaymentIntents(rec, req)
+	} else {
+		e.server.handlePaymentIntent(rec, req)
+	}
+	return rec
+}
+
+func TestPaymentIntentsREST(t *testing.T) {
+	e := newWSEnv(t)
+	e.enableMerchants()
+	e.setMerchant(t, intentMerchant, core.MerchantStatusActive, "secret")
+
+	rec := e.restKey(t, "secret", http.MethodPost, "/payments/intents", map[string]interface{}{
+		"merchant": intentMerchant.Hex(), "amount": "1000", "orderRef": "a",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	var created payment_gateway.PaymentIntent
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	second := e.createIntent(t, map[string]interface{}{"orderRef": "b"})
+	e.pay(t, second.ID)
+
+	id := func(n uint64) string { return "/payments/intents/" + strconv.FormatUint(n, 10) }
+	list := "/payments/intents?merchant=" + intentMerchant.Hex()
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   interface{}
+		code   int
+		ids    []uint64 // bij een lijst: verwachte ids
+	}{
+		{"create without merchant", "secret", http.MethodPost, "/payments/intents", map[string]string{"amount": "1"}, http.StatusBadRequest, nil},
+		{"list", "secret", http.MethodGet, list, nil, http.StatusOK, []uint64{created.ID, second.ID}},
+		{"list by status", "secret", http.MethodGet, list + "&status=paid", nil, http.StatusOK, []uint64{second.ID}},
+		{"list by orderRef", "secret", http.MethodGet, list + "&orderRef=a", nil, http.StatusOK, []uint64{created.ID}},
+		{"list without merchant", "secret", http.MethodGet, "/payments/intents", nil, http.StatusBadRequest, nil},
+		{"get", "", http.MethodGet, id(created.ID), nil, http.StatusOK, nil},
+		{"get unknown", "", http.MethodGet, id(99), nil, http.StatusNotFound, nil},
+		{"unknown action", "secret", http.MethodPost, id(created.ID) + "/pay", nil, http.StatusNotFound, nil},
+		{"cancel without a key", "", http.MethodPost, id(created.ID) + "/cancel", nil, http.StatusUnauthorized, nil},
+		{"cancel with from instead of a key", "", http.MethodPost, id(created.ID) + "/cancel", map[string]string{"from": intentMerchant.Hex()}, http.StatusUnauthorized, nil},
+		{"cancel with a wrong key", "other", http.MethodPost, id(created.ID) + "/cancel", nil, http.StatusUnauthorized, nil},
+		{"cancel after paid", "secret", http.MethodPost, id(second.ID) + "/cancel", nil, http.StatusConflict, nil},
+		{"cancel", "secret", http.MethodPost, id(created.ID) + "/cancel", nil, http.StatusOK, nil},
+		{"settle", "secret", http.MethodPost, id(second.ID) + "/settle", nil, http.StatusOK, nil},
+		{"get with POST", "secret", http.MethodPost, id(created.ID), nil, http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		rec := e.restKey(t, tt.key, tt.method, tt.path, tt.body)
+		if rec.Code != tt.code {
+			t.Fatalf("%s: %d %s, want %d", tt.name, rec.Code, rec.Body, tt.code)
+		}
+		if tt.ids == nil {
+			continue
+		}
+		var list []payment_gateway.PaymentIntent
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		got := []uint64{}
+		for _, i := range list {
+			got = append(got, i.ID)
+		}
+		if !equalIDs(got, tt.ids) {
+			t.Fatalf("%s: ids %v, want %v", tt.name, got, tt.ids)
+		}
+	}
+
+	for _, tt := range []struct {
+		id   uint64
+		want payment_gateway.PaymentStatus
+	}{{created.ID, payment_gateway.StatusCancelled}, {second.ID, payment_gateway.StatusSettled}} {
+		if got, _ := e.bc.Payment.GetIntent(tt.id); got.Status != tt.want {
+			t.Errorf("intent %d: status %s, want %s", tt.id, got.Status, tt.want)
+		}
+	}
+}
+
+// equalIDs: zelfde ids, volgorde maakt niet uit.
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[uint64]int{}
+	for _, id := range a {
+		seen[id]++
+	}
+	for _, id := range b {
+		if seen[id] == 0 {
+			return false
+		}
+		seen[id]--
+	}
+	return true
+}
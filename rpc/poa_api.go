@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//
+// ------------------------------------------------------------
+// PoA: validator set + stemmen
+// ------------------------------------------------------------
+//
+
+var errNoEngine = errors.New("PoA engine not enabled")
+
+// SetEngine maakt de gorr_poa* methods beschikbaar.
+func (s *Server) SetEngine(engine *poa.Engine) {
+	s.poa = engine
+}
+
+// gorr_poaValidators → huidige set, in-turn proposer voor het volgende block
+// en de lokale voorstellen.
+func (s *Server) handlePoaValidators() (interface{}, error) {
+	if s.poa == nil {
+		return nil, errNoEngine
+	}
+
+	head := s.bc.Head()
+	next := head.Header.Number + 1
+	snap := s.poa.Snapshot()
+
+	proposals := map[string]bool{}
+	for addr, auth := range s.poa.Proposals() {
+		proposals[addr.Hex()] = auth
+	}
+
+	return map[string]interface{}{
+		"number":     snap.Number,
+		"validators": snap.Validators,
+		"inTurn":     s.poa.InTurn(next),
+		"signer":     s.poa.Signer(),
+		"period":     s.poa.Period(),
+		"votes":      snap.Votes,
+		"tally":      snap.Tally,
+		"proposals":  proposals,
+	}, nil
+}
+
+// gorr_poaPropose {from, address, authorize}: deze validator stemt in zijn
+// volgende (getekende) blocks voor toevoegen/verwijderen van address.
+func (s *Server) handlePoaPropose(params []interface{}) (interface{}, error) {
+	if s.poa == nil {
+		return nil, errNoEngine
+	}
+	addr, raw, err := s.poaParams(params)
+	if err != nil {
+		return nil, err
+	}
+	authorize, ok := raw["authorize"].(bool)
+	if !ok {
+		return nil, errors.New("missing/invalid authorize (bool)")
+	}
+
+	s.poa.Propose(addr, authorize)
+	return map[string]interface{}{
+		"success":   true,
+		"address":   addr,
+		"authorize": authorize,
+	}, nil
+}
+
+// gorr_poaDiscard {from, address}: lokaal voorstel intrekken.
+func (s *Server) handlePoaDiscard(params []interface{}) (interface{}, error) {
+	if s.poa == nil {
+		return nil, errNoEngine
+	}
+	addr, _, err := s.poaParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.poa.Discard(addr)
+	return map[string]interface{}{
+		"success": true,
+		"address": addr,
+	}, nil
+}
+
+func (s *Server) poaParams(params []interface{}) (common.Address, map[string]interface{}, error) {
+	if len(params) == 0 {
+		return common.Address{}, nil, errors.New("missing params")
+	}
+	raw, ok := params[0].(map[string]interface{})
+	if !ok {
+		return common.Address{}, nil, errors.New("invalid params")
+	}
+
+	from, _ := raw["from"].(string)
+	if common.HexToAddress(from) != s.bc.AdminAddr {
+		return common.Address{}, nil, errors.New("admin only")
+	}
+
+	addrStr, ok := raw["address"].(string)
+	if !ok || !common.IsHexAddress(addrStr) {
+		return common.Address{}, nil, errors.New("missing/invalid address")
+	}
+	return common.HexToAddress(addrStr), raw, nil
+}
@@ -1,13 +1,22 @@
 package rpc
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/Siasom1/gorrillazz-chain/consensus/bft"
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
+	"github.com/Siasom1/gorrillazz-chain/consensus/producer"
 	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
 	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/modules/webhooks"
+	"github.com/Siasom1/gorrillazz-chain/p2p"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -18,17 +27,33 @@ import (
 //
 
 type Server struct {
-	bc  *blockchain.Blockchain
-	bus *events.EventBus
-	eth *ethRPC
+	bc    *blockchain.Blockchain
+	bus   *events.EventBus
+	eth   *ethRPC
+	subs  *subscriptionHub
+	poa   *poa.Engine
+	bft   *bft.Engine
+	p2p   *p2p.Server
+	hooks *webhooks.Manager
+
+	producer *producer.BlockProducer
+
+	// directState RPCs lopen onder dit lock (de block producer)
+	stateLock StateLocker
 }
 
 func NewServer(bc *blockchain.Blockchain, bus *events.EventBus) *Server {
-	return &Server{
-		bc:  bc,
-		bus: bus,
-		eth: newEthRPC(bc),
+	s := &Server{
+		bc:   bc,
+		bus:  bus,
+		eth:  newEthRPC(bc, bus),
+		subs: newSubscriptionHub(bc, bus),
 	}
+
+	// Eén bus-subscription die events naar alle eth_subscribe clients verdeelt
+	go s.subs.run()
+
+	return s
 }
 
 //
@@ -52,24 +77,49 @@ type rpcReq struct {
 
 func writeJSON(w http.ResponseWriter, id interface{}, result interface{}, err error) {
 	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rpcResponse(id, result, err))
+}
 
+// rpcResponse bouwt het JSON-RPC 2.0 antwoord-object (HTTP + WS).
+func rpcResponse(id interface{}, result interface{}, err error) map[string]interface{} {
 	if err != nil {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		return map[string]interface{}{
 			"jsonrpc": "2.0",
 			"error": map[string]interface{}{
 				"code":    -32000,
 				"message": err.Error(),
 			},
 			"id": id,
-		})
-		return
+		}
 	}
 
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	return map[string]interface{}{
 		"jsonrpc": "2.0",
 		"result":  result,
 		"id":      id,
-	})
+	}
+}
+
+// decodeRPCRequests accepteert zowel een enkel request als een batch
+// (JSON array), zoals ethers' JsonRpcProvider die standaard verstuurt.
+func decodeRPCRequests(body []byte) ([]rpcReq, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []rpcReq
+		if err := json.Unmarshal(trimmed, &reqs); err != nil {
+			return nil, true, err
+		}
+		if len(reqs) == 0 {
+			return nil, true, errors.New("empty batch")
+		}
+		return reqs, true, nil
+	}
+
+	var req rpcReq
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return nil, false, err
+	}
+	return []rpcReq{req}, false, nil
 }
 
 //
@@ -86,9 +136,15 @@ func StartRPCServer(port int, server *Server) {
 
 	// REST
 	mux.HandleFunc("/payments/merchant", server.handleGetMerchantPayments)
+	mux.HandleFunc("/payments/intents", server.handlePaymentIntents)
+	mux.HandleFunc("/payments/intents/", server.handlePaymentIntent)
+	mux.HandleFunc("/payments/settlements", server.handleSettlements)
+	mux.HandleFunc("/payments/settlements/", server.handleSettlement)
+	mux.HandleFunc("/events", server.handleGetEvents)
+	mux.HandleFunc("/events/stream", server.handleStreamEvents)
 
-	// WebSocket (D.4.2)
-	mux.HandleFunc("/ws", WSHandler(server.bus))
+	// WebSocket: JSON-RPC + eth_subscribe
+	mux.HandleFunc("/ws", WSHandler(server))
 
 	addr := fmt.Sprintf(":%d", port)
 	fmt.Println("[RPC] Listening on", addr)
@@ -111,6 +167,10 @@ func (s *Server) handleGetMerchantPayments(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if _, err := s.authorizeMerchant(r, common.HexToAddress(merchant)); err != nil {
+		writeAuthError(w, err)
+		return
+	}
 	payments := s.bc.Payment.ListMerchantPayments(common.HexToAddress(merchant))
 	writeJSON(w, nil, payments, nil)
 }
@@ -122,17 +182,35 @@ func (s *Server) handleGetMerchantPayments(w http.ResponseWriter, r *http.Reques
 //
 
 func (s *Server) HandleJSONRPC(w http.ResponseWriter, r *http.Request) {
-	var req rpcReq
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, nil, nil, err)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	reqs, batch, err := decodeRPCRequests(body)
+	if err != nil {
 		writeJSON(w, nil, nil, err)
 		return
 	}
 
-	// ------------------------------------------------------------
-	// Ethereum JSON-RPC routing (D.5.1)
-	// ------------------------------------------------------------
+	responses := make([]interface{}, 0, len(reqs))
+	for _, req := range reqs {
+		res, err := s.dispatch(req)
+		responses = append(responses, rpcResponse(req.ID, res, err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		_ = json.NewEncoder(w).Encode(responses)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(responses[0])
+}
 
+// dispatch voert één JSON-RPC request uit. Wordt gedeeld door HTTP en /ws,
+// zodat elke methode over beide transports beschikbaar is.
+func (s *Server) dispatch(req rpcReq) (interface{}, error) {
 	// ------------------------------------------------------------
 	// Ethereum JSON-RPC routing (D.5.1)
 	// ------------------------------------------------------------
@@ -141,8 +219,7 @@ func (s *Server) HandleJSONRPC(w http.ResponseWriter, r *http.Request) {
 			req.Method == "net_version" ||
 			req.Method == "web3_clientVersion") {
 
-		HandleEthRPC(w, req, s.eth)
-		return
+		return HandleEthRPC(req, s.eth)
 	}
 
 	switch req.Method {
@@ -150,97 +227,352 @@ func (s *Server) HandleJSONRPC(w http.ResponseWriter, r *http.Request) {
 	// -------- SYSTEM --------
 
 	case "gorr_getSystemWallets":
-		res, err := HandleGetSystemWallets(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		return HandleGetSystemWallets(s.bc, req.Params)
 
 	// -------- BALANCES --------
 
 	case "gorr_getBalance":
-		res, err := HandleGetBalance(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		return HandleGetBalance(s.bc, req.Params)
 
 	case "gorr_getUSDCcBalance":
-		res, err := HandleGetUSDCcBalance(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		return HandleGetUSDCcBalance(s.bc, req.Params)
 
 	// -------- TRANSFERS --------
 
 	case "gorr_sendTransaction":
-		res, err := HandleSendNative(s.bc, req.Params)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleSendNative(s.bc, s.eth.pendingRules(), req.Params)
+		})
 		if err == nil {
-			s.bus.EmitTx(res)
+			s.emitTransfer("GORR", res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
 
 	case "gorr_sendUSDCc":
-		res, err := HandleSendUSDCc(s.bc, req.Params)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleSendUSDCc(s.bc, req.Params)
+		})
 		if err == nil {
-			s.bus.EmitTx(res)
+			s.emitTransfer("USDCc", res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
+
+	// -------- PAYMENT INTENTS --------
+
+	case "gorr_createPaymentIntent":
+		return s.handleCreatePaymentIntent(req.Params)
+
+	case "gorr_getPaymentIntent":
+		return s.handleGetPaymentIntent(req.Params)
+
+	case "gorr_cancelPaymentIntent":
+		return s.handleManagePaymentIntent(intentActionCancel, req.Params)
+
+	case "gorr_refundPaymentIntent":
+		return s.handleManagePaymentIntent(intentActionRefund, req.Params)
+
+	case "gorr_settlePaymentIntent":
+		return s.handleManagePaymentIntent(intentActionSettle, req.Params)
+
+	case "gorr_getPaymentLink":
+		return s.handleGetPaymentLink(req.Params)
+
+	// -------- MERCHANT REGISTRY --------
+
+	case "gorr_getMerchant":
+		return s.handleGetMerchant(req.Params)
+
+	case "gorr_listMerchants":
+		return s.handleListMerchants(req.Params)
+
+	case "gorr_merchantTx":
+		return s.handleMerchantTx(req.Params)
+
+	case "gorr_createMerchantAPIKey":
+		return s.handleCreateMerchantAPIKey(req.Params)
+
+	// -------- SUBSCRIPTIONS --------
+
+	case "gorr_getSubscription":
+		return s.handleGetSubscription(req.Params)
+
+	case "gorr_listSubscriptions":
+		return s.handleListSubscriptions(req.Params)
+
+	case "gorr_subscriptionTx":
+		return s.handleSubscriptionTx(req.Params)
+
+	// -------- SETTLEMENTS --------
+
+	case "gorr_createSettlement":
+		return s.handleCreateSettlement(req.Params)
+
+	case "gorr_getSettlement":
+		return s.handleGetSettlement(req.Params)
+
+	case "gorr_listSettlements":
+		return s.handleListSettlements(req.Params)
+
+	case "gorr_cancelSettlement":
+		return s.handleCancelSettlement(req.Params)
+
+	// -------- WEBHOOKS --------
+
+	case "gorr_registerWebhook":
+		return s.handleRegisterWebhook(req.Params)
+
+	case "gorr_listWebhooks":
+		return s.handleListWebhooks(req.Params)
+
+	case "gorr_deleteWebhook":
+		return s.handleDeleteWebhook(req.Params)
+
+	case "gorr_getWebhookDeliveries":
+		return s.handleGetWebhookDeliveries(req.Params)
+
+	case "gorr_retryWebhookDelivery":
+		return s.handleRetryWebhookDelivery(req.Params)
 
 	// -------- ADMIN --------
 
 	case "gorr_adminMint":
-		res, err := HandleAdminMint(s.bc, req.Params)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleAdminMint(s.bc, req.Params)
+		})
 		if err == nil {
-			s.bus.EmitTx(res)
+			s.emitAdmin("mint", req.Params, res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
 
 	case "gorr_adminBurn":
-		res, err := HandleAdminBurn(s.bc, req.Params)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleAdminBurn(s.bc, req.Params)
+		})
 		if err == nil {
-			s.bus.EmitTx(res)
+			s.emitAdmin("burn", req.Params, res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
 
 	case "gorr_adminSetFees":
 		res, err := HandleSetFees(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		if err == nil {
+			s.emitAdmin("setFees", req.Params, res)
+		}
+		return res, err
 
 	case "gorr_adminPauseTransfers":
 		res, err := HandlePauseTransfers(s.bc, req.Params)
 		if err == nil {
-			s.bus.EmitBlock(map[string]interface{}{
-				"type":   "admin.pause",
-				"paused": res,
-			})
+			s.emitAdmin("pause", req.Params, res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
 
 	case "gorr_adminForceTransfer":
-		res, err := HandleAdminForceTransfer(s.bc, req.Params)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleAdminForceTransfer(s.bc, req.Params)
+		})
 		if err == nil {
-			s.bus.EmitBlock(map[string]interface{}{
-				"type":   "admin.pause",
-				"paused": res,
-			})
+			s.emitAdmin("forceTransfer", req.Params, res)
 		}
-		writeJSON(w, req.ID, res, err)
+		return res, err
 
 	case "gorr_adminMintToTreasury":
-		res, err := HandleAdminMintToTreasury(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleAdminMintToTreasury(s.bc, req.Params)
+		})
+		if err == nil {
+			s.emitAdmin("mintToTreasury", req.Params, res)
+		}
+		return res, err
 
 	case "gorr_adminWithdrawFees":
-		res, err := HandleAdminWithdrawFees(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		res, err := s.directState(func() (interface{}, error) {
+			return HandleAdminWithdrawFees(s.bc, req.Params)
+		})
+		if err == nil {
+			s.emitAdmin("withdrawFees", req.Params, res)
+		}
+		return res, err
 
 	case "gorr_adminStats":
-		res, err := HandleAdminStats(s.bc, req.Params)
-		writeJSON(w, req.ID, res, err)
+		return HandleAdminStats(s.bc, req.Params)
+
+	case "gorr_eventBusStats":
+		return s.bus.Metrics(), nil
+
+	case "gorr_getEvents":
+		return s.handleGetEventsRPC(req.Params)
+
+	case "gorr_chainConfig":
+		return s.handleChainConfig()
+
+	case "gorr_getBlockRewards":
+		return s.handleGetBlockRewards(req.Params)
+
+	// -------- P2P --------
+
+	case "net_peerCount":
+		return s.handlePeerCount()
+
+	case "gorr_peers":
+		return s.handlePeers()
+
+	// -------- PoA --------
+
+	case "gorr_poaValidators":
+		return s.handlePoaValidators()
+
+	case "gorr_poaPropose":
+		res, err := s.handlePoaPropose(req.Params)
+		if err == nil {
+			s.emitAdmin("poa.propose", req.Params, res)
+		}
+		return res, err
+
+	case "gorr_poaDiscard":
+		res, err := s.handlePoaDiscard(req.Params)
+		if err == nil {
+			s.emitAdmin("poa.discard", req.Params, res)
+		}
+		return res, err
+
+	// -------- BFT --------
+
+	case "gorr_getFinalizedBlock":
+		return s.handleGetFinalizedBlock(req.Params)
+
+	case "gorr_bftStatus":
+		return s.handleBftStatus()
+
+	// -------- DEV --------
+
+	case "evm_mine":
+		return s.handleEvmMine(req.Params)
+
+	case "evm_increaseTime":
+		return s.handleEvmIncreaseTime(req.Params)
+
+	case "evm_setNextBlockTimestamp":
+		return s.handleEvmSetNextBlockTimestamp(req.Params)
+
+	case "evm_snapshot":
+		return s.handleEvmSnapshot()
+
+	case "evm_revert":
+		return s.handleEvmRevert(req.Params)
 
 	// -------- FALLBACK --------
 
 	default:
-		writeJSON(
-			w,
-			req.ID,
-			nil,
-			fmt.Errorf("method not found: %s", req.Method),
-		)
+		return nil, fmt.Errorf("method not found: %s", req.Method)
+	}
+}
+
+//
+// ------------------------------------------------------------
+// DIRECTE STATE WIJZIGINGEN (gorr_send*, gorr_admin*)
+// ------------------------------------------------------------
+//
+// Deze RPCs zetten balances direct in bc.State, buiten een block om.
+// Peers zien dat nooit en hun state root gaat afwijken; daarom alleen op
+// een chain die niemand anders volgt. Wie een gedeelde chain wil
+// wijzigen stuurt een getekende tx (eth_sendRawTransaction).
+
+var errDirectStateShared = errors.New("direct state changes are disabled on a shared chain (bft, several validators or p2p); send a signed transaction instead")
+
+// StateLocker: het lock waaronder blocks de state wijzigen
+// (producer.BlockProducer).
+type StateLocker interface {
+	WithStateLock(fn func() error) error
+}
+
+// SetStateLock: directe state wijzigingen lopen onder l, zodat ze niet
+// tussen de overlay van een block en zijn Commit vallen.
+func (s *Server) SetStateLock(l StateLocker) {
+	s.stateLock = l
+}
+
+// sharedChain: blocks van deze node gaan naar andere nodes.
+func (s *Server) sharedChain() bool {
+	if s.bft != nil {
+		return true
+	}
+	if s.poa != nil && len(s.poa.Validators()) > 1 {
+		return true
+	}
+	return s.p2p != nil && s.p2p.Networked()
+}
+
+func (s *Server) directState(fn func() (interface{}, error)) (interface{}, error) {
+	if s.sharedChain() {
+		return nil, errDirectStateShared
+	}
+	if s.stateLock == nil {
+		return fn()
+	}
+	var res interface{}
+	err := s.stateLock.WithStateLock(func() error {
+		var err error
+		res, err = fn()
+		return err
+	})
+	return res, err
+}
+
+//
+// ------------------------------------------------------------
+// EVENTS (typed, zie events/schema.go)
+// ------------------------------------------------------------
+//
+
+// emitTransfer publiceert een directe gorr_send* transfer. res is de
+// map die HandleSendNative / HandleSendUSDCc teruggeven; past die niet
+// (meer), dan geen half leeg event maar een log regel.
+func (s *Server) emitTransfer(token string, res interface{}) {
+	m, ok := res.(map[string]interface{})
+	if !ok {
+		log.Printf("[EVENTS] %s transfer: unexpected result %T, no event", token, res)
+		return
+	}
+	from, okFrom := m["from"].(string)
+	to, okTo := m["to"].(string)
+	net, okNet := m["net"].(string)
+	if !okFrom || !okTo || !okNet {
+		log.Printf("[EVENTS] %s transfer: result without from/to/net, no event", token)
+		return
+	}
+	ev := &events.Transfer{
+		Token:  token,
+		From:   common.HexToAddress(from),
+		To:     common.HexToAddress(to),
+		Amount: net,
+		Fee:    "0",
+	}
+	if v, ok := m["fee"].(string); ok {
+		ev.Fee = v
+	}
+	s.bus.Emit(ev)
+}
+
+// emitAdmin publiceert een AdminAction; actor is params[0].from.
+func (s *Server) emitAdmin(action string, params []interface{}, res interface{}) {
+	ev := &events.AdminAction{
+		Action:  action,
+		Details: map[string]interface{}{},
+	}
+	if len(params) > 0 {
+		if raw, ok := params[0].(map[string]interface{}); ok {
+			if from, ok := raw["from"].(string); ok {
+				ev.Actor = common.HexToAddress(from)
+			}
+		}
+	}
+	if m, ok := res.(map[string]interface{}); ok {
+		for k, v := range m {
+			ev.Details[k] = v
+		}
 	}
+	s.bus.Emit(ev)
 }
 
 //
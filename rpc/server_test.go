@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/consensus/poa"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/Siasom1/gorrillazz-chain/log"
+	"github.com/Siasom1/gorrillazz-chain/p2p"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nextEvent: het volgende event van sub, of nil als er binnen korte tijd
+// niets komt.
+func nextEvent(sub *events.Subscription) interface{} {
+	select {
+	case ev := <-sub.C():
+		return ev.Data
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestEmitTransfer(t *testing.T) {
+	e := newWSEnv(t)
+	sub := e.bus.Subscribe(16, events.DropNewest, events.TopicTx)
+	defer sub.Unsubscribe()
+
+	from, to := common.HexToAddress("0xa11"), common.HexToAddress("0xb0b")
+	wei := new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))
+	if err := e.bc.State.SetBalance(from, wei); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bc.State.AddUSDCc(from, wei); err != nil {
+		t.Fatal(err)
+	}
+	send := map[string]interface{}{"from": from.Hex(), "to": to.Hex(), "amount": 1}
+
+	for _, method := range []string{"gorr_sendTransaction", "gorr_sendUSDCc"} {
+		res, err := e.call(method, send)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		m := res.(map[string]interface{})
+		ev, ok := nextEvent(sub).(*events.Transfer)
+		if !ok {
+			t.Fatalf("%s: no transfer event", method)
+		}
+		if ev.Type != events.TypeTransfer || ev.Version != events.SchemaVersion || ev.From != from || ev.To != to || ev.Amount != m["net"] || ev.Fee != m["fee"] {
+			t.Fatalf("%s: event %+v for result %v", method, ev, m)
+		}
+	}
+
+	// Een result van een andere vorm geeft geen leeg event
+	for _, res := range []interface{}{nil, "ok", map[string]interface{}{"from": from.Hex(), "amount": "1"}} {
+		e.server.emitTransfer("GORR", res)
+		if ev := nextEvent(sub); ev != nil {
+			t.Fatalf("event %+v for result %v", ev, res)
+		}
+	}
+}
+
+func TestEmitAdmin(t *testing.T) {
+	e := newWSEnv(t)
+	sub := e.bus.Subscribe(16, events.DropNewest, events.TopicAdmin)
+	defer sub.Unsubscribe()
+
+	to := common.HexToAddress("0xb0b")
+	if _, err := e.call("gorr_adminMint", map[string]interface{}{"from": e.bc.AdminAddr.Hex(), "to": to.Hex(), "amount": 5, "token": "GORR"}); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := nextEvent(sub).(*events.AdminAction)
+	if !ok {
+		t.Fatal("no admin event")
+	}
+	if ev.Action != "mint" || ev.Actor != e.bc.AdminAddr || ev.Details["token"] != "GORR" {
+		t.Fatalf("event %+v", ev)
+	}
+
+	// Een geweigerde admin call publiceert niets
+	if _, err := e.call("gorr_adminMint", map[string]interface{}{"from": to.Hex(), "to": to.Hex(), "amount": 5, "token": "GORR"}); err == nil {
+		t.Fatal("mint by a non-admin accepted")
+	}
+	if ev := nextEvent(sub); ev != nil {
+		t.Fatalf("event %+v for a rejected call", ev)
+	}
+}
+
+// stateLock: telt de calls die onder het lock lopen.
+type stateLock struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (l *stateLock) WithStateLock(fn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	return fn()
+}
+
+func TestDirectStateChanges(t *testing.T) {
+	e := newWSEnv(t)
+	lock := &stateLock{}
+	e.server.SetStateLock(lock)
+
+	from, to := common.HexToAddress("0xa11"), common.HexToAddress("0xb0b")
+	wei := new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))
+	if err := e.bc.State.SetBalance(from, wei); err != nil {
+		t.Fatal(err)
+	}
+	send := map[string]interface{}{"from": from.Hex(), "to": to.Hex(), "amount": 1}
+	mint := map[string]interface{}{"from": e.bc.AdminAddr.Hex(), "to": to.Hex(), "amount": 1, "token": "GORR"}
+
+	// Een chain zonder peers: onder het lock van de producer
+	for _, method := range []string{"gorr_sendTransaction", "gorr_adminMint"} {
+		params := send
+		if method == "gorr_adminMint" {
+			params = mint
+		}
+		if _, err := e.call(method, params); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+	}
+	if lock.calls != 2 {
+		t.Fatalf("%d calls under the state lock, want 2", lock.calls)
+	}
+
+	// Paused: geweigerd zonder dat de balance van from verandert
+	before, _ := e.bc.State.GetBalance(from)
+	e.bc.State.Paused = true
+	if _, err := e.call("gorr_sendTransaction", send); err == nil || !strings.Contains(err.Error(), "paused") {
+		t.Fatalf("send while paused: %v", err)
+	}
+	e.bc.State.Paused = false
+	if got, _ := e.bc.State.GetBalance(from); got.Cmp(before) != 0 {
+		t.Fatalf("paused send changed the balance: %s -> %s", before, got)
+	}
+
+	// Met peers geconfigureerd (ook nog niet verbonden) weigert de node
+	srv, err := p2p.NewServer(p2p.Config{StaticPeers: []string{"127.0.0.1:1"}}, e.bc, nil, e.bus, log.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.server.SetP2P(srv)
+	bal, _ := e.bc.State.GetBalance(to)
+	calls := lock.calls
+	for _, method := range []string{"gorr_sendTransaction", "gorr_adminMint", "gorr_adminBurn", "gorr_adminForceTransfer", "gorr_adminWithdrawFees"} {
+		params := send
+		if method != "gorr_sendTransaction" {
+			params = mint
+		}
+		if _, err := e.call(method, params); err == nil || !strings.Contains(err.Error(), "shared chain") {
+			t.Fatalf("%s on a networked node: %v", method, err)
+		}
+	}
+	if got, _ := e.bc.State.GetBalance(to); got.Cmp(bal) != 0 {
+		t.Fatalf("rejected calls changed the balance: %s -> %s", bal, got)
+	}
+	if lock.calls != calls {
+		t.Fatalf("rejected calls took the state lock")
+	}
+
+	// Meerdere PoA validators: de chain is gedeeld, ook zonder p2p
+	e = newWSEnv(t)
+	engine, err := poa.New(poa.Config{
+		Validators:   []common.Address{e.bc.AdminAddr, to},
+		SnapshotPath: filepath.Join(t.TempDir(), "poa.json"),
+	}, e.bc.Head().Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.server.SetEngine(engine)
+	if _, err := e.call("gorr_adminMint", mint); err == nil || !strings.Contains(err.Error(), "shared chain") {
+		t.Fatalf("mint with two validators: %v", err)
+	}
+}
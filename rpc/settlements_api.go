@@ -0,0 +1,377 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	payment_gateway "github.com/Siasom1/gorrillazz-chain/modules/payment_gateway"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// SETTLEMENTS — uitbetaling per merchant + rapporten
+// ------------------------------------------------------------
+// Een settlement run bundelt de betaalde, nog niet gesettelde intents van
+// een merchant (modules/payment_gateway/settlement.go). Heeft de merchant
+// in de registry een eigen payout adres, dan staat het geld daar al en is
+// de run meteen settled (payoutMode "direct" in het rapport); anders geeft
+// de node de GORR_SETTLE tx terug die het netto bedrag van de merchant
+// naar "payout" stuurt, en wordt de run settled zodra die tx in een block
+// zit. Aanmaken en intrekken zoals bij de intents alleen met een API key
+// van de merchant ({"apiKey": ...} of X-Api-Key), vóór de merchants fork
+// met {"from": merchant of admin}: een pending run houdt ook refunds tegen.
+//
+
+// createSettlement: {merchant, token?, since?, until?, payout?} namens de
+// merchant (creds).
+func (s *Server) createSettlement(creds merchantCreds, raw map[string]interface{}) (map[string]interface{}, error) {
+	pg := s.bc.Payment
+	if pg == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+
+	merchantStr, _ := raw["merchant"].(string)
+	if !common.IsHexAddress(merchantStr) {
+		return nil, errors.New("invalid merchant address")
+	}
+	merchant := common.HexToAddress(merchantStr)
+	if err := s.requireMerchant(merchant, creds); err != nil {
+		return nil, err
+	}
+
+	req := payment_gateway.SettlementRequest{Merchant: merchant, Token: "GORR"}
+	if v, ok := raw["token"]; ok {
+		t, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid token")
+		}
+		req.Token = t
+	}
+	for key, dst := range map[string]*uint64{"since": &req.From, "until": &req.To} {
+		if v, ok := raw[key]; ok {
+			n, err := parseQuantity(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", key, err)
+			}
+			*dst = n
+		}
+	}
+
+	// Payout adres uit de registry: de payments zijn daar al binnengekomen
+	rules := s.eth.pendingRules()
+	_, registered, err := core.MerchantTerms(s.bc.State, rules, merchant)
+	if err != nil {
+		return nil, err
+	}
+	req.Payout = registered
+	if v, ok := raw["payout"]; ok {
+		str, _ := v.(string)
+		if !common.IsHexAddress(str) {
+			return nil, errors.New("invalid payout address")
+		}
+		payout := common.HexToAddress(str)
+		if registered != merchant && payout != registered {
+			return nil, fmt.Errorf("merchant pays out to %s (merchant registry)", registered.Hex())
+		}
+		req.Payout = payout
+	}
+	// Alleen als het geld nog bij de merchant staat en ergens anders heen
+	// moet is er een tx nodig
+	req.Direct = req.Payout == registered
+	if !req.Direct && !rules.IsSettlements {
+		return nil, errors.New("on-chain settlements are not active yet (settlements fork)")
+	}
+
+	st, err := pg.CreateSettlement(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.settlementResult(st)
+}
+
+// settlementResult: de run, en voor een pending run de te tekenen tx.
+func (s *Server) settlementResult(st *payment_gateway.Settlement) (map[string]interface{}, error) {
+	out := map[string]interface{}{"settlement": st}
+	if st.Status != payment_gateway.SettlementPending {
+		return out, nil
+	}
+
+	to, value := st.Payout, st.Net
+	data := core.SettlementData(st.ID)
+	if st.Token == "USDCc" {
+		to, value = params.USDCcTokenAddress, new(big.Int)
+		data = core.USDCcSettlementData(st.Payout, st.Net, st.ID)
+	}
+	gas, err := core.TxIntrinsicGas(s.eth.pendingRules(), &to, data)
+	if err != nil {
+		return nil, err
+	}
+	out["tx"] = map[string]interface{}{
+		"from":  st.Merchant,
+		"to":    to,
+		"value": hexBig(value),
+		"data":  hexutil.Encode(data),
+		"gas":   hexutil.Uint64(gas),
+	}
+	return out, nil
+}
+
+// cancelSettlement trekt pending run id in namens de merchant (creds).
+func (s *Server) cancelSettlement(id uint64, creds merchantCreds) (*payment_gateway.Settlement, error) {
+	pg := s.bc.Payment
+	if pg == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+	st, err := pg.GetSettlement(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireMerchant(st.Merchant, creds); err != nil {
+		return nil, err
+	}
+	return pg.CancelSettlement(id)
+}
+
+// listSettlements: runs van merchant (nul adres = alle), optioneel op status.
+func (s *Server) listSettlements(merchant common.Address, status string) []*payment_gateway.Settlement {
+	list := []*payment_gateway.Settlement{}
+	if s.bc.Payment == nil {
+		return list
+	}
+	for _, st := range s.bc.Payment.ListSettlements(merchant) {
+		if status != "" && string(st.Status) != status {
+			continue
+		}
+		list = append(list, st)
+	}
+	return list
+}
+
+// ---------------- JSON-RPC ----------------
+
+// gorr_createSettlement [{apiKey | from, merchant, token?, since?, until?, payout?}]
+// → {settlement, tx?}
+func (s *Server) handleCreateSettlement(args []interface{}) (interface{}, error) {
+	raw, err := objectParam(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.createSettlement(paramCreds(raw), raw)
+}
+
+// gorr_getSettlement [id | {id}] → {settlement, tx?}
+func (s *Server) handleGetSettlement(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing settlement id")
+	}
+	v := args[0]
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["id"]
+	}
+	id, err := parseQuantity(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settlement id: %v", err)
+	}
+	if s.bc.Payment == nil {
+		return nil, errors.New("payment gateway not available")
+	}
+	st, err := s.bc.Payment.GetSettlement(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.settlementResult(st)
+}
+
+// gorr_listSettlements [{merchant?, status?}?]
+func (s *Server) handleListSettlements(args []interface{}) (interface{}, error) {
+	var (
+		merchant common.Address
+		status   string
+	)
+	if len(args) > 0 {
+		if raw, ok := args[0].(map[string]interface{}); ok {
+			status, _ = raw["status"].(string)
+			if v, ok := raw["merchant"]; ok {
+				str, _ := v.(string)
+				if !common.IsHexAddress(str) {
+					return nil, errors.New("invalid merchant address")
+				}
+				merchant = common.HexToAddress(str)
+			}
+		}
+	}
+	return s.listSettlements(merchant, status), nil
+}
+
+// gorr_cancelSettlement [{id, apiKey | from}]
+func (s *Server) handleCancelSettlement(args []interface{}) (interface{}, error) {
+	raw, err := objectParam(args)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseQuantity(raw["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid settlement id: %v", err)
+	}
+	return s.cancelSettlement(id, paramCreds(raw))
+}
+
+// ---------------- REST ----------------
+
+// POST /payments/settlements                   body {merchant, token?, since?, until?, payout?} (201)
+// GET  /payments/settlements?merchant=0x..[&status=]
+// Aanmaken alleen met een API key van de merchant (X-Api-Key).
+func (s *Server) handleSettlements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var raw map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		merchant, _ := raw["merchant"].(string)
+		if !common.IsHexAddress(merchant) {
+			http.Error(w, "missing or invalid merchant", http.StatusBadRequest)
+			return
+		}
+		creds := requestCreds(r, raw)
+		if err := s.requireMerchant(common.HexToAddress(merchant), creds); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		res, err := s.createSettlement(creds, raw)
+		if err != nil {
+			http.Error(w, err.Error(), settlementErrorStatus(err))
+			return
+		}
+		writeREST(w, http.StatusCreated, res)
+
+	case http.MethodGet:
+		q := r.URL.Query()
+		merchant := q.Get("merchant")
+		if !common.IsHexAddress(merchant) {
+			http.Error(w, "missing or invalid merchant", http.StatusBadRequest)
+			return
+		}
+		if _, err := s.authorizeMerchant(r, common.HexToAddress(merchant)); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		writeREST(w, http.StatusOK, s.listSettlements(common.HexToAddress(merchant), q.Get("status")))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET  /payments/settlements/{id}              → {settlement, tx?}
+// GET  /payments/settlements/{id}/report.csv|report.json (download)
+// POST /payments/settlements/{id}/cancel       (API key, of body {from})
+func (s *Server) handleSettlement(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/payments/settlements/"), "/"), "/")
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if s.bc.Payment == nil {
+		http.Error(w, "payment gateway not available", http.StatusServiceUnavailable)
+		return
+	}
+	st, err := s.bc.Payment.GetSettlement(id)
+	if err != nil {
+		http.Error(w, err.Error(), settlementErrorStatus(err))
+		return
+	}
+	if _, err := s.authorizeMerchant(r, st.Merchant); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		res, err := s.settlementResult(st)
+		if err != nil {
+			http.Error(w, err.Error(), settlementErrorStatus(err))
+			return
+		}
+		writeREST(w, http.StatusOK, res)
+
+	case action == "report.csv" && r.Method == http.MethodGet:
+		report, err := payment_gateway.SettlementCSV(st)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDownload(w, "text/csv; charset=utf-8", fmt.Sprintf("settlement-%d.csv", st.ID), report)
+
+	case action == "report.json" && r.Method == http.MethodGet:
+		report, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDownload(w, "application/json", fmt.Sprintf("settlement-%d.json", st.ID), report)
+
+	case action == "cancel" && r.Method == http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		creds := requestCreds(r, body)
+		if err := s.requireMerchant(st.Merchant, creds); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		res, err := s.cancelSettlement(id, creds)
+		if err != nil {
+			http.Error(w, err.Error(), settlementErrorStatus(err))
+			return
+		}
+		writeREST(w, http.StatusOK, res)
+
+	case action == "" || action == "report.csv" || action == "report.json" || action == "cancel":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ---------------- helpers ----------------
+
+func settlementErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, payment_gateway.ErrSettlementNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAPIKeyRequired), errors.Is(err, errAPIKeyInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, errAPIKeyNotConfigured):
+		return http.StatusForbidden
+	default:
+		return http.StatusConflict
+	}
+}
+
+// writeDownload: body als bestand (Content-Disposition attachment).
+func writeDownload(w http.ResponseWriter, contentType, filename string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
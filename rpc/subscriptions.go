@@ -0,0 +1,414 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//
+// ------------------------------------------------------------
+// eth_subscribe — newHeads, logs, newPendingTransactions
+// ------------------------------------------------------------
+// De hub heeft één bus-subscription en verdeelt elk event over alle
+// subscriptions van alle /ws clients.
+//
+
+const (
+	subNewHeads   = "newHeads"
+	subLogs       = "logs"
+	subPendingTxs = "newPendingTransactions"
+
+	// Gorrillazz: durable bus events met cursor, params {after, topics}
+	subGorrEvents = "gorrEvents"
+)
+
+type subscription struct {
+	id     string
+	kind   string
+	filter *logFilter // alleen voor "logs"
+	conn   *wsConn
+
+	// alleen voor "gorrEvents"
+	topics    map[events.Topic]bool
+	after     uint64
+	mu        sync.Mutex
+	replaying bool           // backlog wordt nog verstuurd
+	buffer    []events.Event // live events tijdens replay
+	lastSeq   uint64
+}
+
+type subscriptionHub struct {
+	bc  *blockchain.Blockchain
+	bus *events.EventBus
+
+	mu   sync.RWMutex
+	subs map[string]*subscription
+}
+
+func newSubscriptionHub(bc *blockchain.Blockchain, bus *events.EventBus) *subscriptionHub {
+	return &subscriptionHub{
+		bc:   bc,
+		bus:  bus,
+		subs: make(map[string]*subscription),
+	}
+}
+
+// subscribe verwerkt eth_subscribe params: [kind, filter?]
+func (h *subscriptionHub) subscribe(c *wsConn, params []interface{}) (string, error) {
+	if len(params) < 1 {
+		return "", errors.New("missing subscription type")
+	}
+	kind, ok := params[0].(string)
+	if !ok {
+		return "", errors.New("invalid subscription type")
+	}
+
+	sub := &subscription{kind: kind, conn: c}
+
+	switch kind {
+	case subNewHeads, subPendingTxs:
+	case subLogs:
+		var raw interface{}
+		if len(params) > 1 {
+			raw = params[1]
+		}
+		f, err := parseLogFilter(raw)
+		if err != nil {
+			return "", err
+		}
+		sub.filter = f
+	case subGorrEvents:
+		sub.topics = map[events.Topic]bool{}
+		if len(params) > 1 {
+			raw, ok := params[1].(map[string]interface{})
+			if !ok {
+				return "", errors.New("invalid gorrEvents params")
+			}
+			if v, ok := raw["after"]; ok {
+				n, err := parseUint64(v)
+				if err != nil {
+					return "", fmt.Errorf("invalid after: %v", err)
+				}
+				sub.after = n
+			}
+			for _, t := range topicsParam(raw["topics"]) {
+				sub.topics[t] = true
+			}
+		}
+		// Live events bufferen tot de backlog verstuurd is (zie replay)
+		sub.replaying = true
+		sub.lastSeq = sub.after
+		c.replays = append(c.replays, sub)
+	default:
+		return "", fmt.Errorf("unsupported subscription type: %s", kind)
+	}
+
+	id, err := newSubscriptionID()
+	if err != nil {
+		return "", err
+	}
+	sub.id = id
+
+	h.mu.Lock()
+	h.subs[id] = sub
+	h.mu.Unlock()
+
+	return id, nil
+}
+
+// unsubscribe verwijdert een subscription, maar alleen van de eigen connectie.
+func (h *subscriptionHub) unsubscribe(c *wsConn, params []interface{}) (bool, error) {
+	if len(params) < 1 {
+		return false, errors.New("missing subscription id")
+	}
+	id, ok := params[0].(string)
+	if !ok {
+		return false, errors.New("invalid subscription id")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub, ok := h.subs[id]
+	if !ok || sub.conn != c {
+		return false, nil
+	}
+	delete(h.subs, id)
+	return true, nil
+}
+
+// removeConn ruimt alle subscriptions van een gesloten connectie op.
+func (h *subscriptionHub) removeConn(c *wsConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, sub := range h.subs {
+		if sub.conn == c {
+			delete(h.subs, id)
+		}
+	}
+}
+
+func (h *subscriptionHub) snapshot() []*subscription {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := make([]*subscription, 0, len(h.subs))
+	for _, sub := range h.subs {
+		list = append(list, sub)
+	}
+	return list
+}
+
+//
+// ------------------------------------------------------------
+// Event pump
+// ------------------------------------------------------------
+
+// hubQueueSize: de hub zelf blokkeert nooit (notify is niet-blokkerend),
+// dus een ruime queue met DropOldest is genoeg.
+const hubQueueSize = 1024
+
+func (h *subscriptionHub) run() {
+	sub := h.bus.Subscribe(hubQueueSize, events.DropOldest)
+	defer sub.Unsubscribe()
+
+	for ev := range sub.C() {
+		h.publishEvent(ev)
+
+		switch data := ev.Data.(type) {
+		case *events.BlockCommitted:
+			if data.Block != nil {
+				h.publishBlock(data.Block)
+			}
+
+		case *events.TxPending:
+			h.publishPendingTx(data.Hash)
+		}
+	}
+}
+
+func (h *subscriptionHub) publishBlock(b *types.Block) {
+	subs := h.snapshot()
+	if len(subs) == 0 {
+		return
+	}
+
+	header := marshalHeader(b)
+
+	var logs []*types.Log
+	if receipts, err := h.bc.LoadReceipts(b.Header.Number); err == nil {
+		for _, r := range receipts {
+			logs = append(logs, r.Logs...)
+		}
+	}
+
+	for _, sub := range subs {
+		switch sub.kind {
+		case subNewHeads:
+			sub.conn.notify(sub.id, header)
+		case subLogs:
+			for _, l := range logs {
+				if sub.filter.matches(l) {
+					sub.conn.notify(sub.id, marshalLog(l))
+				}
+			}
+		}
+	}
+}
+
+func (h *subscriptionHub) publishPendingTx(hash common.Hash) {
+	for _, sub := range h.snapshot() {
+		if sub.kind == subPendingTxs {
+			sub.conn.notify(sub.id, hash.Hex())
+		}
+	}
+}
+
+// publishEvent levert een bus-event aan alle gorrEvents subscriptions.
+func (h *subscriptionHub) publishEvent(ev events.Event) {
+	for _, sub := range h.snapshot() {
+		if sub.kind != subGorrEvents {
+			continue
+		}
+		if len(sub.topics) > 0 && !sub.topics[ev.Topic] {
+			continue
+		}
+
+		sub.mu.Lock()
+		if sub.replaying {
+			sub.buffer = append(sub.buffer, ev)
+		} else if ev.Seq == 0 || ev.Seq > sub.lastSeq {
+			sub.conn.notify(sub.id, liveRecord(ev))
+			sub.lastSeq = ev.Seq
+		}
+		sub.mu.Unlock()
+	}
+}
+
+// replay stuurt de backlog uit het event log na sub.after en schakelt
+// daarna over op live. Wordt aangeroepen nadat het subscription-id als
+// antwoord verstuurd is, zodat de client de notificaties kan koppelen.
+func (h *subscriptionHub) replay(sub *subscription) {
+	var topics []events.Topic
+	for t := range sub.topics {
+		topics = append(topics, t)
+	}
+
+	if l := h.bus.Log(); l != nil {
+		for {
+			recs, err := l.Read(sub.lastSeq, maxEventsPage, topics...)
+			if err != nil {
+				break
+			}
+			for _, rec := range recs {
+				// blokkerend: backlog mag niet gedropt worden
+				sub.conn.reply(subscriptionMsg(sub.id, rec))
+				sub.lastSeq = rec.Seq
+			}
+			if len(recs) < maxEventsPage {
+				break
+			}
+		}
+	}
+
+	// Gebufferde live events versturen zonder sub.mu vast te houden
+	// tijdens het (blokkerende) schrijven; de hub buffert intussen door.
+	for {
+		sub.mu.Lock()
+		pending := sub.buffer
+		sub.buffer = nil
+		if len(pending) == 0 {
+			sub.replaying = false
+			sub.mu.Unlock()
+			return
+		}
+		sub.mu.Unlock()
+
+		for _, ev := range pending {
+			if ev.Seq == 0 || ev.Seq > sub.lastSeq {
+				sub.conn.reply(subscriptionMsg(sub.id, liveRecord(ev)))
+				sub.lastSeq = ev.Seq
+			}
+		}
+	}
+}
+
+func newSubscriptionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+//
+// ------------------------------------------------------------
+// Log filters (address + topics, zoals eth_newFilter)
+// ------------------------------------------------------------
+
+type logFilter struct {
+	addresses []common.Address
+	topics    [][]common.Hash // per positie: nil/leeg = wildcard, anders OR
+}
+
+// parseLogFilter accepteert {"address": "0x.." | ["0x..", ...], "topics": [...]}
+func parseLogFilter(raw interface{}) (*logFilter, error) {
+	f := &logFilter{}
+	if raw == nil {
+		return f, nil
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid log filter")
+	}
+
+	switch a := obj["address"].(type) {
+	case nil:
+	case string:
+		f.addresses = append(f.addresses, common.HexToAddress(a))
+	case []interface{}:
+		for _, v := range a {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("invalid address in log filter")
+			}
+			f.addresses = append(f.addresses, common.HexToAddress(s))
+		}
+	default:
+		return nil, errors.New("invalid address in log filter")
+	}
+
+	if rawTopics, ok := obj["topics"]; ok && rawTopics != nil {
+		list, ok := rawTopics.([]interface{})
+		if !ok {
+			return nil, errors.New("invalid topics in log filter")
+		}
+		for _, pos := range list {
+			switch t := pos.(type) {
+			case nil:
+				f.topics = append(f.topics, nil)
+			case string:
+				f.topics = append(f.topics, []common.Hash{common.HexToHash(t)})
+			case []interface{}:
+				var alts []common.Hash
+				for _, v := range t {
+					s, ok := v.(string)
+					if !ok {
+						return nil, errors.New("invalid topic in log filter")
+					}
+					alts = append(alts, common.HexToHash(s))
+				}
+				f.topics = append(f.topics, alts)
+			default:
+				return nil, errors.New("invalid topic in log filter")
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func (f *logFilter) matches(l *types.Log) bool {
+	if len(f.addresses) > 0 {
+		found := false
+		for _, a := range f.addresses {
+			if a == l.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.topics) > len(l.Topics) {
+		return false
+	}
+	for i, alts := range f.topics {
+		if len(alts) == 0 {
+			continue
+		}
+		found := false
+		for _, t := range alts {
+			if t == l.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
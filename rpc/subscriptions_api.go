@@ -0,0 +1,246 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Siasom1/gorrillazz-chain/core"
+	"github.com/Siasom1/gorrillazz-chain/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//
+// ------------------------------------------------------------
+// SUBSCRIPTIONS — terugkerende betalingen (niet eth_subscribe)
+// ------------------------------------------------------------
+// De autorisaties staan on-chain (core/subscription.go). De node leest
+// ze uit de state en geeft voor authorize / cancel / pull de ongetekende
+// tx terug, zoals gorr_merchantTx. Elke afgeschreven termijn wordt een
+// settled payment intent met OrderRef "sub:<id>/<termijn>".
+//
+
+// subscriptionTx bouwt de ongetekende subscription tx voor call namens from.
+func (s *Server) subscriptionTx(from common.Address, call *core.SubscriptionCall) (map[string]interface{}, error) {
+	rules := s.eth.pendingRules()
+	if !rules.IsSubscriptions {
+		return nil, errors.New("subscriptions are not active yet (subscriptions fork)")
+	}
+	data, err := core.SubscriptionCallData(call)
+	if err != nil {
+		return nil, err
+	}
+	// Zelfde controles als bij inclusie, zodat niemand een tx tekent die
+	// toch wordt afgewezen
+	if _, err := core.ParseSubscriptionCall(data); err != nil {
+		return nil, err
+	}
+	if err := s.checkSubscriptionCall(from, call, rules); err != nil {
+		return nil, err
+	}
+	to := params.SubscriptionsAddress
+	gas, err := core.TxIntrinsicGas(rules, &to, data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"from":  from,
+		"to":    to,
+		"value": hexBig(new(big.Int)),
+		"data":  hexutil.Encode(data),
+		"gas":   hexutil.Uint64(gas),
+	}, nil
+}
+
+// checkSubscriptionCall: de state afhankelijke controles tegen de huidige
+// head. Of een termijn al due is hangt af van de block time van de tx en
+// wordt pas bij inclusie bepaald.
+func (s *Server) checkSubscriptionCall(from common.Address, call *core.SubscriptionCall, rules params.Rules) error {
+	if call.Op == core.SubscriptionOpAuthorize {
+		if *call.Merchant == from {
+			return errors.New("payer and merchant must differ")
+		}
+		if call.Token == "USDCc" && !rules.IsUSDCc {
+			return errors.New("USDCc subscriptions need the USDCc fork")
+		}
+		if m, err := s.merchant(*call.Merchant); err != nil {
+			return err
+		} else if m != nil && m.Status == core.MerchantStatusSuspended {
+			return fmt.Errorf("merchant %s is suspended", call.Merchant.Hex())
+		}
+		if now := s.bc.Head().Header.Time; call.End < max(call.Start, now) {
+			return fmt.Errorf("end %d is in the past", call.End)
+		}
+		return nil
+	}
+
+	sub, err := core.GetSubscription(s.bc.State, call.ID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return fmt.Errorf("%w: %d", core.ErrSubscriptionNotFound, call.ID)
+	}
+	if !sub.Open() {
+		return fmt.Errorf("subscription %d is %s", sub.ID, sub.Status)
+	}
+	switch call.Op {
+	case core.SubscriptionOpCancel:
+		if from != sub.Payer && from != sub.Merchant {
+			return errors.New("only the payer or merchant can cancel this subscription")
+		}
+	case core.SubscriptionOpPull:
+		if from != sub.Merchant {
+			return errors.New("only the merchant can pull this subscription")
+		}
+		if call.Amount != nil && call.Amount.Cmp(sub.MaxAmount) > 0 {
+			return fmt.Errorf("amount %s above maxAmount %s", call.Amount, sub.MaxAmount)
+		}
+	}
+	return nil
+}
+
+// marshalSubscription: record + of er nu (head time) een termijn due is.
+func (s *Server) marshalSubscription(sub *core.Subscription) map[string]interface{} {
+	now := s.bc.Head().Header.Time
+	out := map[string]interface{}{
+		"id":          sub.ID,
+		"payer":       sub.Payer,
+		"merchant":    sub.Merchant,
+		"token":       sub.Token,
+		"maxAmount":   sub.MaxAmount.String(),
+		"period":      sub.Period,
+		"start":       sub.Start,
+		"end":         sub.End,
+		"autoPull":    sub.AutoPull,
+		"status":      sub.Status,
+		"nextPull":    sub.NextPull,
+		"installment": sub.Installment(),
+		"due":         sub.Due(now),
+		"pulls":       sub.Pulls,
+		"missed":      sub.Missed,
+		"pulledTotal": sub.PulledTotal.String(),
+		"lastPullAt":  sub.LastPullAt,
+		"createdAt":   sub.CreatedAt,
+		"updatedAt":   sub.UpdatedAt,
+	}
+	if sub.CancelledBy != nil {
+		out["cancelledBy"] = *sub.CancelledBy
+	}
+	return out
+}
+
+// ---------------- JSON-RPC ----------------
+
+// gorr_getSubscription [id | {id}]
+func (s *Server) handleGetSubscription(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing subscription id")
+	}
+	v := args[0]
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["id"]
+	}
+	id, err := parseQuantity(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription id: %v", err)
+	}
+	if !s.eth.pendingRules().IsSubscriptions {
+		return nil, nil
+	}
+	sub, err := core.GetSubscription(s.bc.State, id)
+	if err != nil || sub == nil {
+		return nil, err
+	}
+	return s.marshalSubscription(sub), nil
+}
+
+// gorr_listSubscriptions [{payer?, merchant?, status?}?] → records op id
+func (s *Server) handleListSubscriptions(args []interface{}) (interface{}, error) {
+	var (
+		payer, merchant *common.Address
+		status          string
+	)
+	if len(args) > 0 {
+		if raw, ok := args[0].(map[string]interface{}); ok {
+			status, _ = raw["status"].(string)
+			for key, dst := range map[string]**common.Address{"payer": &payer, "merchant": &merchant} {
+				v, ok := raw[key]
+				if !ok {
+					continue
+				}
+				str, _ := v.(string)
+				if !common.IsHexAddress(str) {
+					return nil, fmt.Errorf("invalid %s address", key)
+				}
+				addr := common.HexToAddress(str)
+				*dst = &addr
+			}
+		}
+	}
+
+	list := []map[string]interface{}{}
+	if !s.eth.pendingRules().IsSubscriptions {
+		return list, nil
+	}
+	err := core.ForEachSubscription(s.bc.State, func(sub *core.Subscription) error {
+		if payer != nil && sub.Payer != *payer {
+			return nil
+		}
+		if merchant != nil && sub.Merchant != *merchant {
+			return nil
+		}
+		if status != "" && sub.Status != status {
+			return nil
+		}
+		list = append(list, s.marshalSubscription(sub))
+		return nil
+	})
+	return list, err
+}
+
+// gorr_subscriptionTx [{from, op, merchant?, token?, maxAmount?, period?,
+// start?, end?, autoPull?, id?, amount?}] → te tekenen subscription tx
+func (s *Server) handleSubscriptionTx(args []interface{}) (interface{}, error) {
+	raw, err := objectParam(args)
+	if err != nil {
+		return nil, err
+	}
+	from, _ := raw["from"].(string)
+	if !common.IsHexAddress(from) {
+		return nil, errors.New("invalid from address")
+	}
+
+	call := &core.SubscriptionCall{}
+	call.Op, _ = raw["op"].(string)
+	call.Token, _ = raw["token"].(string)
+	call.AutoPull, _ = raw["autoPull"].(bool)
+	if v, ok := raw["merchant"]; ok {
+		str, _ := v.(string)
+		if !common.IsHexAddress(str) {
+			return nil, errors.New("invalid merchant address")
+		}
+		addr := common.HexToAddress(str)
+		call.Merchant = &addr
+	}
+	for key, dst := range map[string]**big.Int{"maxAmount": &call.MaxAmount, "amount": &call.Amount} {
+		if v, ok := raw[key]; ok {
+			n, err := parseAmount(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", key, err)
+			}
+			*dst = n
+		}
+	}
+	for key, dst := range map[string]*uint64{"id": &call.ID, "period": &call.Period, "start": &call.Start, "end": &call.End} {
+		if v, ok := raw[key]; ok {
+			n, err := parseQuantity(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", key, err)
+			}
+			*dst = n
+		}
+	}
+	return s.subscriptionTx(common.HexToAddress(from), call)
+}
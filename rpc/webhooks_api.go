@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Siasom1/gorrillazz-chain/modules/webhooks"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//
+// ------------------------------------------------------------
+// WEBHOOKS — gorr_*Webhook(s) + delivery log
+// ------------------------------------------------------------
+// Elke call moet een API key van de merchant meesturen ({"apiKey": ...},
+// zie requireMerchant); merchants zonder key in de registry kunnen
+// geen webhooks beheren. Vóór de merchants fork geldt {"from": merchant
+// of admin}. Het secret voor de X-Gorr-Signature header komt
+// alleen terug bij registratie.
+//
+
+var errNoWebhooks = errors.New("webhooks not enabled")
+
+// SetWebhooks maakt de gorr_*Webhook methods beschikbaar.
+func (s *Server) SetWebhooks(m *webhooks.Manager) {
+	s.hooks = m
+}
+
+// gorr_registerWebhook [{merchant, url, events?, apiKey | from}] → webhook incl. secret
+func (s *Server) handleRegisterWebhook(params []interface{}) (interface{}, error) {
+	if s.hooks == nil {
+		return nil, errNoWebhooks
+	}
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	merchant, err := s.webhookMerchant(raw)
+	if err != nil {
+		return nil, err
+	}
+	url, _ := raw["url"].(string)
+
+	var types []string
+	if v, ok := raw["events"]; ok && v != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("events must be an array of event types")
+		}
+		for _, e := range list {
+			str, ok := e.(string)
+			if !ok {
+				return nil, errors.New("events must be an array of event types")
+			}
+			types = append(types, str)
+		}
+	}
+	return s.hooks.Register(merchant, url, types)
+}
+
+// gorr_listWebhooks [{merchant, apiKey | from}] → webhooks zonder secret
+func (s *Server) handleListWebhooks(params []interface{}) (interface{}, error) {
+	if s.hooks == nil {
+		return nil, errNoWebhooks
+	}
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	merchant, err := s.webhookMerchant(raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.hooks.List(merchant), nil
+}
+
+// gorr_deleteWebhook [{id, apiKey | from}]
+func (s *Server) handleDeleteWebhook(params []interface{}) (interface{}, error) {
+	if s.hooks == nil {
+		return nil, errNoWebhooks
+	}
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := raw["id"].(string)
+	wh, err := s.hooks.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkWebhookKey(raw, wh.Merchant); err != nil {
+		return nil, err
+	}
+	if err := s.hooks.Delete(id); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// gorr_getWebhookDeliveries [{merchant | webhookId, apiKey | from, status?, limit?}]
+// → nieuwste deliveries eerst
+func (s *Server) handleGetWebhookDeliveries(params []interface{}) (interface{}, error) {
+	if s.hooks == nil {
+		return nil, errNoWebhooks
+	}
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var f webhooks.DeliveryFilter
+	if id, _ := raw["webhookId"].(string); id != "" {
+		wh, err := s.hooks.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkWebhookKey(raw, wh.Merchant); err != nil {
+			return nil, err
+		}
+		f.WebhookID = id
+		f.Merchant = wh.Merchant
+	} else {
+		if f.Merchant, err = s.webhookMerchant(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if st, _ := raw["status"].(string); st != "" {
+		switch webhooks.DeliveryStatus(st) {
+		case webhooks.DeliveryPending, webhooks.DeliveryDelivered, webhooks.DeliveryFailed:
+			f.Status = webhooks.DeliveryStatus(st)
+		default:
+			return nil, fmt.Errorf("invalid status %q", st)
+		}
+	}
+	if v, ok := raw["limit"]; ok {
+		n, err := parseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %v", err)
+		}
+		f.Limit = int(n)
+	}
+	return s.hooks.Deliveries(f)
+}
+
+// gorr_retryWebhookDelivery [{id, apiKey | from}] → failed delivery opnieuw in de queue
+func (s *Server) handleRetryWebhookDelivery(params []interface{}) (interface{}, error) {
+	if s.hooks == nil {
+		return nil, errNoWebhooks
+	}
+	raw, err := objectParam(params)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseQuantity(raw["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid delivery id: %v", err)
+	}
+	d, err := s.hooks.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkWebhookKey(raw, d.Merchant); err != nil {
+		return nil, err
+	}
+	return s.hooks.Retry(id)
+}
+
+// ---------------- helpers ----------------
+
+// webhookMerchant: raw["merchant"], na controle van raw["apiKey"].
+func (s *Server) webhookMerchant(raw map[string]interface{}) (common.Address, error) {
+	merchantStr, _ := raw["merchant"].(string)
+	if !common.IsHexAddress(merchantStr) {
+		return common.Address{}, errors.New("invalid merchant address")
+	}
+	merchant := common.HexToAddress(merchantStr)
+	return merchant, s.checkWebhookKey(raw, merchant)
+}
+
+func (s *Server) checkWebhookKey(raw map[string]interface{}, merchant common.Address) error {
+	return s.requireMerchant(merchant, paramCreds(raw))
+}
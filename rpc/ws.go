@@ -4,7 +4,6 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/Siasom1/gorrillazz-chain/events"
 	"github.com/gorilla/websocket"
 )
 
@@ -14,59 +13,134 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type wsMessage struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+// Berichten die nog niet naar de client geschreven zijn. Is de buffer vol,
+// dan worden subscription-notificaties voor die client overgeslagen.
+const wsSendBuffer = 256
+
+// wsConn is één /ws client. Alle writes gaan via send, zodat er maar
+// één goroutine tegelijk naar de websocket schrijft.
+type wsConn struct {
+	conn *websocket.Conn
+	send chan interface{}
+	done chan struct{}
+
+	// gorrEvents subscriptions die na het antwoord hun backlog krijgen
+	// (alleen gebruikt door de reader goroutine)
+	replays []*subscription
 }
 
-func WSHandler(bus *events.EventBus) http.HandlerFunc {
+// WSHandler spreekt JSON-RPC over websocket: elke HTTP-methode plus
+// eth_subscribe / eth_unsubscribe (ethers WebSocketProvider compatible).
+func WSHandler(server *Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Println("[WS] upgrade error:", err)
 			return
 		}
-		defer conn.Close()
 
-		log.Println("[WS] client connected")
+		c := &wsConn{
+			conn: conn,
+			send: make(chan interface{}, wsSendBuffer),
+			done: make(chan struct{}),
+		}
+		go c.writeLoop()
 
-		done := make(chan struct{})
+		log.Println("[WS] client connected")
 
-		go func() {
-			defer close(done)
-			for {
-				// We don't expect messages from client (push-only)
-				if _, _, err := conn.ReadMessage(); err != nil {
-					return
-				}
-			}
+		defer func() {
+			server.subs.removeConn(c)
+			close(c.done)
+			conn.Close()
+			log.Println("[WS] client disconnected")
 		}()
 
 		for {
-			select {
-
-			case blk := <-bus.Blocks:
-				_ = conn.WriteJSON(wsMessage{
-					Type: "block",
-					Data: blk,
-				})
-
-			case tx := <-bus.Txs:
-				_ = conn.WriteJSON(wsMessage{
-					Type: "tx",
-					Data: tx,
-				})
-
-			case pay := <-bus.Payments:
-				_ = conn.WriteJSON(wsMessage{
-					Type: "payment",
-					Data: pay,
-				})
-
-			case <-done:
-				log.Println("[WS] client disconnected")
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			reqs, batch, err := decodeRPCRequests(data)
+			if err != nil {
+				c.reply(rpcResponse(nil, nil, err))
+				continue
+			}
+
+			responses := make([]interface{}, 0, len(reqs))
+			for _, req := range reqs {
+				res, err := server.dispatchWS(c, req)
+				responses = append(responses, rpcResponse(req.ID, res, err))
+			}
+
+			if batch {
+				c.reply(responses)
+			} else {
+				c.reply(responses[0])
+			}
+
+			for _, sub := range c.replays {
+				server.subs.replay(sub)
+			}
+			c.replays = nil
+		}
+	}
+}
+
+// dispatchWS handelt de subscription-methodes af; de rest gaat via dispatch.
+func (s *Server) dispatchWS(c *wsConn, req rpcReq) (interface{}, error) {
+	switch req.Method {
+	case "eth_subscribe":
+		return s.subs.subscribe(c, req.Params)
+	case "eth_unsubscribe":
+		return s.subs.unsubscribe(c, req.Params)
+	default:
+		return s.dispatch(req)
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.conn.WriteJSON(msg); err != nil {
+				log.Println("[WS] write error:", err)
+				c.conn.Close()
 				return
 			}
+		case <-c.done:
+			return
 		}
 	}
 }
+
+// reply stuurt een antwoord op een request (blokkeert tot er ruimte is).
+func (c *wsConn) reply(msg interface{}) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	}
+}
+
+func subscriptionMsg(subID string, result interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params": map[string]interface{}{
+			"subscription": subID,
+			"result":       result,
+		},
+	}
+}
+
+// notify stuurt een eth_subscription notificatie (niet-blokkerend).
+func (c *wsConn) notify(subID string, result interface{}) {
+	msg := subscriptionMsg(subID, result)
+
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		log.Println("[WS] client too slow, dropping notification for", subID)
+	}
+}
@@ -0,0 +1,363 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siasom1/gorrillazz-chain/core/blockchain"
+	"github.com/Siasom1/gorrillazz-chain/core/types"
+	"github.com/Siasom1/gorrillazz-chain/events"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+)
+
+// wsEnv: rpc server met /ws op een lege chain.
+type wsEnv struct {
+	bc     *blockchain.Blockchain
+	bus    *events.EventBus
+	server *Server
+	http   *httptest.Server
+}
+
+func newWSEnv(t *testing.T) *wsEnv {
+	t.Helper()
+	bc, err := blockchain.NewBlockchain(t.TempDir(), 9999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewEventBus()
+	server := NewServer(bc, bus)
+	srv := httptest.NewServer(WSHandler(server))
+	t.Cleanup(srv.Close)
+	// De hub subscribet in zijn eigen goroutine
+	waitFor(t, "the hub subscription", func() bool { return len(bus.Metrics().Subscribers) == 1 })
+	return &wsEnv{bc: bc, bus: bus, server: server, http: srv}
+}
+
+func (e *wsEnv) dial(t *testing.T) *wsClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(e.http.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}
+}
+
+// subs: aantal subscriptions in de hub.
+func (e *wsEnv) subs() int { return len(e.server.subs.snapshot()) }
+
+type wsMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+type wsClient struct {
+	t      *testing.T
+	conn   *websocket.Conn
+	nextID int
+	queued []wsMessage // notificaties die binnenkwamen tijdens een call
+}
+
+func (c *wsClient) read() wsMessage {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// call stuurt een request en wacht op het antwoord met hetzelfde id.
+func (c *wsClient) call(method string, params ...interface{}) (json.RawMessage, string) {
+	c.t.Helper()
+	c.nextID++
+	if params == nil {
+		params = []interface{}{}
+	}
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params}
+	if err := c.conn.WriteJSON(req); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg.Method == "eth_subscription" {
+			c.queued = append(c.queued, msg)
+			continue
+		}
+		if msg.ID == nil || *msg.ID != c.nextID {
+			c.t.Fatalf("unexpected response %+v", msg)
+		}
+		if msg.Error != nil {
+			return nil, msg.Error.Message
+		}
+		return msg.Result, ""
+	}
+}
+
+func (c *wsClient) subscribe(params ...interface{}) string {
+	c.t.Helper()
+	res, errMsg := c.call("eth_subscribe", params...)
+	if errMsg != "" {
+		c.t.Fatalf("eth_subscribe %v: %s", params, errMsg)
+	}
+	var id string
+	if err := json.Unmarshal(res, &id); err != nil {
+		c.t.Fatal(err)
+	}
+	return id
+}
+
+func (c *wsClient) unsubscribe(id string) bool {
+	c.t.Helper()
+	res, errMsg := c.call("eth_unsubscribe", id)
+	if errMsg != "" {
+		c.t.Fatalf("eth_unsubscribe: %s", errMsg)
+	}
+	var ok bool
+	if err := json.Unmarshal(res, &ok); err != nil {
+		c.t.Fatal(err)
+	}
+	return ok
+}
+
+// notification: de volgende eth_subscription notificatie.
+func (c *wsClient) notification() (string, json.RawMessage) {
+	c.t.Helper()
+	var msg wsMessage
+	if len(c.queued) > 0 {
+		msg, c.queued = c.queued[0], c.queued[1:]
+	} else {
+		msg = c.read()
+	}
+	if msg.Method != "eth_subscription" {
+		c.t.Fatalf("expected a notification, got %+v", msg)
+	}
+	return msg.Params.Subscription, msg.Params.Result
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// emitBlock publiceert block n zoals de producer na een commit doet.
+func (e *wsEnv) emitBlock(n uint64) {
+	block := &types.Block{Header: &types.Header{Number: n, Time: 1000 + n}}
+	e.bus.Emit(&events.BlockCommitted{Number: n, Hash: block.Hash(), Block: block})
+}
+
+func headNumber(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var h struct {
+		Number string `json:"number"`
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		t.Fatal(err)
+	}
+	return h.Number
+}
+
+func TestWSNewHeadsAndPendingTxs(t *testing.T) {
+	e := newWSEnv(t)
+	c := e.dial(t)
+	heads := c.subscribe(subNewHeads)
+	pending := c.subscribe(subPendingTxs)
+
+	// Alleen events met het block erbij worden heads
+	e.bus.Emit(&events.BlockCommitted{Number: 7})
+	e.emitBlock(1)
+	if id, res := c.notification(); id != heads || headNumber(t, res) != "0x1" {
+		t.Fatalf("got %s %s, want head 0x1 on %s", id, res, heads)
+	}
+
+	// Andere tx events zijn geen pending txs
+	e.bus.Emit(&events.Transfer{Token: "GORR"})
+	hash := common.HexToHash("0xabc")
+	e.bus.Emit(&events.TxPending{Hash: hash})
+	id, res := c.notification()
+	var got string
+	_ = json.Unmarshal(res, &got)
+	if id != pending || got != hash.Hex() {
+		t.Fatalf("got %s %s, want %s on %s", id, res, hash.Hex(), pending)
+	}
+}
+
+func TestWSSubscribeErrors(t *testing.T) {
+	e := newWSEnv(t)
+	c := e.dial(t)
+	tests := []struct {
+		params []interface{}
+		err    string
+	}{
+		{nil, "missing subscription type"},
+		{[]interface{}{42}, "invalid subscription type"},
+		{[]interface{}{"syncing"}, "unsupported subscription type"},
+		{[]interface{}{subLogs, "0x1"}, "invalid log filter"},
+		{[]interface{}{subLogs, map[string]interface{}{"address": 1}}, "invalid address"},
+		{[]interface{}{subLogs, map[string]interface{}{"topics": "0x1"}}, "invalid topics"},
+	}
+	for _, tt := range tests {
+		if _, errMsg := c.call("eth_subscribe", tt.params...); !strings.Contains(errMsg, tt.err) {
+			t.Errorf("eth_subscribe %v: error %q, want %q", tt.params, errMsg, tt.err)
+		}
+	}
+	if e.subs() != 0 {
+		t.Fatalf("%d subscriptions after failed subscribes", e.subs())
+	}
+}
+
+func TestWSLogsFilter(t *testing.T) {
+	e := newWSEnv(t)
+	c := e.dial(t)
+
+	token := common.HexToAddress("0x70")
+	other := common.HexToAddress("0x71")
+	transfer := common.HexToHash("0x01")
+	approval := common.HexToHash("0x02")
+	logAt := func(addr common.Address, data string, topics ...common.Hash) *types.Log {
+		return &types.Log{Address: addr, Topics: topics, Data: []byte(data)}
+	}
+	receipts := []*types.Receipt{
+		{Logs: []*types.Log{
+			logAt(token, "a", transfer),
+			logAt(other, "b", transfer),
+			logAt(token, "c", approval),
+		}},
+		{Logs: []*types.Log{
+			logAt(token, "d", transfer, common.HexToHash("0xf0")),
+			logAt(token, "e"),
+		}},
+	}
+	if err := e.bc.SaveReceipts(1, receipts); err != nil {
+		t.Fatal(err)
+	}
+	// Block 2 sluit af, zodat we weten dat block 1 helemaal binnen is
+	if err := e.bc.SaveReceipts(2, []*types.Receipt{{Logs: []*types.Log{logAt(token, "end", transfer)}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := c.subscribe(subLogs, map[string]interface{}{
+		"address": []interface{}{token.Hex()},
+		"topics":  []interface{}{transfer.Hex()},
+	})
+	e.emitBlock(1)
+	e.emitBlock(2)
+
+	var got []string
+	for {
+		id, res := c.notification()
+		if id != sub {
+			t.Fatalf("notification for %s, want %s", id, sub)
+		}
+		var l struct {
+			Data string `json:"data"`
+		}
+		if err := json.Unmarshal(res, &l); err != nil {
+			t.Fatal(err)
+		}
+		if l.Data == "0x656e64" { // "end"
+			break
+		}
+		got = append(got, l.Data)
+	}
+	if want := []string{"0x61", "0x64"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("logs %v, want %v", got, want)
+	}
+}
+
+func TestLogFilterMatches(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	t1, t2, t3 := common.HexToHash("0x1"), common.HexToHash("0x2"), common.HexToHash("0x3")
+
+	tests := []struct {
+		name   string
+		filter interface{}
+		log    *types.Log
+		want   bool
+	}{
+		{"no filter", nil, &types.Log{Address: a}, true},
+		{"address", map[string]interface{}{"address": a.Hex()}, &types.Log{Address: a}, true},
+		{"other address", map[string]interface{}{"address": a.Hex()}, &types.Log{Address: b}, false},
+		{"address list", map[string]interface{}{"address": []interface{}{b.Hex(), a.Hex()}}, &types.Log{Address: a}, true},
+		{"first topic", map[string]interface{}{"topics": []interface{}{t1.Hex()}}, &types.Log{Topics: []common.Hash{t1, t2}}, true},
+		{"wrong topic", map[string]interface{}{"topics": []interface{}{t2.Hex()}}, &types.Log{Topics: []common.Hash{t1, t2}}, false},
+		{"wildcard then topic", map[string]interface{}{"topics": []interface{}{nil, t2.Hex()}}, &types.Log{Topics: []common.Hash{t3, t2}}, true},
+		{"or of topics", map[string]interface{}{"topics": []interface{}{[]interface{}{t2.Hex(), t1.Hex()}}}, &types.Log{Topics: []common.Hash{t1}}, true},
+		{"more topics than the log", map[string]interface{}{"topics": []interface{}{nil, nil}}, &types.Log{Topics: []common.Hash{t1}}, false},
+		{"address and topic", map[string]interface{}{"address": b.Hex(), "topics": []interface{}{t1.Hex()}}, &types.Log{Address: a, Topics: []common.Hash{t1}}, false},
+	}
+	for _, tt := range tests {
+		f, err := parseLogFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := f.matches(tt.log); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWSUnsubscribe(t *testing.T) {
+	e := newWSEnv(t)
+	a, b := e.dial(t), e.dial(t)
+	heads := a.subscribe(subNewHeads)
+	a.subscribe(subPendingTxs)
+
+	if b.unsubscribe(heads) {
+		t.Fatal("another connection removed the subscription")
+	}
+	if !a.unsubscribe(heads) {
+		t.Fatal("unsubscribe of own subscription failed")
+	}
+	if a.unsubscribe(heads) {
+		t.Fatal("second unsubscribe succeeded")
+	}
+	if e.subs() != 1 {
+		t.Fatalf("%d subscriptions, want 1", e.subs())
+	}
+
+	// Na unsubscribe geen heads meer; de pending tx komt wel door
+	e.emitBlock(1)
+	e.bus.Emit(&events.TxPending{Hash: common.HexToHash("0x1")})
+	if id, _ := a.notification(); id == heads {
+		t.Fatal("notification after unsubscribe")
+	}
+}
+
+func TestWSDisconnectRemovesSubscriptions(t *testing.T) {
+	e := newWSEnv(t)
+	a, b := e.dial(t), e.dial(t)
+	a.subscribe(subNewHeads)
+	a.subscribe(subLogs)
+	kept := b.subscribe(subNewHeads)
+	if e.subs() != 3 {
+		t.Fatalf("%d subscriptions, want 3", e.subs())
+	}
+
+	a.conn.Close()
+	waitFor(t, "cleanup of the closed connection", func() bool { return e.subs() == 1 })
+
+	e.emitBlock(1)
+	if id, _ := b.notification(); id != kept {
+		t.Fatalf("notification for %s, want %s", id, kept)
+	}
+}
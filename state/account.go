@@ -43,3 +43,25 @@ func (a *Account) ensureBalances() {
 		a.Balances["USDCc"] = big.NewInt(0)
 	}
 }
+
+func (a *Account) copy() *Account {
+	cpy := &Account{Address: a.Address, Nonce: a.Nonce, Balances: map[string]*big.Int{}}
+	for token, bal := range a.Balances {
+		cpy.Balances[token] = new(big.Int).Set(bal)
+	}
+	cpy.ensureBalances()
+	return cpy
+}
+
+// empty: geen saldo en nooit een tx verstuurd.
+func (a *Account) empty() bool {
+	if a.Nonce != 0 {
+		return false
+	}
+	for _, bal := range a.Balances {
+		if bal != nil && bal.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ---------------- MERCHANT REGISTRY ----------------
+//
+// Records van de on-chain merchant registry (core/merchant.go), als JSON
+// onder "merchant:<adres>". Anders dan de keys van Put zijn dit consensus
+// gegevens: ze tellen mee in Root.
+
+const merchantPrefix = "merchant:"
+
+func merchantKey(addr common.Address) string { return merchantPrefix + addr.Hex() }
+
+func isMerchantKey(key string) bool { return strings.HasPrefix(key, merchantPrefix) }
+
+// GetMerchant geeft het record van addr, of nil als addr niet
+// geregistreerd is. Reads zien eerst de writes van de overlay.
+func (s *State) GetMerchant(addr common.Address) ([]byte, error) {
+	key := merchantKey(addr)
+	if v, ok := s.dirtyKV[key]; ok {
+		return append([]byte{}, v...), nil
+	}
+	raw, err := s.db.get(key)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// SetMerchant schrijft het record van addr (op een overlay pas bij Commit).
+func (s *State) SetMerchant(addr common.Address, data []byte) error {
+	key := merchantKey(addr)
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(key), data, nil)
+	}
+	s.setKV(key, append([]byte{}, data...))
+	return nil
+}
+
+// ForEachMerchant loopt op adres volgorde over alle records, inclusief
+// de writes van de overlay.
+func (s *State) ForEachMerchant(fn func(addr common.Address, data []byte) error) error {
+	records := map[string][]byte{}
+	err := s.db.ForEachPrefix(merchantPrefix, func(key string, value []byte) error {
+		records[key] = append([]byte{}, value...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range s.dirtyKV {
+		if isMerchantKey(key) {
+			records[key] = value
+		}
+	}
+
+	addrs := make([]common.Address, 0, len(records))
+	for key := range records {
+		addrs = append(addrs, common.HexToAddress(strings.TrimPrefix(key, merchantPrefix)))
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Cmp(addrs[j]) < 0
+	})
+	for _, addr := range addrs {
+		if err := fn(addr, records[merchantKey(addr)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
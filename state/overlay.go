@@ -0,0 +1,242 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ---------------- OVERLAY ----------------
+//
+// Een block wordt uitgevoerd op een overlay: alle account writes blijven in
+// geheugen tot Commit, die ze in één LevelDB batch wegschrijft. Zo laat een
+// afgekeurd block (of een proposal die alleen gecontroleerd wordt) de
+// state ongemoeid.
+
+// Begin geeft een overlay op s. Reads zien eerst de eigen writes.
+func (s *State) Begin() *State {
+	return &State{
+		db:          s.db,
+		Paused:      s.Paused,
+		totalSupply: s.totalSupply,
+		fees:        s.fees,
+		dirty:       map[common.Address]*Account{},
+		dirtyKV:     map[string][]byte{},
+	}
+}
+
+// Commit schrijft de writes van een overlay atomair naar de db.
+// Op de gewone state (geen overlay) is dit een no-op.
+func (s *State) Commit() error {
+	if len(s.dirty) == 0 && len(s.dirtyKV) == 0 {
+		return nil
+	}
+	accs := make([]*Account, 0, len(s.dirty))
+	for _, acc := range s.dirty {
+		accs = append(accs, acc)
+	}
+	if err := s.db.WriteAccounts(accs, s.dirtyKV); err != nil {
+		return err
+	}
+	s.dirty = map[common.Address]*Account{}
+	s.dirtyKV = map[string][]byte{}
+	s.journal = nil
+	return nil
+}
+
+// ---------------- CHECKPOINTS ----------------
+//
+// Een tx die halverwege faalt (bijv. recordPayment na de transfer) mag
+// geen writes in het block achterlaten. De overlay houdt per write de
+// vorige waarde bij; RevertTo draait de writes na een Checkpoint terug.
+
+// change: de waarde van een account of key vóór een write.
+type change struct {
+	addr    *common.Address // account write; anders key
+	key     string
+	account *Account
+	value   []byte
+	existed bool
+}
+
+// Checkpoint: de stand van een overlay, zie RevertTo.
+type Checkpoint struct {
+	journal     int
+	paused      bool
+	totalSupply map[string]*big.Int
+	fees        map[string]*big.Int
+}
+
+// Checkpoint markeert de huidige stand van de overlay.
+func (s *State) Checkpoint() *Checkpoint {
+	return &Checkpoint{
+		journal:     len(s.journal),
+		paused:      s.Paused,
+		totalSupply: copyBigMap(s.totalSupply),
+		fees:        copyBigMap(s.fees),
+	}
+}
+
+// RevertTo draait alle writes sinds cp terug. Alleen op een overlay.
+func (s *State) RevertTo(cp *Checkpoint) error {
+	if s.dirty == nil {
+		return errors.New("cannot revert outside an overlay")
+	}
+	for i := len(s.journal) - 1; i >= cp.journal; i-- {
+		c := s.journal[i]
+		switch {
+		case c.addr != nil && c.existed:
+			s.dirty[*c.addr] = c.account
+		case c.addr != nil:
+			delete(s.dirty, *c.addr)
+		case c.existed:
+			s.dirtyKV[c.key] = c.value
+		default:
+			delete(s.dirtyKV, c.key)
+		}
+	}
+	s.journal = s.journal[:cp.journal]
+	s.Paused = cp.paused
+	// De maps zijn gedeeld met de state onder de overlay (zie Begin)
+	restoreBigMap(s.totalSupply, cp.totalSupply)
+	restoreBigMap(s.fees, cp.fees)
+	return nil
+}
+
+func (s *State) setAccount(acc *Account) {
+	addr := acc.Address
+	prev, ok := s.dirty[addr]
+	s.journal = append(s.journal, change{addr: &addr, account: prev, existed: ok})
+	s.dirty[acc.Address] = acc
+}
+
+func (s *State) setKV(key string, value []byte) {
+	prev, ok := s.dirtyKV[key]
+	s.journal = append(s.journal, change{key: key, value: prev, existed: ok})
+	s.dirtyKV[key] = value
+}
+
+func restoreBigMap(dst, saved map[string]*big.Int) {
+	for k := range dst {
+		if _, ok := saved[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range saved {
+		if dst[k] == nil {
+			dst[k] = new(big.Int)
+		}
+		dst[k].Set(v)
+	}
+}
+
+// Put schrijft een niet-account key (bijv. payment intents). Op een
+// overlay pas bij Commit, in dezelfde batch als de accounts. Deze keys
+// tellen niet mee in Root (merchant, subscription en payment records wel,
+// zie SetMerchant, SetSubscription en SetPaymentRecord).
+func (s *State) Put(key string, value []byte) error {
+	if isAccountKey(key) || key == metaKey || isMerchantKey(key) || isSubscriptionKey(key) || isSubscriptionDueKey(key) || isPaymentKey(key) {
+		return fmt.Errorf("state: key %q is reserved", key)
+	}
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(key), value, nil)
+	}
+	s.setKV(key, append([]byte{}, value...))
+	return nil
+}
+
+// ForEachPrefix loopt in key volgorde over de opgeslagen keys met prefix
+// (alleen de db, niet de writes van een overlay).
+func (s *State) ForEachPrefix(prefix string, fn func(key string, value []byte) error) error {
+	return s.db.ForEachPrefix(prefix, fn)
+}
+
+func (s *State) getAccount(addr common.Address) (*Account, error) {
+	if acc, ok := s.dirty[addr]; ok {
+		return acc.copy(), nil
+	}
+	return s.db.GetAccount(addr)
+}
+
+func (s *State) saveAccount(acc *Account) error {
+	if s.dirty == nil {
+		return s.db.SaveAccount(acc)
+	}
+	acc.ensureBalances()
+	s.setAccount(acc.copy())
+	return nil
+}
+
+// Root is de state root: keccak over alle niet-lege accounts, gesorteerd
+// op adres, elk als adres || GORR || USDCc || nonce, gevolgd door de
+// merchant records als adres || keccak(record), de subscription records
+// als id (8 bytes) || keccak(record) en de payment records als merchant ||
+// id (8 bytes) || keccak(record). Writes van de overlay tellen mee.
+// Lege accounts tellen niet, zodat "0 opslaan" de root niet verandert;
+// zonder records is de root dezelfde als vóór de merchants fork.
+func (s *State) Root() (common.Hash, error) {
+	accs := map[common.Address]*Account{}
+	err := s.db.ForEachAccount(func(acc *Account) error {
+		accs[acc.Address] = acc
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for addr, acc := range s.dirty {
+		accs[addr] = acc
+	}
+
+	addrs := make([]common.Address, 0, len(accs))
+	for addr, acc := range accs {
+		if !acc.empty() {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	hasher := crypto.NewKeccakState()
+	for _, addr := range addrs {
+		acc := accs[addr]
+		hasher.Write(addr[:])
+		hasher.Write(common.BigToHash(acc.Balances["GORR"]).Bytes())
+		hasher.Write(common.BigToHash(acc.Balances["USDCc"]).Bytes())
+		hasher.Write(new(big.Int).SetUint64(acc.Nonce).FillBytes(make([]byte, 8)))
+	}
+	err = s.ForEachMerchant(func(addr common.Address, data []byte) error {
+		hasher.Write(addr[:])
+		hasher.Write(crypto.Keccak256(data))
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	err = s.ForEachSubscription(func(id uint64, data []byte) error {
+		hasher.Write(new(big.Int).SetUint64(id).FillBytes(make([]byte, 8)))
+		hasher.Write(crypto.Keccak256(data))
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	err = s.ForEachPaymentRecord(func(merchant common.Address, id uint64, data []byte) error {
+		hasher.Write(merchant[:])
+		hasher.Write(new(big.Int).SetUint64(id).FillBytes(make([]byte, 8)))
+		hasher.Write(crypto.Keccak256(data))
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	var root common.Hash
+	hasher.Read(root[:])
+	return root, nil
+}
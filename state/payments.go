@@ -0,0 +1,106 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ---------------- PAYMENT RECORDS ----------------
+//
+// Wat consensus van een payment intent weet (vanaf de paymentTerms fork,
+// core/payment_terms.go), als JSON onder "payment:<merchant>:<id>". De
+// intents zelf blijven node-lokaal (Put); deze records tellen net als de
+// merchant en subscription records mee in Root.
+
+const paymentPrefix = "payment:"
+
+func paymentKey(merchant common.Address, id uint64) string {
+	return fmt.Sprintf("%s%s:%020d", paymentPrefix, merchant.Hex(), id)
+}
+
+func isPaymentKey(key string) bool { return strings.HasPrefix(key, paymentPrefix) }
+
+func parsePaymentKey(key string) (common.Address, uint64, error) {
+	addr, idStr, ok := strings.Cut(strings.TrimPrefix(key, paymentPrefix), ":")
+	if !ok || !common.IsHexAddress(addr) {
+		return common.Address{}, 0, fmt.Errorf("state: bad payment key %q", key)
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return common.Address{}, 0, fmt.Errorf("state: bad payment key %q", key)
+	}
+	return common.HexToAddress(addr), id, nil
+}
+
+// GetPaymentRecord geeft het record van intent id bij merchant, of nil
+// als er nog niet voor betaald is.
+func (s *State) GetPaymentRecord(merchant common.Address, id uint64) ([]byte, error) {
+	key := paymentKey(merchant, id)
+	if v, ok := s.dirtyKV[key]; ok {
+		return append([]byte{}, v...), nil
+	}
+	return s.db.get(key)
+}
+
+// SetPaymentRecord schrijft het record (op een overlay pas bij Commit).
+func (s *State) SetPaymentRecord(merchant common.Address, id uint64, data []byte) error {
+	key := paymentKey(merchant, id)
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(key), data, nil)
+	}
+	s.setKV(key, append([]byte{}, data...))
+	return nil
+}
+
+// ForEachPaymentRecord loopt op (merchant adres, id) volgorde over alle
+// records, inclusief de writes van de overlay.
+func (s *State) ForEachPaymentRecord(fn func(merchant common.Address, id uint64, data []byte) error) error {
+	type recordKey struct {
+		merchant common.Address
+		id       uint64
+	}
+	records := map[recordKey][]byte{}
+	add := func(key string, value []byte) error {
+		merchant, id, err := parsePaymentKey(key)
+		if err != nil {
+			return err
+		}
+		records[recordKey{merchant, id}] = value
+		return nil
+	}
+	err := s.db.ForEachPrefix(paymentPrefix, func(key string, value []byte) error {
+		return add(key, append([]byte{}, value...))
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range s.dirtyKV {
+		if isPaymentKey(key) {
+			if err := add(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]recordKey, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].merchant[:], keys[j].merchant[:]); c != 0 {
+			return c < 0
+		}
+		return keys[i].id < keys[j].id
+	})
+	for _, k := range keys {
+		if err := fn(k.merchant, k.id, records[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ---------------- SNAPSHOTS (dev) ----------------
+//
+// Volledige kopie van de state voor evm_snapshot / evm_revert. Bedoeld
+// voor dev chains: alles (accounts, _meta, overige keys) gaat in geheugen.
+
+type Snapshot struct {
+	kv          map[string][]byte
+	paused      bool
+	totalSupply map[string]*big.Int
+	fees        map[string]*big.Int
+}
+
+// Snapshot kopieert de hele state. Niet op een overlay.
+func (s *State) Snapshot() (*Snapshot, error) {
+	if s.dirty != nil {
+		return nil, errors.New("cannot snapshot an overlay")
+	}
+	kv, err := s.db.dump()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		kv:          kv,
+		paused:      s.Paused,
+		totalSupply: copyBigMap(s.totalSupply),
+		fees:        copyBigMap(s.fees),
+	}, nil
+}
+
+// RevertToSnapshot zet de state terug naar snap. snap blijft bruikbaar.
+func (s *State) RevertToSnapshot(snap *Snapshot) error {
+	if s.dirty != nil {
+		return errors.New("cannot revert an overlay")
+	}
+	if err := s.db.restore(snap.kv); err != nil {
+		return err
+	}
+	s.Paused = snap.paused
+	s.totalSupply = copyBigMap(snap.totalSupply)
+	s.fees = copyBigMap(snap.fees)
+	return nil
+}
+
+// dump leest alle keys (accounts, _meta, overige keys) uit de db.
+func (s *StateDB) dump() (map[string][]byte, error) {
+	if err := s.SaveMeta(); err != nil {
+		return nil, err
+	}
+
+	kv := map[string][]byte{}
+	it := s.db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		kv[string(it.Key())] = append([]byte{}, it.Value()...)
+	}
+	return kv, it.Error()
+}
+
+// restore maakt de db gelijk aan kv in één batch en laadt _meta opnieuw.
+func (s *StateDB) restore(kv map[string][]byte) error {
+	batch := new(leveldb.Batch)
+
+	it := s.db.NewIterator(nil, nil)
+	for it.Next() {
+		if _, ok := kv[string(it.Key())]; !ok {
+			batch.Delete(append([]byte{}, it.Key()...))
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	for k, v := range kv {
+		batch.Put([]byte(k), v)
+	}
+	if err := s.db.Write(batch, nil); err != nil {
+		return err
+	}
+	return s.loadMeta()
+}
+
+func copyBigMap(m map[string]*big.Int) map[string]*big.Int {
+	out := make(map[string]*big.Int, len(m))
+	for k, v := range m {
+		if v != nil {
+			out[k] = new(big.Int).Set(v)
+		}
+	}
+	return out
+}
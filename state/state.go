@@ -13,6 +13,17 @@ type State struct {
 	// --- D.3 Admin accounting ---
 	totalSupply map[string]*big.Int
 	fees        map[string]*big.Int
+
+	// Overlay (zie Begin): gewijzigde accounts, nog niet in LevelDB.
+	// nil = schrijven gaat direct naar de db.
+	dirty map[common.Address]*Account
+
+	// Overlay: overige keys (Put), in dezelfde batch als dirty. Een nil
+	// value is een delete (subscription due index).
+	dirtyKV map[string][]byte
+
+	// Overlay: vorige waarden van dirty en dirtyKV, voor RevertTo.
+	journal []change
 }
 
 type Fees struct {
@@ -41,7 +52,7 @@ func (s *State) Close() error {
 // ---------------- GORR ----------------
 
 func (s *State) GetBalance(addr common.Address) (*big.Int, error) {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -49,18 +60,18 @@ func (s *State) GetBalance(addr common.Address) (*big.Int, error) {
 }
 
 func (s *State) SetBalance(addr common.Address, amount *big.Int) error {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return err
 	}
 	acc.Balances["GORR"] = new(big.Int).Set(amount)
-	return s.db.SaveAccount(acc)
+	return s.saveAccount(acc)
 }
 
 // ---------------- USDCc ----------------
 
 func (s *State) GetUSDCcBalance(addr common.Address) (*big.Int, error) {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -68,18 +79,18 @@ func (s *State) GetUSDCcBalance(addr common.Address) (*big.Int, error) {
 }
 
 func (s *State) SetUSDCcBalance(addr common.Address, amount *big.Int) error {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return err
 	}
 	acc.Balances["USDCc"] = new(big.Int).Set(amount)
-	return s.db.SaveAccount(acc)
+	return s.saveAccount(acc)
 }
 
 // ---------------- NONCE ----------------
 
 func (s *State) GetNonce(addr common.Address) (uint64, error) {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return 0, err
 	}
@@ -87,11 +98,12 @@ func (s *State) GetNonce(addr common.Address) (uint64, error) {
 }
 
 func (s *State) IncreaseNonce(addr common.Address) error {
-	acc, err := s.db.GetAccount(addr)
+	acc, err := s.getAccount(addr)
 	if err != nil {
 		return err
 	}
-	return s.db.SaveAccount(acc)
+	acc.Nonce++
+	return s.saveAccount(acc)
 }
 
 // ---------------- TOTAL SUPPLY ----------------
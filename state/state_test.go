@@ -0,0 +1,98 @@
+package state
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestIncreaseNonce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	st, err := NewState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress("0xa")
+	for i := 0; i < 3; i++ {
+		if err := st.IncreaseNonce(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := st.GetNonce(addr); err != nil || n != 3 {
+		t.Fatalf("nonce %d, %v; want 3", n, err)
+	}
+	if n, _ := st.GetNonce(common.HexToAddress("0xb")); n != 0 {
+		t.Fatalf("untouched account has nonce %d", n)
+	}
+
+	// De nonce staat in de db, niet alleen in het geheugen
+	st.Close()
+	if st, err = NewState(path); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if n, _ := st.GetNonce(addr); n != 3 {
+		t.Fatalf("nonce %d after reopen, want 3", n)
+	}
+}
+
+func TestOverlayRevertTo(t *testing.T) {
+	st, err := NewState(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	if err := st.SetBalance(a, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+	st.AddSupply("GORR", big.NewInt(10))
+
+	ov := st.Begin()
+	if err := ov.IncreaseNonce(a); err != nil {
+		t.Fatal(err)
+	}
+	cp := ov.Checkpoint()
+	root, err := ov.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes na de checkpoint: bestaand en nieuw account, record, supply
+	if err := ov.SetBalance(a, big.NewInt(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ov.SetBalance(b, big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ov.SetMerchant(b, []byte("record")); err != nil {
+		t.Fatal(err)
+	}
+	ov.AddSupply("GORR", big.NewInt(5))
+	ov.AddSupply("USDCc", big.NewInt(5))
+
+	if err := ov.RevertTo(cp); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ov.Root(); err != nil || got != root {
+		t.Fatalf("root %s after revert, want %s (%v)", got.Hex(), root.Hex(), err)
+	}
+	if n, _ := ov.GetNonce(a); n != 1 {
+		t.Fatalf("write before the checkpoint reverted: nonce %d", n)
+	}
+	if m, _ := ov.GetMerchant(b); m != nil {
+		t.Fatalf("merchant record %q after revert", m)
+	}
+	if s := st.GetTotalSupply("GORR"); s.Cmp(big.NewInt(10)) != 0 {
+		t.Fatalf("GORR supply %s after revert, want 10", s)
+	}
+	if s := st.GetTotalSupply("USDCc"); s.Sign() != 0 {
+		t.Fatalf("USDCc supply %s after revert, want 0", s)
+	}
+
+	if err := st.RevertTo(cp); err == nil {
+		t.Fatal("revert outside an overlay accepted")
+	}
+}
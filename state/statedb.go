@@ -2,12 +2,19 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// metaKey: admin accounting (Meta). Accounts staan onder hun hex adres.
+const metaKey = "_meta"
+
+func isAccountKey(key string) bool { return common.IsHexAddress(key) }
+
 type Meta struct {
 	MerchantFeeBps uint64              `json:"merchantFeeBps"`
 	Fees           map[string]*big.Int `json:"fees"`
@@ -42,7 +49,7 @@ func (s *StateDB) Close() {
 // ---------------- META ----------------
 
 func (s *StateDB) loadMeta() error {
-	raw, err := s.db.Get([]byte("_meta"), nil)
+	raw, err := s.db.Get([]byte(metaKey), nil)
 	if err == leveldb.ErrNotFound {
 		s.Meta = &Meta{
 			Fees:        make(map[string]*big.Int),
@@ -75,7 +82,7 @@ func (s *StateDB) SaveMeta() error {
 	if err != nil {
 		return err
 	}
-	return s.db.Put([]byte("_meta"), data, nil)
+	return s.db.Put([]byte(metaKey), data, nil)
 }
 
 // ---------------- ACCOUNTS ----------------
@@ -108,3 +115,69 @@ func (s *StateDB) GetAccount(addr common.Address) (*Account, error) {
 	acc.ensureBalances()
 	return &acc, nil
 }
+
+// WriteAccounts schrijft alle accounts (en overige keys kv) in één
+// atomaire LevelDB batch. Een nil value in kv verwijdert de key.
+func (s *StateDB) WriteAccounts(accs []*Account, kv map[string][]byte) error {
+	batch := new(leveldb.Batch)
+	for k, v := range kv {
+		if v == nil {
+			batch.Delete([]byte(k))
+			continue
+		}
+		batch.Put([]byte(k), v)
+	}
+	for _, acc := range accs {
+		acc.ensureBalances()
+		data, err := json.Marshal(acc)
+		if err != nil {
+			return err
+		}
+		batch.Put([]byte(acc.Address.Hex()), data)
+	}
+	return s.db.Write(batch, nil)
+}
+
+// ForEachAccount loopt over alle opgeslagen accounts (niet over _meta).
+func (s *StateDB) ForEachAccount(fn func(acc *Account) error) error {
+	it := s.db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := string(it.Key())
+		if !isAccountKey(key) {
+			continue
+		}
+		var acc Account
+		if err := json.Unmarshal(it.Value(), &acc); err != nil {
+			return fmt.Errorf("account %s: %w", key, err)
+		}
+		acc.ensureBalances()
+		if err := fn(&acc); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// get leest een niet-account key; nil als hij niet bestaat.
+func (s *StateDB) get(key string) ([]byte, error) {
+	raw, err := s.db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return raw, err
+}
+
+// ForEachPrefix loopt in key volgorde over alle keys met prefix.
+func (s *StateDB) ForEachPrefix(prefix string, fn func(key string, value []byte) error) error {
+	it := s.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer it.Release()
+
+	for it.Next() {
+		if err := fn(string(it.Key()), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
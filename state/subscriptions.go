@@ -0,0 +1,218 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------------- SUBSCRIPTIONS ----------------
+//
+// Records van de subscriptions (core/subscription.go), als JSON onder
+// "subscription:<id>". Ids lopen op vanaf 1 en records worden nooit
+// verwijderd, dus het hoogste id is ook de teller. Net als de merchant
+// records tellen ze mee in Root.
+
+const subscriptionPrefix = "subscription:"
+
+// Met voorloopnullen → iteratie in de db gaat op id volgorde.
+func subscriptionKey(id uint64) string { return fmt.Sprintf("%s%020d", subscriptionPrefix, id) }
+
+func isSubscriptionKey(key string) bool { return strings.HasPrefix(key, subscriptionPrefix) }
+
+// GetSubscription geeft record id, of nil als het niet bestaat.
+func (s *State) GetSubscription(id uint64) ([]byte, error) {
+	key := subscriptionKey(id)
+	if v, ok := s.dirtyKV[key]; ok {
+		return append([]byte{}, v...), nil
+	}
+	return s.db.get(key)
+}
+
+// SetSubscription schrijft record id (op een overlay pas bij Commit).
+func (s *State) SetSubscription(id uint64, data []byte) error {
+	if id == 0 {
+		return fmt.Errorf("state: subscription id 0")
+	}
+	key := subscriptionKey(id)
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(key), data, nil)
+	}
+	s.setKV(key, append([]byte{}, data...))
+	return nil
+}
+
+// NextSubscriptionID: het id voor een nieuw record.
+func (s *State) NextSubscriptionID() (uint64, error) {
+	var last uint64
+	err := s.ForEachSubscription(func(id uint64, _ []byte) error {
+		last = id
+		return nil
+	})
+	return last + 1, err
+}
+
+// ForEachSubscription loopt op id volgorde over alle records, inclusief
+// de writes van de overlay.
+func (s *State) ForEachSubscription(fn func(id uint64, data []byte) error) error {
+	records := map[uint64][]byte{}
+	add := func(key string, value []byte) error {
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, subscriptionPrefix), 10, 64)
+		if err != nil {
+			return fmt.Errorf("state: bad subscription key %q", key)
+		}
+		records[id] = value
+		return nil
+	}
+	err := s.db.ForEachPrefix(subscriptionPrefix, func(key string, value []byte) error {
+		return add(key, append([]byte{}, value...))
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range s.dirtyKV {
+		if isSubscriptionKey(key) {
+			if err := add(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids := make([]uint64, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if err := fn(id, records[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------------- DUE INDEX ----------------
+//
+// Open subscriptions op de tijd waarop een block er iets mee moet
+// (core: Subscription.checkAt), als lege value onder
+// "subscription-due:<tijd>:<id>". Zo hoeft ApplySubscriptions niet elk
+// block alle records te lezen. De index volgt uit de records en telt dus
+// niet mee in Root; subscriptionIndexKey markeert dat hij compleet is
+// (databases van vóór de index bouwen hem één keer op).
+
+const (
+	subscriptionDuePrefix = "subscription-due:"
+	subscriptionIndexKey  = "_subscription_due_index"
+)
+
+func subscriptionDueKey(due, id uint64) string {
+	return fmt.Sprintf("%s%020d:%020d", subscriptionDuePrefix, due, id)
+}
+
+func isSubscriptionDueKey(key string) bool {
+	return strings.HasPrefix(key, subscriptionDuePrefix) || key == subscriptionIndexKey
+}
+
+func parseSubscriptionDueKey(key string) (uint64, uint64, error) {
+	dueStr, idStr, ok := strings.Cut(strings.TrimPrefix(key, subscriptionDuePrefix), ":")
+	due, err1 := strconv.ParseUint(dueStr, 10, 64)
+	id, err2 := strconv.ParseUint(idStr, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("state: bad subscription due key %q", key)
+	}
+	return due, id, nil
+}
+
+// deleteKV: op een overlay een nil value, die Commit als delete schrijft.
+func (s *State) deleteKV(key string) error {
+	if s.dirtyKV == nil {
+		return s.db.db.Delete([]byte(key), nil)
+	}
+	s.setKV(key, nil)
+	return nil
+}
+
+// HasSubscriptionIndex: de due index is opgebouwd.
+func (s *State) HasSubscriptionIndex() (bool, error) {
+	if v, ok := s.dirtyKV[subscriptionIndexKey]; ok {
+		return v != nil, nil
+	}
+	v, err := s.db.get(subscriptionIndexKey)
+	return v != nil, err
+}
+
+// SetSubscriptionIndexed markeert de due index als compleet.
+func (s *State) SetSubscriptionIndexed() error {
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(subscriptionIndexKey), []byte{1}, nil)
+	}
+	s.setKV(subscriptionIndexKey, []byte{1})
+	return nil
+}
+
+// MoveSubscriptionDue verplaatst id in de due index van from naar to;
+// nil = niet in de index (niet open).
+func (s *State) MoveSubscriptionDue(id uint64, from, to *uint64) error {
+	if from != nil && to != nil && *from == *to {
+		return nil
+	}
+	if from != nil {
+		if err := s.deleteKV(subscriptionDueKey(*from, id)); err != nil {
+			return err
+		}
+	}
+	if to == nil {
+		return nil
+	}
+	if s.dirtyKV == nil {
+		return s.db.db.Put([]byte(subscriptionDueKey(*to, id)), []byte{}, nil)
+	}
+	s.setKV(subscriptionDueKey(*to, id), []byte{})
+	return nil
+}
+
+var errStopIteration = errors.New("stop")
+
+// SubscriptionsDue geeft op id volgorde de subscriptions in de due index
+// met een tijd ten hoogste now, inclusief de writes van de overlay.
+func (s *State) SubscriptionsDue(now uint64) ([]uint64, error) {
+	due := map[uint64]bool{}
+	err := s.db.ForEachPrefix(subscriptionDuePrefix, func(key string, _ []byte) error {
+		if _, deleted := s.dirtyKV[key]; deleted {
+			return nil // overlay: nil = weg, anders hieronder
+		}
+		at, id, err := parseSubscriptionDueKey(key)
+		if err != nil {
+			return err
+		}
+		if at > now {
+			return errStopIteration // keys staan op tijd volgorde
+		}
+		due[id] = true
+		return nil
+	})
+	if err != nil && err != errStopIteration {
+		return nil, err
+	}
+	for key, value := range s.dirtyKV {
+		if !strings.HasPrefix(key, subscriptionDuePrefix) || value == nil {
+			continue
+		}
+		at, id, err := parseSubscriptionDueKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if at <= now {
+			due[id] = true
+		}
+	}
+
+	ids := make([]uint64, 0, len(due))
+	for id := range due {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}